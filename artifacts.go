@@ -0,0 +1,47 @@
+package patchcover
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoArtifact is returned by ArtifactFetchers when no coverage profile
+// was stored for a branch, e.g. before its first CI run.
+var ErrNoArtifact = errors.New("no coverage artifact")
+
+// ArtifactFetcher retrieves the coverage profile stored by the last CI run
+// of a branch, to be used as the previous coverage. Implementations backed
+// by remote storage download it to a local file.
+type ArtifactFetcher interface {
+	// FetchProfile returns the path of a local copy of the coverage profile
+	// of branch, or an error wrapping ErrNoArtifact when there is none.
+	FetchProfile(branch string) (string, error)
+}
+
+// LocalDirFetcher is an ArtifactFetcher reading profiles stored in a local
+// directory, as <Dir>/<branch>/coverage.out. Branch names holding slashes
+// map to nested directories.
+type LocalDirFetcher struct {
+	Dir string
+}
+
+// FetchProfile implements ArtifactFetcher.
+func (f LocalDirFetcher) FetchProfile(branch string) (string, error) {
+	if branch == "" || path.IsAbs(branch) || strings.Contains("/"+branch+"/", "/../") {
+		return "", fmt.Errorf("invalid branch name %q", branch)
+	}
+
+	name := filepath.Join(f.Dir, filepath.FromSlash(branch), "coverage.out")
+	if _, err := os.Stat(name); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("%w for branch %s in %s", ErrNoArtifact, branch, f.Dir)
+		}
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,36 @@
+package patchcover
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLocalDirFetcher_FetchProfile(t *testing.T) {
+	dir := t.TempDir()
+	for _, branch := range []string{"main", "release/1.2"} {
+		branchDir := filepath.Join(dir, filepath.FromSlash(branch))
+		assert.NilError(t, os.MkdirAll(branchDir, 0o755))
+		assert.NilError(t, os.WriteFile(filepath.Join(branchDir, "coverage.out"), []byte("mode: set\n"), 0o644))
+	}
+	var fetcher ArtifactFetcher = LocalDirFetcher{Dir: dir}
+
+	name, err := fetcher.FetchProfile("main")
+	assert.NilError(t, err)
+	assert.Equal(t, name, filepath.Join(dir, "main", "coverage.out"))
+
+	name, err = fetcher.FetchProfile("release/1.2")
+	assert.NilError(t, err)
+	assert.Equal(t, name, filepath.Join(dir, "release", "1.2", "coverage.out"))
+
+	_, err = fetcher.FetchProfile("feature")
+	assert.Assert(t, errors.Is(err, ErrNoArtifact), err)
+
+	for _, branch := range []string{"", "../main", "main/../../x", "/main"} {
+		_, err = fetcher.FetchProfile(branch)
+		assert.ErrorContains(t, err, "invalid branch name", branch)
+	}
+}
@@ -0,0 +1,49 @@
+package patchcover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// badgeColors maps the minimum patch coverage percentage to a shields.io
+// color, from the highest threshold down.
+var badgeColors = []struct {
+	min   float64
+	color string
+}{
+	{90, "brightgreen"},
+	{80, "green"},
+	{70, "yellowgreen"},
+	{60, "yellow"},
+	{50, "orange"},
+	{0, "red"},
+}
+
+type badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// badgeColor returns the shields.io color for a coverage percentage.
+func badgeColor(coverage float64) string {
+	for _, c := range badgeColors {
+		if coverage >= c.min {
+			return c.color
+		}
+	}
+	return badgeColors[len(badgeColors)-1].color
+}
+
+// RenderBadgeOutput writes the patch coverage as a shields.io endpoint
+// badge JSON document.
+func RenderBadgeOutput(data CoverageData, out io.Writer) error {
+	return json.NewEncoder(out).Encode(badge{
+		SchemaVersion: 1,
+		Label:         "patch coverage",
+		Message:       fmt.Sprintf("%.1f%%", data.PatchCoverage),
+		Color:         badgeColor(data.PatchCoverage),
+	})
+}
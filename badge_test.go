@@ -0,0 +1,39 @@
+package patchcover
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_badgeColor(t *testing.T) {
+	tests := []struct {
+		coverage float64
+		want     string
+	}{
+		{100, "brightgreen"},
+		{90, "brightgreen"},
+		{89.9, "green"},
+		{80, "green"},
+		{75, "yellowgreen"},
+		{60, "yellow"},
+		{50, "orange"},
+		{49.9, "red"},
+		{0, "red"},
+		{-1, "red"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.coverage), func(t *testing.T) {
+			assert.Equal(t, badgeColor(tt.coverage), tt.want)
+		})
+	}
+}
+
+func TestRenderBadgeOutput(t *testing.T) {
+	var buf bytes.Buffer
+	err := RenderBadgeOutput(CoverageData{PatchCoverage: 86.36363636363636}, &buf)
+	assert.NilError(t, err)
+	assert.Equal(t, buf.String(), `{"schemaVersion":1,"label":"patch coverage","message":"86.4%","color":"green"}`+"\n")
+}
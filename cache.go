@@ -0,0 +1,132 @@
+package patchcover
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"golang.org/x/tools/cover"
+)
+
+// parseProfile parses a coverage profile. It is a variable so tests can
+// count parses.
+var parseProfile = cover.ParseProfilesFromReader
+
+// parseDiffContent parses a diff. It is a variable so tests can count
+// parses.
+var parseDiffContent = parseDiff
+
+// cacheVersion is part of the name of cache entries, so entries written in
+// another format are never read.
+const cacheVersion = "v1"
+
+// parseCachedProfile parses the coverage profile read from r, reusing the
+// profiles cached in cacheDir for the same content. Entries are keyed by
+// the SHA-256 of the content, so a changed profile misses the cache. When
+// cacheDir is empty, no cache is used. An lcovReader is parsed with
+// ParseLcovProfiles, and cached apart from Go profiles of the same content.
+func parseCachedProfile(r io.Reader, cacheDir string) ([]*cover.Profile, error) {
+	parse, kind := parseProfile, ""
+	if lr, ok := r.(lcovReader); ok {
+		parse, kind, r = ParseLcovProfiles, "lcov-", lr.Reader
+	}
+	if cacheDir == "" {
+		return parse(r)
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	entry := cacheEntry(cacheDir, kind, content)
+
+	var profiles []*cover.Profile
+	if readCacheEntry(entry, &profiles) {
+		if profiles == nil {
+			// gob does not tell empty and nil slices apart.
+			profiles = []*cover.Profile{}
+		}
+		return profiles, nil
+	}
+	profiles, err = parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	// The cache only saves time: failing to write an entry is not an error.
+	_ = writeCacheEntry(entry, profiles)
+	return profiles, nil
+}
+
+// parseCachedDiff parses the diff read from r, reusing the files cached in
+// cacheDir for the same content, as parseCachedProfile does profiles. When
+// cacheDir is empty, no cache is used.
+func parseCachedDiff(r io.Reader, cacheDir string) ([]*gitdiff.File, error) {
+	if cacheDir == "" {
+		return parseDiffContent(r)
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	entry := cacheEntry(cacheDir, "diff-", content)
+
+	var files []*gitdiff.File
+	if readCacheEntry(entry, &files) {
+		return files, nil
+	}
+	files, err = parseDiffContent(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	_ = writeCacheEntry(entry, files)
+	return files, nil
+}
+
+// cacheEntry returns the path of the cache entry in cacheDir of content,
+// named by the SHA-256 of content after kind, which keeps entries of
+// different kinds apart.
+func cacheEntry(cacheDir, kind string, content []byte) string {
+	sum := sha256.Sum256(content)
+	return filepath.Join(cacheDir, cacheVersion+"-"+kind+hex.EncodeToString(sum[:])+".gob")
+}
+
+// readCacheEntry decodes the cache entry at path into v, a pointer, and
+// reports false when there is no valid entry.
+func readCacheEntry(path string, v interface{}) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	return gob.NewDecoder(f).Decode(v) == nil
+}
+
+// writeCacheEntry stores v in the cache entry at path. The entry is
+// written to a temporary file first, so concurrent readers never see a
+// partial entry.
+func writeCacheEntry(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
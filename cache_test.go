@@ -0,0 +1,116 @@
+package patchcover
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"golang.org/x/tools/cover"
+	"gotest.tools/v3/assert"
+)
+
+// countParses counts the profiles parsed, rather than read from the cache,
+// for the duration of the test.
+func countParses(t *testing.T) *int32 {
+	var n int32
+	orig := parseProfile
+	parseProfile = func(r io.Reader) ([]*cover.Profile, error) {
+		atomic.AddInt32(&n, 1)
+		return orig(r)
+	}
+	t.Cleanup(func() { parseProfile = orig })
+	return &n
+}
+
+func Test_parseProfiles_cacheDir(t *testing.T) {
+	parses := countParses(t)
+	cacheDir := t.TempDir()
+	profiles := []string{syntheticProfile(1, 10), syntheticProfile(2, 10), "mode: set\n"}
+
+	first, err := parseProfiles(readers(profiles), 2, cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, atomic.LoadInt32(parses), int32(3))
+
+	// The same contents are read from the cache.
+	second, err := parseProfiles(readers(profiles), 2, cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, atomic.LoadInt32(parses), int32(3))
+	assert.DeepEqual(t, second, first)
+
+	// A changed profile is parsed again.
+	profiles[1] = syntheticProfile(2, 11)
+	third, err := parseProfiles(readers(profiles), 2, cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, atomic.LoadInt32(parses), int32(4))
+	assert.DeepEqual(t, third[0], first[0])
+	assert.Assert(t, len(third[1][0].Blocks) != len(first[1][0].Blocks))
+}
+
+func Test_parseProfiles_cacheDirError(t *testing.T) {
+	parses := countParses(t)
+	cacheDir := t.TempDir()
+	invalid := []string{"mode: set\nnot a profile line\n"}
+
+	for i := 0; i < 2; i++ {
+		_, err := parseProfiles(readers(invalid), 1, cacheDir)
+		assert.ErrorContains(t, err, `"not a profile line"`)
+	}
+	// Failures are not cached.
+	assert.Equal(t, atomic.LoadInt32(parses), int32(2))
+}
+
+func Test_parseCachedDiff(t *testing.T) {
+	var parses int
+	orig := parseDiffContent
+	parseDiffContent = func(r io.Reader) ([]*gitdiff.File, error) {
+		parses++
+		return orig(r)
+	}
+	t.Cleanup(func() { parseDiffContent = orig })
+
+	cacheDir := t.TempDir()
+	diff := syntheticDiff(2, 10, 3)
+
+	first, err := parseCachedDiff(strings.NewReader(diff), cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, parses, 1)
+
+	// The same diff is read from the cache.
+	second, err := parseCachedDiff(strings.NewReader(diff), cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, parses, 1)
+	assert.DeepEqual(t, second, first)
+
+	// A changed diff is parsed again.
+	third, err := parseCachedDiff(strings.NewReader(syntheticDiff(3, 10, 3)), cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, parses, 2)
+	assert.Equal(t, len(third), 3)
+
+	// Without a cache directory, the diff is always parsed.
+	_, err = parseCachedDiff(strings.NewReader(diff), "")
+	assert.NilError(t, err)
+	assert.Equal(t, parses, 3)
+}
+
+func Test_parseCachedProfile_formats(t *testing.T) {
+	cacheDir := t.TempDir()
+	profile := syntheticProfile(1, 10)
+
+	// Parsed as lcov, a Go profile holds no records.
+	lcov, err := parseCachedProfile(lcovReader{strings.NewReader(profile)}, cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(lcov), 0)
+
+	// The same content parsed as a Go profile does not hit the lcov entry.
+	profiles, err := parseCachedProfile(strings.NewReader(profile), cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(profiles), 1)
+
+	// Nor does the lcov parse hit the Go profile entry.
+	lcov, err = parseCachedProfile(lcovReader{strings.NewReader(profile)}, cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(lcov), 0)
+}
@@ -0,0 +1,70 @@
+package patchcover
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestRenderCloverOutput(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("./testdata/scenarios/single_edit/coverage.out", "./testdata/scenarios/single_edit/diff.diff", "")
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	err = RenderCloverOutput(cov, time.Unix(1700000000, 0), &buf)
+	assert.NilError(t, err)
+
+	golden.Assert(t, buf.String(), "clover.golden.xml")
+
+	// Validate the structure Clover consumers expect.
+	var doc struct {
+		XMLName   xml.Name `xml:"coverage"`
+		Generated int64    `xml:"generated,attr"`
+		Project   struct {
+			Timestamp int64 `xml:"timestamp,attr"`
+			Metrics   struct {
+				Files             int `xml:"files,attr"`
+				Statements        int `xml:"statements,attr"`
+				CoveredStatements int `xml:"coveredstatements,attr"`
+			} `xml:"metrics"`
+			Files []struct {
+				Name    string `xml:"name,attr"`
+				Metrics struct {
+					Statements int `xml:"statements,attr"`
+				} `xml:"metrics"`
+				Lines []struct {
+					Num   int    `xml:"num,attr"`
+					Count int    `xml:"count,attr"`
+					Type  string `xml:"type,attr"`
+				} `xml:"line"`
+			} `xml:"file"`
+		} `xml:"project"`
+	}
+	assert.NilError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, doc.Generated, int64(1700000000))
+	assert.Equal(t, doc.Project.Timestamp, int64(1700000000))
+	assert.Equal(t, doc.Project.Metrics.Files, len(doc.Project.Files))
+	assert.Assert(t, len(doc.Project.Files) > 0)
+	statements := 0
+	for _, f := range doc.Project.Files {
+		assert.Assert(t, f.Name != "")
+		assert.Assert(t, len(f.Lines) > 0)
+		for _, l := range f.Lines {
+			assert.Assert(t, l.Num > 0)
+			assert.Equal(t, l.Type, "stmt")
+		}
+		statements += f.Metrics.Statements
+	}
+	assert.Equal(t, doc.Project.Metrics.Statements, statements)
+}
+
+func TestRenderCloverOutput_empty(t *testing.T) {
+	var buf bytes.Buffer
+	err := RenderCloverOutput(CoverageData{}, time.Unix(0, 0), &buf)
+	assert.NilError(t, err)
+	golden.Assert(t, buf.String(), "clover-empty.golden.xml")
+}
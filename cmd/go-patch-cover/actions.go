@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// writeActionsOutputs appends the coverage to the files of the
+// GITHUB_OUTPUT and GITHUB_STEP_SUMMARY environment variables, GitHub
+// Actions set for steps to declare outputs and a job summary. Unset
+// variables are skipped, so this is a no-op outside of GitHub Actions.
+func writeActionsOutputs(coverage patchcover.CoverageData) error {
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		if err := appendFile(path, func(w io.Writer) error { return writeActionsVariables(w, coverage) }); err != nil {
+			return fmt.Errorf("GITHUB_OUTPUT: %w", err)
+		}
+	}
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		if err := appendFile(path, func(w io.Writer) error { return writeStepSummary(w, coverage) }); err != nil {
+			return fmt.Errorf("GITHUB_STEP_SUMMARY: %w", err)
+		}
+	}
+	return nil
+}
+
+// appendFile opens path for appending, creating it if needed, and closes
+// it once write is done.
+func appendFile(path string, write func(io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeActionsVariables writes the patch_coverage and total_coverage step
+// outputs, and prev_coverage when the previous coverage is known, as
+// name=value lines.
+func writeActionsVariables(w io.Writer, coverage patchcover.CoverageData) error {
+	vars := fmt.Sprintf("patch_coverage=%.1f\ntotal_coverage=%.1f\n", coverage.PatchCoverage, coverage.Coverage)
+	if coverage.HasPrevCoverage {
+		vars += fmt.Sprintf("prev_coverage=%.1f\n", coverage.PrevCoverage)
+	}
+	_, err := io.WriteString(w, vars)
+	return err
+}
+
+// writeStepSummary writes a markdown table of the previous, new and patch
+// coverage, with the delta of the new coverage when the previous coverage
+// is known.
+func writeStepSummary(w io.Writer, coverage patchcover.CoverageData) error {
+	var b strings.Builder
+	b.WriteString("### Patch coverage\n\n")
+	if coverage.HasPrevCoverage {
+		b.WriteString("| Previous | New | Delta | Patch |\n|---|---|---|---|\n")
+		fmt.Fprintf(&b, "| %.1f%% | %.1f%% | %+.1f%% | %.1f%% (%d/%d) |\n",
+			coverage.PrevCoverage, coverage.Coverage, coverage.Coverage-coverage.PrevCoverage,
+			coverage.PatchCoverage, coverage.PatchCoverCount, coverage.PatchNumStmt)
+	} else {
+		b.WriteString("| Previous | New | Patch |\n|---|---|---|\n")
+		fmt.Fprintf(&b, "| unknown | %.1f%% | %.1f%% (%d/%d) |\n",
+			coverage.Coverage, coverage.PatchCoverage, coverage.PatchCoverCount, coverage.PatchNumStmt)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
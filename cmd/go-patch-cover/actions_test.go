@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMain(m *testing.M) {
+	// Tests run in GitHub Actions must not write to the outputs and summary
+	// of the job running them.
+	os.Unsetenv("GITHUB_OUTPUT")
+	os.Unsetenv("GITHUB_STEP_SUMMARY")
+	os.Exit(m.Run())
+}
+
+func TestCoverCommand_Run_actionsOutputs(t *testing.T) {
+	dir := t.TempDir()
+	output, summary := filepath.Join(dir, "output"), filepath.Join(dir, "summary")
+	assert.NilError(t, os.WriteFile(output, []byte("other=1\n"), 0o644))
+	t.Setenv("GITHUB_OUTPUT", output)
+	t.Setenv("GITHUB_STEP_SUMMARY", summary)
+
+	run := func(args ...string) {
+		_, _, err := runCommand(t, append([]string{"-uncovered-out", ""}, args...)...)
+		assert.NilError(t, err)
+	}
+	scenario := "../../testdata/scenarios/new_file/"
+	run(scenario+"coverage.out", scenario+"diff.diff")
+
+	content, err := os.ReadFile(output)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "other=1\npatch_coverage=75.0\ntotal_coverage=75.0\n")
+	content, err = os.ReadFile(summary)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), `### Patch coverage
+
+| Previous | New | Patch |
+|---|---|---|
+| unknown | 75.0% | 75.0% (6/8) |
+
+`)
+
+	assert.NilError(t, os.Remove(output))
+	assert.NilError(t, os.Remove(summary))
+	run(scenario+"coverage.out", scenario+"diff.diff", "../../testdata/variants/race.out")
+	content, err = os.ReadFile(output)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "patch_coverage=75.0\ntotal_coverage=75.0\nprev_coverage=100.0\n")
+	content, err = os.ReadFile(summary)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), `### Patch coverage
+
+| Previous | New | Delta | Patch |
+|---|---|---|---|
+| 100.0% | 75.0% | -25.0% | 75.0% (6/8) |
+
+`)
+
+	// Nothing is written with -no-filewrite.
+	assert.NilError(t, os.Remove(output))
+	run("-no-filewrite", scenario+"coverage.out", scenario+"diff.diff")
+	_, err = os.Stat(output)
+	assert.Assert(t, os.IsNotExist(err))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// batchEntry is one repository of a -batch manifest. Relative paths are
+// resolved against the directory of the manifest.
+type batchEntry struct {
+	Name         string `json:"name"`
+	Coverage     string `json:"coverage"`
+	Diff         string `json:"diff"`
+	PrevCoverage string `json:"prev_coverage,omitempty"`
+}
+
+// batchResult is the outcome of one batch entry: its coverage data, or the
+// error that prevented computing it.
+type batchResult struct {
+	Name     string                   `json:"name"`
+	Coverage *patchcover.CoverageData `json:"coverage,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// batchReport is the aggregate JSON output of batch mode.
+type batchReport struct {
+	Results []batchResult `json:"results"`
+	Failed  int           `json:"failed"`
+}
+
+// summaryRow is the coverage numbers of a batch entry, or of all of them.
+type summaryRow struct {
+	Name            string  `json:"name"`
+	NumStmt         int     `json:"num_stmt"`
+	CoverCount      int     `json:"cover_count"`
+	Coverage        float64 `json:"coverage"`
+	PatchNumStmt    int     `json:"patch_num_stmt"`
+	PatchCoverCount int     `json:"patch_cover_count"`
+	PatchCoverage   float64 `json:"patch_coverage"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// batchSummary is the JSON output of batch mode with -summary-only: the
+// numbers of every entry, and their sums over the entries that did not
+// fail.
+type batchSummary struct {
+	Total   summaryRow   `json:"total"`
+	Entries []summaryRow `json:"entries"`
+	Failed  int          `json:"failed"`
+}
+
+// summarize aggregates the results of a batch report.
+func summarize(report batchReport) batchSummary {
+	summary := batchSummary{Total: summaryRow{Name: "total"}, Entries: make([]summaryRow, 0, len(report.Results)), Failed: report.Failed}
+	for _, r := range report.Results {
+		row := summaryRow{Name: r.Name, Error: r.Error}
+		if r.Coverage != nil {
+			d := r.Coverage
+			row.NumStmt, row.CoverCount, row.Coverage = d.NumStmt, d.CoverCount, d.Coverage
+			row.PatchNumStmt, row.PatchCoverCount, row.PatchCoverage = d.PatchNumStmt, d.PatchCoverCount, d.PatchCoverage
+
+			summary.Total.NumStmt += d.NumStmt
+			summary.Total.CoverCount += d.CoverCount
+			summary.Total.PatchNumStmt += d.PatchNumStmt
+			summary.Total.PatchCoverCount += d.PatchCoverCount
+		}
+		summary.Entries = append(summary.Entries, row)
+	}
+
+	if summary.Total.NumStmt != 0 {
+		summary.Total.Coverage = float64(summary.Total.CoverCount) / float64(summary.Total.NumStmt) * 100
+	}
+	// As for a single patch, no changed statement is full coverage.
+	summary.Total.PatchCoverage = 100
+	if summary.Total.PatchNumStmt != 0 {
+		summary.Total.PatchCoverage = float64(summary.Total.PatchCoverCount) / float64(summary.Total.PatchNumStmt) * 100
+	}
+	return summary
+}
+
+// readBatch reads the batch entries of a manifest, or of a directory with
+// readBatchDir.
+func readBatch(path string) ([]batchEntry, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return readBatchDir(path)
+	}
+	return readManifest(path)
+}
+
+// readBatchDir returns an entry for every subdirectory of dir holding a
+// coverage.out file, named after it, with its diff.diff file and its
+// prev_coverage.out file when present.
+func readBatchDir(dir string) ([]batchEntry, error) {
+	subdirs, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading batch directory: %w", err)
+	}
+
+	var entries []batchEntry
+	for _, d := range subdirs {
+		if !d.IsDir() {
+			continue
+		}
+		e := batchEntry{
+			Name:     d.Name(),
+			Coverage: filepath.Join(dir, d.Name(), "coverage.out"),
+			Diff:     filepath.Join(dir, d.Name(), "diff.diff"),
+		}
+		if !fileExists(e.Coverage) {
+			continue
+		}
+		if prev := filepath.Join(dir, d.Name(), "prev_coverage.out"); fileExists(prev) {
+			e.PrevCoverage = prev
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("batch directory %s has no subdirectory holding a coverage.out file", dir)
+	}
+	return entries, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// readManifest reads a JSON array of batch entries.
+func readManifest(path string) ([]batchEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading batch manifest: %w", err)
+	}
+
+	var entries []batchEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("parsing batch manifest %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i, e := range entries {
+		if e.Name == "" {
+			e.Name = fmt.Sprintf("#%d", i+1)
+		}
+		e.Coverage = resolvePath(dir, e.Coverage)
+		e.Diff = resolvePath(dir, e.Diff)
+		e.PrevCoverage = resolvePath(dir, e.PrevCoverage)
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+func resolvePath(dir, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+// runBatch computes coverage for every entry of the -batch manifest or
+// directory and writes an aggregate JSON report, or its summary with
+// -summary-only. Without -keep-going, the first failing
+// entry aborts the run; with it, failures are recorded in the report and
+// reported once all entries are processed.
+func (c *CoverCommand) runBatch() error {
+	entries, err := readBatch(c.BatchFlag)
+	if err != nil {
+		return err
+	}
+
+	cfg := c.config()
+	// Entries would overwrite each other's report.
+	cfg.UncoveredOut, cfg.CoveredOut = "", ""
+	computer := patchcover.New(cfg)
+
+	report := batchReport{Results: make([]batchResult, 0, len(entries))}
+	for _, e := range entries {
+		result := batchResult{Name: e.Name}
+		data, err := computer.ComputeFromFiles(e.Coverage, e.Diff, e.PrevCoverage)
+		if err != nil {
+			if !c.KeepGoingFlag {
+				return fmt.Errorf("batch entry %s: %w", e.Name, err)
+			}
+			result.Error = err.Error()
+			report.Failed++
+		} else {
+			data.ToolVersion = c.version
+			result.Coverage = &data
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	var out interface{} = report
+	if c.SummaryOnlyFlag {
+		out = summarize(report)
+	}
+	if err := c.jsonEncoder(c.stdout).Encode(out); err != nil {
+		return fmt.Errorf("json output error: %w", err)
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d batch entries failed", report.Failed, len(entries))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// zeroCommit is the commit git blame reports for lines not committed yet.
+const zeroCommit = "0000000000000000000000000000000000000000"
+
+// gitBlame returns, by line number, the commit and author that introduced
+// each line of the working tree file name, relative to dir. Lines not
+// committed yet, including every line of untracked files, are reported as
+// Uncommitted.
+func gitBlame(dir, name string) (map[int]patchcover.Blame, error) {
+	tracked, err := runGit(dir, "ls-files", "--", name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(tracked) == "" {
+		return map[int]patchcover.Blame{}, nil
+	}
+
+	out, err := runGit(dir, "blame", "--line-porcelain", "--", name)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlamePorcelain(out), nil
+}
+
+// parseBlamePorcelain parses the output of git blame --line-porcelain,
+// where every line is preceded by a header holding its commit, its line
+// number and its author.
+func parseBlamePorcelain(out string) map[int]patchcover.Blame {
+	blames := make(map[int]patchcover.Blame)
+
+	var cur patchcover.Blame
+	lineNum := 0
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			// The content of the line ends its entry.
+			if cur.Commit == zeroCommit {
+				cur = patchcover.Blame{Uncommitted: true}
+			}
+			blames[lineNum] = cur
+			cur, lineNum = patchcover.Blame{}, 0
+		case strings.HasPrefix(line, "author "):
+			cur.Author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-mail "):
+			cur.AuthorMail = strings.Trim(strings.TrimPrefix(line, "author-mail "), "<>")
+		case lineNum == 0:
+			// Header: commit, original line number, final line number and,
+			// for the first line of a group, the number of lines.
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(fields[0]) != len(zeroCommit) {
+				continue
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil {
+				continue
+			}
+			cur.Commit, lineNum = fields[0], n
+		}
+	}
+	return blames
+}
+
+// blameUncovered sets the Blame of the uncovered lines of data from git
+// blame of the changed files, in the working tree of dir.
+func blameUncovered(dir string, data *patchcover.CoverageData) error {
+	diffNames := make(map[string]string, len(data.DiffProfiles))
+	for diffName, profileName := range data.DiffProfiles {
+		diffNames[profileName] = diffName
+	}
+
+	files := make(map[string]map[int]patchcover.Blame)
+	for i, l := range data.UncoveredLines {
+		diffName, ok := diffNames[l.FileName]
+		if !ok {
+			continue
+		}
+		blames, ok := files[diffName]
+		if !ok {
+			var err error
+			if blames, err = gitBlame(dir, diffName); err != nil {
+				return err
+			}
+			files[diffName] = blames
+		}
+
+		b, ok := blames[l.LineNum]
+		if !ok {
+			b = patchcover.Blame{Uncommitted: true}
+		}
+		data.UncoveredLines[i].Blame = &b
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+	"gotest.tools/v3/assert"
+)
+
+// newBlameRepo returns a repository whose feature.go was written by Alice,
+// had its line 4 changed by Bob, and has an uncommitted change on line 7.
+// new.go is untracked.
+func newBlameRepo(t *testing.T) (r *scriptedRepo, alice, bob string) {
+	r = newScriptedRepo(t)
+	r.write("feature.go", "package m\n\nfunc Feature() int {\n\treturn 1\n}\n\nvar x = 1\n")
+	r.git("add", "-A")
+	r.git("commit", "-q", "-m", "feature", "--author", "Alice <alice@example.com>")
+	alice = strings.TrimSpace(r.git("rev-parse", "HEAD"))
+
+	r.write("feature.go", "package m\n\nfunc Feature() int {\n\treturn 2\n}\n\nvar x = 1\n")
+	r.git("commit", "-q", "-a", "-m", "fix", "--author", "Bob <bob@example.com>")
+	bob = strings.TrimSpace(r.git("rev-parse", "HEAD"))
+
+	r.write("feature.go", "package m\n\nfunc Feature() int {\n\treturn 2\n}\n\nvar x = 3\n")
+	r.write("new.go", "package m\n\nvar y = 1\n")
+	return r, alice, bob
+}
+
+func Test_gitBlame(t *testing.T) {
+	r, alice, bob := newBlameRepo(t)
+
+	blames, err := gitBlame(r.dir, "feature.go")
+	assert.NilError(t, err)
+	assert.Equal(t, len(blames), 7)
+	assert.DeepEqual(t, blames[3], patchcover.Blame{Commit: alice, Author: "Alice", AuthorMail: "alice@example.com"})
+	assert.DeepEqual(t, blames[4], patchcover.Blame{Commit: bob, Author: "Bob", AuthorMail: "bob@example.com"})
+	assert.DeepEqual(t, blames[7], patchcover.Blame{Uncommitted: true})
+
+	blames, err = gitBlame(r.dir, "new.go")
+	assert.NilError(t, err)
+	assert.Equal(t, len(blames), 0)
+
+	_, err = gitBlame(t.TempDir(), "feature.go")
+	assert.ErrorContains(t, err, "not a git repository")
+}
+
+func Test_blameUncovered(t *testing.T) {
+	r, alice, bob := newBlameRepo(t)
+
+	data := patchcover.CoverageData{
+		DiffProfiles: map[string]string{
+			"feature.go": "example.com/m/feature.go",
+			"new.go":     "example.com/m/new.go",
+		},
+		UncoveredLines: []patchcover.UncoveredLine{
+			{FileName: "example.com/m/feature.go", LineNum: 3},
+			{FileName: "example.com/m/feature.go", LineNum: 4},
+			{FileName: "example.com/m/feature.go", LineNum: 7},
+			{FileName: "example.com/m/new.go", LineNum: 3},
+			{FileName: "example.com/m/other.go", LineNum: 1},
+		},
+	}
+	assert.NilError(t, blameUncovered(r.dir, &data))
+
+	var got []*patchcover.Blame
+	for _, l := range data.UncoveredLines {
+		got = append(got, l.Blame)
+	}
+	assert.DeepEqual(t, got, []*patchcover.Blame{
+		{Commit: alice, Author: "Alice", AuthorMail: "alice@example.com"},
+		{Commit: bob, Author: "Bob", AuthorMail: "bob@example.com"},
+		{Uncommitted: true},
+		{Uncommitted: true},
+		nil,
+	})
+}
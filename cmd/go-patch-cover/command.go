@@ -2,58 +2,353 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	patchcover "github.com/srinidhis05/go-patch-cover"
 )
 
+// stringsFlag is a repeatable string flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// sourcesFlag is a repeatable test_type=coverage_file flag.
+type sourcesFlag []patchcover.Source
+
+func (s *sourcesFlag) String() string {
+	var parts []string
+	for _, src := range *s {
+		parts = append(parts, src.TestType+"="+src.CoverageFile)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *sourcesFlag) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i <= 0 || i == len(v)-1 {
+		return fmt.Errorf("invalid source %q: expected test_type=coverage_file", v)
+	}
+	*s = append(*s, patchcover.Source{TestType: v[:i], CoverageFile: v[i+1:]})
+	return nil
+}
+
 type CoverCommand struct {
 	fs *flag.FlagSet
 
-	VersionFlag  bool
-	HelpFlag     bool
-	OutputFlag   string
-	TemplateFlag string
+	VersionFlag    bool
+	HelpFlag       bool
+	OutputFlag     string
+	JSONPrettyFlag bool
+	EncodingFlag   string
+	OutFlag        string
+	JSONOutFlag    string
+	HTMLOutFlag    string
+	TrimModeFlag   bool
+	TemplateFlag   string
+	NoPrevFlag     string
+
+	CoberturaPatchFlag bool
+
+	CommentTemplateFlag     string
+	CommentTemplateFileFlag string
+
+	ExcludeFlag        stringsFlag
+	IncludeFlag        stringsFlag
+	ExcludeTestsFlag   bool
+	ExtensionsFlag     string
+	PathspecFlag       stringsFlag
+	StrictFlag         bool
+	StaleFlag          float64
+	EmptyPatchFlag     string
+	ModulesFlag        bool
+	GoModFlag          string
+	ModulePrefixFlag   string
+	ModuleDirFlag      string
+	PrecisionFlag      int
+	SkipEmbeddedFlag   bool
+	DeprecatedFlag     bool
+	SkipGenFlag        bool
+	IgnoreFileFlag     string
+	IgnoreMarkerFlag   stringsFlag
+	FormatOnlyFlag     bool
+	FuncBodiesFlag     bool
+	WeightFlag         bool
+	RedactFlag         bool
+	NoFileWriteFlag    bool
+	UncoveredOutFlag   string
+	CoveredOutFlag     string
+	GroupRangesFlag    bool
+	ContextFlag        int
+	HunkFlag           bool
+	CPUProfileFlag     string
+	MemProfileFlag     string
+	BlameFlag          bool
+	RegressionsFlag    bool
+	MinCoverageFlag    thresholdFlag
+	MinPatchFlag       thresholdFlag
+	MinDeltaFlag       thresholdFlag
+	MaxDropFlag        thresholdFlag
+	CompareModeFlag    string
+	MissingPrevFlag    bool
+	ShowRegenFlag      bool
+	MinFilePatchFlag   thresholdFlag
+	PerPackageFlag     thresholdFlag
+	CoverageFloorFlag  int
+	ForbidRegexFlag    string
+	ChangedFuncsFlag   bool
+	FailMessageFlag    string
+	SuitesConfigFlag   string
+	ConfigFlag         string
+	SuiteFlag          string
+	SourceFlag         sourcesFlag
+	DebugPathsFlag     bool
+	DoctorFlag         bool
+	FilesFromFlag      string
+	DiffFlag           stringsFlag
+	DiffOpFlag         string
+	PRFlag             int
+	ReviewFlag         bool
+	MaxCommentsFlag    int
+	GHCommentFlag      bool
+	PlatformFlag       string
+	GHStatusFlag       bool
+	SlackWebhookFlag   string
+	BaseFlag           string
+	SinceTagFlag       bool
+	StashFlag          string
+	HeadFlag           string
+	MergeBaseFlag      bool
+	AgainstMainFlag    bool
+	FetchFlag          bool
+	ConcurrencyFlag    int
+	CacheDirFlag       string
+	DeadlineFlag       time.Duration
+	VariantFlag        stringsFlag
+	CovFlag            stringsFlag
+	ProfileModeFlag    string
+	CovFormatFlag      string
+	TotalMinHitsFlag   int
+	PatchMinHitsFlag   int
+	PackagesFlag       bool
+	TrimGenFlag        bool
+	StrictPctFlag      bool
+	PatchOnlyFlag      bool
+	BatchFlag          string
+	KeepGoingFlag      bool
+	SummaryOnlyFlag    bool
+	EnvFileFlag        string
+	QuietFlag          bool
+	VerboseFlag        bool
+	ChdirFlag          string
+	PrevArtifactFlag   string
+	PrevBranchFlag     string
+	CoverageIgnoreFlag string
+	ByOwnerFlag        bool
+	ByFileFlag         bool
+	CodeOwnersFlag     string
 
-	version string
+	coverageIgnore []string
+	codeOwners     []string
+	logLevel       int
+	version        string
+	stdin          io.Reader
+	stdout         io.Writer
+	stderr         io.Writer
 }
 
 func newCoverCommand(version string) *CoverCommand {
 	c := &CoverCommand{
 		fs:      flag.NewFlagSet("", flag.ContinueOnError),
 		version: version,
+		stdin:   os.Stdin,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
 	}
 
 	c.fs.Usage = c.Usage
 
 	c.fs.BoolVar(&c.VersionFlag, "version", false, "print go-patch-cover version")
 	c.fs.BoolVar(&c.HelpFlag, "help", false, "print go-patch-cover help")
-	c.fs.StringVar(&c.OutputFlag, "o", "template", "coverage output format: json, template")
+	c.fs.StringVar(&c.OutputFlag, "o", "template", "coverage output format: json, ndjson, template, uncovered, clover, cobertura, badge, profile-subset, comment, diff, html, markdown, sarif, tap")
+	c.fs.BoolVar(&c.TrimModeFlag, "trim-mode-header", false, "omit the mode: header of emitted cover profiles")
+	c.fs.BoolVar(&c.CoberturaPatchFlag, "cobertura-patch-only", false, "scope -o cobertura to the added lines")
+	c.fs.BoolVar(&c.JSONPrettyFlag, "json-pretty", false, "indent JSON output")
+	c.fs.StringVar(&c.EncodingFlag, "output-encoding", "lf", "newlines and byte order mark of the output: lf, crlf, lf-bom or crlf-bom")
+	c.fs.StringVar(&c.OutFlag, "out", "", "file to write the output to instead of stdout")
+	c.fs.StringVar(&c.JSONOutFlag, "json-out", "", "file to also write the json output to")
+	c.fs.StringVar(&c.HTMLOutFlag, "html-out", "", "file to write the html report to")
 	c.fs.StringVar(&c.TemplateFlag, "tmpl", "", "go template string override")
+	c.fs.StringVar(&c.NoPrevFlag, "no-prev-coverage-text", "", "line of the default template when there is no previous coverage; empty omits it")
+	c.fs.StringVar(&c.CommentTemplateFlag, "comment-tmpl", "", "go template string override of pull request comments")
+	c.fs.StringVar(&c.CommentTemplateFileFlag, "comment-tmpl-file", "", "file holding a go template override of pull request comments")
+	c.fs.Var(&c.ExcludeFlag, "exclude", "glob pattern of files to exclude from coverage (repeatable)")
+	c.fs.StringVar(&c.CoverageIgnoreFlag, "coverageignore", ".coverageignore", "file of .gitignore style patterns of files to exclude from coverage")
+	c.fs.BoolVar(&c.ByOwnerFlag, "by-owner", false, "break patch coverage down by code owner")
+	c.fs.BoolVar(&c.ByFileFlag, "by-file", false, "break patch coverage down by changed file, for json and templates")
+	c.fs.StringVar(&c.CodeOwnersFlag, "codeowners", "", "CODEOWNERS file of -by-owner")
+	c.fs.BoolVar(&c.ExcludeTestsFlag, "exclude-tests", false, "leave _test.go files out of the total and patch coverage; default: EXCLUDE_TESTS")
+	c.fs.StringVar(&c.ExtensionsFlag, "extensions", ".go", "comma separated extensions of the changed files to consider")
+	c.fs.Var(&c.PathspecFlag, "path", "git-style pathspec of the changed files to consider, \":!\" prefixed to exclude (repeatable)")
+	c.fs.Var(&c.IncludeFlag, "include", "glob pattern of files to restrict coverage to (repeatable)")
+	c.fs.BoolVar(&c.ModulesFlag, "detect-modules", false, "match changed files against the module of their nearest go.mod")
+	c.fs.StringVar(&c.ModulePrefixFlag, "module-prefix", "", "module path stripped from profile file names, which then match diff paths exactly")
+	c.fs.StringVar(&c.ModuleDirFlag, "module-dir", "", "with -module-prefix, repository relative directory of the module")
+	c.fs.StringVar(&c.GoModFlag, "gomod", "", "go.mod file whose local replace directives are applied to profile file names")
+	c.fs.BoolVar(&c.StrictFlag, "strict", false, "fail when no changed go file matches a coverage profile, or the profile is stale")
+	c.fs.Float64Var(&c.StaleFlag, "stale-threshold", 0.5, "fraction of the added code lines of matched files in no block above which the profile is stale")
+	c.fs.StringVar(&c.EmptyPatchFlag, "empty-patch-coverage", "100", "patch coverage of a patch adding no statement: 100, 0 or none")
+	c.fs.IntVar(&c.PrecisionFlag, "precision", 0, "round percentages to this many decimal places")
+	c.fs.BoolVar(&c.SkipEmbeddedFlag, "skip-embedded", false, "exclude added lines of multi-line string literals and //go:embed declarations")
+	c.fs.BoolVar(&c.DeprecatedFlag, "skip-deprecated", false, "exclude added lines of functions documented as Deprecated")
+	c.fs.BoolVar(&c.SkipGenFlag, "skip-generated", false, "leave changed generated files out of all coverage")
+	c.fs.BoolVar(&c.FuncBodiesFlag, "function-bodies-only", false, "restrict patch coverage to added lines inside function bodies")
+	c.fs.StringVar(&c.IgnoreFileFlag, "ignore-file", "", "file of file:line entries excluded from patch coverage")
+	c.fs.Var(&c.IgnoreMarkerFlag, "ignore-marker", "marker excluding the added lines holding it from patch coverage (repeatable)")
+	c.fs.BoolVar(&c.FormatOnlyFlag, "skip-format-only", false, "exclude added lines only reformatted, matching a deleted line but for whitespace")
+	c.fs.BoolVar(&c.WeightFlag, "weight-by-complexity", false, "weight changed statements by the cyclomatic complexity of their function")
+	c.fs.BoolVar(&c.RedactFlag, "redact-source", false, "omit the content of source lines from all outputs")
+	c.fs.BoolVar(&c.NoFileWriteFlag, "no-filewrite", false, "write no file, only stdout and stderr")
+	c.fs.StringVar(&c.UncoveredOutFlag, "uncovered-out", "uncovered_lines.txt", "file the uncovered lines report is written to; empty writes none")
+	c.fs.StringVar(&c.CoveredOutFlag, "covered-out", "", "file the covered lines report is written to, listing the covered added lines")
+	c.fs.BoolVar(&c.GroupRangesFlag, "group-uncovered", false, "report contiguous uncovered lines as ranges")
+	c.fs.IntVar(&c.ContextFlag, "include-unchanged-coverage", 0, "number of source lines of context reported around uncovered lines")
+	c.fs.BoolVar(&c.HunkFlag, "uncovered-with-hunk", false, "report the header of the diff hunk of uncovered lines")
+	// Hidden flags, left out of the usage, to diagnose the performance of
+	// the tool itself.
+	c.fs.StringVar(&c.CPUProfileFlag, "cpuprofile", "", "write a cpu profile of the run to this file")
+	c.fs.StringVar(&c.MemProfileFlag, "memprofile", "", "write a memory profile of the run to this file")
+	c.fs.BoolVar(&c.BlameFlag, "blame", false, "annotate uncovered lines with the commit and author that introduced them")
+	c.fs.BoolVar(&c.ShowRegenFlag, "show-regen", false, "print the go test command regenerating the coverage file")
+	c.fs.BoolVar(&c.RegressionsFlag, "regressions", false, "warn about lines covered in the previous coverage and not anymore")
+	c.fs.StringVar(&c.FilesFromFlag, "files-from", "", "file listing changed files, one per line, to use instead of a diff")
+	c.fs.Var(&c.DiffFlag, "diff", "diff file, or comma separated list of them, to use instead of diff_file, combined with -diff-op (repeatable)")
+	c.fs.StringVar(&c.DiffOpFlag, "diff-op", "", "how several -diff combine: union or intersect; default: union")
+	c.fs.BoolVar(&c.QuietFlag, "q", false, "print nothing on stderr but errors")
+	c.fs.BoolVar(&c.VerboseFlag, "v", false, "also print on stderr how inputs were resolved")
+	c.fs.StringVar(&c.EnvFileFlag, "env-file", "", "dotenv file of environment variables, which the environment overrides")
+	c.fs.StringVar(&c.ChdirFlag, "C", "", "change to this directory before doing anything else")
+	c.fs.StringVar(&c.ChdirFlag, "chdir", "", "change to this directory before doing anything else")
+	c.fs.StringVar(&c.PrevArtifactFlag, "prev-artifact-dir", "", "directory of coverage files stored per branch, the previous coverage is read from")
+	c.fs.StringVar(&c.PrevBranchFlag, "prev-artifact-branch", "", "branch whose stored coverage file is the previous coverage; default: $GITHUB_BASE_REF")
+	c.fs.IntVar(&c.PRFlag, "pr", 0, "GitHub pull request number to fetch the diff of instead of a diff file")
+	c.fs.BoolVar(&c.ReviewFlag, "review", false, "with -pr, post a review commenting on uncovered added lines")
+	c.fs.IntVar(&c.MaxCommentsFlag, "review-max-comments", 50, "maximum number of inline comments of -review")
+	c.fs.BoolVar(&c.GHCommentFlag, "gh-comment", false, "post the markdown comment as a pull request comment, updated on later runs")
+	c.fs.StringVar(&c.PlatformFlag, "platform", "", "platform -gh-comment posts to: github or gitlab; default: gitlab in GitLab CI, github otherwise")
+	c.fs.BoolVar(&c.GHStatusFlag, "gh-status", false, "set a commit status of the patch coverage on $GITHUB_SHA, failing with the gates")
+	c.fs.StringVar(&c.SlackWebhookFlag, "slack-webhook", "", "Slack incoming webhook URL the template output is posted to")
+	c.fs.StringVar(&c.BaseFlag, "base", "", "git ref to diff the working tree against instead of a diff file")
+	c.fs.BoolVar(&c.SinceTagFlag, "since-tag", false, "diff the working tree against the latest tag reachable from HEAD")
+	c.fs.StringVar(&c.StashFlag, "stash", "", "git stash entry whose changes are used instead of a diff file")
+	c.fs.StringVar(&c.HeadFlag, "head", "", "with -base, git ref diffed against -base instead of the working tree")
+	c.fs.BoolVar(&c.MergeBaseFlag, "merge-base", false, "diff against the merge-base of -base and HEAD")
+	c.fs.BoolVar(&c.AgainstMainFlag, "compare-against-main", false, "diff against the merge-base of the base branch, and compare with its stored coverage")
+	c.fs.BoolVar(&c.FetchFlag, "fetch", false, "with -merge-base, fetch the full history of shallow clones")
+	c.fs.Var(&c.VariantFlag, "variant", "coverage file of another build variant to merge into coverage_file (repeatable)")
+	c.fs.Var(&c.CovFlag, "cov", "coverage file of another test suite to sum with coverage_file (repeatable)")
+	c.fs.IntVar(&c.TotalMinHitsFlag, "total-min-hits", 1, "count a block needs to be covered in the total coverage")
+	c.fs.IntVar(&c.PatchMinHitsFlag, "patch-min-hits", 1, "count a block needs to be covered in the patch coverage")
+	c.fs.BoolVar(&c.PackagesFlag, "packages", false, "break total and previous coverage down by package")
+	c.fs.BoolVar(&c.TrimGenFlag, "trim-generated-from-total", false, "leave generated files out of the total and previous coverage")
+	c.fs.BoolVar(&c.StrictPctFlag, "strict-percentages", false, "fail on covered statement counts out of range instead of clamping percentages")
+	c.fs.BoolVar(&c.PatchOnlyFlag, "patch-coverage-only", false, "compute the patch coverage only, skipping the total and previous coverage")
+	c.fs.StringVar(&c.ProfileModeFlag, "profile-format", "", "override the mode of coverage files: set, count or atomic")
+	c.fs.StringVar(&c.CovFormatFlag, "cov-format", "", "format of coverage files: go or lcov; default: lcov for .info files, go otherwise")
+	c.fs.IntVar(&c.ConcurrencyFlag, "concurrency", 0, "maximum number of coverage profiles parsed, and of profiles whose patch coverage is computed, in parallel; default: GOMAXPROCS")
+	c.fs.StringVar(&c.CacheDirFlag, "cache-dir", "", "directory caching parsed coverage profiles and diffs across runs")
+	c.fs.DurationVar(&c.DeadlineFlag, "deadline", 0, "time budget of matching profiles against the diff, after which coverage is incomplete")
+	c.fs.StringVar(&c.BatchFlag, "batch", "", "JSON manifest of coverage, diff and previous coverage files to process")
+	c.fs.BoolVar(&c.KeepGoingFlag, "keep-going", false, "with -batch, process every entry even when some fail")
+	c.fs.BoolVar(&c.SummaryOnlyFlag, "summary-only", false, "with -batch, write the coverage numbers of every entry and their sums only")
+	c.fs.Var(&c.MinCoverageFlag, "min-coverage", "fail when total coverage is below this percentage")
+	c.fs.Var(&c.MinCoverageFlag, "fail-under-total", "alias of -min-coverage")
+	c.fs.Var(&c.MinPatchFlag, "min-patch-coverage", "fail when patch coverage is below this percentage")
+	c.fs.Var(&c.MinPatchFlag, "fail-under", "alias of -min-patch-coverage")
+	c.fs.Var(&c.MinFilePatchFlag, "min-file-patch-coverage", "fail when a changed file's patch coverage is below this percentage")
+	c.fs.Var(&c.PerPackageFlag, "per-package-fail-under", "fail when the total coverage of a package is below this percentage")
+	c.fs.IntVar(&c.CoverageFloorFlag, "coverage-floor", 0, "leave files with fewer statements out of per-file gates")
+	c.fs.Var(&c.MinDeltaFlag, "min-delta", "fail unless total coverage changed by at least this many percentage points")
+	c.fs.Var(&c.MaxDropFlag, "max-drop", "fail when total coverage dropped by more than this many percentage points")
+	c.fs.StringVar(&c.CompareModeFlag, "compare-mode", "", "metric compared by -min-delta: total, patch or changed-files; default: total")
+	c.fs.BoolVar(&c.MissingPrevFlag, "ignore-missing-prev-files", false, "with -compare-mode changed-files, leave files absent from the previous coverage out")
+	c.fs.StringVar(&c.ForbidRegexFlag, "forbid-uncovered-regex", "", "fail when an uncovered added line matches this regular expression")
+	c.fs.BoolVar(&c.ChangedFuncsFlag, "require-coverage-for-changed-funcs", false, "fail when a changed function has no covered added statement")
+	c.fs.StringVar(&c.FailMessageFlag, "fail-message-tmpl", "", "go template string of the error reported when a gate fails")
+	c.fs.StringVar(&c.SuitesConfigFlag, "suites-config", "", "JSON file of excludes and thresholds of named test suites")
+	c.fs.StringVar(&c.ConfigFlag, "config", "", "JSON file of excludes and thresholds; default: $GO_PATCH_COVER_CONFIG")
+	c.fs.StringVar(&c.SuiteFlag, "suite", "", "suite of -suites-config to apply; default: $TEST_TYPE")
+	// Hidden: not listed in Usage.
+	c.fs.BoolVar(&c.DebugPathsFlag, "debug-paths", false, "print raw and normalized profile and diff paths, then exit")
+	c.fs.BoolVar(&c.DoctorFlag, "doctor", false, "check the coverage and diff files for common setup issues, then exit")
+	c.fs.Var(&c.SourceFlag, "source", "test_type=coverage_file to report which test types cover each added line (repeatable)")
 	return c
 }
 
 func (c *CoverCommand) Usage() {
 	// TODO: Link to template variable struct on github.
-	usage := `Usage: go-patch-cover [--version] [--help] [flags...] coverage_file diff_file [previous_coverage_file] 
+	usage := `Usage: go-patch-cover [--version] [--help] [flags...] coverage_file [diff_file [previous_coverage_file]]
+       go-patch-cover [flags...] -files-from file_list coverage_file [previous_coverage_file]
+       go-patch-cover [flags...] -diff diff_file... [-diff-op op] coverage_file [previous_coverage_file]
+       go-patch-cover [flags...] -pr number [-review] coverage_file [previous_coverage_file]
+       go-patch-cover [flags...] -base ref [-head ref] [-merge-base [-fetch]] coverage_file [previous_coverage_file]
+       go-patch-cover [flags...] -compare-against-main -prev-artifact-dir dir coverage_file
+       go-patch-cover [flags...] -since-tag coverage_file [previous_coverage_file]
+       go-patch-cover [flags...] -source test_type=coverage_file... diff_file
+       go-patch-cover [flags...] -batch manifest|dir [-keep-going] [-summary-only]
+       go-patch-cover [flags...] -doctor coverage_file diff_file
 
 Arguments:
 	coverage_file
 		go coverage file for the code after patch was applied.
-		Can be generated with any cover mode.
+		Can be generated with any cover mode. "-" reads it from stdin,
+		along with a diff_file or a diff of -pr, -base, -since-tag or
+		-stash.
 		Example generation:
 			go test -coverprofile=coverage.out -covermode=count ./...
+		Overlapping blocks, which go test does not produce, are resolved
+		by keeping the innermost one, or the one with the highest count
+		among blocks of the same size.
 
-	diff_file
+	diff_file [OPTIONAL]
 		unified diff file of the patch to compute coverage for.
+		When not provided, or "", only the total coverage is computed:
+		patch coverage is not reported, and -min-patch-coverage fails.
+		"-" reads it from stdin, e.g.
+			git diff -U0 origin/main | go-patch-cover coverage.out -
+		git, Mercurial and Subversion diffs are supported. Combined
+		diffs, which git produces for merge commits, are rejected: diff
+		against a single parent instead, e.g. git diff base..merge.
+		Any git --diff-algorithm works, but algorithms may report moved
+		code differently: myers may report a moved function as
+		rewritten where histogram reports it unchanged, counting its
+		statements in the patch coverage.
 		Example generation:
 			git diff -U0 --no-color origin/${GITHUB_BASE_REF} > patch.diff
+		A coverage block counts as changed when an added line holds some
+		of its code: lines only holding braces or comments of a block,
+		such as its closing brace, do not count it.
 
 	previous_coverage_file [OPTIONAL]
 		go coverage file for the code before the patch was applied.
 		When not provided, previous coverage information will not be displayed.
+		A file holding no statement counts as no previous coverage.
 
 Flags:
 	--version
@@ -62,11 +357,685 @@ Flags:
 	--help
 		display this help message.
 
+	-C dir, -chdir dir
+		change to dir before doing anything else, so that relative
+		paths, of arguments, flags and written files, and git commands
+		resolve from dir, as with "go -C".
+
+	-doctor
+		check coverage_file and diff_file for common setup issues
+		instead of computing coverage: an empty coverage file, a
+		missing mode line, changed go files matching no profile,
+		filesystem paths instead of import paths, or a coverage file
+		older than the diff. Prints advice for every failed check, and
+		fails when any did.
+
+	-source test_type=coverage_file
+		coverage file of one kind of test run; repeatable. When set,
+		reports for every added line which test types cover it instead
+		of coverage percentages. Only diff_file is expected as argument.
+
+	-variant file
+		coverage file of another variant of the build coverage_file
+		comes from, e.g. with -race; repeatable. Variants are merged
+		into coverage_file: the union of their blocks is kept, and a
+		block present in several variants keeps its highest count.
+
+	-cov file
+		coverage file of another test suite run on the same code as
+		coverage_file, e.g. integration tests; repeatable. Block counts
+		are summed with those of coverage_file, in count mode unless
+		every file uses set mode. Fails when the blocks of a file
+		differ between coverage files.
+
+	-total-min-hits int
+		count a block needs to be covered in the total and previous
+		coverage, e.g. 2 in count mode to require several hits;
+		default: 1.
+
+	-patch-min-hits int
+		count a block needs to be covered in the patch coverage;
+		default: 1.
+
+	-packages
+		break total coverage down by package, reported as
+		"package pkg: 80.0% -> 72.0%" against the previous coverage, so
+		regressed packages stand out. Packages only present in one of
+		the coverage files are reported as new or removed. json
+		includes them as packages.
+
+	-by-file
+		break patch coverage down by changed file, to tell which files
+		lower it. json includes the total and patch coverage of every
+		changed file matching a profile as files, and templates can
+		range over them, e.g.
+		{{ range .Files }}{{ .FileName }} {{ .PatchCoverage }}{{ end }}.
+		A file without changed statements has a patch coverage of 100%,
+		as a patch without any.
+
+	-by-owner
+		break patch coverage down by the code owners of the changed
+		files, from the -codeowners file, reported as
+		"owner @org/team: 80.0% of changed statements (4/5)". json
+		includes the patch coverage and uncovered lines of every owner
+		as by_owner. Files without an owner are grouped under "", and
+		reported as "owner (none)".
+
+	-codeowners file
+		CODEOWNERS file of -by-owner. Diff paths are matched against its
+		patterns; the last matching pattern wins.
+		default: the first of .github/CODEOWNERS, CODEOWNERS and
+		docs/CODEOWNERS found, as GitHub looks them up.
+
+	-trim-generated-from-total
+		leave generated files, marked by a "// Code generated ... DO NOT
+		EDIT." comment, out of the total and previous coverage, so
+		generated code neither inflates nor deflates them. Files are
+		read from disk, relative to the module of the go.mod of the
+		working directory.
+
+	-strict-percentages
+		fail when covered statement counts are negative or exceed
+		statement counts, revealing an accounting bug, instead of
+		clamping percentages to the 0-100 range.
+
+	-patch-coverage-only
+		compute the patch coverage only, skipping the total and previous
+		coverage, which are reported as zero, for faster patch gates on
+		large profiles. The previous coverage file is not read, and
+		-min-coverage, -min-delta and -max-drop fail.
+
+	-profile-format string
+		mode coverage files are interpreted in, overriding their
+		"mode:" header: set, count or atomic. In set mode, block counts
+		are clamped to 1.
+
+	-cov-format string
+		format of coverage files: go, go cover profiles, or lcov, lcov
+		tracefiles such as those of Bazel or of the coverage tools of
+		other languages. Every line of an lcov DA record counts as a
+		statement, hit when its count is positive. default: lcov for
+		files named *.info, go otherwise.
+
 	-o string
-		output format: json, template; default: template.
+		output format: json, ndjson, template, uncovered, clover,
+		cobertura, badge, profile-subset, comment, diff, html,
+		markdown, sarif, tap; default: template.
+		json includes report_schema_version, bumped whenever the JSON
+		fields change, and the tool_version producing it.
+		uncovered outputs only a JSON array of the uncovered added lines,
+		each with its file, line and code.
+		ndjson outputs one JSON object per line, for streaming
+		consumers: a header record, one record per changed file with
+		its patch coverage and uncovered lines, then a summary record.
+		clover outputs a Clover XML report scoped to the added lines.
+		cobertura outputs a Cobertura XML report of the coverage
+		profile, one package per directory and one class per file.
+		badge outputs a shields.io endpoint badge of the patch coverage.
+		profile-subset outputs a cover profile of only the blocks
+		overlapping added lines, for "go tool cover -html".
+		comment outputs the body of a pull request comment, the
+		markdown output under a heading unless -comment-tmpl or
+		-comment-tmpl-file is set.
+		diff reprints the diff with the first added line of every block
+		marked "+✓" when covered and "+✗" when not.
+		html outputs a standalone HTML page of the coverage, with the
+		added lines of every changed file, green when covered and red
+		when not.
+		markdown outputs a markdown table of the previous, new and
+		patch coverage, then the uncovered lines grouped by file in a
+		collapsible block, to paste into comments.
+		sarif outputs a SARIF 2.1.0 log for code scanning, one
+		"patch-coverage/uncovered-line" warning per uncovered added
+		line, with the total and patch coverage in the run properties.
+		tap outputs a TAP version 13 report: one test point per
+		changed file, "not ok" when it has uncovered added lines, then
+		one per gate, "not ok" when it fails.
+		Formats registered with patchcover.RegisterFormatter are
+		selected by name too, and passed the options of flags such as
+		-tmpl and -json-pretty; unknown formats are rejected.
+
+	-json-pretty
+		indent JSON output, of -o json, -o uncovered, -json-out, -source
+		and -batch, with two spaces. Output is compact by default.
+
+	-output-encoding encoding
+		newlines and charset of the -o output and of -json-out, for
+		tools reading reports the Windows way: lf (default), crlf to end
+		lines with "\r\n", and lf-bom or crlf-bom to also start them
+		with a UTF-8 byte order mark.
+
+	-out file
+		write the output, of -o, to file instead of stdout, so that
+		e.g. "-o json -out report.json" holds only the JSON report.
+		Warnings and the gate table stay on stderr.
+
+	-json-out file
+		also write the json output to file, whatever -o is, e.g. to log
+		the template output while keeping a JSON report.
+
+	-html-out file
+		also write the html output, of -o html, to file, whatever -o
+		is, e.g. to publish it as a CI artifact.
+
+	-trim-mode-header
+		omit the "mode:" header line of emitted cover profiles.
+
+	-cobertura-patch-only
+		scope -o cobertura to the added lines counted in the patch
+		coverage, for dashboards of the patch coverage.
 
 	-tmpl string
 		go template string to override default template.
+		When the template defines a template named "main", that
+		template is executed instead of the top-level one.
+
+	-no-prev-coverage-text string
+		line printed by the default template in place of "previous
+		coverage: unknown" when there is no previous coverage, e.g.
+		"previous coverage: N/A". An empty value omits the line.
+		Templates can print it as {{ .NoPrevCoverageLine }}.
+
+	-comment-tmpl string
+		go template string to override the markdown of pull request
+		comments, independently of -tmpl.
+
+	-comment-tmpl-file string
+		file holding a go template to override the markdown of pull
+		request comments; exclusive with -comment-tmpl.
+
+	-exclude pattern
+		glob pattern of files to exclude from coverage; repeatable.
+		Patterns also match trailing path segments: "mocks/*" matches
+		"github.com/org/repo/mocks/store.go", and a pattern matching a
+		directory matches the files in it, e.g. "**/mock". "*" matches
+		within a path segment, "**" any number of segments. Generated
+		code, e.g. of easyjson, is excluded with patterns such as
+		"*_easyjson.go".
+
+	-coverageignore file
+		file of patterns in .gitignore syntax, e.g. "vendor/" or
+		"/internal/gen/*.go", of files to exclude from coverage along
+		with -exclude. Patterns match paths relative to the module root;
+		"!" patterns re-include files, even in excluded directories.
+		default: .coverageignore, skipped when missing.
+
+	-extensions string
+		comma separated extensions of the changed files to consider;
+		other files of the diff are ignored. default: .go.
+
+	-exclude-tests
+		leave _test.go files out of both the total and the patch
+		coverage, whatever the -exclude patterns. When not set, the
+		EXCLUDE_TESTS environment variable, true or false, selects the
+		default; default: false.
+
+	-path pathspec
+		git-style pathspec of the changed files to consider, matched
+		against diff paths from the repository root as a file or a
+		parent directory; repeatable. "*" matches within a path segment,
+		"**" any number of segments. Pathspecs prefixed with ":!", ":^"
+		or ":(exclude)" exclude files; others restrict the diff to the
+		files matching one of them, e.g.
+			-path 'pkg/**' -path ':!**/testdata/**'
+
+	-include pattern
+		glob pattern of files to restrict coverage to; repeatable.
+		Patterns match as those of -exclude do.
+
+	-detect-modules
+		match each changed file against the module of the nearest go.mod
+		above it, for repositories holding several modules. go.mod files
+		are read from disk, relative to the working directory.
+
+	-module-prefix string
+		module path stripped from profile file names, which then match
+		diff paths exactly rather than by suffix, e.g.
+		"github.com/org/repo" for profiles of
+		"github.com/org/repo/pkg/x.go" and a diff of "pkg/x.go".
+		Without it, the module path of the go.mod of the working
+		directory is stripped and names match by suffix.
+
+	-module-dir string
+		with -module-prefix, directory of the module within the
+		repository, joined to module relative profile file names before
+		they are matched against the repository relative diff paths.
+
+	-gomod file
+		go.mod file whose replace directives by a local directory, e.g.
+		"replace example.com/lib => ./lib", are applied to profile file
+		names, so files of a replaced module match their path in the
+		replacement directory.
+
+	-strict
+		fail when the patch changes go files but none of them match a
+		coverage profile, or when the profile is stale.
+
+	-stale-threshold float
+		fraction of the added lines holding code, of the files matching
+		a coverage profile, that may fall in none of its blocks before
+		the profile is reported stale: generated from another revision
+		than the diff, so that line numbers do not line up. A warning is
+		written, or -strict fails. The json output reports
+		patch_unmatched_lines and stale. default: 0.5.
+
+	-empty-patch-coverage string
+		patch coverage of a patch adding no statement, e.g. of comments
+		or docs only: 100, 0, failing -min-patch-coverage, or none,
+		printing "no testable changes" instead. The json output reports
+		patch_has_statements. default: 100.
+
+	-precision int
+		round percentages to this many decimal places.
+
+	-skip-embedded
+		exclude added lines that hold data rather than code: continuation
+		lines of multi-line string literals and declarations following a
+		//go:embed directive. Changed files are read from disk.
+
+	-skip-deprecated
+		exclude added lines of functions whose doc comment has a
+		paragraph starting with "Deprecated:". Changed files are read
+		from disk.
+
+	-skip-generated
+		leave changed generated files, marked by a "// Code generated
+		... DO NOT EDIT." comment, out of the patch, total and previous
+		coverage. Changed files are read from disk, or checked through
+		the leading lines of the diff when not on disk.
+
+	-function-bodies-only
+		restrict patch coverage to added lines inside the bodies of
+		function declarations, leaving out imports and package-level
+		declarations. Changed files are read from disk.
+
+	-ignore-file string
+		file listing added lines to exclude from patch coverage, for
+		teams keeping ignores out of the source: one file:line or
+		file:start-end entry per line, where file is its path in the
+		diff. Blank lines and lines starting with # are skipped.
+
+	-ignore-marker string
+		marker, e.g. "// TODO" or "//nocover", excluding the added
+		lines holding it from patch coverage; repeatable.
+
+	-skip-format-only
+		exclude added lines only reformatted, e.g. by gofmt or an import
+		reordering: those matching a line deleted from the same file
+		once whitespace is removed.
+
+	-weight-by-complexity
+		weight the statements of each changed block by the cyclomatic
+		complexity of the function containing it. Changed files are read
+		from disk.
+
+	-redact-source
+		omit the content of source lines from all outputs, keeping file
+		names and line numbers, for environments where code must not
+		leave the build. Exclusive with -o diff and
+		-forbid-uncovered-regex.
+
+	-no-filewrite
+		write no file: the uncovered lines report is not written,
+		and -out, -json-out, -cache-dir, -fetch, -uncovered-out and
+		-covered-out are rejected. Input files are never modified; output only goes to
+		stdout and stderr.
+
+	-uncovered-out file
+		file the uncovered lines report is written to, e.g. outside a
+		read-only working directory; empty writes none, the report
+		still being printed by the default template and included in
+		json as uncovered_lines. default: uncovered_lines.txt.
+
+	-covered-out file
+		file the covered lines report is written to: the added lines
+		counted as covered in the patch coverage, in the format of the
+		uncovered lines report, e.g. to audit that new code is tested.
+		A line holding statements of covered and uncovered blocks is
+		reported in both. json then includes the lines as covered, with
+		the statements of their covered blocks.
+
+	-group-uncovered
+		report contiguous uncovered lines of a file as one range, e.g.
+		"LineNum: 42-48", in the uncovered lines report and the
+		template output. json includes the ranges as uncovered_ranges.
+
+	-include-unchanged-coverage int
+		number of source lines, changed or not, reported before and
+		after each uncovered line for context, in the uncovered lines
+		report, the template output and the context of json uncovered
+		lines.
+		Changed files are read from disk; files missing from disk get
+		no context. Ignored with -redact-source.
+
+	-uncovered-with-hunk
+		add to each uncovered line of json and -o uncovered outputs, as
+		hunk, the header of the diff hunk holding it, e.g.
+		"@@ -12,4 +12,6 @@ func A() {". With -redact-source, the code
+		following the header is left out.
+
+	-blame
+		annotate each uncovered line of json and -o uncovered outputs
+		with the commit and author that introduced it, from git blame of
+		the changed file in the working tree. Lines not committed yet
+		are reported as uncommitted. Requires a git repository.
+
+	-regressions
+		warn, on stderr, about every line covered in
+		previous_coverage_file and not anymore, including lines the
+		patch did not change, correlated with their previous version
+		through the diff. They are listed in the regressions field of
+		json outputs, apart from the uncovered added lines.
+
+	-show-regen
+		print, on stderr, the go test command regenerating coverage_file
+		in the cover mode of its header, e.g.
+			go test -covermode=count -coverprofile=coverage.out ./...
+		json outputs hold the mode as mode.
+
+	-files-from string
+		file listing changed files, one per line, used instead of
+		diff_file. Every statement of the listed files counts as changed.
+		Listed files are read from disk; missing files are skipped.
+
+	-diff file
+		diff file used instead of diff_file. Repeated, or given as a
+		comma separated list, e.g. of per-service diffs, the diffs are
+		combined by -diff-op. Their line numbers must refer to the same
+		version of the files, the one coverage_file covers. diff_file
+		may also be a comma separated list, combined the same way.
+
+	-diff-op string
+		how several -diff combine: union, counting the lines added by
+		any of them, or intersect, counting only the lines added by
+		all of them, e.g. to find the risky changes two pull requests
+		share. Files changed by several diffs only keep their added
+		lines, so -skip-format-only and -regressions, which rely on
+		deleted lines, are less accurate for them. default: union.
+
+	-pr int
+		GitHub pull request number whose diff is fetched from the GitHub
+		API instead of reading diff_file. Requires GITHUB_TOKEN and
+		GITHUB_REPOSITORY (owner/repo); GITHUB_API_URL overrides the API
+		endpoint. Fails when the pull request changes 3000 files or
+		more, or GitHub leaves the patch of a file out as too large.
+
+	-review
+		with -pr, post a review of the pull request once output is
+		written: its body is the -o comment output, and it comments
+		inline on every uncovered added line, on the RIGHT side of the
+		diff. When GitHub rejects the inline comments, e.g. of lines
+		outside of the diff of the pull request, the review is posted
+		without them.
+
+	-review-max-comments int
+		maximum number of inline comments of -review, as GitHub rejects
+		reviews with too many; the body of the review counts the
+		uncovered lines left out. default: 50.
+
+	-gh-comment
+		post the markdown comment, of -comment-tmpl or
+		-comment-tmpl-file, as a comment of the -pr pull request, or of
+		the PR_NUMBER environment variable, once output is written. The comment holds a hidden
+		"<!-- go-patch-cover -->" marker: later runs update the comment
+		holding it posted with the same token rather than adding one.
+		Requires GITHUB_TOKEN and GITHUB_REPOSITORY (owner/repo). On
+		GitLab, see -platform, the comment is a note of the
+		CI_MERGE_REQUEST_IID merge request of the CI_PROJECT_ID project,
+		and requires GITLAB_TOKEN; CI_API_V4_URL overrides the API
+		endpoint.
+
+	-platform string
+		platform -gh-comment posts to: github or gitlab. default:
+		gitlab when the GITLAB_CI environment variable is set, as in
+		GitLab CI, and github otherwise.
+
+	-gh-status
+		set a commit status on the GITHUB_SHA commit, for branch
+		protection rules: "success" when the gates pass and "failure"
+		otherwise, described by the patch coverage and failed gates.
+		Its context is "go-patch-cover/unit", or
+		"go-patch-cover/<suite>" for the suite of -suite or TEST_TYPE,
+		e.g. "go-patch-cover/integration". Requires GITHUB_TOKEN and
+		GITHUB_REPOSITORY (owner/repo).
+
+	-slack-webhook string
+		Slack incoming webhook URL the template output, of -tmpl, is
+		posted to once output is written, green when all gates pass and
+		red otherwise. Defaults to the SLACK_WEBHOOK_URL environment
+		variable.
+
+	-q
+		print nothing on stderr but errors: no warnings, hints or gate
+		table. Failed gates still fail the command.
+
+	-v
+		also print on stderr how inputs were resolved: the profile each
+		changed file matched, or that it matched none, and the
+		uncovered lines report written. Without -q or -v, the
+		LOG_LEVEL environment variable selects quiet, info or verbose;
+		default: info. Output only ever goes to stdout, or -out, so
+		"-o json" prints a single JSON document whatever the level.
+
+	-env-file string
+		dotenv file of KEY=value lines loaded before environment
+		variables such as GITHUB_TOKEN are read, to reproduce CI runs
+		locally. Variables already set in the environment take
+		precedence over the file.
+
+	-prev-artifact-dir string
+		directory of the coverage files stored by the CI runs of each
+		branch, as <dir>/<branch>/coverage.out, the previous coverage
+		is read from instead of previous_coverage_file. When no file was
+		stored for the branch yet, previous coverage is unknown.
+
+	-prev-artifact-branch string
+		with -prev-artifact-dir, branch whose coverage file is the
+		previous coverage; default: GITHUB_BASE_REF.
+
+	-base string
+		git ref the working tree is diffed against, with
+		"git diff -U0 --no-color", instead of reading diff_file.
+
+	-since-tag
+		diff the working tree against the latest tag reachable from
+		HEAD, found with "git describe --tags --abbrev=0", for the
+		coverage of everything changed since the last release.
+		Exclusive with -base. Fails when the repository has no tags.
+
+	-stash string
+		git stash entry, e.g. stash@{0}, whose changes are the patch,
+		with "git stash show -p", instead of reading diff_file, to check
+		the coverage of stashed work. Untracked files of the stash are
+		not part of the patch. Exclusive with -base and -since-tag.
+
+	-head string
+		with -base, git ref diffed against -base, with
+		"git diff -U0 --no-color <base> <head>", instead of the working
+		tree, e.g. to check the coverage of a release branch relative to
+		another one: coverage_file is then the coverage of -head, and
+		previous_coverage_file that of -base.
+
+	-merge-base
+		diff against "git merge-base <base> HEAD", or <head> with -head,
+		rather than the tip of -base, so changes merged into the base
+		branch after branching off do not count as part of the patch,
+		matching GitHub's pull request diff. Shallow clones, common in
+		CI, may lack the history needed; the command then fails asking
+		to deepen the clone.
+
+	-compare-against-main
+		report the coverage of a pull request in one flag: diff the
+		working tree against the merge-base of the base branch, as with
+		-base and -merge-base, and compare with the coverage file stored
+		for it in -prev-artifact-dir, required. The base branch is
+		GITHUB_BASE_REF, or else the default branch of the origin remote,
+		or else main or master; it is diffed locally, or from origin
+		when not checked out. -prev-artifact-branch overrides the stored
+		coverage compared with. Only coverage_file is passed.
+
+	-fetch
+		with -merge-base, fetch the full history of shallow clones
+		lacking the merge-base, with "git fetch --unshallow".
+
+	-concurrency int
+		maximum number of coverage profiles parsed, and of profiles
+		whose patch coverage is computed, in parallel;
+		default: GOMAXPROCS.
+
+	-cache-dir string
+		directory where parsed coverage files and diffs are stored,
+		keyed by the hash of their content, and reused by later runs
+		instead of parsing the same file again, e.g. of one large diff
+		against the coverage of several services. A changed file is
+		parsed again.
+
+	-deadline duration
+		time budget of matching coverage files against the diff, e.g.
+		30s, as a safety valve for huge diffs. Once exceeded, the
+		remaining files are left out of the patch coverage, which is
+		reported as incomplete; json sets incomplete. Total coverage is
+		always complete.
+
+	-batch manifest
+		JSON array of entries, each with a name and coverage, diff and
+		optional prev_coverage file paths, resolved relative to the
+		manifest. Coverage is computed for every entry and written as an
+		aggregate JSON report. No argument is expected.
+		A directory can be given instead: every subdirectory holding a
+		coverage.out file is an entry named after it, with diff.diff
+		and an optional prev_coverage.out.
+
+	-keep-going
+		with -batch, keep processing entries after a failure. Errors are
+		recorded in the report and the command fails once all entries
+		are processed.
+
+	-summary-only
+		with -batch, write only the statement counts and coverages of
+		every entry and their sums over all entries, as total, e.g. for
+		an organization-wide report.
+
+	-min-coverage float
+		fail when total coverage is below this percentage.
+
+	-fail-under-total float
+		alias of -min-coverage, as the --fail-under of coverage.py.
+
+	-min-patch-coverage float
+		fail when patch coverage is below this percentage. A patch
+		changing no statement passes, unless -empty-patch-coverage is
+		0.
+
+	-fail-under float
+		alias of -min-patch-coverage. When neither is set, the
+		min_patch_coverage of the suite of -suite or TEST_TYPE in
+		-suites-config, or of the -config file, applies.
+
+	-min-file-patch-coverage float
+		fail when the patch coverage of a changed file is below this
+		percentage, listing those files.
+
+	-per-package-fail-under float
+		fail when the total coverage of a package, the directory of
+		its profile file names, is below this percentage, listing
+		those packages. Implies -packages.
+
+	-coverage-floor int
+		leave files with fewer than this many statements in total out
+		of -min-file-patch-coverage, as a few statements swing between
+		0% and 100%. They still count toward the total and patch
+		coverage.
+
+	-min-delta float
+		fail unless total coverage changed by at least this many
+		percentage points since the previous coverage. Use 0 to forbid
+		regressions. Requires previous_coverage_file.
+
+	-max-drop float
+		fail when total coverage dropped by more than this many
+		percentage points since the previous coverage, comparing the
+		percentages rounded to one decimal as displayed. Passes when
+		the previous coverage is unknown, e.g. without
+		previous_coverage_file or when it holds no statement.
+
+	-compare-mode string
+		metric -min-delta compares with the previous coverage: total,
+		the total coverage; patch, the patch coverage against the
+		previous total coverage; or changed-files, the coverage of the
+		changed files against their previous coverage, files absent
+		from it counting for no statement. default: total.
+
+	-ignore-missing-prev-files
+		with -compare-mode changed-files, leave the changed files
+		absent from the previous coverage, e.g. files added since it
+		was generated, out of the comparison rather than counting their
+		statements in the coverage only. Files present in it are still
+		compared, so their regressions fail -min-delta.
+
+	-forbid-uncovered-regex string
+		fail when an uncovered added line matches this regular
+		expression, e.g. "panic\(|log\.Fatal".
+
+	-require-coverage-for-changed-funcs
+		fail when a function holding changed statements has none of
+		them covered, listing those functions. Changed files are read
+		from disk.
+
+	-fail-message-tmpl string
+		go template string of the error reported when a gate fails,
+		e.g. to link to documentation. It is executed with the
+		coverage data, as -tmpl, and .Gates: every configured gate with
+		its Name, Threshold, Actual, Passed and Error.
+
+	-suites-config string
+		JSON file configuring named test suites, e.g. smoke, e2e or
+		contract, each with its own excludes, includes, min_coverage,
+		min_patch_coverage and min_delta:
+			{"suites": {"e2e": {"min_patch_coverage": 60, "excludes": ["mocks/*"]}}}
+		Excludes and includes of the selected suite are added to the
+		flags; its thresholds apply to gates whose flag is not set.
+
+	-suite string
+		with -suites-config, suite to apply; default: TEST_TYPE.
+
+	-config string
+		JSON file of the excludes, includes, min_coverage,
+		min_patch_coverage and min_delta of every run, as a suite of
+		-suites-config:
+			{"min_patch_coverage": 80, "excludes": ["mocks/*"]}
+		Its thresholds apply to gates whose flag is not set, nor by the
+		selected suite. The file must exist; unknown fields are
+		rejected. default: GO_PATCH_COVER_CONFIG.
+
+	Gates (-min-coverage, -min-patch-coverage,
+	-min-file-patch-coverage, -per-package-fail-under, -min-delta,
+	-max-drop, -forbid-uncovered-regex and
+	-require-coverage-for-changed-funcs) are all evaluated once output
+	is written.
+	A table of each configured gate, its threshold, actual value and
+	result is printed to stderr, and the command fails if any failed.
+	Percentage thresholds also take a schedule of thresholds applying
+	from UTC dates on, to raise the bar over time, e.g.
+		-min-patch-coverage "from 2024-01-01: 70%, from 2024-06-01: 80%"
+	The threshold applying at the current date is checked; before the
+	first date, the gate is not, and no threshold of a suite or -config
+	file applies instead. Suites and -config files take schedules as
+	strings:
+		{"min_patch_coverage": "from 2024-01-01: 70%"}
+
+Environment:
+	GITHUB_OUTPUT
+		file the patch_coverage and total_coverage step outputs, and
+		prev_coverage when the previous coverage is known, are appended
+		to as name=value lines, for later steps of a GitHub Actions job
+		to gate on. Skipped when unset, or with -no-filewrite.
+
+	GITHUB_STEP_SUMMARY
+		file a markdown table of the previous, new and patch coverage is
+		appended to, the GitHub Actions job summary. The delta of the
+		new coverage is shown when the previous coverage is known.
+		Skipped when unset, or with -no-filewrite.
 
 Examples:
 
@@ -79,14 +1048,99 @@ Examples:
 	Display previous, total and patch coverage percentages as JSON to stdout:
 		go-patch-cover -o json coverage.out patch.diff prevcoverage.out
 
+	Display coverage of the changes made since branching off origin/main:
+		go-patch-cover -base origin/main -merge-base coverage.out
+
+	Display coverage of everything changed since the latest release tag:
+		go-patch-cover -since-tag coverage.out
+
+	Display coverage of every statement in a list of changed files:
+		go-patch-cover -files-from changed_files.txt coverage.out
+
+	Display coverage of the lines both of two patches add:
+		go-patch-cover -diff pr1.diff -diff pr2.diff -diff-op intersect coverage.out
+
+	Display which of the unit and integration tests cover each added line:
+		go-patch-cover -source unit=coverage-ut.out -source integration=coverage-it.out patch.diff
+
+	Display coverage of several repositories as JSON, continuing past failures:
+		go-patch-cover -batch repos.json -keep-going
+
+	Display the aggregated coverage of a directory of per-repository coverage and diff files:
+		go-patch-cover -batch nightly/ -summary-only
+
+	Display coverage percentages to stdout and write them as JSON to a file:
+		go-patch-cover -json-out coverage.json coverage.out patch.diff
+
+	Display the uncovered added lines as JSON to stdout:
+		go-patch-cover -o uncovered coverage.out patch.diff
+
+	Display only the changed lines in the cover HTML viewer:
+		go-patch-cover -o profile-subset coverage.out patch.diff > patch.out
+		go tool cover -html patch.out
+
+	Comment the coverage on a pull request with the GitHub CLI:
+		go-patch-cover -o comment coverage.out patch.diff | gh pr comment --body-file -
+
 	Display patch coverage percentage to stdout by providing a custom template:
 		go-patch-cover -tmpl "{{ .PatchCoverage }}" coverage.out patch.diff
 `
 
-	_, _ = fmt.Fprint(os.Stdout, usage)
+	_, _ = fmt.Fprint(c.stdout, usage)
 }
 
-func (c *CoverCommand) Run(args []string) error {
+// config builds the patchcover configuration from the parsed flags.
+func (c *CoverCommand) config() patchcover.Config {
+	return patchcover.Config{
+		Excludes:               c.ExcludeFlag,
+		Includes:               c.IncludeFlag,
+		Pathspecs:              c.PathspecFlag,
+		CoverageIgnore:         c.coverageIgnore,
+		CodeOwners:             c.codeOwners,
+		ExcludeTests:           c.ExcludeTestsFlag,
+		Extensions:             splitList(c.ExtensionsFlag),
+		DetectModules:          c.ModulesFlag,
+		ModulePrefix:           c.ModulePrefixFlag,
+		ModuleDir:              c.ModuleDirFlag,
+		GoModFile:              c.GoModFlag,
+		Strict:                 c.StrictFlag,
+		StaleThreshold:         c.StaleFlag,
+		EmptyPatchCoverage:     c.EmptyPatchFlag,
+		UncoveredOut:           c.uncoveredOut(),
+		CoveredOut:             c.CoveredOutFlag,
+		Precision:              c.PrecisionFlag,
+		Concurrency:            c.ConcurrencyFlag,
+		CacheDir:               c.CacheDirFlag,
+		Deadline:               c.DeadlineFlag,
+		Variants:               c.VariantFlag,
+		Suites:                 c.CovFlag,
+		ProfileMode:            c.ProfileModeFlag,
+		CoverageFormat:         c.CovFormatFlag,
+		TotalMinHits:           c.TotalMinHitsFlag,
+		PatchMinHits:           c.PatchMinHitsFlag,
+		Packages:               c.PackagesFlag || c.PerPackageFlag.set,
+		TrimGeneratedFromTotal: c.TrimGenFlag,
+		StrictPercentages:      c.StrictPctFlag,
+		Regressions:            c.RegressionsFlag,
+		PatchOnly:              c.PatchOnlyFlag,
+		SkipEmbeddedData:       c.SkipEmbeddedFlag,
+		SkipDeprecated:         c.DeprecatedFlag,
+		SkipGenerated:          c.SkipGenFlag,
+		IgnoreFile:             c.IgnoreFileFlag,
+		IgnoreMarkers:          c.IgnoreMarkerFlag,
+		SkipFormatOnly:         c.FormatOnlyFlag,
+		FunctionBodiesOnly:     c.FuncBodiesFlag,
+		WeightByComplexity:     c.WeightFlag,
+		ChangedFunctions:       c.ChangedFuncsFlag,
+		Files:                  c.ByFileFlag || c.MinFilePatchFlag.set || c.compareMode() == "changed-files",
+		RedactSource:           c.RedactFlag,
+		GroupUncoveredRanges:   c.GroupRangesFlag,
+		UncoveredContext:       c.ContextFlag,
+		UncoveredHunks:         c.HunkFlag,
+	}
+}
+
+func (c *CoverCommand) Run(args []string) (err error) {
 	if err := c.fs.Parse(args); err != nil {
 		return fmt.Errorf("flag parse error: %v", err)
 	}
@@ -97,38 +1151,748 @@ func (c *CoverCommand) Run(args []string) error {
 	}
 
 	if c.VersionFlag {
-		fmt.Println(c.version)
+		fmt.Fprintln(c.stdout, c.version)
 		return nil
 	}
 
+	if c.ChdirFlag != "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if err := os.Chdir(c.ChdirFlag); err != nil {
+			return fmt.Errorf("-C: %w", err)
+		}
+		// Restored for callers running several commands, e.g. tests.
+		defer os.Chdir(wd)
+	}
+
+	if c.EnvFileFlag != "" {
+		if err := loadEnvFile(c.EnvFileFlag); err != nil {
+			return err
+		}
+	}
+	if err := c.applyLogLevel(); err != nil {
+		return err
+	}
+	if err := c.applyExcludeTests(); err != nil {
+		return err
+	}
+
+	if err := c.applySuite(); err != nil {
+		return err
+	}
+	if err := c.applyConfigFile(); err != nil {
+		return err
+	}
+	if err := c.applyCompareAgainstMain(); err != nil {
+		return err
+	}
+
+	var forbidRegex *regexp.Regexp
+	if c.ForbidRegexFlag != "" {
+		re, err := regexp.Compile(c.ForbidRegexFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -forbid-uncovered-regex: %w", err)
+		}
+		forbidRegex = re
+	}
+
+	if c.NoFileWriteFlag {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-out", c.OutFlag != ""},
+			{"-json-out", c.JSONOutFlag != ""},
+			{"-html-out", c.HTMLOutFlag != ""},
+			{"-cache-dir", c.CacheDirFlag != ""},
+			{"-fetch", c.FetchFlag},
+			{"-cpuprofile", c.CPUProfileFlag != ""},
+			{"-memprofile", c.MemProfileFlag != ""},
+			{"-uncovered-out", c.isSet("uncovered-out") && c.UncoveredOutFlag != ""},
+			{"-covered-out", c.CoveredOutFlag != ""},
+		} {
+			if f.set {
+				return fmt.Errorf("-no-filewrite cannot be used with %s, which writes files", f.name)
+			}
+		}
+	}
+
+	stopProfiles, err := c.startProfiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if stopErr := stopProfiles(); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}()
+
+	if _, ok := patchcover.LookupFormatter(c.OutputFlag); !ok {
+		return fmt.Errorf("unknown output format %q, expected one of: %s", c.OutputFlag, strings.Join(patchcover.Formatters(), ", "))
+	}
+
+	if c.OutFlag != "" {
+		out := &outFile{path: c.OutFlag}
+		c.stdout = out
+		defer func() {
+			if closeErr := out.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	if _, err := newEncodingWriter(io.Discard, c.EncodingFlag); err != nil {
+		return err
+	}
+
+	if c.CoberturaPatchFlag && c.OutputFlag != "cobertura" {
+		return fmt.Errorf("-cobertura-patch-only requires -o cobertura")
+	}
+
+	if c.MissingPrevFlag && c.compareMode() != "changed-files" {
+		return fmt.Errorf("-ignore-missing-prev-files requires -compare-mode changed-files")
+	}
+
+	if c.CompareModeFlag != "" {
+		if !c.MinDeltaFlag.explicit() {
+			return fmt.Errorf("-compare-mode requires -min-delta")
+		}
+		valid := false
+		for _, m := range compareModes {
+			valid = valid || m == c.CompareModeFlag
+		}
+		if !valid {
+			return fmt.Errorf("invalid -compare-mode %q, expected one of: %s", c.CompareModeFlag, strings.Join(compareModes, ", "))
+		}
+	}
+
+	if c.RedactFlag && c.OutputFlag == "diff" {
+		return fmt.Errorf("-redact-source cannot be used with -o diff, which prints the patch")
+	}
+	if c.RedactFlag && forbidRegex != nil {
+		return fmt.Errorf("-redact-source and -forbid-uncovered-regex are mutually exclusive")
+	}
+
+	var failMessage *template.Template
+	if c.FailMessageFlag != "" {
+		tmpl, err := template.New("fail-message").Parse(c.FailMessageFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -fail-message-tmpl: %w", err)
+		}
+		failMessage = tmpl
+	}
+
+	if len(c.SourceFlag) > 0 {
+		return c.runSources()
+	}
+
+	if c.ModuleDirFlag != "" && c.ModulePrefixFlag == "" {
+		return fmt.Errorf("-module-dir requires -module-prefix")
+	}
+	if c.ReviewFlag && c.PRFlag <= 0 {
+		return fmt.Errorf("-review requires -pr")
+	}
+	if c.MaxCommentsFlag < 0 {
+		return fmt.Errorf("invalid -review-max-comments %d, expected 0 or more", c.MaxCommentsFlag)
+	}
+	if c.GHCommentFlag {
+		if err := c.checkComment(); err != nil {
+			return err
+		}
+	}
+	if c.GHStatusFlag {
+		if os.Getenv("GITHUB_SHA") == "" {
+			return fmt.Errorf("-gh-status requires GITHUB_SHA")
+		}
+		if os.Getenv("GITHUB_TOKEN") == "" {
+			return fmt.Errorf("-gh-status requires GITHUB_TOKEN")
+		}
+	}
+
+	if err := c.readCoverageIgnore(); err != nil {
+		return err
+	}
+	if err := c.readCodeOwners(); err != nil {
+		return err
+	}
+
+	if c.KeepGoingFlag && c.BatchFlag == "" {
+		return fmt.Errorf("-keep-going requires -batch")
+	}
+	if c.SummaryOnlyFlag && c.BatchFlag == "" {
+		return fmt.Errorf("-summary-only requires -batch")
+	}
+	if c.BatchFlag != "" {
+		return c.runBatch()
+	}
+
 	covFile := c.fs.Arg(0)
 	if covFile == "" {
 		return fmt.Errorf("missing coverage file argument")
 	}
-	diffFile := c.fs.Arg(1)
+
+	if c.DebugPathsFlag {
+		return patchcover.New(c.config()).DumpPaths(c.stdout, covFile, c.fs.Arg(1))
+	}
+	if c.DoctorFlag {
+		return c.runDoctor(covFile, c.fs.Arg(1))
+	}
+
+	coverage, err := c.compute(covFile)
+	if err != nil {
+		return fmt.Errorf("processing error: %w", err)
+	}
+	coverage.ToolVersion = c.version
+	c.logInputs(coverage)
+	if c.BlameFlag {
+		if err := blameUncovered("", &coverage); err != nil {
+			return fmt.Errorf("blame: %w", err)
+		}
+	}
+	c.fs.Visit(func(f *flag.Flag) {
+		if f.Name == "no-prev-coverage-text" {
+			coverage.NoPrevCoverageText = &c.NoPrevFlag
+		}
+	})
+
+	gates := c.evaluateGates(coverage, forbidRegex)
+	if err := c.output(coverage, gates); err != nil {
+		return err
+	}
+	if coverage.Stale {
+		c.logf(logInfo, "warning: %d added lines of files matching a coverage profile are in none of its blocks, the profile and diff are likely of different revisions", coverage.PatchUnmatchedLines)
+	}
+	for _, r := range coverage.Regressions {
+		c.logf(logInfo, "warning: %s:%d is not covered anymore (previously line %d)", r.FileName, r.LineNum, r.PrevLineNum)
+	}
+	if c.ShowRegenFlag && coverage.Mode != "" && covFile != "-" {
+		c.logf(logInfo, "regenerate %s with: %s", covFile, regenCommand(coverage.Mode, covFile))
+	}
+
+	if c.JSONOutFlag != "" {
+		if err := c.writeJSONFile(coverage); err != nil {
+			return err
+		}
+	}
+	if c.HTMLOutFlag != "" {
+		if err := c.writeHTMLFile(coverage); err != nil {
+			return err
+		}
+	}
+
+	if !c.NoFileWriteFlag {
+		if err := writeActionsOutputs(coverage); err != nil {
+			return err
+		}
+	}
+
+	if c.ReviewFlag {
+		if err := c.postReview(coverage); err != nil {
+			return err
+		}
+	}
+	if c.GHCommentFlag {
+		if err := c.postComment(coverage); err != nil {
+			return err
+		}
+	}
+
+	if c.GHStatusFlag {
+		if err := c.postStatus(coverage, gates); err != nil {
+			return err
+		}
+	}
+
+	err = gatesError(gates)
+
+	if webhook := c.slackWebhook(); webhook != "" {
+		if err := c.postSlack(webhook, coverage, err == nil); err != nil {
+			return err
+		}
+	}
+
+	if len(gates) == 0 {
+		return nil
+	}
+	if c.logLevel >= logInfo {
+		if err := writeGateTable(c.stderr, gates); err != nil {
+			return err
+		}
+	}
+	if err != nil && failMessage != nil {
+		return failMessageError(failMessage, coverage, gates)
+	}
+	return err
+}
+
+// runSources reports which of the -source test types cover each added line.
+func (c *CoverCommand) runSources() error {
+	diffFile := c.fs.Arg(0)
 	if diffFile == "" {
 		return fmt.Errorf("missing diff file argument")
 	}
-	prevCovFile := c.fs.Arg(2)
 
-	coverage, err := patchcover.ProcessFiles(covFile, diffFile, prevCovFile)
+	lines, err := patchcover.New(c.config()).CompareSources(diffFile, c.SourceFlag)
 	if err != nil {
 		return fmt.Errorf("processing error: %w", err)
 	}
 
 	if c.OutputFlag == "json" {
-		enc := json.NewEncoder(os.Stdout)
-		err := enc.Encode(coverage)
-		if err != nil {
+		if err := c.jsonEncoder(c.stdout).Encode(lines); err != nil {
 			return fmt.Errorf("json output error: %w", err)
 		}
 		return nil
 	}
 
-	err = patchcover.RenderTemplateOutput(coverage, c.TemplateFlag, os.Stdout)
+	for _, l := range lines {
+		coveredBy := "none"
+		if len(l.CoveredBy) > 0 {
+			coveredBy = strings.Join(l.CoveredBy, ", ")
+		}
+		fmt.Fprintf(c.stdout, "%s:%d [%s]: %s\n", l.FileName, l.LineNum, coveredBy, strings.TrimSpace(l.LineString))
+	}
+	return nil
+}
+
+func (c *CoverCommand) compute(covFile string) (patchcover.CoverageData, error) {
+	computer := patchcover.New(c.config())
+
+	diffs := diffList(c.DiffFlag)
+	prevArg := 2 // coverage_file diff_file [previous_coverage_file]
+	if c.PRFlag > 0 || c.SinceTagFlag || c.BaseFlag != "" || c.StashFlag != "" || c.FilesFromFlag != "" || len(diffs) > 0 {
+		prevArg = 1
+	}
+	prevFile, err := c.prevCoverageFile(c.fs.Arg(prevArg))
+	if err != nil {
+		return patchcover.CoverageData{}, err
+	}
+	if list := diffList([]string{c.fs.Arg(1)}); prevArg == 2 && len(list) > 1 {
+		// A diff_file list, combined as several -diff.
+		diffs = list
+	}
+
+	if covFile == "-" && (c.FilesFromFlag != "" || len(diffs) > 0 || prevArg == 2 && c.fs.Arg(1) == "") {
+		return patchcover.CoverageData{}, fmt.Errorf("reading coverage_file from stdin requires a diff")
+	}
+	if covFile == "-" && c.fs.Arg(1) == "-" && prevArg == 2 {
+		return patchcover.CoverageData{}, fmt.Errorf("coverage_file and diff_file cannot both be read from stdin")
+	}
+
+	if c.DiffOpFlag != "" && len(diffs) < 2 {
+		return patchcover.CoverageData{}, fmt.Errorf("-diff-op requires several -diff")
+	}
+	if len(diffs) > 0 {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-pr", c.PRFlag > 0},
+			{"-base", c.BaseFlag != ""},
+			{"-since-tag", c.SinceTagFlag},
+			{"-stash", c.StashFlag != ""},
+			{"-files-from", c.FilesFromFlag != ""},
+		} {
+			if f.set {
+				return patchcover.CoverageData{}, fmt.Errorf("-diff cannot be used with %s", f.name)
+			}
+		}
+		op := c.DiffOpFlag
+		if op == "" {
+			op = "union"
+		}
+		if op != "union" && op != "intersect" {
+			return patchcover.CoverageData{}, fmt.Errorf("invalid -diff-op %q, expected union or intersect", op)
+		}
+		return computer.ComputeFromDiffs(diffs, op, covFile, prevFile)
+	}
+
+	if c.PRFlag > 0 {
+		client, err := newGitHubClientFromEnv()
+		if err != nil {
+			return patchcover.CoverageData{}, err
+		}
+		diff, err := client.pullRequestDiff(c.PRFlag)
+		if err != nil {
+			return patchcover.CoverageData{}, err
+		}
+		return c.computeDiff(computer, strings.NewReader(diff), covFile, prevFile)
+	}
+
+	if c.HeadFlag != "" && c.BaseFlag == "" {
+		return patchcover.CoverageData{}, fmt.Errorf("-head requires -base")
+	}
+	if c.MergeBaseFlag && c.BaseFlag == "" {
+		return patchcover.CoverageData{}, fmt.Errorf("-merge-base requires -base")
+	}
+	if c.FetchFlag && !c.MergeBaseFlag {
+		return patchcover.CoverageData{}, fmt.Errorf("-fetch requires -merge-base")
+	}
+	if c.SinceTagFlag && c.BaseFlag != "" {
+		return patchcover.CoverageData{}, fmt.Errorf("-since-tag and -base are mutually exclusive")
+	}
+	if c.StashFlag != "" && (c.SinceTagFlag || c.BaseFlag != "") {
+		return patchcover.CoverageData{}, fmt.Errorf("-stash is exclusive with -base and -since-tag")
+	}
+	if c.StashFlag != "" {
+		diff, err := gitStashDiff("", c.StashFlag)
+		if err != nil {
+			return patchcover.CoverageData{}, err
+		}
+		return c.computeDiff(computer, strings.NewReader(diff), covFile, prevFile)
+	}
+	if c.SinceTagFlag {
+		tag, err := gitLatestTag("")
+		if err != nil {
+			return patchcover.CoverageData{}, err
+		}
+		diff, err := gitDiff("", tag, false, false)
+		if err != nil {
+			return patchcover.CoverageData{}, err
+		}
+		return c.computeDiff(computer, strings.NewReader(diff), covFile, prevFile)
+	}
+	if c.BaseFlag != "" {
+		diff, err := gitRangeDiff("", c.BaseFlag, c.HeadFlag, c.MergeBaseFlag, c.FetchFlag)
+		if err != nil {
+			return patchcover.CoverageData{}, err
+		}
+		return c.computeDiff(computer, strings.NewReader(diff), covFile, prevFile)
+	}
+
+	if c.FilesFromFlag != "" {
+		fileNames, err := readFileList(c.FilesFromFlag)
+		if err != nil {
+			return patchcover.CoverageData{}, err
+		}
+		return computer.ComputeWholeFiles(covFile, fileNames, prevFile)
+	}
+
+	switch diffFile := c.fs.Arg(1); {
+	case diffFile == "-":
+		return c.computeDiff(computer, c.stdin, covFile, prevFile)
+	case covFile == "-":
+		f, err := os.Open(diffFile)
+		if err != nil {
+			return patchcover.CoverageData{}, &patchcover.FileError{Arg: "diff", Path: diffFile, Err: err}
+		}
+		defer f.Close()
+		return c.computeDiff(computer, f, covFile, prevFile)
+	}
+
+	// Without diff_file, only the total coverage is computed.
+	return computer.ComputeFromFiles(covFile, c.fs.Arg(1), prevFile)
+}
+
+// computeDiff computes the coverage of the patch read from diff, reading
+// the coverage profile from stdin when covFile is "-".
+func (c *CoverCommand) computeDiff(computer *patchcover.Computer, diff io.Reader, covFile, prevFile string) (patchcover.CoverageData, error) {
+	if covFile != "-" {
+		return computer.ComputeFromDiffReader(diff, covFile, prevFile)
+	}
+	var prev io.Reader
+	if prevFile != "" {
+		f, err := os.Open(prevFile)
+		if err != nil {
+			return patchcover.CoverageData{}, &patchcover.FileError{Arg: "previous coverage", Path: prevFile, Err: err}
+		}
+		defer f.Close()
+		prev = f
+	}
+	return computer.ComputeFromReaders(c.stdin, diff, prev)
+}
+
+// uncoveredOut returns the file the uncovered lines report is written to,
+// -uncovered-out, or "" with -no-filewrite.
+func (c *CoverCommand) uncoveredOut() string {
+	if c.NoFileWriteFlag {
+		return ""
+	}
+	return c.UncoveredOutFlag
+}
+
+// isSet reports whether the flag name was set on the command line.
+func (c *CoverCommand) isSet(name string) bool {
+	set := false
+	c.fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// applyExcludeTests sets -exclude-tests, when not set on the command line,
+// of the EXCLUDE_TESTS environment variable.
+func (c *CoverCommand) applyExcludeTests() error {
+	v := os.Getenv("EXCLUDE_TESTS")
+	if v == "" || c.isSet("exclude-tests") {
+		return nil
+	}
+	exclude, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid EXCLUDE_TESTS %q, expected true or false", v)
+	}
+	c.ExcludeTestsFlag = exclude
+	return nil
+}
+
+// regenCommand returns the go test command writing a coverage profile of
+// all packages in mode to covFile.
+func regenCommand(mode, covFile string) string {
+	return fmt.Sprintf("go test -covermode=%s -coverprofile=%s ./...", mode, covFile)
+}
+
+// codeOwnersPaths are the locations GitHub looks CODEOWNERS files up, in
+// order.
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// readCodeOwners reads the -codeowners file with -by-owner, or the first
+// CODEOWNERS file found.
+func (c *CoverCommand) readCodeOwners() error {
+	if !c.ByOwnerFlag {
+		if c.CodeOwnersFlag != "" {
+			return fmt.Errorf("-codeowners requires -by-owner")
+		}
+		return nil
+	}
+	paths := codeOwnersPaths
+	if c.CodeOwnersFlag != "" {
+		paths = []string{c.CodeOwnersFlag}
+	}
+	for _, p := range paths {
+		content, err := os.ReadFile(p)
+		if errors.Is(err, fs.ErrNotExist) && c.CodeOwnersFlag == "" {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading codeowners file: %w", err)
+		}
+		c.codeOwners = strings.Split(string(content), "\n")
+		return nil
+	}
+	return fmt.Errorf("-by-owner requires a CODEOWNERS file, none of %s found", strings.Join(codeOwnersPaths, ", "))
+}
+
+// readCoverageIgnore reads the patterns of the -coverageignore file. The
+// default file is skipped when missing.
+func (c *CoverCommand) readCoverageIgnore() error {
+	content, err := os.ReadFile(c.CoverageIgnoreFlag)
 	if err != nil {
+		set := false
+		c.fs.Visit(func(f *flag.Flag) { set = set || f.Name == "coverageignore" })
+		if errors.Is(err, fs.ErrNotExist) && !set {
+			return nil
+		}
+		return fmt.Errorf("reading coverageignore file: %w", err)
+	}
+	c.coverageIgnore = strings.Split(string(content), "\n")
+	return nil
+}
+
+// applyCompareAgainstMain sets, with -compare-against-main, -base and
+// -prev-artifact-branch to the base branch, GITHUB_BASE_REF or the
+// detected default branch, and -merge-base.
+func (c *CoverCommand) applyCompareAgainstMain() error {
+	if !c.AgainstMainFlag {
+		return nil
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"-base", c.BaseFlag != ""},
+		{"-pr", c.PRFlag > 0},
+		{"-since-tag", c.SinceTagFlag},
+		{"-stash", c.StashFlag != ""},
+		{"-files-from", c.FilesFromFlag != ""},
+	} {
+		if f.set {
+			return fmt.Errorf("-compare-against-main cannot be used with %s", f.name)
+		}
+	}
+	if c.PrevArtifactFlag == "" {
+		return fmt.Errorf("-compare-against-main requires -prev-artifact-dir")
+	}
+
+	branch, ref, err := gitBaseBranch("", os.Getenv("GITHUB_BASE_REF"))
+	if err != nil {
+		return fmt.Errorf("-compare-against-main: %w", err)
+	}
+	c.BaseFlag = ref
+	c.MergeBaseFlag = true
+	if c.PrevBranchFlag == "" {
+		c.PrevBranchFlag = branch
+	}
+	return nil
+}
+
+// prevCoverageFile returns the previous coverage file: arg, the
+// previous_coverage_file argument, or with -prev-artifact-dir the file
+// stored for the -prev-artifact-branch branch. It returns "" when no
+// file was stored for the branch yet.
+func (c *CoverCommand) prevCoverageFile(arg string) (string, error) {
+	if c.PrevArtifactFlag == "" {
+		if c.PrevBranchFlag != "" {
+			return "", fmt.Errorf("-prev-artifact-branch requires -prev-artifact-dir")
+		}
+		return arg, nil
+	}
+	if arg != "" {
+		return "", fmt.Errorf("-prev-artifact-dir and previous_coverage_file are mutually exclusive")
+	}
+
+	branch := c.PrevBranchFlag
+	if branch == "" {
+		branch = os.Getenv("GITHUB_BASE_REF")
+	}
+	if branch == "" {
+		return "", fmt.Errorf("-prev-artifact-dir requires -prev-artifact-branch or GITHUB_BASE_REF")
+	}
+
+	var fetcher patchcover.ArtifactFetcher = patchcover.LocalDirFetcher{Dir: c.PrevArtifactFlag}
+	name, err := fetcher.FetchProfile(branch)
+	if errors.Is(err, patchcover.ErrNoArtifact) {
+		return "", nil
+	}
+	return name, err
+}
+
+// commentTemplate returns the -comment-tmpl or -comment-tmpl-file
+// template, or "" for the default markdown comment.
+func (c *CoverCommand) commentTemplate() (string, error) {
+	if c.CommentTemplateFileFlag == "" {
+		return c.CommentTemplateFlag, nil
+	}
+	if c.CommentTemplateFlag != "" {
+		return "", fmt.Errorf("-comment-tmpl and -comment-tmpl-file are mutually exclusive")
+	}
+	tmpl, err := os.ReadFile(c.CommentTemplateFileFlag)
+	if err != nil {
+		return "", fmt.Errorf("reading comment template: %w", err)
+	}
+	return string(tmpl), nil
+}
+
+// jsonEncoder returns an encoder of JSON output to out, indented with
+// -json-pretty.
+func (c *CoverCommand) jsonEncoder(out io.Writer) *json.Encoder {
+	enc := json.NewEncoder(out)
+	if c.JSONPrettyFlag {
+		enc.SetIndent("", "  ")
+	}
+	return enc
+}
+
+// writeJSONFile writes the json output to the -json-out file, in addition
+// to the -o output.
+func (c *CoverCommand) writeJSONFile(coverage patchcover.CoverageData) error {
+	f, err := os.Create(c.JSONOutFlag)
+	if err != nil {
+		return fmt.Errorf("json output error: %w", err)
+	}
+	out, err := newEncodingWriter(f, c.EncodingFlag)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := c.jsonEncoder(out).Encode(coverage); err != nil {
+		f.Close()
 		return fmt.Errorf("json output error: %w", err)
 	}
+	return f.Close()
+}
+
+// writeHTMLFile writes the html report to the -html-out file, in addition
+// to the -o output.
+func (c *CoverCommand) writeHTMLFile(coverage patchcover.CoverageData) error {
+	f, err := os.Create(c.HTMLOutFlag)
+	if err != nil {
+		return fmt.Errorf("html output error: %w", err)
+	}
+	if err := patchcover.RenderHTMLOutput(coverage, f); err != nil {
+		f.Close()
+		return fmt.Errorf("html output error: %w", err)
+	}
+	return f.Close()
+}
+
+// splitList splits a comma separated list, dropping empty elements.
+func splitList(list string) []string {
+	var elems []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+// diffList returns the diff files of values, each a diff file or a comma
+// separated list of them. Values naming an existing file are taken whole,
+// so that file names holding a comma still work.
+func diffList(values []string) []string {
+	var files []string
+	for _, v := range values {
+		if _, err := os.Stat(v); err == nil || !strings.Contains(v, ",") {
+			files = append(files, v)
+			continue
+		}
+		files = append(files, splitList(v)...)
+	}
+	return files
+}
 
+// readFileList reads a newline delimited list of file names, ignoring
+// blank lines.
+func readFileList(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file list: %w", err)
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+func (c *CoverCommand) output(coverage patchcover.CoverageData, gates []gateResult) error {
+	stdout, err := newEncodingWriter(c.stdout, c.EncodingFlag)
+	if err != nil {
+		return err
+	}
+	opts, err := c.formatOptions(gates)
+	if err != nil {
+		return err
+	}
+
+	f, ok := patchcover.LookupFormatter(c.OutputFlag)
+	if !ok {
+		return fmt.Errorf("unknown output format %q", c.OutputFlag)
+	}
+	if err := f.Format(coverage, opts, stdout); err != nil {
+		return fmt.Errorf("%s output error: %w", c.OutputFlag, err)
+	}
 	return nil
 }
+
+// formatOptions returns the options of the output formats set by flags.
+// The gates are reported as test points of the tap format.
+func (c *CoverCommand) formatOptions(gates []gateResult) (patchcover.FormatOptions, error) {
+	commentTmpl, err := c.commentTemplate()
+	if err != nil {
+		return patchcover.FormatOptions{}, err
+	}
+	return patchcover.FormatOptions{
+		Template:           c.TemplateFlag,
+		CommentTemplate:    commentTmpl,
+		Indent:             c.JSONPrettyFlag,
+		CoberturaPatchOnly: c.CoberturaPatchFlag,
+		OmitProfileMode:    c.TrimModeFlag,
+		TAPResults:         tapGates(gates),
+	}, nil
+}
@@ -1,12 +1,1702 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	patchcover "github.com/srinidhis05/go-patch-cover"
+	"golang.org/x/tools/cover"
 	"gotest.tools/v3/assert"
 )
 
 func Test_newCoverCommand(t *testing.T) {
-	c := newCoverCommand("1.0.0")
+	c := newTestCommand(t)
 	assert.Assert(t, c != nil)
 }
+
+func TestCoverCommand_Run_minDelta(t *testing.T) {
+	const (
+		newFile    = "../../testdata/scenarios/new_file/coverage.out"    // 75% of statements
+		singleEdit = "../../testdata/scenarios/single_edit/coverage.out" // 88.2% of statements
+		diff       = "../../testdata/scenarios/new_file/diff.diff"
+	)
+
+	tests := map[string]struct {
+		args            []string
+		wantErrContains string
+	}{
+		"improving":  {args: []string{"-min-delta", "10", singleEdit, diff, newFile}},
+		"flat":       {args: []string{"-min-delta", "0", newFile, diff, newFile}},
+		"regressing": {args: []string{"-min-delta", "0", newFile, diff, singleEdit}, wantErrContains: "below the required minimum of 0.00%"},
+		"no prev":    {args: []string{"-min-delta", "0", newFile, diff}, wantErrContains: "requires a previous coverage file"},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c := newTestCommand(t)
+			var out bytes.Buffer
+			c.stdout = &out
+
+			err := c.Run(tt.args)
+			if tt.wantErrContains != "" {
+				assert.ErrorContains(t, err, tt.wantErrContains)
+			} else {
+				assert.NilError(t, err)
+			}
+			// Output is written before gates are evaluated.
+			assert.Assert(t, strings.Contains(out.String(), "patch coverage"))
+		})
+	}
+}
+
+func TestCoverCommand_Run_maxDrop(t *testing.T) {
+	const (
+		newFile    = "../../testdata/scenarios/new_file/coverage.out"    // 75% of statements
+		singleEdit = "../../testdata/scenarios/single_edit/coverage.out" // 88.2% of statements
+		diff       = "../../testdata/scenarios/new_file/diff.diff"
+	)
+
+	run := func(args ...string) error {
+		_, _, err := runCommand(t, append([]string{"-no-filewrite"}, args...)...)
+		return err
+	}
+	assert.NilError(t, run("-max-drop", "0", singleEdit, diff, newFile))
+	assert.NilError(t, run("-max-drop", "13.2", newFile, diff, singleEdit))
+	assert.ErrorContains(t, run("-max-drop", "0.5", newFile, diff, singleEdit), "max-drop: coverage dropped 13.2% (allowed 0.5%)")
+	assert.NilError(t, run("-max-drop", "0", newFile, diff))
+}
+
+func TestCoverCommand_Run_compareMode(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+	// The changed big.go and tiny.go are 4/6 covered, and the total 14/16.
+	covFile := write("coverage.out", `mode: set
+example.com/m/pkg/big.go:3.25,4.8 1 1
+example.com/m/pkg/big.go:4.8,6.3 1 1
+example.com/m/pkg/big.go:7.2,8.10 2 1
+example.com/m/pkg/tiny.go:3.18,6.2 2 0
+example.com/m/pkg/other.go:3.18,12.2 10 1
+`)
+	// tiny.go was covered: 6/6, with a total of 11/16 before.
+	prevFile := write("prev.out", `mode: set
+example.com/m/pkg/big.go:3.25,4.8 1 1
+example.com/m/pkg/big.go:4.8,6.3 1 1
+example.com/m/pkg/big.go:7.2,8.10 2 1
+example.com/m/pkg/tiny.go:3.18,6.2 2 1
+example.com/m/pkg/other.go:3.18,7.2 5 1
+example.com/m/pkg/other.go:8.2,12.2 5 0
+`)
+	// The same, with a total of 8/16 before.
+	lowPrevFile := write("low-prev.out", `mode: set
+example.com/m/pkg/big.go:3.25,4.8 1 1
+example.com/m/pkg/big.go:4.8,6.3 1 1
+example.com/m/pkg/big.go:7.2,8.10 2 1
+example.com/m/pkg/tiny.go:3.18,6.2 2 1
+example.com/m/pkg/other.go:3.18,5.2 2 1
+example.com/m/pkg/other.go:6.2,12.2 8 0
+`)
+	run := func(prev string, args ...string) error {
+		_, _, err := runCommand(t, append(append([]string{"-min-delta", "0"}, args...), covFile, "../../testdata/coverage-floor/diff.diff", prev)...)
+		return err
+	}
+
+	// Only the patch and changed files coverage regressed.
+	assert.NilError(t, run(prevFile))
+	assert.NilError(t, run(prevFile, "-compare-mode", "total"))
+	assert.ErrorContains(t, run(prevFile, "-compare-mode", "patch"), "min-delta: patch coverage delta -2.08% is below the required minimum of 0.00%")
+	assert.ErrorContains(t, run(prevFile, "-compare-mode", "changed-files"), "min-delta: changed files coverage delta -33.33% is below the required minimum of 0.00%")
+
+	// Only the changed files coverage regressed.
+	assert.NilError(t, run(lowPrevFile, "-compare-mode", "total"))
+	assert.NilError(t, run(lowPrevFile, "-compare-mode", "patch"))
+	assert.ErrorContains(t, run(lowPrevFile, "-compare-mode", "changed-files"), "changed files coverage delta -33.33%")
+
+	// tiny.go, uncovered, did not exist before.
+	newFilePrev := write("new-file-prev.out", `mode: set
+example.com/m/pkg/big.go:3.25,4.8 1 1
+example.com/m/pkg/big.go:4.8,6.3 1 1
+example.com/m/pkg/big.go:7.2,8.10 2 1
+example.com/m/pkg/other.go:3.18,12.2 10 1
+`)
+	assert.ErrorContains(t, run(newFilePrev, "-compare-mode", "changed-files"), "changed files coverage delta -33.33%")
+	assert.NilError(t, run(newFilePrev, "-compare-mode", "changed-files", "-ignore-missing-prev-files"))
+	// Files of the previous coverage are still compared.
+	assert.ErrorContains(t, run(prevFile, "-compare-mode", "changed-files", "-ignore-missing-prev-files"), "changed files coverage delta -33.33%")
+	assert.ErrorContains(t, run(newFilePrev, "-ignore-missing-prev-files"), "-ignore-missing-prev-files requires -compare-mode changed-files")
+
+	assert.ErrorContains(t, run(prevFile, "-compare-mode", "package"), `invalid -compare-mode "package", expected one of: total, patch, changed-files`)
+	c := newTestCommand(t)
+	assert.ErrorContains(t, c.Run([]string{"-compare-mode", "patch", covFile}), "-compare-mode requires -min-delta")
+}
+
+func TestCoverCommand_Run_covFormat(t *testing.T) {
+	const cov, diff = "../../testdata/lcov/coverage.info", "../../testdata/lcov/diff.diff"
+	run := func(stdin string, args ...string) (patchcover.CoverageData, error) {
+		c := newTestCommand(t)
+		c.stdin = strings.NewReader(stdin)
+		out, _, err := runCommandOn(c, append([]string{"-no-filewrite", "-o", "json", "-extensions", ".py"}, args...)...)
+		if err != nil {
+			return patchcover.CoverageData{}, err
+		}
+		return decodeCoverage(t, out), nil
+	}
+
+	data, err := run("", cov, diff)
+	assert.NilError(t, err)
+	assert.Equal(t, data.PatchCoverCount, 2)
+	assert.Equal(t, data.PatchNumStmt, 3)
+
+	// stdin has no extension to detect lcov from.
+	content, err := os.ReadFile(cov)
+	assert.NilError(t, err)
+	_, err = run(string(content), "-", diff)
+	assert.ErrorContains(t, err, "bad mode line")
+	data, err = run(string(content), "-cov-format", "lcov", "-", diff)
+	assert.NilError(t, err)
+	assert.Equal(t, data.PatchCoverCount, 2)
+}
+
+func TestCoverCommand_Run_stdin(t *testing.T) {
+	const cov, diff = "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"
+	run := func(stdin string, args ...string) (string, error) {
+		c := newTestCommand(t)
+		c.stdin = strings.NewReader(stdin)
+		out, _, err := runCommandOn(c, append([]string{"-no-filewrite", "-o", "json"}, args...)...)
+		return out, err
+	}
+	read := func(name string) string {
+		content, err := os.ReadFile(name)
+		assert.NilError(t, err)
+		return string(content)
+	}
+
+	want, err := run("", cov, diff, cov)
+	assert.NilError(t, err)
+	got, err := run(read(diff), cov, "-", cov)
+	assert.NilError(t, err)
+	assert.Equal(t, got, want)
+	got, err = run(read(cov), "-", diff, cov)
+	assert.NilError(t, err)
+	assert.Equal(t, got, want)
+
+	_, err = run("", "-", "-")
+	assert.Error(t, err, "processing error: coverage_file and diff_file cannot both be read from stdin")
+	_, err = run(read(cov), "-")
+	assert.Error(t, err, "processing error: reading coverage_file from stdin requires a diff")
+}
+
+func TestCoverCommand_Run_diffOp(t *testing.T) {
+	const cov, diff = "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"
+	run := func(args ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, append([]string{"-no-filewrite"}, args...)...)
+	}
+
+	// A diff intersected with itself is unchanged, and the previous
+	// coverage follows the coverage file.
+	data, err := run("-diff", diff, "-diff", diff, "-diff-op", "intersect", cov, cov)
+	assert.NilError(t, err)
+	assert.Equal(t, data.PatchNumStmt, 8)
+	assert.Equal(t, data.PatchCoverCount, 6)
+	assert.Assert(t, data.HasPrevCoverage)
+	data, err = run("-diff", diff, cov)
+	assert.NilError(t, err)
+	assert.Equal(t, data.PatchNumStmt, 8)
+
+	_, err = run("-diff", diff, "-diff-op", "intersect", cov)
+	assert.Error(t, err, "processing error: -diff-op requires several -diff")
+	_, err = run("-diff", diff, "-diff", diff, "-diff-op", "xor", cov)
+	assert.Error(t, err, `processing error: invalid -diff-op "xor", expected union or intersect`)
+	_, err = run("-diff", diff, "-base", "main", cov)
+	assert.Error(t, err, "processing error: -diff cannot be used with -base")
+}
+
+func TestCoverCommand_Run_diffList(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		assert.NilError(t, os.WriteFile(p, []byte(content), 0o644))
+		return p
+	}
+	cov := write("coverage.out", "mode: set\n"+
+		"example.com/m/a.go:3.2,3.10 1 1\n"+
+		"example.com/m/a.go:4.2,4.10 1 0\n"+
+		"example.com/m/a.go:6.2,6.10 1 1\n")
+	// Non-overlapping hunks of the same file, in two diffs.
+	first := write("first.diff", "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -2,0 +3,2 @@\n+\tx := 1\n+\ty := 2\n")
+	second := write("second.diff", "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -5,0 +6 @@\n+\tz := 3\n")
+	run := func(args ...string) patchcover.CoverageData {
+		t.Helper()
+		data, err := runCommandJSON(t, append([]string{"-no-filewrite"}, args...)...)
+		assert.NilError(t, err)
+		return data
+	}
+
+	assert.Equal(t, run(cov, first).PatchNumStmt, 2)
+	assert.Equal(t, run(cov, second).PatchNumStmt, 1)
+
+	// The patch coverage of the lists is the sum of their diffs.
+	for _, args := range [][]string{
+		{"-diff", first + "," + second, cov},
+		{"-diff", first, "-diff", second, cov},
+		{cov, first + "," + second},
+	} {
+		data := run(args...)
+		assert.Equal(t, data.PatchNumStmt, 3, args)
+		assert.Equal(t, data.PatchCoverCount, 2, args)
+	}
+
+	// A file whose name holds a comma is not a list.
+	comma := write("first,second.diff", "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -5,0 +6 @@\n+\tz := 3\n")
+	assert.Equal(t, run(cov, comma).PatchNumStmt, 1)
+}
+
+func TestCoverCommand_Run_pathspecs(t *testing.T) {
+	run := func(args ...string) patchcover.CoverageData {
+		t.Helper()
+		data, err := runCommandJSON(t, append(args, "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff")...)
+		assert.NilError(t, err)
+		return data
+	}
+
+	assert.Equal(t, run("-path", "testdata/**").PatchNumStmt, 8)
+	assert.Equal(t, run("-path", "testdata/**", "-path", ":!**/func1.go").PatchNumStmt, 0)
+}
+
+func TestCoverCommand_Run_modulePrefix(t *testing.T) {
+	dir := t.TempDir()
+	profile := filepath.Join(dir, "coverage.out")
+	assert.NilError(t, os.WriteFile(profile, []byte("mode: set\n"+
+		"github.com/org/repo/pkg/x.go:3.14,5.2 1 1\n"+
+		"github.com/org/repo/svc/pkg/x.go:3.14,5.2 1 0\n"), 0o644))
+	diff := filepath.Join(dir, "diff.diff")
+	assert.NilError(t, os.WriteFile(diff, []byte("diff --git a/pkg/x.go b/pkg/x.go\n--- a/pkg/x.go\n+++ b/pkg/x.go\n@@ -4 +4 @@\n-\treturn 0\n+\treturn 1\n"), 0o644))
+
+	run := func(args ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, append(append([]string{"-no-filewrite"}, args...), profile, diff)...)
+	}
+
+	// By suffix, pkg/x.go matches the file of the svc directory too.
+	data, err := run()
+	assert.NilError(t, err)
+	assert.Equal(t, data.PatchNumStmt, 2)
+
+	data, err = run("-module-prefix", "github.com/org/repo")
+	assert.NilError(t, err)
+	assert.Equal(t, data.PatchNumStmt, 1)
+	assert.Equal(t, data.PatchCoverCount, 1)
+
+	_, err = run("-module-dir", "svc")
+	assert.Error(t, err, "-module-dir requires -module-prefix")
+}
+
+func TestCoverCommand_Run_excludeTests(t *testing.T) {
+	t.Setenv("EXCLUDE_TESTS", "")
+	run := func(args ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, append(append([]string{"-no-filewrite"}, args...), "../../testdata/test-files/coverage.out", "../../testdata/test-files/diff.diff")...)
+	}
+
+	data, err := run()
+	assert.NilError(t, err)
+	assert.Equal(t, data.NumStmt, 2)
+	assert.Equal(t, data.PatchNumStmt, 2)
+
+	// Only pkg/sum.go is counted, the test file it adds is not.
+	data, err = run("-exclude-tests")
+	assert.NilError(t, err)
+	assert.Equal(t, data.NumStmt, 1)
+	assert.Equal(t, data.PatchNumStmt, 1)
+	assert.Equal(t, data.PatchCoverCount, 1)
+
+	t.Setenv("EXCLUDE_TESTS", "true")
+	data, err = run()
+	assert.NilError(t, err)
+	assert.Equal(t, data.PatchNumStmt, 1)
+
+	data, err = run("-exclude-tests=false")
+	assert.NilError(t, err)
+	assert.Equal(t, data.PatchNumStmt, 2)
+
+	t.Setenv("EXCLUDE_TESTS", "sometimes")
+	_, err = run()
+	assert.Error(t, err, `invalid EXCLUDE_TESTS "sometimes", expected true or false`)
+}
+
+func TestCoverCommand_Run_stale(t *testing.T) {
+	dir := t.TempDir()
+	profile := filepath.Join(dir, "coverage.out")
+	// Profiled before the function the diff adds.
+	assert.NilError(t, os.WriteFile(profile, []byte("mode: set\nexample.com/m/pkg/x.go:3.14,5.2 1 1\n"), 0o644))
+	diff := filepath.Join(dir, "diff.diff")
+	assert.NilError(t, os.WriteFile(diff, []byte("diff --git a/pkg/x.go b/pkg/x.go\n--- a/pkg/x.go\n+++ b/pkg/x.go\n@@ -8,0 +9,4 @@\n+\n+func G() int {\n+\treturn 1\n+}\n"), 0o644))
+
+	run := func(args ...string) (string, error) {
+		_, stderr, err := runCommand(t, append(append([]string{"-no-filewrite"}, args...), profile, diff)...)
+		return stderr, err
+	}
+
+	stderr, err := run()
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(stderr, "warning: 2 added lines of files matching a coverage profile are in none of its blocks"), stderr)
+
+	stderr, err = run("-stale-threshold", "1")
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(stderr, "warning"), stderr)
+
+	_, err = run("-strict")
+	assert.ErrorContains(t, err, "the profile and diff are likely of different revisions")
+}
+
+func TestCoverCommand_Run_uncoveredOutput(t *testing.T) {
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-o", "uncovered", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+
+	var lines []map[string]interface{}
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &lines))
+	assert.DeepEqual(t, lines, []map[string]interface{}{{
+		"file":     "github.com/seriousben/go-patch-cover/testdata/test-project/func1.go",
+		"line":     float64(15),
+		"code":     "\t\tfmt.Println(\"bool2\", bool2)",
+		"num_stmt": float64(2),
+	}})
+}
+
+func TestCoverCommand_Run_redactSource(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	coverage := filepath.Join(wd, "../../testdata/scenarios/new_file/coverage.out")
+	diff := filepath.Join(wd, "../../testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	for _, output := range []string{"template", "json", "ndjson", "uncovered", "clover", "comment"} {
+		c := newCoverCommand("1.0.0")
+		var out bytes.Buffer
+		c.stdout = &out
+		assert.NilError(t, c.Run([]string{"-redact-source", "-o", output, coverage, diff}))
+
+		report, err := os.ReadFile("uncovered_lines.txt")
+		assert.NilError(t, err)
+		for _, s := range []string{out.String(), string(report)} {
+			assert.Assert(t, !strings.Contains(s, "bool2"), "%s output: %s", output, s)
+		}
+		// The location of the uncovered line is kept.
+		assert.Assert(t, strings.Contains(out.String()+string(report), "15"), "%s output: %s", output, out.String())
+	}
+
+	c := newTestCommand(t)
+	assert.ErrorContains(t, c.Run([]string{"-redact-source", "-o", "diff", coverage, diff}), "cannot be used with -o diff")
+	c = newTestCommand(t)
+	assert.ErrorContains(t, c.Run([]string{"-redact-source", "-forbid-uncovered-regex", "panic", coverage, diff}), "mutually exclusive")
+}
+
+func TestCoverCommand_Run_packages(t *testing.T) {
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-packages",
+		"../../testdata/scenarios/new_file/coverage.out",
+		"../../testdata/scenarios/new_file/diff.diff",
+		"../../testdata/scenarios/single_edit/coverage.out",
+	})
+	assert.NilError(t, err)
+	// The previous coverage has its statements in the root package only.
+	assert.Assert(t, strings.Contains(out.String(), ""+
+		"package github.com/seriousben/go-patch-cover: 88.2% -> removed\n"+
+		"package github.com/seriousben/go-patch-cover/testdata/test-project: new -> 75.0%\n"), out.String())
+}
+
+func TestCoverCommand_Run_trimGeneratedWithoutGoMod(t *testing.T) {
+	c := newTestCommand(t)
+	c.stdout = io.Discard
+
+	// This directory holds no go.mod to map profile file names to files.
+	err := c.Run([]string{"-trim-generated-from-total",
+		"../../testdata/scenarios/new_file/coverage.out",
+		"../../testdata/scenarios/new_file/diff.diff",
+	})
+	assert.ErrorContains(t, err, "trimming generated files requires a module prefix or a go.mod in the working directory")
+}
+
+func TestCoverCommand_Run_groupUncovered(t *testing.T) {
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-group-uncovered", "-o", "json",
+		"../../testdata/scenarios/new_file/coverage.out",
+		"../../testdata/scenarios/new_file/diff.diff",
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(out.String(), `"uncovered_ranges":[{"file":"github.com/seriousben/go-patch-cover/testdata/test-project/func1.go","start_line":15,"end_line":15}]`), out.String())
+}
+
+func TestCoverCommand_Run_prevArtifactDir(t *testing.T) {
+	prev, err := os.ReadFile("../../testdata/scenarios/single_edit/coverage.out")
+	assert.NilError(t, err)
+	dir := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "main"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "main", "coverage.out"), prev, 0o644))
+
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(flags ...string) (string, error) {
+		out, _, err := runCommand(t, append(append(flags, "-tmpl", "{{ if .HasPrevCoverage }}{{ .PrevNumStmt }}{{ else }}unknown{{ end }}"), args...)...)
+		return out, err
+	}
+
+	out, err := run("-prev-artifact-dir", dir, "-prev-artifact-branch", "main")
+	assert.NilError(t, err)
+	assert.Equal(t, out, "34")
+
+	// The branch defaults to the base branch of GitHub pull requests.
+	t.Setenv("GITHUB_BASE_REF", "main")
+	out, err = run("-prev-artifact-dir", dir)
+	assert.NilError(t, err)
+	assert.Equal(t, out, "34")
+
+	// Branches without a stored file yet have no previous coverage.
+	out, err = run("-prev-artifact-dir", dir, "-prev-artifact-branch", "develop")
+	assert.NilError(t, err)
+	assert.Equal(t, out, "unknown")
+
+	c := newTestCommand(t)
+	err = c.Run(append([]string{"-prev-artifact-dir", dir}, append(args, "prev.out")...))
+	assert.Error(t, err, "processing error: -prev-artifact-dir and previous_coverage_file are mutually exclusive")
+}
+
+func TestCoverCommand_Run_noFileWrite(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	dir := t.TempDir()
+	for _, name := range []string{"coverage.out", "diff.diff"} {
+		content, err := os.ReadFile(filepath.Join(wd, "../../testdata/scenarios/new_file", name))
+		assert.NilError(t, err)
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), content, 0o644))
+	}
+	original, err := os.ReadFile(filepath.Join(dir, "coverage.out"))
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	c := newTestCommand(t)
+	c.stdout = io.Discard
+	err = c.Run([]string{"-no-filewrite", "-exclude", "*/func1.go", "coverage.out", "diff.diff"})
+	assert.NilError(t, err)
+
+	// Excludes apply to the parsed profiles, the coverage file is untouched
+	// and no report is written.
+	content, err := os.ReadFile("coverage.out")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), string(original))
+	entries, err := os.ReadDir(".")
+	assert.NilError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.DeepEqual(t, names, []string{"coverage.out", "diff.diff"})
+
+	c = newTestCommand(t)
+	err = c.Run([]string{"-no-filewrite", "-cache-dir", "cache", "coverage.out", "diff.diff"})
+	assert.Error(t, err, "-no-filewrite cannot be used with -cache-dir, which writes files")
+}
+
+func TestCoverCommand_Run_uncoveredOut(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	args := []string{filepath.Join(wd, "../../testdata/scenarios/new_file/coverage.out"), filepath.Join(wd, "../../testdata/scenarios/new_file/diff.diff")}
+	dir := t.TempDir()
+	assert.NilError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	run := func(args ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, args...)
+	}
+
+	report := filepath.Join(t.TempDir(), "report.txt")
+	data, err := run(append([]string{"-uncovered-out", report}, args...)...)
+	assert.NilError(t, err)
+	content, err := os.ReadFile(report)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), data.Uncovered_lines)
+	assert.Assert(t, strings.Contains(data.Uncovered_lines, "func1.go"), data.Uncovered_lines)
+
+	// Without a report file, the report is still part of the coverage.
+	data, err = run(append([]string{"-uncovered-out", ""}, args...)...)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(data.Uncovered_lines, "func1.go"), data.Uncovered_lines)
+	entries, err := os.ReadDir(".")
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+
+	_, err = run(append([]string{"-no-filewrite", "-uncovered-out", report}, args...)...)
+	assert.Error(t, err, "-no-filewrite cannot be used with -uncovered-out, which writes files")
+	_, err = run(append([]string{"-no-filewrite", "-uncovered-out", ""}, args...)...)
+	assert.NilError(t, err)
+
+	covered := filepath.Join(t.TempDir(), "covered.txt")
+	data, err = run(append([]string{"-uncovered-out", "", "-covered-out", covered}, args...)...)
+	assert.NilError(t, err)
+	assert.Equal(t, len(data.CoveredLines), 4)
+	content, err = os.ReadFile(covered)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(string(content), "<pre>\nCovered lines in github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:\n"), string(content))
+
+	_, err = run(append([]string{"-no-filewrite", "-covered-out", covered}, args...)...)
+	assert.Error(t, err, "-no-filewrite cannot be used with -covered-out, which writes files")
+}
+
+func TestCoverCommand_Run_emptyPrevCoverage(t *testing.T) {
+	prev := filepath.Join(t.TempDir(), "prev.out")
+	assert.NilError(t, os.WriteFile(prev, []byte("mode: set\n"), 0o644))
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff", prev}
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-o", "json"}, args...)))
+	assert.Assert(t, strings.Contains(out.String(), `"has_prev_coverage":false`), out.String())
+
+	c = newTestCommand(t)
+	out.Reset()
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-no-prev-coverage-text", ""}, args...)))
+	assert.Assert(t, strings.HasPrefix(out.String(), "new coverage: 75.0% of statements\n"), out.String())
+
+	c = newTestCommand(t)
+	out.Reset()
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-no-prev-coverage-text", "previous coverage: N/A"}, args...)))
+	assert.Assert(t, strings.HasPrefix(out.String(), "previous coverage: N/A\nnew coverage"), out.String())
+}
+
+func TestCoverCommand_Run_out(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"-no-prev-coverage-text", "", "-show-regen", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(args ...string) (string, string, error) {
+		return runCommand(t, args...)
+	}
+
+	// The output goes to the file alone, and the warnings to stderr.
+	report := filepath.Join(dir, "report.json")
+	stdout, stderr, err := run(append([]string{"-o", "json", "-out", report}, args...)...)
+	assert.NilError(t, err)
+	assert.Equal(t, stdout, "")
+	assert.Assert(t, strings.Contains(stderr, "regenerate"), stderr)
+	content, err := os.ReadFile(report)
+	assert.NilError(t, err)
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(content, &data))
+	assert.Equal(t, data.PatchCoverage, 75.0)
+
+	// Runs failing before any output create no file.
+	failed := filepath.Join(dir, "failed.txt")
+	_, _, err = run(append([]string{"-out", failed, "-review"}, args...)...)
+	assert.Error(t, err, "-review requires -pr")
+	_, err = os.Stat(failed)
+	assert.Assert(t, os.IsNotExist(err), err)
+
+	_, _, err = run(append([]string{"-out", filepath.Join(dir, "missing", "report.txt")}, args...)...)
+	assert.ErrorContains(t, err, "template output error")
+
+	_, _, err = run(append([]string{"-no-filewrite", "-out", report}, args...)...)
+	assert.Error(t, err, "-no-filewrite cannot be used with -out, which writes files")
+}
+
+func TestCoverCommand_Run_jsonOut(t *testing.T) {
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	jsonOut := filepath.Join(t.TempDir(), "coverage.json")
+
+	err := c.Run([]string{"-json-out", jsonOut, "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+
+	// The template goes to stdout and the JSON to the file, with the same
+	// numbers.
+	report, err := os.ReadFile(jsonOut)
+	assert.NilError(t, err)
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(report, &data))
+	assert.Equal(t, data.PatchCoverCount, 6)
+	assert.Equal(t, data.PatchNumStmt, 8)
+	assert.Assert(t, strings.Contains(out.String(), fmt.Sprintf("patch coverage: %.1f%% of changed statements (%d/%d)", data.PatchCoverage, data.PatchCoverCount, data.PatchNumStmt)), out.String())
+	assert.Assert(t, strings.Contains(out.String(), fmt.Sprintf("new coverage: %.1f%% of statements", data.Coverage)), out.String())
+}
+
+func TestCoverCommand_Run_htmlOut(t *testing.T) {
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-o", "html"}, args...)))
+	assert.Assert(t, strings.HasPrefix(out.String(), "<!DOCTYPE html>"), out.String())
+
+	c = newTestCommand(t)
+	var stdout bytes.Buffer
+	c.stdout = &stdout
+	htmlOut := filepath.Join(t.TempDir(), "coverage.html")
+	assert.NilError(t, c.Run(append([]string{"-html-out", htmlOut}, args...)))
+	report, err := os.ReadFile(htmlOut)
+	assert.NilError(t, err)
+	assert.Equal(t, string(report), out.String())
+	assert.Assert(t, strings.Contains(stdout.String(), "patch coverage: 75.0%"), stdout.String())
+
+	c = newTestCommand(t)
+	assert.Error(t, c.Run(append([]string{"-no-filewrite", "-html-out", htmlOut}, args...)), "-no-filewrite cannot be used with -html-out, which writes files")
+}
+
+func TestCoverCommand_Run_invalidThreshold(t *testing.T) {
+	c := newTestCommand(t)
+	c.stdout = &bytes.Buffer{}
+	c.fs.SetOutput(&bytes.Buffer{})
+
+	err := c.Run([]string{"-min-delta", "0,5", "coverage.out", "patch.diff"})
+	assert.ErrorContains(t, err, `invalid percentage "0,5": use "." as the decimal separator`)
+}
+
+func TestCoverCommand_Run_filesFrom(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	// File lists hold repository relative paths.
+	assert.NilError(t, os.Chdir("../.."))
+	defer os.Chdir(wd)
+
+	fileList := filepath.Join(t.TempDir(), "files.txt")
+	assert.NilError(t, os.WriteFile(fileList, []byte("testdata/test-project/func1.go\n\nREADME.md\n"), 0o644))
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err = c.Run([]string{"-files-from", fileList, "-o", "json", "testdata/test-project/coverage.out"})
+	assert.NilError(t, err)
+
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &data))
+	assert.Equal(t, data.PatchNumStmt, 8)
+	assert.Equal(t, data.PatchCoverCount, 6)
+}
+
+func TestCoverCommand_Run_cloverOutput(t *testing.T) {
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-o", "clover", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(out.String(), "<?xml"))
+	assert.Assert(t, strings.Contains(out.String(), `<line num="15" count="0" type="stmt"></line>`))
+}
+
+func TestCoverCommand_Run_coberturaOutput(t *testing.T) {
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-o", "cobertura"}, args...)))
+	full := out.String()
+	assert.Assert(t, strings.HasPrefix(full, "<?xml"))
+	assert.Assert(t, strings.Contains(full, `<line number="15" hits="0"></line>`))
+
+	c = newTestCommand(t)
+	out.Reset()
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-o", "cobertura", "-cobertura-patch-only"}, args...)))
+	assert.Assert(t, strings.Contains(out.String(), `<line number="15" hits="0"></line>`))
+	assert.Assert(t, len(out.String()) < len(full))
+
+	c = newTestCommand(t)
+	c.stdout = &bytes.Buffer{}
+	assert.Error(t, c.Run(append([]string{"-cobertura-patch-only"}, args...)), "-cobertura-patch-only requires -o cobertura")
+}
+
+func TestCoverCommand_Run_forbidUncoveredRegex(t *testing.T) {
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+
+	c := newTestCommand(t)
+	c.stdout = &bytes.Buffer{}
+	err := c.Run(append([]string{"-forbid-uncovered-regex", `"bool2",`}, args...))
+	assert.ErrorContains(t, err, `func1.go:15: fmt.Println("bool2", bool2)`)
+
+	c = newTestCommand(t)
+	c.stdout = &bytes.Buffer{}
+	err = c.Run(append([]string{"-forbid-uncovered-regex", `panic\(`}, args...))
+	assert.NilError(t, err)
+
+	c = newTestCommand(t)
+	c.stdout = &bytes.Buffer{}
+	err = c.Run(append([]string{"-forbid-uncovered-regex", `(`}, args...))
+	assert.ErrorContains(t, err, "invalid -forbid-uncovered-regex")
+}
+
+func TestCoverCommand_Run_requireCoverageForChangedFuncs(t *testing.T) {
+	// Changed files are read relative to the repository root.
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir("../.."))
+	defer os.Chdir(wd)
+	args := []string{"testdata/changed-funcs/coverage.out", "testdata/changed-funcs/diff.diff"}
+
+	var stderr bytes.Buffer
+	c := newTestCommand(t)
+	c.stdout = io.Discard
+	c.stderr = &stderr
+	err = c.Run(append([]string{"-no-filewrite", "-require-coverage-for-changed-funcs"}, args...))
+	assert.ErrorContains(t, err, "testdata/changed-funcs/store.go:11: Store.Delete")
+	assert.Assert(t, !strings.Contains(err.Error(), "Store.Get"), err)
+	assert.Assert(t, strings.Contains(stderr.String(), "1 uncovered functions  FAIL"), stderr.String())
+
+	c = newTestCommand(t)
+	c.stdout = io.Discard
+	c.stderr = io.Discard
+	assert.NilError(t, c.Run(append([]string{"-no-filewrite"}, args...)))
+}
+
+func TestCoverCommand_Run_sources(t *testing.T) {
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{
+		"-source", "unit=../../testdata/sources/unit.out",
+		"-source", "integration=../../testdata/sources/integration.out",
+		"../../testdata/scenarios/new_file/diff.diff",
+	})
+	assert.NilError(t, err)
+
+	const fileName = "github.com/seriousben/go-patch-cover/testdata/test-project/func1.go"
+	assert.Equal(t, out.String(), ""+
+		fileName+":6 [unit, integration]: fmt.Println(\"func1\")\n"+
+		fileName+":9 [unit]: fmt.Println(\"bool1\", bool1)\n"+
+		fileName+":14 [unit, integration]: if bool2 {\n"+
+		fileName+":15 [integration]: fmt.Println(\"bool2\", bool2)\n"+
+		fileName+":20 [unit, integration]: fmt.Println(\"end func1\")\n")
+}
+
+func Test_sourcesFlag_Set(t *testing.T) {
+	var s sourcesFlag
+	assert.NilError(t, s.Set("unit=coverage.out"))
+	assert.DeepEqual(t, []patchcover.Source(s), []patchcover.Source{{TestType: "unit", CoverageFile: "coverage.out"}})
+	assert.Error(t, s.Set("coverage.out"), `invalid source "coverage.out": expected test_type=coverage_file`)
+	assert.Error(t, s.Set("=coverage.out"), `invalid source "=coverage.out": expected test_type=coverage_file`)
+}
+
+func TestCoverCommand_Run_pr(t *testing.T) {
+	srv := newMockGitHub(t, func1Patch(t))
+	setGitHubEnv(t, srv.URL)
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-pr", "1", "-o", "json", "../../testdata/scenarios/new_file/coverage.out"})
+	assert.NilError(t, err)
+
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &data))
+	assert.Equal(t, data.PatchNumStmt, 8)
+	assert.Equal(t, data.PatchCoverCount, 6)
+}
+
+func TestCoverCommand_Run_debugPaths(t *testing.T) {
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-debug-paths", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(out.String(), "\ttestdata/test-project/func1.go -> testdata/test-project/func1.go\n"))
+	assert.Assert(t, strings.Contains(out.String(), "\tgo.mod -> go.mod (no matching profile)\n"))
+	// Exits after dumping, without coverage output.
+	assert.Assert(t, !strings.Contains(out.String(), "patch coverage"))
+}
+
+func TestCoverCommand_Run_mergeBase(t *testing.T) {
+	r := newDivergedRepo(t)
+	r.write("coverage.out", "mode: set\n"+
+		"example.com/m/main.go:3.17,5.2 1 0\n"+
+		"example.com/m/feature.go:3.20,5.2 1 1\n")
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(r.dir))
+	defer os.Chdir(wd)
+
+	run := func(args ...string) patchcover.CoverageData {
+		t.Helper()
+		data, err := runCommandJSON(t, args...)
+		assert.NilError(t, err)
+		return data
+	}
+
+	// The tip of main changed main.go after feature branched off.
+	tip := run("-base", "main", "coverage.out")
+	assert.Equal(t, tip.PatchNumStmt, 2)
+	assert.Equal(t, tip.PatchCoverCount, 1)
+
+	mb := run("-base", "main", "-merge-base", "coverage.out")
+	assert.Equal(t, mb.PatchNumStmt, 1)
+	assert.Equal(t, mb.PatchCoverCount, 1)
+
+	c := newTestCommand(t)
+	c.stdout = &bytes.Buffer{}
+	assert.ErrorContains(t, c.Run([]string{"-merge-base", "coverage.out"}), "-merge-base requires -base")
+}
+
+func TestCoverCommand_Run_sinceTag(t *testing.T) {
+	r := newScriptedRepo(t)
+	r.write("go.mod", "module example.com/m\n")
+	r.write("main.go", "package m\n")
+	r.write("coverage.out", "mode: set\n"+
+		"example.com/m/main.go:3.17,5.2 1 0\n"+
+		"example.com/m/feature.go:3.20,5.2 1 1\n")
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(r.dir))
+	defer os.Chdir(wd)
+
+	run := func() error {
+		_, _, err := runCommand(t, "-since-tag", "coverage.out")
+		return err
+	}
+
+	r.commit("initial")
+	assert.Error(t, run(), "processing error: no tag to diff against: the repository has no tags")
+
+	r.git("tag", "v1.0.0")
+	r.write("main.go", "package m\n\nfunc Main() int {\n\treturn 1\n}\n")
+	r.commit("main")
+	r.git("tag", "v1.1.0")
+	r.write("feature.go", "package m\n\nfunc Feature() int {\n\treturn 2\n}\n")
+	r.commit("feature")
+
+	// Only the changes made since v1.1.0 count.
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run([]string{"-since-tag", "-o", "json", "coverage.out"}))
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &data))
+	assert.Equal(t, data.PatchNumStmt, 1)
+	assert.Equal(t, data.PatchCoverCount, 1)
+
+	c = newTestCommand(t)
+	assert.Error(t, c.Run([]string{"-since-tag", "-base", "main", "coverage.out"}), "processing error: -since-tag and -base are mutually exclusive")
+}
+
+func TestCoverCommand_Run_totalOnly(t *testing.T) {
+	covFile := "../../testdata/scenarios/new_file/coverage.out"
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run([]string{covFile}))
+	assert.Assert(t, strings.Contains(out.String(), "coverage:"), out.String())
+	assert.Assert(t, !strings.Contains(out.String(), "patch coverage"), out.String())
+
+	c = newTestCommand(t)
+	c.stdout = io.Discard
+	c.stderr = io.Discard
+	assert.ErrorContains(t, c.Run([]string{"-min-patch-coverage", "50", covFile}), "-min-patch-coverage requires a diff")
+}
+
+func TestCoverCommand_Run_patchCoverageOnly(t *testing.T) {
+	dir := "../../testdata/scenarios/single_edit"
+	args := []string{filepath.Join(dir, "coverage.out"), filepath.Join(dir, "diff.diff"), filepath.Join(dir, "coverage.out")}
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-patch-coverage-only", "-min-patch-coverage", "80", "-o", "json"}, args...)))
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &data))
+	assert.Assert(t, data.PatchOnly)
+	assert.Equal(t, data.NumStmt, 0)
+	assert.Assert(t, data.PatchNumStmt > 0)
+
+	c = newTestCommand(t)
+	c.stdout = io.Discard
+	c.stderr = io.Discard
+	err := c.Run(append([]string{"-patch-coverage-only", "-min-coverage", "10", "-min-delta", "0"}, args...))
+	assert.ErrorContains(t, err, "min-coverage: total coverage is not computed with -patch-coverage-only")
+	assert.ErrorContains(t, err, "min-delta: -min-delta requires the total coverage")
+}
+
+func TestCoverCommand_Run_branches(t *testing.T) {
+	r := newScriptedRepo(t)
+	r.write("go.mod", "module example.com/m\n")
+	r.write("lib.go", "package m\n\nfunc A() int {\n\treturn 1\n}\n")
+	r.commit("initial")
+	r.git("checkout", "-q", "-b", "release")
+	r.write("lib.go", "package m\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B() int {\n\tx := 2\n\treturn x\n}\n")
+	r.commit("add B")
+	r.git("checkout", "-q", "main")
+
+	// The coverage of each branch.
+	r.write("main.out", "mode: set\n"+
+		"example.com/m/lib.go:3.14,5.2 1 1\n")
+	r.write("release.out", "mode: set\n"+
+		"example.com/m/lib.go:3.14,5.2 1 1\n"+
+		"example.com/m/lib.go:7.14,10.2 2 0\n")
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(r.dir))
+	defer os.Chdir(wd)
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run([]string{"-base", "main", "-head", "release", "-o", "json", "release.out", "main.out"}))
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &data))
+	assert.Assert(t, data.HasPrevCoverage)
+	assert.Equal(t, data.PrevNumStmt, 1)
+	assert.Equal(t, data.PrevCoverage, 100.0)
+	assert.Equal(t, data.NumStmt, 3)
+	assert.Equal(t, data.PatchNumStmt, 2)
+	assert.Equal(t, data.PatchCoverCount, 0)
+
+	c = newTestCommand(t)
+	assert.Error(t, c.Run([]string{"-head", "release", "release.out"}), "processing error: -head requires -base")
+}
+
+func TestCoverCommand_Run_compareAgainstMain(t *testing.T) {
+	r := newScriptedRepo(t)
+	r.write("go.mod", "module example.com/m\n")
+	r.write("lib.go", "package m\n\nfunc A() int {\n\treturn 1\n}\n")
+	r.commit("initial")
+	r.git("checkout", "-q", "-b", "feature")
+	r.write("lib.go", "package m\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B() int {\n\tx := 2\n\treturn x\n}\n")
+	r.commit("add B")
+	// Changes merged into main after branching off are not part of the
+	// patch.
+	r.git("checkout", "-q", "main")
+	r.write("other.go", "package m\n\nfunc C() int {\n\treturn 3\n}\n")
+	r.commit("add C")
+	r.git("checkout", "-q", "feature")
+
+	// The coverage stored by the last run on main, and of the feature.
+	artifacts := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(artifacts, "main"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(artifacts, "main", "coverage.out"), []byte("mode: set\n"+
+		"example.com/m/lib.go:3.14,5.2 1 1\n"+
+		"example.com/m/other.go:3.14,5.2 1 0\n"), 0o644))
+	r.write("feature.out", "mode: set\n"+
+		"example.com/m/lib.go:3.14,5.2 1 1\n"+
+		"example.com/m/lib.go:7.14,10.2 2 1\n")
+
+	t.Setenv("GITHUB_BASE_REF", "")
+	run := func(dir string, args ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, append([]string{"-C", dir, "-compare-against-main", "-prev-artifact-dir", artifacts}, args...)...)
+	}
+	check := func(data patchcover.CoverageData) {
+		t.Helper()
+		assert.Assert(t, data.HasPrevCoverage)
+		assert.Equal(t, data.PrevNumStmt, 2)
+		assert.Equal(t, data.PrevCoverage, 50.0)
+		assert.Equal(t, data.NumStmt, 3)
+		assert.Equal(t, data.Coverage, 100.0)
+		assert.Equal(t, data.PatchNumStmt, 2)
+		assert.Equal(t, data.PatchCoverCount, 2)
+	}
+
+	// The local main branch is detected.
+	data, err := run(r.dir, "feature.out")
+	assert.NilError(t, err)
+	check(data)
+
+	// In a clone, the default branch of origin is detected, and diffed from
+	// origin when not checked out locally.
+	clone := t.TempDir()
+	_, err = runGit("", "clone", "-q", r.dir, clone)
+	assert.NilError(t, err)
+	_, err = runGit(clone, "remote", "set-head", "origin", "main")
+	assert.NilError(t, err)
+	_, err = runGit(clone, "checkout", "-q", "-b", "pr", "origin/feature")
+	assert.NilError(t, err)
+	_, err = runGit(clone, "branch", "-q", "-D", "feature")
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(filepath.Join(clone, "feature.out"), []byte("mode: set\n"+
+		"example.com/m/lib.go:3.14,5.2 1 1\n"+
+		"example.com/m/lib.go:7.14,10.2 2 1\n"), 0o644))
+	data, err = run(clone, "feature.out")
+	assert.NilError(t, err)
+	check(data)
+
+	// GitHub pull requests name their base branch.
+	t.Setenv("GITHUB_BASE_REF", "release")
+	_, err = run(r.dir, "feature.out")
+	assert.Error(t, err, "-compare-against-main: base branch release is neither a local branch nor fetched from origin")
+	t.Setenv("GITHUB_BASE_REF", "main")
+	data, err = run(r.dir, "feature.out")
+	assert.NilError(t, err)
+	check(data)
+
+	_, err = run(r.dir, "-base", "main", "feature.out")
+	assert.Error(t, err, "-compare-against-main cannot be used with -base")
+	c := newTestCommand(t)
+	assert.Error(t, c.Run([]string{"-C", r.dir, "-compare-against-main", "feature.out"}), "-compare-against-main requires -prev-artifact-dir")
+}
+
+func TestCoverCommand_Run_showRegen(t *testing.T) {
+	run := func(args ...string) string {
+		t.Helper()
+		_, stderr, err := runCommand(t, args...)
+		assert.NilError(t, err)
+		return stderr
+	}
+
+	for scenario, mode := range map[string]string{"new_file": "count", "single_edit": "set"} {
+		covFile := "../../testdata/scenarios/" + scenario + "/coverage.out"
+		stderr := run("-show-regen", covFile, "../../testdata/scenarios/"+scenario+"/diff.diff")
+		assert.Equal(t, stderr, "regenerate "+covFile+" with: go test -covermode="+mode+" -coverprofile="+covFile+" ./...\n")
+	}
+
+	// The mode overridden by -profile-format is the one to regenerate.
+	covFile := "../../testdata/scenarios/new_file/coverage.out"
+	stderr := run("-show-regen", "-profile-format", "atomic", covFile, "../../testdata/scenarios/new_file/diff.diff")
+	assert.Assert(t, strings.Contains(stderr, "go test -covermode=atomic -coverprofile="+covFile+" ./...\n"), stderr)
+
+	assert.Equal(t, run(covFile, "../../testdata/scenarios/new_file/diff.diff"), "")
+}
+
+func TestCoverCommand_Run_regressions(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		assert.NilError(t, os.WriteFile(p, []byte(content), 0o644))
+		return p
+	}
+	prev := write("prev.out", "mode: set\nexample.com/m/a.go:3.14,5.2 1 1\n")
+	cov := write("coverage.out", "mode: set\nexample.com/m/a.go:3.14,5.2 1 0\n")
+	diff := write("diff.diff", "")
+
+	c := newTestCommand(t)
+	var errOut bytes.Buffer
+	c.stdout = io.Discard
+	c.stderr = &errOut
+	assert.NilError(t, c.Run([]string{"-regressions", cov, diff, prev}))
+	assert.Equal(t, errOut.String(), `warning: example.com/m/a.go:3 is not covered anymore (previously line 3)
+warning: example.com/m/a.go:4 is not covered anymore (previously line 4)
+warning: example.com/m/a.go:5 is not covered anymore (previously line 5)
+`)
+}
+
+func TestCoverCommand_Run_chdir(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run([]string{"-C", "../../testdata/scenarios/new_file", "-no-filewrite", "coverage.out", "diff.diff"}))
+	assert.Assert(t, strings.Contains(out.String(), "patch coverage: 75.0%"), out.String())
+	cwd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.Equal(t, cwd, wd)
+
+	// Written files are relative to the directory too.
+	dir := t.TempDir()
+	for _, name := range []string{"coverage.out", "diff.diff"} {
+		content, err := os.ReadFile(filepath.Join("../../testdata/scenarios/new_file", name))
+		assert.NilError(t, err)
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), content, 0o644))
+	}
+	c = newTestCommand(t)
+	c.stdout = io.Discard
+	assert.NilError(t, c.Run([]string{"-chdir", dir, "-json-out", "report.json", "coverage.out", "diff.diff"}))
+	_, err = os.Stat(filepath.Join(dir, "report.json"))
+	assert.NilError(t, err)
+
+	c = newTestCommand(t)
+	assert.ErrorContains(t, c.Run([]string{"-C", filepath.Join(dir, "missing"), "coverage.out"}), "-C: ")
+}
+
+func TestCoverCommand_Run_byFile(t *testing.T) {
+	args := []string{"-no-filewrite", "../../testdata/coverage-floor/coverage.out", "../../testdata/coverage-floor/diff.diff"}
+	run := func(args ...string) string {
+		t.Helper()
+		out, _, err := runCommand(t, args...)
+		assert.NilError(t, err)
+		return out
+	}
+
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal([]byte(run(append([]string{"-by-file", "-o", "json"}, args...)...)), &data))
+	assert.DeepEqual(t, data.Files, []patchcover.FileCoverage{
+		{FileName: "example.com/m/pkg/big.go", NumStmt: 4, CoverCount: 4, Coverage: 100, PatchNumStmt: 4, PatchCoverCount: 4, PatchCoverage: 100, AddedLines: 9},
+		{FileName: "example.com/m/pkg/tiny.go", NumStmt: 2, PatchNumStmt: 2, AddedLines: 6},
+	})
+
+	out := run(append([]string{"-by-file", "-tmpl", "{{ range .Files }}{{ .FileName }} {{ .PatchCoverCount }}/{{ .PatchNumStmt }}\n{{ end }}"}, args...)...)
+	assert.Equal(t, out, "example.com/m/pkg/big.go 4/4\nexample.com/m/pkg/tiny.go 0/2\n")
+
+	data = patchcover.CoverageData{}
+	assert.NilError(t, json.Unmarshal([]byte(run(append([]string{"-o", "json"}, args...)...)), &data))
+	assert.Assert(t, data.Files == nil)
+}
+
+func TestCoverCommand_Run_cov(t *testing.T) {
+	integration := filepath.Join(t.TempDir(), "coverage-int.out")
+	assert.NilError(t, os.WriteFile(integration, []byte(`mode: count
+example.com/m/pkg/tiny.go:3.18,6.2 2 4
+`), 0o644))
+	run := func(args ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, append(append([]string{"-no-filewrite"}, args...), "../../testdata/coverage-floor/coverage.out", "../../testdata/coverage-floor/diff.diff")...)
+	}
+
+	data, err := run("-cov", integration)
+	assert.NilError(t, err)
+	assert.Equal(t, data.Mode, "count")
+	assert.Equal(t, data.PatchCoverCount, 6)
+	assert.Equal(t, data.PatchCoverage, 100.0)
+
+	assert.NilError(t, os.WriteFile(integration, []byte(`mode: count
+example.com/m/pkg/tiny.go:3.18,5.2 2 4
+`), 0o644))
+	_, err = run("-cov", integration)
+	assert.Error(t, err, "processing error: block boundaries of example.com/m/pkg/tiny.go disagree between coverage files: 3.18,5.2 instead of 3.18,6.2")
+}
+
+func TestCoverCommand_Run_byOwner(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"coverage.out", "diff.diff"} {
+		content, err := os.ReadFile(filepath.Join("../../testdata/coverage-floor", name))
+		assert.NilError(t, err)
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), content, 0o644))
+	}
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, ".github"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, ".github", "CODEOWNERS"), []byte("*.go @org/go\n"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "OWNERS"), []byte("tiny.go @org/tiny\n"), 0o644))
+
+	run := func(args ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, append([]string{"-C", dir, "-no-filewrite"}, append(args, "coverage.out", "diff.diff")...)...)
+	}
+
+	// The CODEOWNERS file is looked up as GitHub does.
+	data, err := run("-by-owner")
+	assert.NilError(t, err)
+	assert.Equal(t, len(data.ByOwner), 1)
+	assert.Equal(t, data.ByOwner[0].Owner, "@org/go")
+	assert.Equal(t, data.ByOwner[0].PatchNumStmt, 6)
+
+	data, err = run("-by-owner", "-codeowners", "OWNERS")
+	assert.NilError(t, err)
+	assert.Equal(t, len(data.ByOwner), 2)
+	assert.Equal(t, data.ByOwner[0].Owner, "")
+	assert.Equal(t, data.ByOwner[1].Owner, "@org/tiny")
+	assert.Equal(t, data.ByOwner[1].PatchNumStmt, 2)
+
+	_, err = run("-codeowners", "OWNERS")
+	assert.Error(t, err, "-codeowners requires -by-owner")
+	assert.NilError(t, os.RemoveAll(filepath.Join(dir, ".github")))
+	_, err = run("-by-owner")
+	assert.Error(t, err, "-by-owner requires a CODEOWNERS file, none of .github/CODEOWNERS, CODEOWNERS, docs/CODEOWNERS found")
+}
+
+func TestCoverCommand_Run_stash(t *testing.T) {
+	r := newScriptedRepo(t)
+	r.write("go.mod", "module example.com/m\n")
+	r.write("main.go", "package m\n")
+	r.commit("initial")
+	r.write("main.go", "package m\n\nfunc Main() int {\n\treturn 1\n}\n")
+	r.git("stash", "push", "-q")
+	r.write("coverage.out", "mode: set\n"+
+		"example.com/m/main.go:3.17,5.2 1 1\n")
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(r.dir))
+	defer os.Chdir(wd)
+
+	// The stashed changes are the patch, though not in the working tree.
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run([]string{"-stash", "stash@{0}", "-o", "json", "coverage.out"}))
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &data))
+	assert.Equal(t, data.PatchNumStmt, 1)
+	assert.Equal(t, data.PatchCoverCount, 1)
+
+	c = newTestCommand(t)
+	assert.Error(t, c.Run([]string{"-stash", "stash@{3}", "coverage.out"}), `processing error: no stash entry stash@{3}: list entries with "git stash list"`)
+	c = newTestCommand(t)
+	assert.Error(t, c.Run([]string{"-stash", "stash@{0}", "-base", "main", "coverage.out"}), "processing error: -stash is exclusive with -base and -since-tag")
+}
+
+func TestCoverCommand_Run_batch(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "repos.json")
+	scenarios, err := filepath.Abs("../../testdata/scenarios")
+	assert.NilError(t, err)
+	entries := []batchEntry{
+		{Name: "new_file", Coverage: filepath.Join(scenarios, "new_file/coverage.out"), Diff: filepath.Join(scenarios, "new_file/diff.diff")},
+		{Name: "missing", Coverage: "missing.out", Diff: filepath.Join(scenarios, "new_file/diff.diff")},
+		{Name: "single_edit", Coverage: filepath.Join(scenarios, "single_edit/coverage.out"), Diff: filepath.Join(scenarios, "single_edit/diff.diff")},
+	}
+	content, err := json.Marshal(entries)
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(manifest, content, 0o644))
+
+	t.Run("keep going", func(t *testing.T) {
+		c := newTestCommand(t)
+		var out bytes.Buffer
+		c.stdout = &out
+
+		err := c.Run([]string{"-batch", manifest, "-keep-going"})
+		assert.ErrorContains(t, err, "1 of 3 batch entries failed")
+
+		var report batchReport
+		assert.NilError(t, json.Unmarshal(out.Bytes(), &report))
+		assert.Equal(t, report.Failed, 1)
+		assert.Equal(t, len(report.Results), 3)
+		assert.Equal(t, report.Results[0].Coverage.PatchCoverage, 75.0)
+		assert.Assert(t, report.Results[1].Coverage == nil)
+		// Relative paths are resolved against the manifest directory.
+		assert.Equal(t, report.Results[1].Error, "coverage file not found: "+filepath.Join(dir, "missing.out"))
+		assert.Assert(t, report.Results[2].Coverage != nil)
+	})
+
+	t.Run("stop at first failure", func(t *testing.T) {
+		c := newTestCommand(t)
+		var out bytes.Buffer
+		c.stdout = &out
+
+		err := c.Run([]string{"-batch", manifest})
+		assert.ErrorContains(t, err, "batch entry missing: coverage file not found")
+		assert.Equal(t, out.String(), "")
+	})
+
+	t.Run("keep going requires batch", func(t *testing.T) {
+		err := newTestCommand(t).Run([]string{"-keep-going", "coverage.out", "diff.diff"})
+		assert.ErrorContains(t, err, "-keep-going requires -batch")
+	})
+}
+
+func TestCoverCommand_Run_batchSummary(t *testing.T) {
+	dir := t.TempDir()
+	for repo, scenario := range map[string]string{"repo-a": "new_file", "repo-b": "single_edit"} {
+		assert.NilError(t, os.Mkdir(filepath.Join(dir, repo), 0o755))
+		for _, name := range []string{"coverage.out", "diff.diff"} {
+			content, err := os.ReadFile(filepath.Join("../../testdata/scenarios", scenario, name))
+			assert.NilError(t, err)
+			assert.NilError(t, os.WriteFile(filepath.Join(dir, repo, name), content, 0o644))
+		}
+	}
+	// Neither are entries.
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "docs"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "README.md"), nil, 0o644))
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run([]string{"-batch", dir, "-summary-only"}))
+
+	var summary batchSummary
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &summary))
+	assert.DeepEqual(t, summary, batchSummary{
+		Total: summaryRow{Name: "total", NumStmt: 42, CoverCount: 36, Coverage: 36.0 / 42 * 100, PatchNumStmt: 31, PatchCoverCount: 26, PatchCoverage: 26.0 / 31 * 100},
+		Entries: []summaryRow{
+			{Name: "repo-a", NumStmt: 8, CoverCount: 6, Coverage: 75, PatchNumStmt: 8, PatchCoverCount: 6, PatchCoverage: 75},
+			{Name: "repo-b", NumStmt: 34, CoverCount: 30, Coverage: 30.0 / 34 * 100, PatchNumStmt: 23, PatchCoverCount: 20, PatchCoverage: 20.0 / 23 * 100},
+		},
+	})
+
+	err := newTestCommand(t).Run([]string{"-summary-only", "coverage.out", "diff.diff"})
+	assert.ErrorContains(t, err, "-summary-only requires -batch")
+
+	err = newTestCommand(t).Run([]string{"-batch", filepath.Join(dir, "docs")})
+	assert.ErrorContains(t, err, "has no subdirectory holding a coverage.out file")
+}
+
+func TestCoverCommand_Run_jsonPretty(t *testing.T) {
+	args := []string{"-o", "json", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+
+	run := func(t *testing.T, args []string) string {
+		out, _, err := runCommand(t, args...)
+		assert.NilError(t, err)
+		return out
+	}
+
+	compact := run(t, args)
+	assert.Assert(t, !strings.Contains(compact, "\n  "))
+	assert.Assert(t, strings.HasPrefix(compact, `{"report_schema_version":21,"tool_version":"1.0.0","num_stmt":8,`), compact)
+
+	pretty := run(t, append([]string{"-json-pretty"}, args...))
+	assert.Assert(t, strings.HasPrefix(pretty, "{\n  \"report_schema_version\": 21,\n"), pretty)
+
+	// Both encode the same data.
+	var a, b patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal([]byte(compact), &a))
+	assert.NilError(t, json.Unmarshal([]byte(pretty), &b))
+	assert.DeepEqual(t, a, b)
+}
+
+func TestCoverCommand_Run_gateTable(t *testing.T) {
+	c := newTestCommand(t)
+	var out, errOut bytes.Buffer
+	c.stdout = &out
+	c.stderr = &errOut
+
+	err := c.Run([]string{
+		"-min-coverage", "80",
+		"-min-patch-coverage", "70",
+		"-min-delta", "0",
+		"-forbid-uncovered-regex", `"bool2",`,
+		"../../testdata/scenarios/new_file/coverage.out",
+		"../../testdata/scenarios/new_file/diff.diff",
+		"../../testdata/scenarios/single_edit/coverage.out",
+	})
+	// Every failing gate is reported, not only the first one.
+	assert.ErrorContains(t, err, "3 of 4 gates failed")
+	assert.ErrorContains(t, err, "min-coverage: total coverage 75.00% is below the required minimum of 80.00%")
+	assert.ErrorContains(t, err, "min-delta: coverage delta -13.24% is below the required minimum of 0.00%")
+	assert.ErrorContains(t, err, `forbid-uncovered-regex: uncovered lines match "\"bool2\","`)
+
+	assert.Equal(t, errOut.String(), `GATE                    THRESHOLD  ACTUAL            RESULT
+min-coverage            80.00%     75.00%            FAIL
+min-patch-coverage      70.00%     75.00%            pass
+min-delta               0.00%      -13.24%           FAIL
+forbid-uncovered-regex  "bool2",   1 matching lines  FAIL
+`)
+	assert.Assert(t, strings.Contains(out.String(), "patch coverage"))
+}
+
+func TestCoverCommand_Run_failUnder(t *testing.T) {
+	run := func(scenario string, args ...string) error {
+		_, _, err := runCommand(t, append(args, "../../testdata/scenarios/"+scenario+"/coverage.out", "../../testdata/scenarios/"+scenario+"/diff.diff")...)
+		return err
+	}
+
+	// The patch coverage is 87.0%, and the total coverage 88.2%.
+	assert.ErrorContains(t, run("single_edit", "--fail-under", "87.5"), "min-patch-coverage: patch coverage 86.96% is below the required minimum of 87.50%")
+	assert.NilError(t, run("single_edit", "--fail-under", "85"))
+	assert.NilError(t, run("single_edit", "--fail-under-total", "87.5"))
+	assert.ErrorContains(t, run("single_edit", "--fail-under-total", "90"), "min-coverage: total coverage 88.24% is below the required minimum of 90.00%")
+
+	// A patch changing no statement passes.
+	assert.NilError(t, run("deletion_only", "--fail-under", "100"))
+
+	// It is evaluated with the other gates.
+	err := run("single_edit", "--fail-under", "90", "-fail-under-total", "90")
+	assert.ErrorContains(t, err, "2 of 2 gates failed")
+
+	// Without the flag, the threshold of the suite of TEST_TYPE applies.
+	config := filepath.Join(t.TempDir(), "suites.json")
+	assert.NilError(t, os.WriteFile(config, []byte(`{"suites": {"unit": {"min_patch_coverage": 90}}}`), 0o644))
+	t.Setenv("TEST_TYPE", "unit")
+	assert.ErrorContains(t, run("single_edit", "-suites-config", config), "min-patch-coverage: patch coverage 86.96% is below the required minimum of 90.00%")
+	assert.NilError(t, run("single_edit", "-suites-config", config, "--fail-under", "80"))
+}
+
+func TestCoverCommand_Run_tap(t *testing.T) {
+	run := func(args ...string) (string, error) {
+		out, _, err := runCommand(t, append(append([]string{"-o", "tap"}, args...), "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff")...)
+		return out, err
+	}
+
+	out, err := run("-min-coverage", "80", "-min-patch-coverage", "70")
+	assert.ErrorContains(t, err, "1 of 2 gates failed")
+	assert.Equal(t, out, `TAP version 13
+1..3
+not ok 1 - github.com/seriousben/go-patch-cover/testdata/test-project/func1.go: 75.0% of changed statements (6/8)
+not ok 2 - gate min-coverage: 75.00% (threshold 80.00%)
+ok 3 - gate min-patch-coverage: 75.00% (threshold 70.00%)
+`)
+
+	out, err = run()
+	assert.NilError(t, err)
+	assert.Equal(t, out, `TAP version 13
+1..1
+not ok 1 - github.com/seriousben/go-patch-cover/testdata/test-project/func1.go: 75.0% of changed statements (6/8)
+`)
+}
+
+func TestCoverCommand_Run_failMessage(t *testing.T) {
+	c := newTestCommand(t)
+	c.stdout = io.Discard
+	c.stderr = io.Discard
+
+	err := c.Run([]string{
+		"-min-coverage", "80",
+		"-min-patch-coverage", "70",
+		"-fail-message-tmpl", `patch coverage is {{ .PatchCoverage }}%:{{ range .Gates }}{{ if not .Passed }} {{ .Name }} wants {{ .Threshold }} ({{ .Actual }}){{ end }}{{ end }}, see https://example.com/coverage`,
+		"../../testdata/scenarios/new_file/coverage.out",
+		"../../testdata/scenarios/new_file/diff.diff",
+	})
+	assert.Error(t, err, "patch coverage is 75%: min-coverage wants 80.00% (75.00%), see https://example.com/coverage")
+
+	// The template is not used when every gate passes.
+	c = newTestCommand(t)
+	c.stdout = io.Discard
+	c.stderr = io.Discard
+	err = c.Run([]string{"-min-coverage", "10", "-fail-message-tmpl", "failed", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+
+	err = newTestCommand(t).Run([]string{"-fail-message-tmpl", "{{ .Unclosed", "../../testdata/scenarios/new_file/coverage.out"})
+	assert.ErrorContains(t, err, "invalid -fail-message-tmpl")
+}
+
+func TestCoverCommand_Run_noGates(t *testing.T) {
+	c := newTestCommand(t)
+	var out, errOut bytes.Buffer
+	c.stdout = &out
+	c.stderr = &errOut
+
+	err := c.Run([]string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+	assert.Equal(t, errOut.String(), "")
+}
+
+func TestCoverCommand_Run_envFile(t *testing.T) {
+	srv := newMockGitHub(t, func1Patch(t))
+	for _, key := range []string{"GITHUB_TOKEN", "GITHUB_REPOSITORY", "GITHUB_API_URL"} {
+		t.Setenv(key, "")
+		assert.NilError(t, os.Unsetenv(key))
+	}
+	envFile := filepath.Join(t.TempDir(), ".env")
+	assert.NilError(t, os.WriteFile(envFile, []byte("GITHUB_TOKEN=secret\nGITHUB_REPOSITORY=octo/repo\nGITHUB_API_URL="+srv.URL+"\n"), 0o644))
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-env-file", envFile, "-pr", "1", "-o", "json", "../../testdata/scenarios/new_file/coverage.out"})
+	assert.NilError(t, err)
+
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &data))
+	assert.Equal(t, data.PatchNumStmt, 8)
+}
+
+func TestCoverCommand_Run_profileSubset(t *testing.T) {
+	args := []string{"-o", "profile-subset", "../../testdata/deprecated/coverage.out", "../../testdata/deprecated/diff.diff"}
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run(args))
+
+	profiles, err := cover.ParseProfilesFromReader(&out)
+	assert.NilError(t, err)
+	assert.Equal(t, len(profiles), 1)
+	assert.Equal(t, profiles[0].Mode, "set")
+	// Only the blocks holding the added lines 7 and 16.
+	assert.DeepEqual(t, profiles[0].Blocks, []cover.ProfileBlock{
+		{StartLine: 6, StartCol: 24, EndLine: 8, EndCol: 3, NumStmt: 1, Count: 1},
+		{StartLine: 15, StartCol: 24, EndLine: 17, EndCol: 2, NumStmt: 1, Count: 0},
+	})
+
+	c = newTestCommand(t)
+	out.Reset()
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-trim-mode-header"}, args...)))
+	assert.Equal(t, out.String(), `github.com/srinidhis05/go-patch-cover/testdata/deprecated/legacy.go:6.24,8.3 1 1
+github.com/srinidhis05/go-patch-cover/testdata/deprecated/legacy.go:15.24,17.2 1 0
+`)
+}
+
+func TestCoverCommand_Run_commentTemplate(t *testing.T) {
+	args := []string{"-o", "comment", "-tmpl", "console {{.PatchCoverage}}", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	tmplFile := filepath.Join(t.TempDir(), "comment.tmpl")
+	assert.NilError(t, os.WriteFile(tmplFile, []byte("<details>{{.PatchCoverCount}}/{{.PatchNumStmt}}</details>"), 0o644))
+
+	tests := map[string]struct {
+		flags           []string
+		want            string
+		wantErrContains string
+	}{
+		"default markdown":  {want: "### Patch coverage\n"},
+		"comment-tmpl":      {flags: []string{"-comment-tmpl", "@team {{.PatchCoverage}}"}, want: "@team 75"},
+		"comment-tmpl-file": {flags: []string{"-comment-tmpl-file", tmplFile}, want: "<details>6/8</details>"},
+		"both": {
+			flags:           []string{"-comment-tmpl", "x", "-comment-tmpl-file", tmplFile},
+			wantErrContains: "mutually exclusive",
+		},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c := newTestCommand(t)
+			var out bytes.Buffer
+			c.stdout = &out
+
+			err := c.Run(append(tt.flags, args...))
+			if tt.wantErrContains != "" {
+				assert.ErrorContains(t, err, tt.wantErrContains)
+				return
+			}
+			assert.NilError(t, err)
+			// -tmpl only applies to the console template output.
+			assert.Assert(t, strings.HasPrefix(out.String(), tt.want), out.String())
+		})
+	}
+}
+
+func Test_splitList(t *testing.T) {
+	assert.DeepEqual(t, splitList(".go, .gohtml,,"), []string{".go", ".gohtml"})
+	assert.Assert(t, splitList("") == nil)
+}
+
+func TestCoverCommand_Run_diffOutput(t *testing.T) {
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-o", "diff", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(out.String(), "+✓ \tfmt.Println(\"func1\")\n"))
+	assert.Assert(t, strings.Contains(out.String(), "+✗ \t\tfmt.Println(\"bool2\", bool2)\n"))
+}
+
+func TestCoverCommand_Run_reportVersion(t *testing.T) {
+	c := newCoverCommand("1.2.3")
+	var out bytes.Buffer
+	c.stdout = &out
+
+	err := c.Run([]string{"-o", "json", "-uncovered-out", "", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+
+	var report struct {
+		ReportSchemaVersion *int    `json:"report_schema_version"`
+		ToolVersion         *string `json:"tool_version"`
+	}
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Assert(t, report.ReportSchemaVersion != nil)
+	assert.Equal(t, *report.ReportSchemaVersion, patchcover.ReportSchemaVersion)
+	assert.Assert(t, report.ToolVersion != nil)
+	assert.Equal(t, *report.ToolVersion, "1.2.3")
+}
+
+func TestCoverCommand_Run_coverageIgnore(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	dir := t.TempDir()
+	for _, name := range []string{"coverage.out", "diff.diff"} {
+		content, err := os.ReadFile(filepath.Join(wd, "../../testdata/scenarios/new_file", name))
+		assert.NilError(t, err)
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), content, 0o644))
+	}
+	// Patterns match paths relative to the module of the go.mod.
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module github.com/seriousben/go-patch-cover\n"), 0o644))
+	assert.NilError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	run := func(args ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, append(append([]string{"-no-filewrite"}, args...), "coverage.out", "diff.diff")...)
+	}
+
+	// Without a .coverageignore file, nothing is excluded.
+	data, err := run()
+	assert.NilError(t, err)
+	assert.Equal(t, data.NumStmt, 8)
+
+	// The .coverageignore file excludes the directory but the negated file.
+	assert.NilError(t, os.WriteFile(".coverageignore", []byte("testdata/test-project/\n!testdata/test-project/func1.go\n"), 0o644))
+	data, err = run()
+	assert.NilError(t, err)
+	assert.Equal(t, data.NumStmt, 8)
+
+	assert.NilError(t, os.WriteFile(".coverageignore", []byte("testdata/test-project/\n"), 0o644))
+	data, err = run()
+	assert.NilError(t, err)
+	assert.Equal(t, data.NumStmt, 0)
+
+	_, err = run("-coverageignore", "missing")
+	assert.ErrorContains(t, err, "reading coverageignore file")
+}
+
+func TestCoverCommand_Run_coverageFloor(t *testing.T) {
+	args := []string{"../../testdata/coverage-floor/coverage.out", "../../testdata/coverage-floor/diff.diff"}
+	run := func(flags ...string) (patchcover.CoverageData, error) {
+		return runCommandJSON(t, append(append([]string{"-no-filewrite"}, flags...), args...)...)
+	}
+
+	// tiny.go, of 2 uncovered statements, fails the per-file gate.
+	_, err := run("-min-file-patch-coverage", "50")
+	assert.ErrorContains(t, err, "example.com/m/pkg/tiny.go: 0.00% (0/2)")
+	assert.Assert(t, !strings.Contains(err.Error(), "big.go"), err)
+
+	// Below the floor, it is left out of the per-file gate but not of the
+	// totals.
+	data, err := run("-min-file-patch-coverage", "50", "-coverage-floor", "3")
+	assert.NilError(t, err)
+	assert.Equal(t, data.NumStmt, 6)
+	assert.Equal(t, data.CoverCount, 4)
+	assert.Equal(t, data.PatchNumStmt, 6)
+	assert.Equal(t, data.PatchCoverCount, 4)
+	assert.DeepEqual(t, data.Files, []patchcover.FileCoverage{
+		{FileName: "example.com/m/pkg/big.go", NumStmt: 4, CoverCount: 4, Coverage: 100, PatchNumStmt: 4, PatchCoverCount: 4, PatchCoverage: 100, AddedLines: 9},
+		{FileName: "example.com/m/pkg/tiny.go", NumStmt: 2, PatchNumStmt: 2, AddedLines: 6},
+	})
+}
+
+func TestCoverCommand_Run_registeredFormatter(t *testing.T) {
+	if _, ok := patchcover.LookupFormatter("test-patch-stmts"); !ok {
+		patchcover.RegisterFormatter("test-patch-stmts", patchcover.FormatterFunc(func(data patchcover.CoverageData, opts patchcover.FormatOptions, out io.Writer) error {
+			_, err := fmt.Fprintf(out, "%d/%d%s\n", data.PatchCoverCount, data.PatchNumStmt, opts.Template)
+			return err
+		}))
+	}
+	args := []string{"-no-filewrite", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-o", "test-patch-stmts"}, args...)))
+	assert.Equal(t, out.String(), "6/8\n")
+
+	// Flags reach registered formats as options.
+	c = newTestCommand(t)
+	out.Reset()
+	c.stdout = &out
+	assert.NilError(t, c.Run(append([]string{"-o", "test-patch-stmts", "-tmpl", " patch"}, args...)))
+	assert.Equal(t, out.String(), "6/8 patch\n")
+
+	c = newTestCommand(t)
+	err := c.Run(append([]string{"-o", "yaml"}, args...))
+	assert.ErrorContains(t, err, `unknown output format "yaml", expected one of: badge, clover, cobertura, comment, diff, html, json, markdown, ndjson, profile-subset, sarif, tap, template, test-patch-stmts, uncovered`)
+}
+
+// The command computes coverage with the patchcover package rather than a
+// copy of its own, so that ProcessFiles and the command agree.
+var _ func(coverageFile, diffFile, prevCovFile string) (patchcover.CoverageData, error) = patchcover.ProcessFiles
+
+func TestCoverCommand_Run_processFiles(t *testing.T) {
+	cov, err := filepath.Abs("../../testdata/scenarios/new_file/coverage.out")
+	assert.NilError(t, err)
+	diff, err := filepath.Abs("../../testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, err)
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	assert.NilError(t, c.Run([]string{"-no-filewrite", "-o", "json", cov, diff}))
+
+	// ProcessFiles writes uncovered_lines.txt in the working directory.
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+	data, err := patchcover.ProcessFiles(cov, diff, "")
+	assert.NilError(t, err)
+	data.ToolVersion = "1.0.0"
+
+	want, err := json.Marshal(data)
+	assert.NilError(t, err)
+	assert.Equal(t, out.String(), string(want)+"\n")
+}
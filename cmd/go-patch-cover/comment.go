@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// commentMarker is the hidden marker identifying the comment -gh-comment
+// keeps up to date on a pull request or merge request.
+const commentMarker = "<!-- go-patch-cover -->"
+
+// Platforms of -platform.
+const (
+	platformGitHub = "github"
+	platformGitLab = "gitlab"
+)
+
+// platform returns the platform -gh-comment posts to: -platform, or gitlab
+// when run in GitLab CI and github otherwise.
+func (c *CoverCommand) platform() (string, error) {
+	switch c.PlatformFlag {
+	case platformGitHub, platformGitLab:
+		return c.PlatformFlag, nil
+	case "":
+		if os.Getenv("GITLAB_CI") != "" {
+			return platformGitLab, nil
+		}
+		return platformGitHub, nil
+	}
+	return "", fmt.Errorf("invalid -platform %q, expected github or gitlab", c.PlatformFlag)
+}
+
+// markedComment is a comment of a commentThread.
+type markedComment struct {
+	id   int64
+	body string
+	// own reports whether the comment was posted with the token in use.
+	own bool
+}
+
+// commentThread is the comments of a pull request or merge request.
+type commentThread interface {
+	listComments() ([]markedComment, error)
+	createComment(body string) error
+	updateComment(id int64, body string) error
+}
+
+// upsertComment updates the first own comment of the thread holding
+// commentMarker with body, or creates it.
+func upsertComment(t commentThread, body string) error {
+	comments, err := t.listComments()
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		if comment.own && strings.Contains(comment.body, commentMarker) {
+			return t.updateComment(comment.id, body)
+		}
+	}
+	return t.createComment(body)
+}
+
+// checkComment reports the settings -gh-comment is missing on the selected
+// platform, before coverage is computed.
+func (c *CoverCommand) checkComment() error {
+	platform, err := c.platform()
+	if err != nil {
+		return err
+	}
+	if platform == platformGitLab {
+		for _, name := range []string{"CI_PROJECT_ID", "GITLAB_TOKEN"} {
+			if os.Getenv(name) == "" {
+				return fmt.Errorf("-gh-comment requires %s", name)
+			}
+		}
+		_, err := mergeRequestIID()
+		return err
+	}
+
+	if _, err := c.commentPR(); err != nil {
+		return err
+	}
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		return fmt.Errorf("-gh-comment requires GITHUB_TOKEN")
+	}
+	return nil
+}
+
+// postComment posts the markdown comment, of -comment-tmpl or
+// -comment-tmpl-file, as a comment of the pull request or merge request,
+// updating the one posted by a previous run.
+func (c *CoverCommand) postComment(data patchcover.CoverageData) error {
+	platform, err := c.platform()
+	if err != nil {
+		return err
+	}
+	tmpl, err := c.commentTemplate()
+	if err != nil {
+		return err
+	}
+	body := bytes.NewBufferString(commentMarker + "\n")
+	if err := patchcover.RenderCommentOutput(data, tmpl, body); err != nil {
+		return fmt.Errorf("gh-comment output error: %w", err)
+	}
+
+	var thread commentThread
+	if platform == platformGitLab {
+		iid, err := mergeRequestIID()
+		if err != nil {
+			return err
+		}
+		client, err := newGitLabClientFromEnv()
+		if err != nil {
+			return err
+		}
+		thread = mrNotes{client: client, iid: iid}
+	} else {
+		number, err := c.commentPR()
+		if err != nil {
+			return err
+		}
+		client, err := newGitHubClientFromEnv()
+		if err != nil {
+			return err
+		}
+		thread = prComments{client: client, number: number}
+	}
+	return upsertComment(thread, body.String())
+}
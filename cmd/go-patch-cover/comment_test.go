@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// fakeThread is a commentThread recording the comments created and
+// updated.
+type fakeThread struct {
+	comments []markedComment
+	err      error
+	created  []string
+	updated  map[int64]string
+}
+
+func (t *fakeThread) listComments() ([]markedComment, error) {
+	return t.comments, t.err
+}
+
+func (t *fakeThread) createComment(body string) error {
+	t.created = append(t.created, body)
+	return nil
+}
+
+func (t *fakeThread) updateComment(id int64, body string) error {
+	if t.updated == nil {
+		t.updated = make(map[int64]string)
+	}
+	t.updated[id] = body
+	return nil
+}
+
+func Test_upsertComment(t *testing.T) {
+	// A comment of someone else holding the marker, e.g. quoting it, and an
+	// own comment without it.
+	others := []markedComment{
+		{id: 1, body: "> " + commentMarker},
+		{id: 2, body: "LGTM", own: true},
+	}
+
+	thread := &fakeThread{comments: others}
+	assert.NilError(t, upsertComment(thread, "body"))
+	assert.DeepEqual(t, thread.created, []string{"body"})
+	assert.Equal(t, len(thread.updated), 0)
+
+	// The first own comment holding the marker is updated.
+	thread = &fakeThread{comments: append(others,
+		markedComment{id: 3, body: commentMarker + "\nold", own: true},
+		markedComment{id: 4, body: commentMarker + "\nolder", own: true},
+	)}
+	assert.NilError(t, upsertComment(thread, "body"))
+	assert.Equal(t, len(thread.created), 0)
+	assert.DeepEqual(t, thread.updated, map[int64]string{3: "body"})
+
+	thread = &fakeThread{err: errors.New("listing comments")}
+	assert.Error(t, upsertComment(thread, "body"), "listing comments")
+	assert.Equal(t, len(thread.created), 0)
+}
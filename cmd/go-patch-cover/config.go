@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// configEnv is the environment variable naming the -config file when the
+// flag is not set.
+const configEnv = "GO_PATCH_COVER_CONFIG"
+
+// applyConfigFile applies the -config file, or the file named by
+// GO_PATCH_COVER_CONFIG: a JSON object of the fields of a suite of
+// -suites-config, e.g. {"min_patch_coverage": 80, "excludes": ["mocks/*"]}.
+// A named file must exist. The thresholds of flags and of the selected
+// suite take precedence over its own.
+func (c *CoverCommand) applyConfigFile() error {
+	path := c.ConfigFlag
+	if path == "" {
+		path = os.Getenv(configEnv)
+	}
+	if path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	var cfg suiteConfig
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	c.applySuiteConfig(cfg)
+	return nil
+}
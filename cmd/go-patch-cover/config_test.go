@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCoverCommand_Run_config(t *testing.T) {
+	t.Setenv(configEnv, "")
+	dir := t.TempDir()
+	config := filepath.Join(dir, "patch-cover.json")
+	assert.NilError(t, os.WriteFile(config, []byte(`{"min_coverage": 10, "min_patch_coverage": 90, "excludes": ["*/func2.go"]}`), 0o644))
+
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(flags ...string) (*CoverCommand, error) {
+		c := newTestCommand(t)
+		_, _, err := runCommandOn(c, append(flags, args...)...)
+		return c, err
+	}
+
+	// The patch coverage is 75%.
+	c, err := run("-config", config)
+	assert.ErrorContains(t, err, "min-patch-coverage")
+	assert.Equal(t, c.MinCoverageFlag.String(), "10")
+	assert.Equal(t, c.MinPatchFlag.String(), "90")
+	assert.DeepEqual(t, []string(c.ExcludeFlag), []string{"*/func2.go"})
+	assert.Assert(t, !c.MinDeltaFlag.set)
+
+	// Flags take precedence over the thresholds of the file.
+	_, err = run("-config", config, "-min-patch-coverage", "70")
+	assert.NilError(t, err)
+
+	t.Setenv(configEnv, config)
+	c, err = run()
+	assert.ErrorContains(t, err, "min-patch-coverage")
+	assert.Equal(t, c.MinPatchFlag.String(), "90")
+
+	// The flag takes precedence over the environment, and a missing file
+	// is an error rather than no configuration.
+	_, err = run("-config", filepath.Join(dir, "missing.json"))
+	assert.ErrorContains(t, err, "reading config")
+
+	t.Setenv(configEnv, filepath.Join(dir, "missing.json"))
+	_, err = run()
+	assert.ErrorContains(t, err, "reading config")
+
+	typo := filepath.Join(dir, "typo.json")
+	assert.NilError(t, os.WriteFile(typo, []byte(`{"min_patch_covrage": 90}`), 0o644))
+	_, err = run("-config", typo)
+	assert.ErrorContains(t, err, `unknown field "min_patch_covrage"`)
+}
+
+func TestCoverCommand_Run_configSchedule(t *testing.T) {
+	t.Setenv(configEnv, "")
+	now = func() time.Time { return time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = time.Now })
+
+	dir := t.TempDir()
+	writeConfig := func(content string) string {
+		t.Helper()
+		config := filepath.Join(dir, "patch-cover.json")
+		assert.NilError(t, os.WriteFile(config, []byte(content), 0o644))
+		return config
+	}
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(flags ...string) (*CoverCommand, error) {
+		c := newTestCommand(t)
+		_, _, err := runCommandOn(c, append(flags, args...)...)
+		return c, err
+	}
+
+	// The patch coverage is 75%.
+	config := writeConfig(`{"min_patch_coverage": "from 2024-01-01: 70%, from 2024-03-01: 80%"}`)
+	c, err := run("-config", config)
+	assert.ErrorContains(t, err, "min-patch-coverage: patch coverage 75.00% is below the required minimum of 80.00%")
+	assert.Equal(t, c.MinPatchFlag.String(), "from 2024-01-01: 70%, from 2024-03-01: 80%")
+
+	// A schedule of the flag not started yet still takes precedence over
+	// the threshold of the file, and its gate is not checked.
+	config = writeConfig(`{"min_patch_coverage": 100}`)
+	c, err = run("-config", config, "-min-patch-coverage", "from 2099-01-01: 100%")
+	assert.NilError(t, err)
+	assert.Assert(t, !c.MinPatchFlag.set)
+
+	config = writeConfig(`{"min_patch_coverage": true}`)
+	_, err = run("-config", config)
+	assert.ErrorContains(t, err, "invalid threshold true")
+
+	config = writeConfig(`{"min_patch_coverage": "from 2024-13-01: 70%"}`)
+	_, err = run("-config", config)
+	assert.ErrorContains(t, err, "invalid threshold schedule step")
+}
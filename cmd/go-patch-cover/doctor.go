@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// runDoctor prints the result of every setup check of -doctor, with the
+// advice of failed checks, and fails when any check failed.
+func (c *CoverCommand) runDoctor(covFile, diffFile string) error {
+	if diffFile == "" {
+		return fmt.Errorf("missing diff file argument")
+	}
+	diagnostics, err := patchcover.New(c.config()).Diagnose(covFile, diffFile)
+	if err != nil {
+		return fmt.Errorf("processing error: %w", err)
+	}
+
+	failed := 0
+	for _, d := range diagnostics {
+		if d.Passed {
+			fmt.Fprintf(c.stdout, "ok    %s\n", d.Name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(c.stdout, "FAIL  %s\n      %s\n", d.Name, d.Advice)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(diagnostics))
+	}
+	return nil
+}
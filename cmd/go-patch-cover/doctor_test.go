@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCoverCommand_Run_doctor(t *testing.T) {
+	dir := t.TempDir()
+	covFile, diffFile := filepath.Join(dir, "coverage.out"), filepath.Join(dir, "diff.diff")
+	assert.NilError(t, os.WriteFile(diffFile, []byte(`diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4 +4 @@ func A() int {
+-	return 0
++	return 1
+`), 0o644))
+	assert.NilError(t, os.WriteFile(covFile, []byte("mode: set\nexample.com/m/b.go:3.14,5.2 1 1\n"), 0o644))
+
+	c := newTestCommand(t)
+	var out bytes.Buffer
+	c.stdout = &out
+	err := c.Run([]string{"-doctor", covFile, diffFile})
+	assert.Error(t, err, "1 of 5 checks failed")
+	assert.Equal(t, out.String(), `ok    profile-not-empty
+ok    mode-header
+FAIL  diff-matches-profile
+      none of the changed go files matches a profile: compare their paths with -debug-paths, use -modules or -gomod in repositories holding several modules, and check the tests of the changed packages ran
+ok    consistent-paths
+ok    profile-up-to-date
+`)
+
+	assert.NilError(t, os.WriteFile(covFile, []byte("mode: set\nexample.com/m/a.go:3.14,5.2 1 1\n"), 0o644))
+	c = newTestCommand(t)
+	out.Reset()
+	c.stdout = &out
+	assert.NilError(t, c.Run([]string{"-doctor", covFile, diffFile}))
+
+	c = newTestCommand(t)
+	assert.Error(t, c.Run([]string{"-doctor", covFile}), "missing diff file argument")
+}
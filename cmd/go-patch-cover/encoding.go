@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// utf8BOM is the byte order mark some Windows tools need to read UTF-8.
+const utf8BOM = "\xef\xbb\xbf"
+
+// encodingWriter writes output in the newline and charset of
+// -output-encoding: "\n" is written as "\r\n" when crlf is set, and the
+// first write is preceded by a UTF-8 byte order mark when bom is set.
+type encodingWriter struct {
+	w      io.Writer
+	crlf   bool
+	bom    bool
+	lastCR bool
+}
+
+// newEncodingWriter returns a writer to w in the encoding named by
+// -output-encoding: lf, crlf, lf-bom or crlf-bom. The lf encoding writes
+// to w unchanged.
+func newEncodingWriter(w io.Writer, encoding string) (io.Writer, error) {
+	ew := &encodingWriter{w: w}
+	switch encoding {
+	case "", "lf":
+		return w, nil
+	case "crlf":
+		ew.crlf = true
+	case "lf-bom":
+		ew.bom = true
+	case "crlf-bom":
+		ew.crlf, ew.bom = true, true
+	default:
+		return nil, fmt.Errorf("invalid -output-encoding %q, expected lf, crlf, lf-bom or crlf-bom", encoding)
+	}
+	return ew, nil
+}
+
+func (ew *encodingWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if ew.bom {
+		if _, err := io.WriteString(ew.w, utf8BOM); err != nil {
+			return 0, err
+		}
+		ew.bom = false
+	}
+	if !ew.crlf {
+		return ew.w.Write(p)
+	}
+
+	out := make([]byte, 0, len(p)+len(p)/16)
+	for _, b := range p {
+		// Newlines already preceded by "\r" are kept as they are.
+		if b == '\n' && !ew.lastCR {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+		ew.lastCR = b == '\r'
+	}
+	if _, err := ew.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
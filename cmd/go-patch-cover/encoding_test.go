@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_newEncodingWriter(t *testing.T) {
+	tests := map[string]struct {
+		writes []string
+		want   string
+	}{
+		"lf":       {writes: []string{"a\nb\n"}, want: "a\nb\n"},
+		"crlf":     {writes: []string{"a\nb\r\n", "\r", "\nc\n"}, want: "a\r\nb\r\n\r\nc\r\n"},
+		"lf-bom":   {writes: []string{"", "a\n", "b\n"}, want: utf8BOM + "a\nb\n"},
+		"crlf-bom": {writes: []string{"a\n"}, want: utf8BOM + "a\r\n"},
+	}
+	for encoding, tt := range tests {
+		t.Run(encoding, func(t *testing.T) {
+			var out bytes.Buffer
+			w, err := newEncodingWriter(&out, encoding)
+			assert.NilError(t, err)
+			for _, s := range tt.writes {
+				n, err := io.WriteString(w, s)
+				assert.NilError(t, err)
+				assert.Equal(t, n, len(s))
+			}
+			assert.Equal(t, out.String(), tt.want)
+		})
+	}
+
+	_, err := newEncodingWriter(io.Discard, "utf16")
+	assert.Error(t, err, `invalid -output-encoding "utf16", expected lf, crlf, lf-bom or crlf-bom`)
+}
+
+func TestCoverCommand_Run_outputEncoding(t *testing.T) {
+	args := []string{"-no-filewrite", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(args ...string) (string, error) {
+		out, _, err := runCommand(t, args...)
+		return out, err
+	}
+
+	lf, err := run(args...)
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(lf, "\r"))
+	crlf, err := run(append([]string{"-output-encoding", "crlf"}, args...)...)
+	assert.NilError(t, err)
+	assert.Equal(t, crlf, strings.ReplaceAll(lf, "\n", "\r\n"))
+
+	out, err := run(append([]string{"-output-encoding", "crlf-bom", "-o", "json"}, args...)...)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(out, utf8BOM+"{"), out)
+	assert.Assert(t, strings.HasSuffix(out, "}\r\n"), out)
+
+	_, err = run(append([]string{"-output-encoding", "cr"}, args...)...)
+	assert.Error(t, err, `invalid -output-encoding "cr", expected lf, crlf, lf-bom or crlf-bom`)
+}
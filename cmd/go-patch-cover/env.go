@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadEnvFile sets the variables of a dotenv file in the process
+// environment. Variables already set in the environment take precedence
+// over the file.
+func loadEnvFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading env file: %w", err)
+	}
+
+	vars, err := parseDotenv(string(content))
+	if err != nil {
+		return fmt.Errorf("env file %s: %w", path, err)
+	}
+
+	for _, v := range vars {
+		if _, ok := os.LookupEnv(v[0]); ok {
+			continue
+		}
+		if err := os.Setenv(v[0], v[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDotenv parses KEY=value lines, in order. Blank lines and lines
+// starting with # are ignored, as is an "export " prefix. Double quoted
+// values are unescaped, single quoted values are taken literally, and
+// unquoted values end at a " #" comment.
+func parseDotenv(content string) ([][2]string, error) {
+	var vars [][2]string
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=value", i+1)
+		}
+		key := strings.TrimSpace(line[:eq])
+		value := strings.TrimSpace(line[eq+1:])
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value for %s", i+1, key)
+			}
+			value = unquoted
+		case strings.HasPrefix(value, "'"):
+			if len(value) < 2 || !strings.HasSuffix(value, "'") {
+				return nil, fmt.Errorf("line %d: invalid quoted value for %s", i+1, key)
+			}
+			value = value[1 : len(value)-1]
+		default:
+			if j := strings.Index(value, " #"); j >= 0 {
+				value = strings.TrimSpace(value[:j])
+			}
+		}
+
+		vars = append(vars, [2]string{key, value})
+	}
+	return vars, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_parseDotenv(t *testing.T) {
+	vars, err := parseDotenv(`# local overrides
+GITHUB_REPOSITORY=org/repo # inline comment
+export GITHUB_TOKEN="tok\"en"
+
+GITHUB_API_URL='http://localhost:8080 #not a comment'
+EMPTY=
+`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, vars, [][2]string{
+		{"GITHUB_REPOSITORY", "org/repo"},
+		{"GITHUB_TOKEN", `tok"en`},
+		{"GITHUB_API_URL", "http://localhost:8080 #not a comment"},
+		{"EMPTY", ""},
+	})
+
+	_, err = parseDotenv("A=1\nnot a variable\n")
+	assert.Error(t, err, "line 2: expected KEY=value")
+
+	_, err = parseDotenv(`A="unterminated`)
+	assert.Error(t, err, "line 1: invalid quoted value for A")
+}
+
+func Test_loadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NilError(t, os.WriteFile(path, []byte("PATCHCOVER_TEST_FROM_FILE=file\nPATCHCOVER_TEST_FROM_ENV=file\n"), 0o644))
+
+	t.Setenv("PATCHCOVER_TEST_FROM_ENV", "env")
+	// Registers the restoration of the variable set by loadEnvFile.
+	t.Setenv("PATCHCOVER_TEST_FROM_FILE", "")
+	assert.NilError(t, os.Unsetenv("PATCHCOVER_TEST_FROM_FILE"))
+
+	assert.NilError(t, loadEnvFile(path))
+	assert.Equal(t, os.Getenv("PATCHCOVER_TEST_FROM_FILE"), "file")
+	// The environment takes precedence over the file.
+	assert.Equal(t, os.Getenv("PATCHCOVER_TEST_FROM_ENV"), "env")
+
+	err := loadEnvFile(filepath.Join(t.TempDir(), "missing.env"))
+	assert.ErrorContains(t, err, "reading env file")
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// now returns the current time, replaced in tests.
+var now = time.Now
+
+// thresholdFlag is a percentage flag that records whether it was set.
+type thresholdFlag struct {
+	value float64
+	set   bool
+	// schedule is the threshold schedule the value was picked from.
+	schedule string
+}
+
+func (f *thresholdFlag) String() string {
+	if f.schedule != "" {
+		return f.schedule
+	}
+	if !f.set {
+		return ""
+	}
+	return strconv.FormatFloat(f.value, 'f', -1, 64)
+}
+
+// Set parses a percentage written with "." as the decimal separator,
+// regardless of the locale of the environment, or a threshold schedule
+// of percentages applying from UTC dates on, e.g.
+// "from 2024-01-01: 70%, from 2024-06-01: 80%". The value of a schedule
+// is the one applying at the current date; before its first date, the
+// flag is left unset, so its gate is not checked, nor set by a config
+// file or suite.
+func (f *thresholdFlag) Set(v string) error {
+	if strings.HasPrefix(strings.TrimSpace(v), "from ") {
+		value, ok, err := scheduledThreshold(v, now())
+		if err != nil {
+			return err
+		}
+		*f = thresholdFlag{value: value, set: ok, schedule: v}
+		return nil
+	}
+	value, err := parsePercentage(v)
+	if err != nil {
+		return err
+	}
+	f.value = value
+	f.set = true
+	return nil
+}
+
+// UnmarshalJSON decodes a threshold of a config file: a percentage
+// number, or a string parsed by Set, e.g. a threshold schedule.
+func (f *thresholdFlag) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*f = thresholdFlag{value: v, set: true}
+		return nil
+	case string:
+		return f.Set(v)
+	}
+	return fmt.Errorf("invalid threshold %s: expected a percentage or a threshold schedule", b)
+}
+
+// explicit reports whether the threshold was given, including as a
+// schedule whose first date has not arrived, which leaves its gate
+// unchecked rather than open to another threshold.
+func (f *thresholdFlag) explicit() bool {
+	return f.set || f.schedule != ""
+}
+
+func parsePercentage(v string) (float64, error) {
+	if strings.Contains(v, ",") {
+		return 0, fmt.Errorf("invalid percentage %q: use \".\" as the decimal separator", v)
+	}
+	value, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid percentage %q", v)
+	}
+	return value, nil
+}
+
+// scheduledThreshold returns the percentage of the last step of the
+// threshold schedule starting at or before t, and whether there is one.
+// Steps, separated by commas, are written "from YYYY-MM-DD: N%", with
+// increasing dates.
+func scheduledThreshold(schedule string, t time.Time) (float64, bool, error) {
+	var (
+		value float64
+		ok    bool
+		last  time.Time
+	)
+	for _, step := range strings.Split(schedule, ",") {
+		step = strings.TrimSpace(step)
+		colon := strings.Index(step, ":")
+		if !strings.HasPrefix(step, "from ") || colon < 0 {
+			return 0, false, fmt.Errorf("invalid threshold schedule step %q: expected \"from YYYY-MM-DD: N%%\"", step)
+		}
+		from, err := time.Parse("2006-01-02", strings.TrimSpace(step[len("from "):colon]))
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid threshold schedule step %q: %w", step, err)
+		}
+		if !last.IsZero() && !from.After(last) {
+			return 0, false, fmt.Errorf("invalid threshold schedule %q: dates must increase", schedule)
+		}
+		last = from
+		percent, err := parsePercentage(strings.TrimSuffix(strings.TrimSpace(step[colon+1:]), "%"))
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid threshold schedule step %q: %w", step, err)
+		}
+		if !t.UTC().Before(from) {
+			value, ok = percent, true
+		}
+	}
+	return value, ok, nil
+}
+
+// compareModes are the values of -compare-mode, the metric compared with
+// the previous coverage by -min-delta:
+//   - total: the total coverage;
+//   - patch: the patch coverage, against the previous total coverage;
+//   - changed-files: the coverage of the changed files, against their
+//     previous coverage.
+var compareModes = []string{"total", "patch", "changed-files"}
+
+// compareMode returns the compare mode of -min-delta.
+func (c *CoverCommand) compareMode() string {
+	if c.CompareModeFlag == "" {
+		return "total"
+	}
+	return c.CompareModeFlag
+}
+
+// coverageDelta returns the change of the metric of the compare mode since
+// the previous coverage, in percentage points.
+func coverageDelta(data patchcover.CoverageData, mode string) (float64, error) {
+	if data.PatchOnly {
+		return 0, fmt.Errorf("-min-delta requires the total coverage, not computed with -patch-coverage-only")
+	}
+	if !data.HasPrevCoverage {
+		return 0, fmt.Errorf("-min-delta requires a previous coverage file")
+	}
+	switch mode {
+	case "patch":
+		return data.PatchCoverage - data.PrevCoverage, nil
+	case "changed-files":
+		coverage, prevCoverage := patchcover.ChangedFilesCoverage(data.Files)
+		return coverage - prevCoverage, nil
+	}
+	return data.Coverage - data.PrevCoverage, nil
+}
+
+// filesWithPrev returns the files present in the previous coverage,
+// leaving out new files, which have no previous coverage to compare with.
+func filesWithPrev(files []patchcover.FileCoverage) []patchcover.FileCoverage {
+	var withPrev []patchcover.FileCoverage
+	for _, f := range files {
+		if f.PrevNumStmt > 0 {
+			withPrev = append(withPrev, f)
+		}
+	}
+	return withPrev
+}
+
+// checkMinDelta fails unless the metric of the compare mode changed by at
+// least min percentage points since the previous coverage.
+func checkMinDelta(data patchcover.CoverageData, mode string, min float64) error {
+	delta, err := coverageDelta(data, mode)
+	if err != nil {
+		return err
+	}
+	if delta < min {
+		metric := "coverage"
+		switch mode {
+		case "patch":
+			metric = "patch coverage"
+		case "changed-files":
+			metric = "changed files coverage"
+		}
+		return fmt.Errorf("%s delta %.2f%% is below the required minimum of %.2f%%", metric, delta, min)
+	}
+	return nil
+}
+
+// coverageDrop returns by how many percentage points the total coverage
+// dropped since the previous coverage, or false when the previous coverage
+// is unknown. Both percentages are rounded to one decimal first, so that
+// the drop is the difference of the displayed percentages.
+func coverageDrop(data patchcover.CoverageData) (float64, bool) {
+	if !data.HasPrevCoverage || data.PrevNumStmt == 0 {
+		return 0, false
+	}
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	return round(round(data.PrevCoverage) - round(data.Coverage)), true
+}
+
+// checkMaxDrop fails when the total coverage dropped by more than max
+// percentage points since the previous coverage. An unknown previous
+// coverage is no drop.
+func checkMaxDrop(data patchcover.CoverageData, max float64) error {
+	if data.PatchOnly {
+		return fmt.Errorf("total coverage is not computed with -patch-coverage-only")
+	}
+	drop, ok := coverageDrop(data)
+	if ok && drop > max {
+		return fmt.Errorf("coverage dropped %.1f%% (allowed %.1f%%)", drop, max)
+	}
+	return nil
+}
+
+// checkForbiddenUncovered fails when an uncovered added line matches re,
+// listing every offending line.
+func checkForbiddenUncovered(data patchcover.CoverageData, re *regexp.Regexp) error {
+	var offending []string
+	for _, l := range data.UncoveredLines {
+		if re.MatchString(l.LineString) {
+			offending = append(offending, fmt.Sprintf("%s:%d: %s", l.FileName, l.LineNum, strings.TrimSpace(l.LineString)))
+		}
+	}
+	if len(offending) > 0 {
+		return fmt.Errorf("uncovered lines match %q:\n\t%s", re, strings.Join(offending, "\n\t"))
+	}
+	return nil
+}
+
+// checkMinCoverage fails when total coverage is below min percent.
+func checkMinCoverage(data patchcover.CoverageData, min float64) error {
+	if data.PatchOnly {
+		return fmt.Errorf("total coverage is not computed with -patch-coverage-only")
+	}
+	if data.Coverage < min {
+		return fmt.Errorf("total coverage %.2f%% is below the required minimum of %.2f%%", data.Coverage, min)
+	}
+	return nil
+}
+
+// checkMinPatchCoverage fails when patch coverage is below min percent.
+// emptyFails fails patches without statements too, of
+// -empty-patch-coverage 0.
+func checkMinPatchCoverage(data patchcover.CoverageData, min float64, emptyFails bool) error {
+	if data.TotalOnly {
+		return fmt.Errorf("-min-patch-coverage requires a diff")
+	}
+	if data.PatchNumStmt == 0 && !emptyFails {
+		// A patch without statements, e.g. of docs only, has nothing left
+		// uncovered, whatever its patch coverage reads.
+		return nil
+	}
+	if data.PatchCoverage < min {
+		return fmt.Errorf("patch coverage %.2f%% is below the required minimum of %.2f%%", data.PatchCoverage, min)
+	}
+	return nil
+}
+
+// filesBelow returns the changed files whose patch coverage is below min
+// percent, leaving out files of fewer than floor statements.
+func filesBelow(data patchcover.CoverageData, min float64, floor int) []patchcover.FileCoverage {
+	var below []patchcover.FileCoverage
+	for _, f := range data.Files {
+		if f.NumStmt < floor || f.PatchNumStmt == 0 {
+			continue
+		}
+		if f.PatchCoverage < min {
+			below = append(below, f)
+		}
+	}
+	return below
+}
+
+// checkMinFilePatchCoverage fails when the patch coverage of a changed file
+// of at least floor statements is below min percent, listing every such
+// file.
+func checkMinFilePatchCoverage(data patchcover.CoverageData, min float64, floor int) error {
+	var offending []string
+	for _, f := range filesBelow(data, min, floor) {
+		offending = append(offending, fmt.Sprintf("%s: %.2f%% (%d/%d)", f.FileName, f.PatchCoverage, f.PatchCoverCount, f.PatchNumStmt))
+	}
+	if len(offending) > 0 {
+		return fmt.Errorf("file patch coverage is below the required minimum of %.2f%%:\n\t%s", min, strings.Join(offending, "\n\t"))
+	}
+	return nil
+}
+
+// packagesBelow returns the packages whose total coverage is below min
+// percent. Packages removed since the previous coverage are left out.
+func packagesBelow(data patchcover.CoverageData, min float64) []patchcover.PackageCoverage {
+	var below []patchcover.PackageCoverage
+	for _, pkg := range data.Packages {
+		if pkg.Removed || pkg.NumStmt == 0 {
+			continue
+		}
+		if pkg.Coverage < min {
+			below = append(below, pkg)
+		}
+	}
+	return below
+}
+
+// checkPerPackageCoverage fails when the total coverage of a package is
+// below min percent, listing every such package.
+func checkPerPackageCoverage(data patchcover.CoverageData, min float64) error {
+	if data.PatchOnly {
+		return fmt.Errorf("package coverage is not computed with -patch-coverage-only")
+	}
+	var offending []string
+	for _, pkg := range packagesBelow(data, min) {
+		offending = append(offending, fmt.Sprintf("%s: %.2f%% (%d/%d)", pkg.Package, pkg.Coverage, pkg.CoverCount, pkg.NumStmt))
+	}
+	if len(offending) > 0 {
+		return fmt.Errorf("package coverage is below the required minimum of %.2f%%:\n\t%s", min, strings.Join(offending, "\n\t"))
+	}
+	return nil
+}
+
+// uncoveredFunctions returns the functions holding changed statements of
+// which none is covered.
+func uncoveredFunctions(data patchcover.CoverageData) []patchcover.FunctionCoverage {
+	var uncovered []patchcover.FunctionCoverage
+	for _, fn := range data.Functions {
+		if fn.PatchNumStmt > 0 && fn.PatchCoverCount == 0 {
+			uncovered = append(uncovered, fn)
+		}
+	}
+	return uncovered
+}
+
+// checkChangedFunctions fails when a function holding changed statements
+// has none of them covered, listing every such function.
+func checkChangedFunctions(data patchcover.CoverageData) error {
+	var offending []string
+	for _, fn := range uncoveredFunctions(data) {
+		offending = append(offending, fmt.Sprintf("%s:%d: %s", fn.FileName, fn.Line, fn.Name))
+	}
+	if len(offending) > 0 {
+		return fmt.Errorf("changed functions have no covered added statement:\n\t%s", strings.Join(offending, "\n\t"))
+	}
+	return nil
+}
+
+// gateResult is the outcome of one configured gate.
+type gateResult struct {
+	name      string
+	threshold string
+	actual    string
+	err       error
+}
+
+// evaluateGates evaluates every configured gate, in a fixed order, rather
+// than stopping at the first failure.
+func (c *CoverCommand) evaluateGates(data patchcover.CoverageData, forbidRegex *regexp.Regexp) []gateResult {
+	var gates []gateResult
+	percent := func(v float64) string { return fmt.Sprintf("%.2f%%", v) }
+
+	if c.MinCoverageFlag.set {
+		gates = append(gates, gateResult{
+			name:      "min-coverage",
+			threshold: percent(c.MinCoverageFlag.value),
+			actual:    percent(data.Coverage),
+			err:       checkMinCoverage(data, c.MinCoverageFlag.value),
+		})
+	}
+
+	if c.MinPatchFlag.set {
+		gates = append(gates, gateResult{
+			name:      "min-patch-coverage",
+			threshold: percent(c.MinPatchFlag.value),
+			actual:    percent(data.PatchCoverage),
+			err:       checkMinPatchCoverage(data, c.MinPatchFlag.value, c.EmptyPatchFlag == "0"),
+		})
+	}
+
+	if c.MinFilePatchFlag.set {
+		below := filesBelow(data, c.MinFilePatchFlag.value, c.CoverageFloorFlag)
+		gates = append(gates, gateResult{
+			name:      "min-file-patch-coverage",
+			threshold: percent(c.MinFilePatchFlag.value),
+			actual:    fmt.Sprintf("%d files below", len(below)),
+			err:       checkMinFilePatchCoverage(data, c.MinFilePatchFlag.value, c.CoverageFloorFlag),
+		})
+	}
+
+	if c.PerPackageFlag.set {
+		gates = append(gates, gateResult{
+			name:      "per-package-fail-under",
+			threshold: percent(c.PerPackageFlag.value),
+			actual:    fmt.Sprintf("%d packages below", len(packagesBelow(data, c.PerPackageFlag.value))),
+			err:       checkPerPackageCoverage(data, c.PerPackageFlag.value),
+		})
+	}
+
+	if c.MinDeltaFlag.set {
+		deltaData := data
+		if c.MissingPrevFlag {
+			deltaData.Files = filesWithPrev(data.Files)
+		}
+		actual := "unknown"
+		if delta, err := coverageDelta(deltaData, c.compareMode()); err == nil {
+			actual = percent(delta)
+		}
+		gates = append(gates, gateResult{
+			name:      "min-delta",
+			threshold: percent(c.MinDeltaFlag.value),
+			actual:    actual,
+			err:       checkMinDelta(deltaData, c.compareMode(), c.MinDeltaFlag.value),
+		})
+	}
+
+	if c.MaxDropFlag.set {
+		actual := "unknown"
+		if drop, ok := coverageDrop(data); ok {
+			actual = percent(drop)
+		}
+		gates = append(gates, gateResult{
+			name:      "max-drop",
+			threshold: percent(c.MaxDropFlag.value),
+			actual:    actual,
+			err:       checkMaxDrop(data, c.MaxDropFlag.value),
+		})
+	}
+
+	if forbidRegex != nil {
+		matching := 0
+		for _, l := range data.UncoveredLines {
+			if forbidRegex.MatchString(l.LineString) {
+				matching++
+			}
+		}
+		gates = append(gates, gateResult{
+			name:      "forbid-uncovered-regex",
+			threshold: forbidRegex.String(),
+			actual:    fmt.Sprintf("%d matching lines", matching),
+			err:       checkForbiddenUncovered(data, forbidRegex),
+		})
+	}
+
+	if c.ChangedFuncsFlag {
+		gates = append(gates, gateResult{
+			name:      "require-coverage-for-changed-funcs",
+			threshold: "1 covered statement",
+			actual:    fmt.Sprintf("%d uncovered functions", len(uncoveredFunctions(data))),
+			err:       checkChangedFunctions(data),
+		})
+	}
+
+	return gates
+}
+
+// tapGates returns the TAP test points of the gates.
+func tapGates(gates []gateResult) []patchcover.TAPResult {
+	results := make([]patchcover.TAPResult, 0, len(gates))
+	for _, g := range gates {
+		results = append(results, patchcover.TAPResult{
+			OK:          g.err == nil,
+			Description: fmt.Sprintf("gate %s: %s (threshold %s)", g.name, g.actual, g.threshold),
+		})
+	}
+	return results
+}
+
+// writeGateTable writes a table of the gates and whether they passed.
+func writeGateTable(out io.Writer, gates []gateResult) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GATE\tTHRESHOLD\tACTUAL\tRESULT")
+	for _, g := range gates {
+		result := "pass"
+		if g.err != nil {
+			result = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", g.name, g.threshold, g.actual, result)
+	}
+	return w.Flush()
+}
+
+// gatesError returns an error listing every failed gate, or nil when all
+// gates passed.
+func gatesError(gates []gateResult) error {
+	var failures []string
+	for _, g := range gates {
+		if g.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", g.name, g.err))
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d gates failed:\n%s", len(failures), len(gates), strings.Join(failures, "\n"))
+}
+
+// failMessageData is the data -fail-message-tmpl is executed with.
+type failMessageData struct {
+	patchcover.CoverageData
+	Gates []failMessageGate
+}
+
+// failMessageGate describes one configured gate to -fail-message-tmpl.
+type failMessageGate struct {
+	Name      string
+	Threshold string
+	Actual    string
+	Passed    bool
+	Error     string
+}
+
+// failMessageError returns an error whose message is tmpl executed with
+// data and every configured gate.
+func failMessageError(tmpl *template.Template, data patchcover.CoverageData, gates []gateResult) error {
+	d := failMessageData{CoverageData: data}
+	for _, g := range gates {
+		fg := failMessageGate{Name: g.name, Threshold: g.threshold, Actual: g.actual, Passed: g.err == nil}
+		if g.err != nil {
+			fg.Error = g.err.Error()
+		}
+		d.Gates = append(d.Gates, fg)
+	}
+
+	var msg strings.Builder
+	if err := tmpl.Execute(&msg, d); err != nil {
+		return fmt.Errorf("rendering -fail-message-tmpl: %w", err)
+	}
+	return errors.New(strings.TrimRight(msg.String(), "\n"))
+}
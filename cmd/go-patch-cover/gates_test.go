@@ -0,0 +1,277 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+	"gotest.tools/v3/assert"
+)
+
+func Test_checkMinDelta(t *testing.T) {
+	tests := map[string]struct {
+		coverage        float64
+		prevCoverage    float64
+		min             float64
+		wantErrContains string
+	}{
+		"improving":            {coverage: 80.5, prevCoverage: 80, min: 0},
+		"improving at bound":   {coverage: 80.5, prevCoverage: 80, min: 0.5},
+		"improving too little": {coverage: 80.5, prevCoverage: 80, min: 0.75, wantErrContains: "coverage delta 0.50% is below the required minimum of 0.75%"},
+		"flat":                 {coverage: 80, prevCoverage: 80, min: 0},
+		"flat must improve":    {coverage: 80, prevCoverage: 80, min: 0.25, wantErrContains: "coverage delta 0.00%"},
+		"regressing":           {coverage: 79.75, prevCoverage: 80, min: 0, wantErrContains: "coverage delta -0.25%"},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			data := patchcover.CoverageData{
+				HasPrevCoverage: true,
+				Coverage:        tt.coverage,
+				PrevCoverage:    tt.prevCoverage,
+			}
+			err := checkMinDelta(data, "total", tt.min)
+			if tt.wantErrContains != "" {
+				assert.ErrorContains(t, err, tt.wantErrContains)
+				return
+			}
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func Test_checkMinDelta_noPrevCoverage(t *testing.T) {
+	err := checkMinDelta(patchcover.CoverageData{Coverage: 100}, "total", 0)
+	assert.ErrorContains(t, err, "requires a previous coverage file")
+}
+
+func Test_checkMaxDrop(t *testing.T) {
+	tests := map[string]struct {
+		data    patchcover.CoverageData
+		max     float64
+		wantErr string
+	}{
+		"improving":      {data: patchcover.CoverageData{HasPrevCoverage: true, PrevNumStmt: 10, PrevCoverage: 80, Coverage: 82}, max: 0},
+		"dropping":       {data: patchcover.CoverageData{HasPrevCoverage: true, PrevNumStmt: 10, PrevCoverage: 80, Coverage: 77.7}, max: 0.5, wantErr: "coverage dropped 2.3% (allowed 0.5%)"},
+		"at the bound":   {data: patchcover.CoverageData{HasPrevCoverage: true, PrevNumStmt: 10, PrevCoverage: 80, Coverage: 79.5}, max: 0.5},
+		"rounded":        {data: patchcover.CoverageData{HasPrevCoverage: true, PrevNumStmt: 10, PrevCoverage: 80.04, Coverage: 79.46}, max: 0.5},
+		"rounded beyond": {data: patchcover.CoverageData{HasPrevCoverage: true, PrevNumStmt: 10, PrevCoverage: 80.05, Coverage: 79.5}, max: 0.5, wantErr: "coverage dropped 0.6% (allowed 0.5%)"},
+		"no prev":        {data: patchcover.CoverageData{Coverage: 10}, max: 0},
+		"new package":    {data: patchcover.CoverageData{HasPrevCoverage: true, Coverage: 10}, max: 0},
+		"patch only":     {data: patchcover.CoverageData{PatchOnly: true}, max: 0, wantErr: "total coverage is not computed with -patch-coverage-only"},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			err := checkMaxDrop(tt.data, tt.max)
+			if tt.wantErr != "" {
+				assert.Error(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func Test_thresholdFlag_Set(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    float64
+		wantErr string
+	}{
+		"integer":         {value: "80", want: 80},
+		"decimal":         {value: "80.0", want: 80},
+		"fraction":        {value: "82.5", want: 82.5},
+		"negative":        {value: "-0.5", want: -0.5},
+		"comma separator": {value: "80,0", wantErr: `invalid percentage "80,0": use "." as the decimal separator`},
+		"not a number":    {value: "eighty", wantErr: `invalid percentage "eighty"`},
+		"nan":             {value: "NaN", wantErr: `invalid percentage "NaN"`},
+		"infinite":        {value: "Inf", wantErr: `invalid percentage "Inf"`},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var f thresholdFlag
+			err := f.Set(tt.value)
+			if tt.wantErr != "" {
+				assert.Error(t, err, tt.wantErr)
+				assert.Assert(t, !f.set)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Assert(t, f.set)
+			assert.Equal(t, f.value, tt.want)
+		})
+	}
+}
+
+func Test_scheduledThreshold(t *testing.T) {
+	const schedule = "from 2024-01-01: 70%, from 2024-06-01: 80%"
+	tests := map[string]struct {
+		date   string
+		want   float64
+		wantOK bool
+	}{
+		"before":           {date: "2023-12-31T23:59:59Z"},
+		"first day":        {date: "2024-01-01T00:00:00Z", want: 70, wantOK: true},
+		"first step":       {date: "2024-05-31T12:00:00Z", want: 70, wantOK: true},
+		"second day":       {date: "2024-06-01T00:00:00Z", want: 80, wantOK: true},
+		"after":            {date: "2025-03-01T00:00:00Z", want: 80, wantOK: true},
+		"other time zones": {date: "2024-06-01T01:00:00+02:00", want: 70, wantOK: true},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			date, err := time.Parse(time.RFC3339, tt.date)
+			assert.NilError(t, err)
+			got, ok, err := scheduledThreshold(schedule, date)
+			assert.NilError(t, err)
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+
+	for schedule, wantErr := range map[string]string{
+		"from 2024-01-01 70":                      `invalid threshold schedule step "from 2024-01-01 70": expected "from YYYY-MM-DD: N%"`,
+		"from 2024-13-01: 70":                     `invalid threshold schedule step "from 2024-13-01: 70": parsing time`,
+		"from 2024-01-01: seventy%":               `invalid threshold schedule step "from 2024-01-01: seventy%": invalid percentage "seventy"`,
+		"from 2024-06-01: 80, from 2024-01-01: 7": `invalid threshold schedule "from 2024-06-01: 80, from 2024-01-01: 7": dates must increase`,
+	} {
+		_, _, err := scheduledThreshold(schedule, time.Now())
+		assert.ErrorContains(t, err, wantErr)
+	}
+}
+
+func TestCoverCommand_Run_thresholdSchedule(t *testing.T) {
+	run := func(date string, args ...string) (*CoverCommand, error) {
+		t.Helper()
+		d, err := time.Parse("2006-01-02", date)
+		assert.NilError(t, err)
+		now = func() time.Time { return d }
+		t.Cleanup(func() { now = time.Now })
+
+		c := newTestCommand(t)
+		_, _, err = runCommandOn(c, append(args, "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff")...)
+		return c, err
+	}
+	// The patch coverage is 75%.
+	const schedule = "from 2024-01-01: 70%, from 2024-06-01: 80%"
+
+	c, err := run("2024-03-15", "-min-patch-coverage", schedule)
+	assert.NilError(t, err)
+	assert.Equal(t, c.MinPatchFlag.value, 70.0)
+	assert.Equal(t, c.MinPatchFlag.String(), schedule)
+
+	c, err = run("2024-06-01", "-min-patch-coverage", schedule)
+	assert.ErrorContains(t, err, "min-patch-coverage: patch coverage 75.00% is below the required minimum of 80.00%")
+	assert.Equal(t, c.MinPatchFlag.value, 80.0)
+
+	// Before the first date, the gate is not checked.
+	c, err = run("2023-06-01", "-min-patch-coverage", schedule)
+	assert.NilError(t, err)
+	assert.Assert(t, !c.MinPatchFlag.set)
+}
+
+func Test_checkChangedFunctions(t *testing.T) {
+	data := patchcover.CoverageData{
+		Functions: []patchcover.FunctionCoverage{
+			{FileName: "pkg/a.go", Name: "Covered", Line: 3, PatchNumStmt: 2, PatchCoverCount: 1},
+			{FileName: "pkg/a.go", Name: "Store.Get", Line: 10, PatchNumStmt: 3},
+			{FileName: "pkg/b.go", Name: "Run", Line: 5, PatchNumStmt: 1},
+		},
+	}
+	err := checkChangedFunctions(data)
+	assert.Error(t, err, `changed functions have no covered added statement:
+	pkg/a.go:10: Store.Get
+	pkg/b.go:5: Run`)
+
+	data.Functions = data.Functions[:1]
+	assert.NilError(t, checkChangedFunctions(data))
+}
+
+func Test_checkForbiddenUncovered(t *testing.T) {
+	data := patchcover.CoverageData{
+		UncoveredLines: []patchcover.UncoveredLine{
+			{FileName: "pkg/a.go", LineNum: 10, LineString: "\t\tpanic(err)"},
+			{FileName: "pkg/a.go", LineNum: 12, LineString: "\t\treturn nil"},
+			{FileName: "pkg/b.go", LineNum: 3, LineString: "\tlog.Fatal(err)"},
+		},
+	}
+
+	err := checkForbiddenUncovered(data, regexp.MustCompile(`panic\(|log\.Fatal\(`))
+	assert.Error(t, err, `uncovered lines match "panic\\(|log\\.Fatal\\(":
+	pkg/a.go:10: panic(err)
+	pkg/b.go:3: log.Fatal(err)`)
+
+	err = checkForbiddenUncovered(data, regexp.MustCompile(`os\.Exit\(`))
+	assert.NilError(t, err)
+}
+
+func Test_checkMinCoverage(t *testing.T) {
+	data := patchcover.CoverageData{Coverage: 75, PatchCoverage: 90, PatchNumStmt: 10, PatchCoverCount: 9}
+
+	assert.NilError(t, checkMinCoverage(data, 75))
+	assert.Error(t, checkMinCoverage(data, 75.5), "total coverage 75.00% is below the required minimum of 75.50%")
+
+	assert.NilError(t, checkMinPatchCoverage(data, 90, false))
+	assert.Error(t, checkMinPatchCoverage(data, 95, false), "patch coverage 90.00% is below the required minimum of 95.00%")
+
+	// Without changed statements, there is nothing to cover, unless the
+	// empty patch coverage is 0.
+	assert.NilError(t, checkMinPatchCoverage(patchcover.CoverageData{}, 100, false))
+	assert.Error(t, checkMinPatchCoverage(patchcover.CoverageData{}, 100, true), "patch coverage 0.00% is below the required minimum of 100.00%")
+}
+
+func Test_checkPerPackageCoverage(t *testing.T) {
+	data := patchcover.CoverageData{Packages: []patchcover.PackageCoverage{
+		{Package: "example.com/m/a", NumStmt: 4, CoverCount: 3, Coverage: 75},
+		{Package: "example.com/m/b", NumStmt: 2, CoverCount: 2, Coverage: 100},
+		{Package: "example.com/m/c", Removed: true},
+	}}
+
+	assert.NilError(t, checkPerPackageCoverage(data, 75))
+	assert.Error(t, checkPerPackageCoverage(data, 80), `package coverage is below the required minimum of 80.00%:
+	example.com/m/a: 75.00% (3/4)`)
+
+	assert.ErrorContains(t, checkPerPackageCoverage(patchcover.CoverageData{PatchOnly: true}, 80), "not computed with -patch-coverage-only")
+}
+
+func TestCoverCommand_Run_perPackageFailUnder(t *testing.T) {
+	coverage := filepath.Join(t.TempDir(), "coverage.out")
+	assert.NilError(t, os.WriteFile(coverage, []byte(`mode: set
+example.com/m/a/a.go:3.14,5.2 1 1
+example.com/m/a/a.go:7.14,9.2 1 0
+example.com/m/b/b.go:3.14,5.2 2 1
+`), 0o644))
+
+	run := func(threshold string) (string, error) {
+		out, _, err := runCommand(t, "-per-package-fail-under", threshold, coverage, "../../testdata/scenarios/new_file/diff.diff")
+		return out, err
+	}
+
+	// Package a is 50% covered, package b 100%.
+	out, err := run("60")
+	assert.ErrorContains(t, err, "per-package-fail-under: package coverage is below the required minimum of 60.00%:\n\texample.com/m/a: 50.00% (1/2)")
+	assert.Assert(t, !strings.Contains(err.Error(), "example.com/m/b"), err.Error())
+	assert.Assert(t, strings.Contains(out, "package example.com/m/a: 50.0%\npackage example.com/m/b: 100.0%\n"), out)
+
+	_, err = run("50")
+	assert.NilError(t, err)
+}
+
+func TestCoverCommand_Run_minPatchCoverage(t *testing.T) {
+	run := func(args ...string) (string, error) {
+		out, _, err := runCommand(t, args...)
+		return out, err
+	}
+
+	// The patch coverage is 75%, and the output written before failing.
+	out, err := run("-min-patch-coverage", "80", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff")
+	assert.ErrorContains(t, err, "min-patch-coverage: patch coverage 75.00% is below the required minimum of 80.00%")
+	assert.Assert(t, strings.Contains(out, "patch coverage: 75.0% of changed statements (6/8)"), out)
+
+	// A patch changing no statement does not fail.
+	out, err = run("-min-patch-coverage", "100", "-path", "Makefile", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(out, "patch coverage: 100.0% of changed statements (0/0)"), out)
+}
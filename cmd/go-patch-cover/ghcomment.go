@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// issueComment is a comment of the issue comments endpoints.
+type issueComment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+	User struct {
+		Login string `json:"login"`
+		Type  string `json:"type"`
+	} `json:"user"`
+}
+
+// commentPR returns the pull request -gh-comment comments on: -pr, or the
+// PR_NUMBER environment variable.
+func (c *CoverCommand) commentPR() (int, error) {
+	if c.PRFlag > 0 {
+		return c.PRFlag, nil
+	}
+	v := os.Getenv("PR_NUMBER")
+	if v == "" {
+		return 0, fmt.Errorf("-gh-comment requires -pr or PR_NUMBER")
+	}
+	number, err := strconv.Atoi(v)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid PR_NUMBER %q: expected a pull request number", v)
+	}
+	return number, nil
+}
+
+// viewerLogin returns the login of the user the token authenticates, or ""
+// for tokens of GitHub Apps, such as the GITHUB_TOKEN of GitHub Actions,
+// which cannot read it.
+func (c *githubClient) viewerLogin() (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if _, err := c.do(http.MethodGet, "/user", nil, &user); err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.statusCode == http.StatusForbidden {
+			return "", nil
+		}
+		return "", err
+	}
+	return user.Login, nil
+}
+
+// prComments is the comments of a GitHub pull request.
+type prComments struct {
+	client *githubClient
+	number int
+}
+
+// listComments returns the comments of the pull request. The comments of
+// the user of the token are the own ones, or those of a bot for tokens of
+// GitHub Apps.
+func (t prComments) listComments() ([]markedComment, error) {
+	login, err := t.client.viewerLogin()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []markedComment
+	url := fmt.Sprintf("/repos/%s/%s/issues/%d/comments?per_page=100", t.client.owner, t.client.repo, t.number)
+	for url != "" {
+		var comments []issueComment
+		link, err := t.client.do(http.MethodGet, url, nil, &comments)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			own := comment.User.Login == login
+			if login == "" {
+				own = comment.User.Type == "Bot"
+			}
+			list = append(list, markedComment{id: comment.ID, body: comment.Body, own: own})
+		}
+
+		url = ""
+		if m := nextLinkRe.FindStringSubmatch(link); m != nil {
+			url = m[1]
+		}
+	}
+	return list, nil
+}
+
+func (t prComments) createComment(body string) error {
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = t.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/comments", t.client.owner, t.client.repo, t.number), bytes.NewReader(payload), nil)
+	return err
+}
+
+func (t prComments) updateComment(id int64, body string) error {
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = t.client.do(http.MethodPatch, fmt.Sprintf("/repos/%s/%s/issues/comments/%d", t.client.owner, t.client.repo, id), bytes.NewReader(payload), nil)
+	return err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+// commentsCall is the call listing the comments of pull request 1 of
+// octo/repo.
+const commentsCall = "GET /repos/octo/repo/issues/1/comments?per_page=100"
+
+func Test_prComments(t *testing.T) {
+	api := newMockAPI(t, "Authorization", "Bearer secret")
+	setGitHubEnv(t, api.URL)
+	api.respond(commentsCall, apiResponse{
+		header: map[string]string{"Link": fmt.Sprintf(`<%s/repos/octo/repo/issues/1/comments?per_page=100&page=2>; rel="next"`, api.URL)},
+		body:   `[{"id": 1, "body": "a", "user": {"login": "someone", "type": "User"}}]`,
+	})
+	api.respond(commentsCall+"&page=2", apiResponse{
+		body: `[{"id": 2, "body": "b", "user": {"login": "octocat", "type": "User"}}, {"id": 3, "body": "c", "user": {"login": "github-actions[bot]", "type": "Bot"}}]`,
+	})
+	api.respond("POST /repos/octo/repo/issues/1/comments", apiResponse{status: http.StatusCreated, body: "{}"})
+	api.respond("PATCH /repos/octo/repo/issues/comments/2", apiResponse{body: "{}"})
+
+	client, err := newGitHubClientFromEnv()
+	assert.NilError(t, err)
+	thread := prComments{client: client, number: 1}
+
+	t.Run("user token", func(t *testing.T) {
+		api.respond("GET /user", apiResponse{body: `{"login": "octocat"}`})
+		comments, err := thread.listComments()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, comments, []markedComment{{id: 1, body: "a"}, {id: 2, body: "b", own: true}, {id: 3, body: "c"}}, cmp.AllowUnexported(markedComment{}))
+	})
+
+	t.Run("app token", func(t *testing.T) {
+		// The comments of its bot are the own ones.
+		api.respond("GET /user", apiResponse{status: http.StatusForbidden, body: `{"message":"Resource not accessible by integration"}`})
+		comments, err := thread.listComments()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, comments, []markedComment{{id: 1, body: "a"}, {id: 2, body: "b"}, {id: 3, body: "c", own: true}}, cmp.AllowUnexported(markedComment{}))
+	})
+
+	t.Run("create and update", func(t *testing.T) {
+		n := len(api.requests())
+		assert.NilError(t, thread.createComment("new"))
+		assert.NilError(t, thread.updateComment(2, "updated"))
+		assert.DeepEqual(t, api.requests()[n:], []apiRequest{
+			{call: "POST /repos/octo/repo/issues/1/comments", body: `{"body":"new"}`},
+			{call: "PATCH /repos/octo/repo/issues/comments/2", body: `{"body":"updated"}`},
+		}, cmp.AllowUnexported(apiRequest{}))
+	})
+}
+
+// postedBodies returns the bodies of the comments posted to api.
+func postedBodies(t *testing.T, api *mockAPI) []string {
+	t.Helper()
+	var bodies []string
+	for _, r := range api.requests() {
+		if strings.HasPrefix(r.call, "POST ") {
+			var comment struct {
+				Body string `json:"body"`
+			}
+			assert.NilError(t, json.Unmarshal([]byte(r.body), &comment))
+			bodies = append(bodies, comment.Body)
+		}
+	}
+	return bodies
+}
+
+func TestCoverCommand_Run_ghComment(t *testing.T) {
+	args := []string{"-gh-comment", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(args ...string) error {
+		_, _, err := runCommand(t, args...)
+		return err
+	}
+
+	t.Run("comment", func(t *testing.T) {
+		api := newMockAPI(t, "Authorization", "Bearer secret")
+		api.respond("GET /user", apiResponse{body: `{"login": "octocat"}`})
+		api.respond(commentsCall, apiResponse{body: "[]"})
+		api.respond("POST /repos/octo/repo/issues/1/comments", apiResponse{status: http.StatusCreated, body: "{}"})
+		setGitHubEnv(t, api.URL)
+		t.Setenv("PR_NUMBER", "1")
+
+		assert.NilError(t, run(args...))
+		assert.NilError(t, run(append([]string{"-comment-tmpl", "{{ .PatchCoverage }}"}, args...)...))
+
+		bodies := postedBodies(t, api)
+		assert.Equal(t, len(bodies), 2)
+		assert.Assert(t, strings.HasPrefix(bodies[0], commentMarker+"\n"), bodies[0])
+		assert.Assert(t, strings.Contains(bodies[0], "| Patch    | 75.0% (6/8) |"), bodies[0])
+		assert.Equal(t, bodies[1], commentMarker+"\n75")
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+		}))
+		defer srv.Close()
+		setGitHubEnv(t, srv.URL)
+		t.Setenv("PR_NUMBER", "1")
+
+		assert.Error(t, run(args...), `github: GET /user: 401 Unauthorized: {"message":"Bad credentials"}`)
+	})
+
+	t.Run("missing settings", func(t *testing.T) {
+		t.Setenv("GITLAB_CI", "")
+		t.Setenv("GITHUB_TOKEN", "secret")
+		t.Setenv("PR_NUMBER", "")
+		assert.Error(t, run(args...), "-gh-comment requires -pr or PR_NUMBER")
+		t.Setenv("PR_NUMBER", "one")
+		assert.Error(t, run(args...), `invalid PR_NUMBER "one": expected a pull request number`)
+
+		t.Setenv("PR_NUMBER", "1")
+		t.Setenv("GITHUB_TOKEN", "")
+		assert.Error(t, run(args...), "-gh-comment requires GITHUB_TOKEN")
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// Commit status contexts of -gh-status, by suite: branch protection rules
+// require them by name.
+const (
+	unitTestContext    = "go-patch-cover/unit"
+	integrationContext = "go-patch-cover/integration"
+)
+
+// maxStatusDescription is the length GitHub limits commit status
+// descriptions to.
+const maxStatusDescription = 140
+
+// statusContext returns the commit status context of the suite selected by
+// -suite, or the TEST_TYPE environment variable: unitTestContext without a
+// suite.
+func (c *CoverCommand) statusContext() string {
+	suite := c.SuiteFlag
+	if suite == "" {
+		suite = os.Getenv("TEST_TYPE")
+	}
+	switch suite {
+	case "", "unit":
+		return unitTestContext
+	case "integration":
+		return integrationContext
+	}
+	return "go-patch-cover/" + suite
+}
+
+// statusDescription returns the patch coverage, followed by the failed
+// gates if any, truncated to maxStatusDescription.
+func statusDescription(data patchcover.CoverageData, gates []gateResult) string {
+	desc := fmt.Sprintf("patch coverage %.1f%% (%d/%d)", data.PatchCoverage, data.PatchCoverCount, data.PatchNumStmt)
+	var failed []string
+	for _, g := range gates {
+		if g.err != nil {
+			failed = append(failed, g.name)
+		}
+	}
+	if len(failed) > 0 {
+		desc += ", failed " + strings.Join(failed, ", ")
+	}
+	if r := []rune(desc); len(r) > maxStatusDescription {
+		desc = string(r[:maxStatusDescription-1]) + "…"
+	}
+	return desc
+}
+
+// postStatus sets the commit status of statusContext on the GITHUB_SHA
+// commit: success when the gates passed, failure otherwise.
+func (c *CoverCommand) postStatus(data patchcover.CoverageData, gates []gateResult) error {
+	state := "success"
+	if gatesError(gates) != nil {
+		state = "failure"
+	}
+	payload, err := json.Marshal(map[string]string{
+		"state":       state,
+		"context":     c.statusContext(),
+		"description": statusDescription(data, gates),
+	})
+	if err != nil {
+		return err
+	}
+
+	client, err := newGitHubClientFromEnv()
+	if err != nil {
+		return err
+	}
+	_, err = client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/statuses/%s", client.owner, client.repo, os.Getenv("GITHUB_SHA")), bytes.NewReader(payload), nil)
+	return err
+}
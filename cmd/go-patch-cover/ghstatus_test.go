@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+	"gotest.tools/v3/assert"
+)
+
+func TestCoverCommand_Run_ghStatus(t *testing.T) {
+	const statusCall = "POST /repos/octo/repo/statuses/abc123"
+	api := newMockAPI(t, "Authorization", "Bearer secret")
+	api.respond(statusCall, apiResponse{status: http.StatusCreated, body: "{}"})
+	setGitHubEnv(t, api.URL)
+	t.Setenv("GITHUB_SHA", "abc123")
+	t.Setenv("TEST_TYPE", "")
+
+	run := func(args ...string) error {
+		_, _, err := runCommand(t, append(append([]string{"-gh-status"}, args...), "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff")...)
+		return err
+	}
+	statuses := func() []map[string]string {
+		var statuses []map[string]string
+		for _, r := range api.requests() {
+			assert.Equal(t, r.call, statusCall)
+			var status map[string]string
+			assert.NilError(t, json.Unmarshal([]byte(r.body), &status))
+			statuses = append(statuses, status)
+		}
+		return statuses
+	}
+
+	assert.NilError(t, run("-min-patch-coverage", "70"))
+	assert.DeepEqual(t, statuses()[0], map[string]string{
+		"state":       "success",
+		"context":     unitTestContext,
+		"description": "patch coverage 75.0% (6/8)",
+	})
+
+	t.Setenv("TEST_TYPE", "integration")
+	assert.ErrorContains(t, run("-min-patch-coverage", "80"), "patch coverage")
+	assert.DeepEqual(t, statuses()[1], map[string]string{
+		"state":       "failure",
+		"context":     integrationContext,
+		"description": "patch coverage 75.0% (6/8), failed min-patch-coverage",
+	})
+
+	t.Setenv("GITHUB_SHA", "")
+	assert.Error(t, run(), "-gh-status requires GITHUB_SHA")
+	assert.Equal(t, len(statuses()), 2)
+}
+
+func Test_statusDescription(t *testing.T) {
+	gates := []gateResult{{name: strings.Repeat("x", 200), err: io.EOF}, {name: "min-delta"}}
+	desc := statusDescription(patchcover.CoverageData{PatchCoverage: 100}, gates)
+	assert.Equal(t, len([]rune(desc)), maxStatusDescription)
+	assert.Assert(t, strings.HasPrefix(desc, "patch coverage 100.0% (0/0), failed xxx"), desc)
+	assert.Assert(t, strings.HasSuffix(desc, "x…"), desc)
+}
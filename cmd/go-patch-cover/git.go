@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runGit runs git with args in dir, or in the current directory when dir
+// is empty, and returns its standard output.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// gitMergeBase returns the best common ancestor of a and b.
+func gitMergeBase(dir, a, b string) (string, error) {
+	out, err := runGit(dir, "merge-base", a, b)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// gitLatestTag returns the most recent tag reachable from HEAD.
+func gitLatestTag(dir string) (string, error) {
+	out, err := runGit(dir, "describe", "--tags", "--abbrev=0")
+	if err != nil {
+		if !gitHasTags(dir) {
+			return "", fmt.Errorf("no tag to diff against: the repository has no tags")
+		}
+		return "", shallowCloneError(dir, fmt.Errorf("no tag is reachable from HEAD: %w", err))
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// gitHasTags reports whether the repository in dir has any tag.
+func gitHasTags(dir string) bool {
+	out, err := runGit(dir, "tag", "--list")
+	return err == nil && strings.TrimSpace(out) != ""
+}
+
+// gitBaseBranch returns the branch pull requests of the repository in dir
+// are based on: the default branch of the origin remote, or else the
+// local main or master branch, along with the ref to diff against, the
+// local branch or its origin remote-tracking one.
+func gitBaseBranch(dir, branch string) (name, ref string, err error) {
+	if branch == "" {
+		if out, err := runGit(dir, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil {
+			branch = strings.TrimPrefix(strings.TrimSpace(out), "origin/")
+		}
+	}
+	if branch == "" {
+		for _, b := range []string{"main", "master"} {
+			if gitHasRef(dir, "refs/heads/"+b) || gitHasRef(dir, "refs/remotes/origin/"+b) {
+				branch = b
+				break
+			}
+		}
+	}
+	if branch == "" {
+		return "", "", fmt.Errorf("cannot detect the base branch: there is no origin/HEAD, main or master branch; use -base")
+	}
+
+	if gitHasRef(dir, "refs/heads/"+branch) {
+		return branch, branch, nil
+	}
+	if gitHasRef(dir, "refs/remotes/origin/"+branch) {
+		return branch, "origin/" + branch, nil
+	}
+	return "", "", fmt.Errorf("base branch %s is neither a local branch nor fetched from origin", branch)
+}
+
+// gitHasRef reports whether ref exists in the repository in dir.
+func gitHasRef(dir, ref string) bool {
+	_, err := runGit(dir, "rev-parse", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+// gitIsShallow reports whether the repository in dir is a shallow clone.
+func gitIsShallow(dir string) (bool, error) {
+	out, err := runGit(dir, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "true", nil
+}
+
+// shallowCloneError adds a hint to deepen the clone to err, returned by a
+// git command run in dir, when dir is a shallow clone: missing history is
+// then the likely cause of the failure.
+func shallowCloneError(dir string, err error) error {
+	if shallow, serr := gitIsShallow(dir); serr != nil || !shallow {
+		return err
+	}
+	return fmt.Errorf("%w\nthe repository is a shallow clone, which may lack the history needed: "+
+		"deepen it, e.g. with \"git fetch --unshallow\" or fetch-depth: 0 in actions/checkout, or use -fetch", err)
+}
+
+// gitDiff returns the diff of the working tree against base, in the format
+// go-patch-cover expects. When mergeBase is true, the diff is taken against
+// the merge-base of base and HEAD instead, so only the changes made since
+// branching off base are included. When fetch is true and the repository
+// is a shallow clone lacking that history, the full history is fetched
+// with "git fetch --unshallow" before trying again.
+func gitDiff(dir, base string, mergeBase, fetch bool) (string, error) {
+	return gitRangeDiff(dir, base, "", mergeBase, fetch)
+}
+
+// gitRangeDiff is gitDiff for the diff of base against the head ref rather
+// than the working tree, when head is not empty, e.g. to compare two
+// branches. With mergeBase, the merge-base of base and head is used.
+func gitRangeDiff(dir, base, head string, mergeBase, fetch bool) (string, error) {
+	headRev := head
+	if headRev == "" {
+		headRev = "HEAD"
+	}
+	if mergeBase {
+		mb, err := gitMergeBase(dir, base, headRev)
+		if err != nil && fetch {
+			if shallow, serr := gitIsShallow(dir); serr == nil && shallow {
+				if _, ferr := runGit(dir, "fetch", "-q", "--unshallow"); ferr != nil {
+					return "", ferr
+				}
+				mb, err = gitMergeBase(dir, base, headRev)
+			}
+		}
+		if err != nil {
+			return "", shallowCloneError(dir, err)
+		}
+		base = mb
+	}
+	args := []string{"diff", "-U0", "--no-color", base}
+	if head != "" {
+		args = append(args, head)
+	}
+	out, err := runGit(dir, args...)
+	if err != nil {
+		return "", shallowCloneError(dir, err)
+	}
+	return out, nil
+}
+
+// gitStashDiff returns the diff of the stash entry, e.g. "stash@{0}",
+// against the commit it was created on, in the format go-patch-cover
+// expects.
+func gitStashDiff(dir, stash string) (string, error) {
+	if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", stash+"^{commit}"); err != nil {
+		if _, lerr := runGit(dir, "rev-parse", "--git-dir"); lerr != nil {
+			return "", lerr
+		}
+		return "", fmt.Errorf("no stash entry %s: list entries with \"git stash list\"", stash)
+	}
+	return runGit(dir, "stash", "show", "-p", "-U0", "--no-color", stash)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// scriptedRepo is a git repository created for a test.
+type scriptedRepo struct {
+	t   *testing.T
+	dir string
+}
+
+func newScriptedRepo(t *testing.T) *scriptedRepo {
+	r := &scriptedRepo{t: t, dir: t.TempDir()}
+	r.git("init", "-q", "-b", "main")
+	return r
+}
+
+func (r *scriptedRepo) git(args ...string) string {
+	r.t.Helper()
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)
+	out, err := runGit(r.dir, args...)
+	assert.NilError(r.t, err)
+	return out
+}
+
+func (r *scriptedRepo) write(name, content string) {
+	r.t.Helper()
+	p := filepath.Join(r.dir, name)
+	assert.NilError(r.t, os.MkdirAll(filepath.Dir(p), 0o755))
+	assert.NilError(r.t, os.WriteFile(p, []byte(content), 0o644))
+}
+
+func (r *scriptedRepo) commit(msg string) {
+	r.t.Helper()
+	r.git("add", "-A")
+	r.git("commit", "-q", "-m", msg)
+}
+
+// newDivergedRepo returns a repository whose feature branch, checked out,
+// changed feature.go while main changed main.go after the branch point.
+func newDivergedRepo(t *testing.T) *scriptedRepo {
+	r := newScriptedRepo(t)
+	r.write("go.mod", "module example.com/m\n")
+	r.write("main.go", "package m\n\nfunc Main() int {\n\treturn 1\n}\n")
+	r.write("feature.go", "package m\n")
+	r.commit("initial")
+
+	r.git("checkout", "-q", "-b", "feature")
+	r.write("feature.go", "package m\n\nfunc Feature() int {\n\treturn 2\n}\n")
+	r.commit("feature")
+
+	r.git("checkout", "-q", "main")
+	r.write("main.go", "package m\n\nfunc Main() int {\n\treturn 10\n}\n")
+	r.commit("merged after branching")
+
+	r.git("checkout", "-q", "feature")
+	return r
+}
+
+func Test_gitDiff(t *testing.T) {
+	r := newDivergedRepo(t)
+
+	tip, err := gitDiff(r.dir, "main", false, false)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(tip, "diff --git a/feature.go b/feature.go"))
+	// Against the tip of main, the changes merged after branching show up
+	// reverted.
+	assert.Assert(t, strings.Contains(tip, "diff --git a/main.go b/main.go"))
+
+	mb, err := gitDiff(r.dir, "main", true, false)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(mb, "diff --git a/feature.go b/feature.go"))
+	assert.Assert(t, !strings.Contains(mb, "main.go"))
+}
+
+func Test_gitRangeDiff(t *testing.T) {
+	r := newDivergedRepo(t)
+	// The working tree is not part of the diff.
+	r.git("checkout", "-q", "main")
+	r.write("main.go", "package m\n\nfunc Main() int {\n\treturn 100\n}\n")
+
+	tip, err := gitRangeDiff(r.dir, "main", "feature", false, false)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(tip, "diff --git a/feature.go b/feature.go"))
+	assert.Assert(t, strings.Contains(tip, "-\treturn 10\n+\treturn 1\n"), tip)
+
+	mb, err := gitRangeDiff(r.dir, "main", "feature", true, false)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(mb, "diff --git a/feature.go b/feature.go"))
+	assert.Assert(t, !strings.Contains(mb, "main.go"))
+}
+
+func Test_gitDiff_unknownRef(t *testing.T) {
+	r := newScriptedRepo(t)
+	r.write("a.go", "package a\n")
+	r.commit("initial")
+
+	_, err := gitDiff(r.dir, "no-such-ref", true, false)
+	assert.ErrorContains(t, err, "git merge-base no-such-ref HEAD")
+}
+
+// newShallowClone returns a depth 1 clone of the feature branch of a
+// diverged repository, with the tip of main fetched at depth 1, as CI
+// checkouts commonly are.
+func newShallowClone(t *testing.T) *scriptedRepo {
+	origin := newDivergedRepo(t)
+	r := &scriptedRepo{t: t, dir: t.TempDir()}
+	r.git("clone", "-q", "--depth", "1", "--branch", "feature", "file://"+origin.dir, r.dir)
+	r.git("fetch", "-q", "--depth", "1", "origin", "main:refs/remotes/origin/main")
+	return r
+}
+
+func Test_gitDiff_shallowClone(t *testing.T) {
+	r := newShallowClone(t)
+
+	_, err := gitDiff(r.dir, "origin/main", true, false)
+	assert.ErrorContains(t, err, "the repository is a shallow clone")
+	assert.ErrorContains(t, err, "git fetch --unshallow")
+
+	diff, err := gitDiff(r.dir, "origin/main", true, true)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(diff, "diff --git a/feature.go b/feature.go"))
+	assert.Assert(t, !strings.Contains(diff, "main.go"))
+
+	shallow, err := gitIsShallow(r.dir)
+	assert.NilError(t, err)
+	assert.Assert(t, !shallow)
+}
+
+func Test_gitLatestTag(t *testing.T) {
+	r := newScriptedRepo(t)
+	r.write("a.go", "package a\n")
+	r.commit("initial")
+
+	_, err := gitLatestTag(r.dir)
+	assert.Error(t, err, "no tag to diff against: the repository has no tags")
+
+	r.git("tag", "v1.0.0")
+	r.write("a.go", "package a\n\nvar A = 1\n")
+	r.commit("after v1.0.0")
+	r.git("tag", "v1.1.0")
+	r.write("a.go", "package a\n\nvar A = 2\n")
+	r.commit("after v1.1.0")
+
+	tag, err := gitLatestTag(r.dir)
+	assert.NilError(t, err)
+	assert.Equal(t, tag, "v1.1.0")
+
+	// Tags not reachable from HEAD are ignored.
+	r.git("checkout", "-q", "-b", "old", "v1.0.0")
+	r.git("tag", "-m", "other branch", "v2.0.0", "main")
+	tag, err = gitLatestTag(r.dir)
+	assert.NilError(t, err)
+	assert.Equal(t, tag, "v1.0.0")
+}
+
+func Test_gitStashDiff(t *testing.T) {
+	r := newScriptedRepo(t)
+	r.write("main.go", "package m\n")
+	r.commit("initial")
+
+	_, err := gitStashDiff(r.dir, "stash@{0}")
+	assert.Error(t, err, `no stash entry stash@{0}: list entries with "git stash list"`)
+
+	r.write("main.go", "package m\n\nfunc Main() int {\n\treturn 1\n}\n")
+	r.git("stash", "push", "-q")
+
+	diff, err := gitStashDiff(r.dir, "stash@{0}")
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(diff, "diff --git a/main.go b/main.go"), diff)
+	assert.Assert(t, strings.Contains(diff, "@@ -1,0 +2,4 @@"), diff)
+
+	_, err = gitStashDiff(r.dir, "stash@{1}")
+	assert.ErrorContains(t, err, "no stash entry stash@{1}")
+
+	_, err = gitStashDiff(t.TempDir(), "stash@{0}")
+	assert.ErrorContains(t, err, "not a git repository")
+}
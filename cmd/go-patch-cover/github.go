@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// githubClient is a minimal GitHub REST API client configured from the
+// environment GitHub Actions provides.
+type githubClient struct {
+	baseURL string
+	token   string
+	owner   string
+	repo    string
+	http    *http.Client
+}
+
+// newGitHubClientFromEnv reads GITHUB_TOKEN, GITHUB_REPOSITORY (owner/repo)
+// and the optional GITHUB_API_URL.
+func newGitHubClientFromEnv() (*githubClient, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GITHUB_TOKEN is not set")
+	}
+	repository := os.Getenv("GITHUB_REPOSITORY")
+	parts := strings.Split(repository, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("GITHUB_REPOSITORY must be owner/repo, got %q", repository)
+	}
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+
+	return &githubClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		owner:   parts[0],
+		repo:    parts[1],
+		http:    http.DefaultClient,
+	}, nil
+}
+
+// apiError is a non-2xx response of the API, holding its body.
+type apiError struct {
+	method     string
+	path       string
+	status     string
+	statusCode int
+	body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("github: %s %s: %s: %s", e.method, e.path, e.status, e.body)
+}
+
+// do sends a request to the API and decodes a JSON response into v when v
+// is not nil. It returns the response Link header for pagination.
+func (c *githubClient) do(method, url string, body io.Reader, v interface{}) (string, error) {
+	if strings.HasPrefix(url, "/") {
+		url = c.baseURL + url
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return "", &apiError{method: method, path: req.URL.Path, status: resp.Status, statusCode: resp.StatusCode, body: strings.TrimSpace(string(msg))}
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return "", fmt.Errorf("github: decoding %s response: %w", req.URL.Path, err)
+		}
+	}
+	return resp.Header.Get("Link"), nil
+}
+
+var nextLinkRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// pullRequestFile is an entry of the pull request files endpoint.
+type pullRequestFile struct {
+	Filename         string `json:"filename"`
+	PreviousFilename string `json:"previous_filename"`
+	Status           string `json:"status"`
+	Additions        int    `json:"additions"`
+	Deletions        int    `json:"deletions"`
+	Patch            string `json:"patch"`
+}
+
+// maxPullRequestFiles is the number of files the pull request files
+// endpoint lists at most.
+const maxPullRequestFiles = 3000
+
+// pullRequestDiff returns the unified diff of a pull request. It pages
+// through the files endpoint and rebuilds a git diff from each file patch.
+// The endpoint lists 3000 files at most, and leaves the patch of files out
+// when the diff is too large: rather than under-reporting the patch, both
+// are errors, leaving the diff to be computed with git instead. Files
+// without a patch that change no line, such as binary files, or are
+// removed, are skipped.
+func (c *githubClient) pullRequestDiff(number int) (string, error) {
+	var diff strings.Builder
+
+	listed := 0
+	url := fmt.Sprintf("/repos/%s/%s/pulls/%d/files?per_page=100", c.owner, c.repo, number)
+	for url != "" {
+		var files []pullRequestFile
+		link, err := c.do(http.MethodGet, url, nil, &files)
+		if err != nil {
+			return "", err
+		}
+
+		listed += len(files)
+		if listed >= maxPullRequestFiles {
+			return "", fmt.Errorf("pull request %d changes %d files or more, the most the GitHub API lists: pass its diff as diff_file instead of -pr", number, maxPullRequestFiles)
+		}
+		for _, f := range files {
+			if f.Patch == "" {
+				if f.Status != "removed" && f.Additions+f.Deletions > 0 {
+					return "", fmt.Errorf("the GitHub API omits the patch of %s, of pull request %d, as its diff is too large: pass its diff as diff_file instead of -pr", f.Filename, number)
+				}
+				continue
+			}
+			oldName := f.Filename
+			if f.PreviousFilename != "" {
+				oldName = f.PreviousFilename
+			}
+			fmt.Fprintf(&diff, "diff --git a/%s b/%s\n", oldName, f.Filename)
+			switch f.Status {
+			case "added":
+				fmt.Fprintf(&diff, "--- /dev/null\n+++ b/%s\n", f.Filename)
+			case "removed":
+				fmt.Fprintf(&diff, "--- a/%s\n+++ /dev/null\n", oldName)
+			default:
+				fmt.Fprintf(&diff, "--- a/%s\n+++ b/%s\n", oldName, f.Filename)
+			}
+			diff.WriteString(strings.TrimSuffix(f.Patch, "\n"))
+			diff.WriteString("\n")
+		}
+
+		url = ""
+		if m := nextLinkRe.FindStringSubmatch(link); m != nil {
+			url = m[1]
+		}
+	}
+
+	return diff.String(), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// func1Patch is the patch GitHub reports for testdata/test-project/func1.go
+// in the new_file scenario.
+func func1Patch(t *testing.T) string {
+	diff, err := os.ReadFile("../../testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, err)
+
+	s := string(diff)
+	start := strings.Index(s, "diff --git a/testdata/test-project/func1.go")
+	s = s[start:]
+	s = s[strings.Index(s, "@@"):]
+	if end := strings.Index(s, "\ndiff --git"); end >= 0 {
+		s = s[:end]
+	}
+	return s
+}
+
+// filesCall is the call listing the files of pull request 1 of octo/repo.
+const filesCall = "GET /repos/octo/repo/pulls/1/files?per_page=100"
+
+// mockGitHub is a GitHub API serving pull request 1 of octo/repo.
+type mockGitHub struct {
+	*mockAPI
+}
+
+// newMockGitHub serves the pull request files endpoint for pull request 1
+// of octo/repo over two pages, and accepts reviews on it.
+func newMockGitHub(t *testing.T, patch string) *mockGitHub {
+	api := newMockAPI(t, "Authorization", "Bearer secret")
+	next := fmt.Sprintf("%s/repos/octo/repo/pulls/1/files?per_page=100&page=2", api.URL)
+	api.respond(filesCall, apiResponse{
+		header: map[string]string{"Link": fmt.Sprintf(`<%s>; rel="next", <%s>; rel="last"`, next, next)},
+		body: encodeFiles(t,
+			pullRequestFile{Filename: "logo.png", Status: "added"},
+			pullRequestFile{Filename: "README.md", Status: "modified", Patch: "@@ -1 +1 @@\n-# old\n+# new"},
+		),
+	})
+	api.respond(filesCall+"&page=2", apiResponse{
+		body: encodeFiles(t, pullRequestFile{Filename: "testdata/test-project/func1.go", Status: "added", Patch: patch}),
+	})
+	api.respond("POST /repos/octo/repo/pulls/1/reviews", apiResponse{body: `{"id": 1}`})
+	return &mockGitHub{api}
+}
+
+// reviews returns the reviews created on the pull request.
+func (srv *mockGitHub) reviews(t *testing.T) []review {
+	t.Helper()
+	var reviews []review
+	for _, r := range srv.requests() {
+		if r.call == "POST /repos/octo/repo/pulls/1/reviews" {
+			var rev review
+			assert.NilError(t, json.Unmarshal([]byte(r.body), &rev))
+			reviews = append(reviews, rev)
+		}
+	}
+	return reviews
+}
+
+// encodeFiles returns the JSON of files, as listed by the pull request
+// files endpoint.
+func encodeFiles(t *testing.T, files ...pullRequestFile) string {
+	t.Helper()
+	content, err := json.Marshal(files)
+	assert.NilError(t, err)
+	return string(content)
+}
+
+func setGitHubEnv(t *testing.T, apiURL string) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("GITHUB_REPOSITORY", "octo/repo")
+	t.Setenv("GITHUB_API_URL", apiURL)
+	t.Setenv("GITLAB_CI", "")
+}
+
+func Test_githubClient_pullRequestDiff(t *testing.T) {
+	patch := func1Patch(t)
+	srv := newMockGitHub(t, patch)
+	setGitHubEnv(t, srv.URL)
+
+	client, err := newGitHubClientFromEnv()
+	assert.NilError(t, err)
+
+	diff, err := client.pullRequestDiff(1)
+	assert.NilError(t, err)
+	assert.Equal(t, diff, ""+
+		"diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -1 +1 @@\n-# old\n+# new\n"+
+		"diff --git a/testdata/test-project/func1.go b/testdata/test-project/func1.go\n--- /dev/null\n+++ b/testdata/test-project/func1.go\n"+
+		patch+"\n")
+}
+
+func Test_githubClient_pullRequestDiff_incomplete(t *testing.T) {
+	serve := func(pages int, files []pullRequestFile) {
+		t.Helper()
+		api := newMockAPI(t, "Authorization", "Bearer secret")
+		call := filesCall
+		for page := 1; page <= pages; page++ {
+			resp := apiResponse{body: encodeFiles(t, files...)}
+			if page < pages {
+				resp.header = map[string]string{"Link": fmt.Sprintf(`<%s/repos/octo/repo/pulls/1/files?per_page=100&page=%d>; rel="next"`, api.URL, page+1)}
+			}
+			api.respond(call, resp)
+			call = fmt.Sprintf("%s&page=%d", filesCall, page+1)
+		}
+		setGitHubEnv(t, api.URL)
+	}
+
+	// The patch of a file changing lines is left out as too large.
+	serve(1, []pullRequestFile{
+		{Filename: "logo.png", Status: "added"},
+		{Filename: "old.go", Status: "removed", Deletions: 4000},
+		{Filename: "big.go", Status: "modified", Additions: 4000, Deletions: 10},
+	})
+	client, err := newGitHubClientFromEnv()
+	assert.NilError(t, err)
+	_, err = client.pullRequestDiff(1)
+	assert.Error(t, err, "the GitHub API omits the patch of big.go, of pull request 1, as its diff is too large: pass its diff as diff_file instead of -pr")
+
+	// 30 pages of 100 files reach the limit of the endpoint.
+	files := make([]pullRequestFile, 100)
+	for i := range files {
+		files[i] = pullRequestFile{Filename: fmt.Sprintf("f%d.go", i), Status: "added", Additions: 1, Patch: "@@ -0,0 +1 @@\n+package f"}
+	}
+	serve(30, files)
+	client, err = newGitHubClientFromEnv()
+	assert.NilError(t, err)
+	_, err = client.pullRequestDiff(1)
+	assert.Error(t, err, "pull request 1 changes 3000 files or more, the most the GitHub API lists: pass its diff as diff_file instead of -pr")
+
+	// One file less is listed whole.
+	serve(30, files[:99])
+	client, err = newGitHubClientFromEnv()
+	assert.NilError(t, err)
+	diff, err := client.pullRequestDiff(1)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Count(diff, "diff --git"), 30*99)
+}
+
+func Test_githubClient_errorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+	setGitHubEnv(t, srv.URL)
+
+	client, err := newGitHubClientFromEnv()
+	assert.NilError(t, err)
+
+	_, err = client.pullRequestDiff(2)
+	assert.Error(t, err, `github: GET /repos/octo/repo/pulls/2/files: 404 Not Found: {"message":"Not Found"}`)
+}
+
+func Test_newGitHubClientFromEnv(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	_, err := newGitHubClientFromEnv()
+	assert.Error(t, err, "GITHUB_TOKEN is not set")
+
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("GITHUB_REPOSITORY", "octo")
+	_, err = newGitHubClientFromEnv()
+	assert.Error(t, err, `GITHUB_REPOSITORY must be owner/repo, got "octo"`)
+
+	t.Setenv("GITHUB_REPOSITORY", "octo/repo")
+	t.Setenv("GITHUB_API_URL", "")
+	client, err := newGitHubClientFromEnv()
+	assert.NilError(t, err)
+	assert.Equal(t, client.baseURL, "https://api.github.com")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// gitlabClient is a minimal GitLab REST API client configured from the
+// environment GitLab CI provides.
+type gitlabClient struct {
+	baseURL string
+	token   string
+	project string
+	http    *http.Client
+}
+
+// newGitLabClientFromEnv reads GITLAB_TOKEN, CI_PROJECT_ID and the
+// optional CI_API_V4_URL.
+func newGitLabClientFromEnv() (*gitlabClient, error) {
+	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GITLAB_TOKEN is not set")
+	}
+	project := os.Getenv("CI_PROJECT_ID")
+	if project == "" {
+		return nil, fmt.Errorf("CI_PROJECT_ID is not set")
+	}
+	baseURL := os.Getenv("CI_API_V4_URL")
+	if baseURL == "" {
+		baseURL = "https://gitlab.com/api/v4"
+	}
+
+	return &gitlabClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		project: project,
+		http:    http.DefaultClient,
+	}, nil
+}
+
+// mergeRequestIID returns the GitLab merge request -gh-comment comments
+// on, of the CI_MERGE_REQUEST_IID environment variable.
+func mergeRequestIID() (int, error) {
+	v := os.Getenv("CI_MERGE_REQUEST_IID")
+	if v == "" {
+		return 0, fmt.Errorf("-gh-comment requires CI_MERGE_REQUEST_IID")
+	}
+	iid, err := strconv.Atoi(v)
+	if err != nil || iid <= 0 {
+		return 0, fmt.Errorf("invalid CI_MERGE_REQUEST_IID %q: expected a merge request number", v)
+	}
+	return iid, nil
+}
+
+// do sends a request to the API and decodes a JSON response into v when v
+// is not nil. It returns the response X-Next-Page header for pagination.
+func (c *gitlabClient) do(method, path string, body io.Reader, v interface{}) (string, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("gitlab: %s %s: %s: %s", method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return "", fmt.Errorf("gitlab: decoding %s response: %w", req.URL.Path, err)
+		}
+	}
+	return resp.Header.Get("X-Next-Page"), nil
+}
+
+// note is a note of the merge request notes endpoints.
+type note struct {
+	ID     int64  `json:"id"`
+	Body   string `json:"body"`
+	System bool   `json:"system"`
+	Author struct {
+		ID int64 `json:"id"`
+	} `json:"author"`
+}
+
+// mrNotes is the notes of a GitLab merge request.
+type mrNotes struct {
+	client *gitlabClient
+	iid    int
+}
+
+func (t mrNotes) notesPath() string {
+	return fmt.Sprintf("/projects/%s/merge_requests/%d/notes", url.PathEscape(t.client.project), t.iid)
+}
+
+// listComments returns the notes of the merge request, but for the system
+// notes GitLab adds. The notes of the user of the token are the own ones.
+func (t mrNotes) listComments() ([]markedComment, error) {
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if _, err := t.client.do(http.MethodGet, "/user", nil, &user); err != nil {
+		return nil, err
+	}
+
+	var list []markedComment
+	page := "1"
+	for page != "" {
+		var notes []note
+		next, err := t.client.do(http.MethodGet, t.notesPath()+"?per_page=100&page="+url.QueryEscape(page), nil, &notes)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range notes {
+			if n.System {
+				continue
+			}
+			list = append(list, markedComment{id: n.ID, body: n.Body, own: n.Author.ID == user.ID})
+		}
+		page = next
+	}
+	return list, nil
+}
+
+func (t mrNotes) createComment(body string) error {
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = t.client.do(http.MethodPost, t.notesPath(), bytes.NewReader(payload), nil)
+	return err
+}
+
+func (t mrNotes) updateComment(id int64, body string) error {
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = t.client.do(http.MethodPut, fmt.Sprintf("%s/%d", t.notesPath(), id), bytes.NewReader(payload), nil)
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+// notesPath is the path of the notes of merge request 3 of project 42.
+const notesPath = "/api/v4/projects/42/merge_requests/3/notes"
+
+func setGitLabEnv(t *testing.T, apiURL string) {
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("GITLAB_TOKEN", "secret")
+	t.Setenv("CI_PROJECT_ID", "42")
+	t.Setenv("CI_MERGE_REQUEST_IID", "3")
+	t.Setenv("CI_API_V4_URL", apiURL+"/api/v4")
+}
+
+func Test_mrNotes(t *testing.T) {
+	api := newMockAPI(t, "PRIVATE-TOKEN", "secret")
+	setGitLabEnv(t, api.URL)
+	api.respond("GET /api/v4/user", apiResponse{body: `{"id": 7}`})
+	// GitLab adds system notes, e.g. of pushed commits.
+	api.respond("GET "+notesPath+"?per_page=100&page=1", apiResponse{
+		header: map[string]string{"X-Next-Page": "2"},
+		body:   `[{"id": 1, "body": "a", "author": {"id": 1}}, {"id": 2, "body": "added 1 commit", "system": true, "author": {"id": 7}}]`,
+	})
+	api.respond("GET "+notesPath+"?per_page=100&page=2", apiResponse{body: `[{"id": 3, "body": "c", "author": {"id": 7}}]`})
+	api.respond("POST "+notesPath, apiResponse{status: http.StatusCreated, body: "{}"})
+	api.respond("PUT "+notesPath+"/3", apiResponse{body: "{}"})
+
+	client, err := newGitLabClientFromEnv()
+	assert.NilError(t, err)
+	thread := mrNotes{client: client, iid: 3}
+
+	notes, err := thread.listComments()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, notes, []markedComment{{id: 1, body: "a"}, {id: 3, body: "c", own: true}}, cmp.AllowUnexported(markedComment{}))
+
+	n := len(api.requests())
+	assert.NilError(t, thread.createComment("new"))
+	assert.NilError(t, thread.updateComment(3, "updated"))
+	assert.DeepEqual(t, api.requests()[n:], []apiRequest{
+		{call: "POST " + notesPath, body: `{"body":"new"}`},
+		{call: "PUT " + notesPath + "/3", body: `{"body":"updated"}`},
+	}, cmp.AllowUnexported(apiRequest{}))
+}
+
+func TestCoverCommand_Run_gitlabComment(t *testing.T) {
+	args := []string{"-gh-comment", "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(args ...string) error {
+		_, _, err := runCommand(t, args...)
+		return err
+	}
+	newMockNotes := func(t *testing.T) *mockAPI {
+		api := newMockAPI(t, "PRIVATE-TOKEN", "secret")
+		api.respond("GET /api/v4/user", apiResponse{body: `{"id": 7}`})
+		api.respond("GET "+notesPath+"?per_page=100&page=1", apiResponse{body: "[]"})
+		api.respond("POST "+notesPath, apiResponse{status: http.StatusCreated, body: "{}"})
+		return api
+	}
+
+	t.Run("note", func(t *testing.T) {
+		api := newMockNotes(t)
+		setGitLabEnv(t, api.URL)
+
+		assert.NilError(t, run(args...))
+		assert.NilError(t, run(append([]string{"-comment-tmpl", "{{ .PatchCoverage }}"}, args...)...))
+
+		bodies := postedBodies(t, api)
+		assert.Equal(t, len(bodies), 2)
+		assert.Assert(t, strings.HasPrefix(bodies[0], commentMarker+"\n"), bodies[0])
+		assert.Assert(t, strings.Contains(bodies[0], "| Patch    | 75.0% (6/8) |"), bodies[0])
+		assert.Equal(t, bodies[1], commentMarker+"\n75")
+	})
+
+	t.Run("platform flag", func(t *testing.T) {
+		api := newMockNotes(t)
+		setGitLabEnv(t, api.URL)
+		t.Setenv("GITLAB_CI", "")
+
+		assert.NilError(t, run(append([]string{"-platform", "gitlab"}, args...)...))
+		assert.Equal(t, len(postedBodies(t, api)), 1)
+
+		assert.Error(t, run(append([]string{"-platform", "bitbucket"}, args...)...), `invalid -platform "bitbucket", expected github or gitlab`)
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+		}))
+		defer srv.Close()
+		setGitLabEnv(t, srv.URL)
+
+		assert.Error(t, run(args...), `gitlab: GET /api/v4/user: 401 Unauthorized: {"message":"401 Unauthorized"}`)
+	})
+
+	t.Run("missing settings", func(t *testing.T) {
+		setGitLabEnv(t, "http://localhost")
+		t.Setenv("CI_MERGE_REQUEST_IID", "")
+		assert.Error(t, run(args...), "-gh-comment requires CI_MERGE_REQUEST_IID")
+		t.Setenv("CI_MERGE_REQUEST_IID", "three")
+		assert.Error(t, run(args...), `invalid CI_MERGE_REQUEST_IID "three": expected a merge request number`)
+
+		t.Setenv("CI_MERGE_REQUEST_IID", "3")
+		t.Setenv("GITLAB_TOKEN", "")
+		assert.Error(t, run(args...), "-gh-comment requires GITLAB_TOKEN")
+	})
+}
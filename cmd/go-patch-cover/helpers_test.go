@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+	"gotest.tools/v3/assert"
+)
+
+// newTestCommand returns a new command writing its uncovered lines report
+// to a temporary directory by default, rather than to the working
+// directory, the source tree of the tests.
+func newTestCommand(t *testing.T) *CoverCommand {
+	c := newCoverCommand("1.0.0")
+	c.UncoveredOutFlag = filepath.Join(t.TempDir(), "uncovered_lines.txt")
+	return c
+}
+
+// runCommand runs a new test command with args, returning what it writes
+// to stdout and stderr.
+func runCommand(t *testing.T, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	return runCommandOn(newTestCommand(t), args...)
+}
+
+// runCommandOn runs c with args, e.g. once its stdin is set or to inspect
+// it afterwards, returning what it writes to stdout and stderr.
+func runCommandOn(c *CoverCommand, args ...string) (stdout, stderr string, err error) {
+	var out, errOut bytes.Buffer
+	c.stdout, c.stderr = &out, &errOut
+	err = c.Run(args)
+	return out.String(), errOut.String(), err
+}
+
+// runCommandJSON runs a new command with -o json and args, returning the
+// coverage data it outputs. Output written before an error, e.g. of a
+// failed gate, is decoded too.
+func runCommandJSON(t *testing.T, args ...string) (patchcover.CoverageData, error) {
+	t.Helper()
+	stdout, _, err := runCommand(t, append([]string{"-o", "json"}, args...)...)
+	if stdout == "" {
+		return patchcover.CoverageData{}, err
+	}
+	return decodeCoverage(t, stdout), err
+}
+
+// decodeCoverage decodes the json output of the command.
+func decodeCoverage(t *testing.T, stdout string) patchcover.CoverageData {
+	t.Helper()
+	var data patchcover.CoverageData
+	assert.NilError(t, json.Unmarshal([]byte(stdout), &data))
+	return data
+}
+
+// apiResponse is the canned response of a mockAPI to a call.
+type apiResponse struct {
+	// status is the status code, 200 when zero.
+	status int
+	header map[string]string
+	body   string
+}
+
+// apiRequest is a request received by a mockAPI.
+type apiRequest struct {
+	// call is the method and URI of the request, e.g. "GET /user".
+	call string
+	body string
+}
+
+// mockAPI is a JSON API answering calls with canned responses, and
+// recording the requests it receives for the test to check once they are
+// answered. Its handler never fails the test itself, as it does not run
+// in the test goroutine: requests missing the token are answered 401 and
+// unknown calls 404, failing the client instead.
+type mockAPI struct {
+	*httptest.Server
+	// authHeader holds auth, the token of the requests.
+	authHeader, auth string
+
+	mu        sync.Mutex
+	responses map[string]apiResponse
+	received  []apiRequest
+}
+
+func newMockAPI(t *testing.T, authHeader, auth string) *mockAPI {
+	api := &mockAPI{authHeader: authHeader, auth: auth, responses: make(map[string]apiResponse)}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// respond sets the response to call, e.g. "GET /user".
+func (api *mockAPI) respond(call string, resp apiResponse) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.responses[call] = resp
+}
+
+// requests returns the requests received so far.
+func (api *mockAPI) requests() []apiRequest {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]apiRequest(nil), api.received...)
+}
+
+func (api *mockAPI) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	call := r.Method + " " + r.URL.RequestURI()
+
+	api.mu.Lock()
+	api.received = append(api.received, apiRequest{call: call, body: string(body)})
+	resp, ok := api.responses[call]
+	api.mu.Unlock()
+
+	switch {
+	case r.Header.Get(api.authHeader) != api.auth:
+		http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+	case !ok:
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	default:
+		for k, v := range resp.header {
+			w.Header().Set(k, v)
+		}
+		if resp.status != 0 {
+			w.WriteHeader(resp.status)
+		}
+		io.WriteString(w, resp.body)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// Levels of the messages written to stderr, selected by -q and -v.
+const (
+	// logQuiet writes nothing but errors.
+	logQuiet = iota - 1
+	// logInfo, the zero value, writes warnings, hints and the gate table.
+	logInfo
+	// logVerbose also traces how inputs were resolved.
+	logVerbose
+)
+
+// logLevels are the levels of the LOG_LEVEL environment variable.
+var logLevels = map[string]int{"quiet": logQuiet, "info": logInfo, "verbose": logVerbose}
+
+// applyLogLevel sets the level of -q or -v, or else of the LOG_LEVEL
+// environment variable; default: info.
+func (c *CoverCommand) applyLogLevel() error {
+	switch {
+	case c.QuietFlag && c.VerboseFlag:
+		return fmt.Errorf("-q and -v are mutually exclusive")
+	case c.QuietFlag:
+		c.logLevel = logQuiet
+	case c.VerboseFlag:
+		c.logLevel = logVerbose
+	default:
+		c.logLevel = logInfo
+		if v := os.Getenv("LOG_LEVEL"); v != "" {
+			level, ok := logLevels[v]
+			if !ok {
+				return fmt.Errorf("invalid LOG_LEVEL %q, expected quiet, info or verbose", v)
+			}
+			c.logLevel = level
+		}
+	}
+	return nil
+}
+
+// logf writes a line to stderr when the log level is level or above.
+func (c *CoverCommand) logf(level int, format string, args ...interface{}) {
+	if c.logLevel < level {
+		return
+	}
+	fmt.Fprintf(c.stderr, format+"\n", args...)
+}
+
+// logInputs traces, in verbose mode, the profile each changed file
+// matched, or that it matched none, and the uncovered lines report
+// written.
+func (c *CoverCommand) logInputs(data patchcover.CoverageData) {
+	if c.logLevel < logVerbose {
+		return
+	}
+	logf := func(format string, args ...interface{}) { c.logf(logVerbose, format, args...) }
+	logf("%d profiles, %d changed files", len(data.Profiles), len(data.DiffFiles))
+	for _, f := range data.DiffFiles {
+		if profileName, ok := data.DiffProfiles[f.NewName]; ok {
+			logf("%s: matched profile %s", f.NewName, profileName)
+		} else {
+			logf("%s: no matching profile", f.NewName)
+		}
+	}
+	if out := c.uncoveredOut(); out != "" {
+		logf("uncovered lines report written to %s", out)
+	}
+}
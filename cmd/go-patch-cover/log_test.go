@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+	"gotest.tools/v3/assert"
+)
+
+func TestCoverCommand_Run_logLevel(t *testing.T) {
+	const (
+		cov  = "../../testdata/scenarios/new_file/coverage.out"
+		diff = "../../testdata/scenarios/new_file/diff.diff"
+	)
+	// Arguments printing a hint and the gate table on stderr.
+	args := []string{"-no-filewrite", "-show-regen", "-min-patch-coverage", "50", cov, diff}
+	run := func(args ...string) (string, string, error) {
+		return runCommand(t, args...)
+	}
+
+	t.Run("json stdout", func(t *testing.T) {
+		stdout, stderr, err := run(append([]string{"-v", "-o", "json"}, args...)...)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(stderr, "testdata/test-project/func1.go: matched profile github.com/seriousben/go-patch-cover/testdata/test-project/func1.go\n"), stderr)
+
+		// stdout holds exactly one JSON document.
+		dec := json.NewDecoder(strings.NewReader(stdout))
+		var data patchcover.CoverageData
+		assert.NilError(t, dec.Decode(&data))
+		assert.Equal(t, data.PatchCoverage, 75.0)
+		var extra interface{}
+		assert.Equal(t, dec.Decode(&extra), io.EOF)
+	})
+
+	t.Run("info", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "")
+		_, stderr, err := run(args...)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(stderr, "regenerate "), stderr)
+		assert.Assert(t, strings.Contains(stderr, "min-patch-coverage"), stderr)
+		assert.Assert(t, !strings.Contains(stderr, "matched profile"), stderr)
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		stdout, stderr, err := run(append([]string{"-q"}, args...)...)
+		assert.NilError(t, err)
+		assert.Equal(t, stderr, "")
+		assert.Assert(t, strings.Contains(stdout, "patch coverage"), stdout)
+
+		// Failed gates still fail.
+		_, stderr, err = run("-q", "-min-patch-coverage", "90", cov, diff)
+		assert.ErrorContains(t, err, "patch coverage")
+		assert.Equal(t, stderr, "")
+	})
+
+	t.Run("LOG_LEVEL", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "quiet")
+		_, stderr, err := run(args...)
+		assert.NilError(t, err)
+		assert.Equal(t, stderr, "")
+
+		// Flags take precedence.
+		_, stderr, err = run(append([]string{"-v"}, args...)...)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(stderr, "matched profile"), stderr)
+
+		t.Setenv("LOG_LEVEL", "debug")
+		_, _, err = run(args...)
+		assert.Error(t, err, `invalid LOG_LEVEL "debug", expected quiet, info or verbose`)
+	})
+
+	_, _, err := run(append([]string{"-q", "-v"}, args...)...)
+	assert.Error(t, err, "-q and -v are mutually exclusive")
+}
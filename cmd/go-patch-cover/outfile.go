@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// outFile is the -out file the output is written to instead of stdout. It
+// is created on the first write, so runs failing before any output leave
+// no empty report behind.
+type outFile struct {
+	path string
+	f    *os.File
+}
+
+func (o *outFile) Write(p []byte) (int, error) {
+	if o.f == nil {
+		f, err := os.Create(o.path)
+		if err != nil {
+			return 0, err
+		}
+		o.f = f
+	}
+	return o.f.Write(p)
+}
+
+// Close closes the file, when it was created.
+func (o *outFile) Close() error {
+	if o.f == nil {
+		return nil
+	}
+	if err := o.f.Close(); err != nil {
+		return fmt.Errorf("output error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiles starts the CPU profile of -cpuprofile. The returned stop
+// function writes it, and the heap profile of -memprofile; it must be
+// called whether the run succeeds or not.
+func (c *CoverCommand) startProfiles() (stop func() error, err error) {
+	var cpu *os.File
+	if c.CPUProfileFlag != "" {
+		cpu, err = os.Create(c.CPUProfileFlag)
+		if err != nil {
+			return nil, fmt.Errorf("creating cpu profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("starting cpu profile: %w", err)
+		}
+	}
+
+	return func() error {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				return fmt.Errorf("writing cpu profile: %w", err)
+			}
+		}
+		if c.MemProfileFlag != "" {
+			return writeHeapProfile(c.MemProfileFlag)
+		}
+		return nil
+	}, nil
+}
+
+// writeHeapProfile writes the heap profile of the run to name.
+func writeHeapProfile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("creating memory profile: %w", err)
+	}
+	// Collect garbage to report up-to-date allocation statistics.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing memory profile: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCoverCommand_Run_profiles(t *testing.T) {
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(dir string, flags ...string) error {
+		flags = append([]string{
+			"-cpuprofile", filepath.Join(dir, "cpu.pprof"),
+			"-memprofile", filepath.Join(dir, "mem.pprof"),
+		}, flags...)
+		_, _, err := runCommand(t, append(flags, args...)...)
+		return err
+	}
+	assertProfiles := func(dir string) {
+		t.Helper()
+		for _, name := range []string{"cpu.pprof", "mem.pprof"} {
+			info, err := os.Stat(filepath.Join(dir, name))
+			assert.NilError(t, err)
+			assert.Assert(t, info.Size() > 0, name)
+		}
+	}
+
+	dir := t.TempDir()
+	assert.NilError(t, run(dir))
+	assertProfiles(dir)
+
+	// Profiles are written when a gate fails too.
+	dir = t.TempDir()
+	assert.ErrorContains(t, run(dir, "-min-patch-coverage", "90"), "min-patch-coverage")
+	assertProfiles(dir)
+}
+
+func TestCoverCommand_profileFlagsHidden(t *testing.T) {
+	var stderr bytes.Buffer
+	c := newTestCommand(t)
+	c.stdout = &stderr
+	c.stderr = &stderr
+	assert.NilError(t, c.Run([]string{"-help"}))
+	assert.Assert(t, strings.Contains(stderr.String(), "Usage:"))
+	for _, name := range []string{"-cpuprofile", "-memprofile"} {
+		assert.Assert(t, !strings.Contains(stderr.String(), name), name)
+	}
+}
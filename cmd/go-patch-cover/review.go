@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// reviewComment is an inline comment of a pull request review, on a line
+// of the new version of a file: the RIGHT side of the diff.
+type reviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Side string `json:"side"`
+	Body string `json:"body"`
+}
+
+// review is a pull request review, created and submitted at once.
+type review struct {
+	Body     string          `json:"body"`
+	Event    string          `json:"event"`
+	Comments []reviewComment `json:"comments"`
+}
+
+// uncoveredLineComment is the body of the review comment of an uncovered
+// added line.
+const uncoveredLineComment = "This added line is not covered by tests."
+
+// addedLineNumbers returns the line numbers in the new file of the added
+// lines of f, the lines a review can comment on.
+func addedLineNumbers(f *gitdiff.File) map[int]bool {
+	added := make(map[int]bool)
+	for _, frag := range f.TextFragments {
+		num := frag.NewPosition
+		for _, line := range frag.Lines {
+			switch line.Op {
+			case gitdiff.OpAdd:
+				added[int(num)] = true
+				num++
+			case gitdiff.OpContext:
+				num++
+			}
+		}
+	}
+	return added
+}
+
+// coverageReview returns a review whose body is body and which comments
+// on the uncovered added lines, at most max of them. Uncovered lines past
+// max, which the API would reject in a single review, are counted in the
+// body. Lines outside of the diff, which cannot be commented, are skipped.
+func coverageReview(data patchcover.CoverageData, body string, max int) review {
+	r := review{Body: body, Event: "COMMENT", Comments: []reviewComment{}}
+	for _, f := range data.DiffFiles {
+		profileName, ok := data.DiffProfiles[f.NewName]
+		if !ok {
+			continue
+		}
+		added := addedLineNumbers(f)
+		for _, l := range data.UncoveredLines {
+			if l.FileName == profileName && added[l.LineNum] {
+				r.Comments = append(r.Comments, reviewComment{Path: f.NewName, Line: l.LineNum, Side: "RIGHT", Body: uncoveredLineComment})
+			}
+		}
+	}
+	sort.SliceStable(r.Comments, func(i, j int) bool {
+		if r.Comments[i].Path != r.Comments[j].Path {
+			return r.Comments[i].Path < r.Comments[j].Path
+		}
+		return r.Comments[i].Line < r.Comments[j].Line
+	})
+	if len(r.Comments) > max {
+		r.Body += fmt.Sprintf("\n\n%d more uncovered lines are not commented inline.\n", len(r.Comments)-max)
+		r.Comments = r.Comments[:max]
+	}
+	return r
+}
+
+// createReview creates and submits r on a pull request, so all its
+// comments are grouped in one review.
+func (c *githubClient) createReview(number int, r review) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews", c.owner, c.repo, number), bytes.NewReader(body), nil)
+	return err
+}
+
+// postReview posts the coverage as a review of the -pr pull request, with
+// the pull request comment as its body.
+func (c *CoverCommand) postReview(data patchcover.CoverageData) error {
+	tmpl, err := c.commentTemplate()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if err := patchcover.RenderCommentOutput(data, tmpl, &body); err != nil {
+		return fmt.Errorf("review output error: %w", err)
+	}
+
+	client, err := newGitHubClientFromEnv()
+	if err != nil {
+		return err
+	}
+	r := coverageReview(data, body.String(), c.MaxCommentsFlag)
+	err = client.createReview(c.PRFlag, r)
+	var apiErr *apiError
+	if err != nil && len(r.Comments) > 0 && errors.As(err, &apiErr) && apiErr.statusCode == http.StatusUnprocessableEntity {
+		// A comment the API cannot place, e.g. on a line outside of the
+		// diff of the pull request, fails the whole review: post it
+		// without its inline comments.
+		c.logf(logInfo, "warning: inline review comments rejected, posting the review without them: %v", err)
+		r.Comments = []reviewComment{}
+		err = client.createReview(c.PRFlag, r)
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	patchcover "github.com/srinidhis05/go-patch-cover"
+	"gotest.tools/v3/assert"
+)
+
+func Test_addedLineNumbers(t *testing.T) {
+	files, _, err := gitdiff.Parse(strings.NewReader(`diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@
+ package a
+-var x = 1
++var x = 2
+ var y = 3
+@@ -10,2 +10,3 @@ func f() {
+ 	a()
++	b()
+ 	c()
+`))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, addedLineNumbers(files[0]), map[int]bool{2: true, 11: true})
+}
+
+func TestCoverCommand_Run_review(t *testing.T) {
+	srv := newMockGitHub(t, func1Patch(t))
+	setGitHubEnv(t, srv.URL)
+
+	c := newTestCommand(t)
+	c.stdout = io.Discard
+	err := c.Run([]string{"-pr", "1", "-review", "-o", "json", "../../testdata/scenarios/new_file/coverage.out"})
+	assert.NilError(t, err)
+
+	// All the coverage feedback is submitted as a single review.
+	reviews := srv.reviews(t)
+	assert.Equal(t, len(reviews), 1)
+	r := reviews[0]
+	assert.Equal(t, r.Event, "COMMENT")
+	assert.Assert(t, strings.Contains(r.Body, "75.0%"), r.Body)
+	assert.DeepEqual(t, r.Comments, []reviewComment{
+		{Path: "testdata/test-project/func1.go", Line: 15, Side: "RIGHT", Body: uncoveredLineComment},
+	})
+}
+
+func Test_coverageReview_maxComments(t *testing.T) {
+	files, _, err := gitdiff.Parse(strings.NewReader(`diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,0 +2,3 @@
++	a()
++	b()
++	c()
+`))
+	assert.NilError(t, err)
+	data := patchcover.CoverageData{
+		DiffFiles:    files,
+		DiffProfiles: map[string]string{"a.go": "example.com/m/a.go"},
+		UncoveredLines: []patchcover.UncoveredLine{
+			{FileName: "example.com/m/a.go", LineNum: 4},
+			{FileName: "example.com/m/a.go", LineNum: 2},
+			{FileName: "example.com/m/a.go", LineNum: 3},
+			// Not an added line: left out.
+			{FileName: "example.com/m/a.go", LineNum: 9},
+		},
+	}
+
+	r := coverageReview(data, "body", 2)
+	assert.DeepEqual(t, r.Comments, []reviewComment{
+		{Path: "a.go", Line: 2, Side: "RIGHT", Body: uncoveredLineComment},
+		{Path: "a.go", Line: 3, Side: "RIGHT", Body: uncoveredLineComment},
+	})
+	assert.Equal(t, r.Body, "body\n\n1 more uncovered lines are not commented inline.\n")
+
+	r = coverageReview(data, "body", 3)
+	assert.Equal(t, len(r.Comments), 3)
+	assert.Equal(t, r.Body, "body")
+}
+
+func TestCoverCommand_Run_reviewRejectedComments(t *testing.T) {
+	files := encodeFiles(t, pullRequestFile{Filename: "testdata/test-project/func1.go", Status: "added", Patch: func1Patch(t)})
+	var reviews []review
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/files") {
+			io.WriteString(w, files)
+			return
+		}
+		var rev review
+		if err := json.NewDecoder(r.Body).Decode(&rev); err != nil {
+			t.Errorf("decoding review: %v", err)
+		}
+		reviews = append(reviews, rev)
+		if len(rev.Comments) > 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message": "Unprocessable Entity", "errors": ["Line could not be resolved"]}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": 1}`)
+	}))
+	defer srv.Close()
+	setGitHubEnv(t, srv.URL)
+
+	c := newTestCommand(t)
+	var stderr bytes.Buffer
+	c.stdout = io.Discard
+	c.stderr = &stderr
+	assert.NilError(t, c.Run([]string{"-pr", "1", "-review", "-no-filewrite", "../../testdata/scenarios/new_file/coverage.out"}))
+	assert.Equal(t, len(reviews), 2)
+	assert.Equal(t, len(reviews[1].Comments), 0)
+	assert.Equal(t, reviews[1].Body, reviews[0].Body)
+	assert.Assert(t, strings.Contains(stderr.String(), "warning: inline review comments rejected"), stderr.String())
+
+	c = newTestCommand(t)
+	assert.Error(t, c.Run([]string{"-pr", "1", "-review", "-review-max-comments", "-1", "coverage.out"}), "invalid -review-max-comments -1, expected 0 or more")
+}
+
+func TestCoverCommand_Run_reviewWithoutPR(t *testing.T) {
+	err := newTestCommand(t).Run([]string{"-review", "coverage.out", "patch.diff"})
+	assert.Error(t, err, "-review requires -pr")
+}
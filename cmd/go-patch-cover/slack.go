@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	patchcover "github.com/srinidhis05/go-patch-cover"
+)
+
+// slackWebhookEnv is the environment variable holding the Slack incoming
+// webhook URL when -slack-webhook is not set.
+const slackWebhookEnv = "SLACK_WEBHOOK_URL"
+
+// slackMessage is the payload of a Slack incoming webhook. The summary is
+// sent as an attachment so its color bar reflects the gates.
+type slackMessage struct {
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color string `json:"color"`
+	Text  string `json:"text"`
+}
+
+// slackWebhook returns the -slack-webhook URL, or the SLACK_WEBHOOK_URL
+// environment variable, or "" when neither is set.
+func (c *CoverCommand) slackWebhook() string {
+	if c.SlackWebhookFlag != "" {
+		return c.SlackWebhookFlag
+	}
+	return os.Getenv(slackWebhookEnv)
+}
+
+// postSlack posts the template output to the Slack incoming webhook url,
+// green when passed and red otherwise.
+func (c *CoverCommand) postSlack(url string, data patchcover.CoverageData, passed bool) error {
+	var text bytes.Buffer
+	if err := patchcover.RenderTemplateOutput(data, c.TemplateFlag, &text); err != nil {
+		return fmt.Errorf("slack output error: %w", err)
+	}
+
+	color := "good"
+	if !passed {
+		color = "danger"
+	}
+	body, err := json.Marshal(slackMessage{Attachments: []slackAttachment{
+		{Color: color, Text: strings.TrimSpace(text.String())},
+	}})
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("slack: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// newMockSlack serves a Slack incoming webhook recording the messages
+// posted to it.
+func newMockSlack(t *testing.T, messages *[]slackMessage) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Not in the test goroutine: failures are recorded, not fatal.
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected %s request of content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+
+		var m slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			t.Errorf("decoding message: %v", err)
+		}
+		*messages = append(*messages, m)
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCoverCommand_Run_slack(t *testing.T) {
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+
+	tests := map[string]struct {
+		flags     []string
+		wantColor string
+		wantErr   string
+	}{
+		"passed": {
+			wantColor: "good",
+		},
+		"failed": {
+			flags:     []string{"-min-patch-coverage", "90"},
+			wantColor: "danger",
+			wantErr:   "1 of 1 gates failed",
+		},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var messages []slackMessage
+			srv := newMockSlack(t, &messages)
+			t.Setenv(slackWebhookEnv, srv.URL)
+
+			c := newTestCommand(t)
+			c.stdout = io.Discard
+			c.stderr = io.Discard
+			err := c.Run(append(append(tt.flags, "-tmpl", "patch coverage: {{ .PatchCoverage }}%"), args...))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			assert.DeepEqual(t, messages, []slackMessage{{Attachments: []slackAttachment{
+				{Color: tt.wantColor, Text: "patch coverage: 75%"},
+			}}})
+		})
+	}
+}
+
+func TestCoverCommand_Run_slackFlag(t *testing.T) {
+	var messages []slackMessage
+	srv := newMockSlack(t, &messages)
+	t.Setenv(slackWebhookEnv, "http://127.0.0.1:0/unused")
+
+	c := newTestCommand(t)
+	c.stdout = io.Discard
+	err := c.Run([]string{"-slack-webhook", srv.URL, "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.NilError(t, err)
+
+	// The flag takes precedence over the environment, and the default
+	// template is used.
+	assert.Equal(t, len(messages), 1)
+	assert.Assert(t, strings.Contains(messages[0].Attachments[0].Text, "patch coverage: 75.0%"), messages[0].Attachments[0].Text)
+}
+
+func TestCoverCommand_Run_slackError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	c := newTestCommand(t)
+	c.stdout = io.Discard
+	err := c.Run([]string{"-slack-webhook", srv.URL, "../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"})
+	assert.Error(t, err, "slack: 403 Forbidden: invalid_token")
+}
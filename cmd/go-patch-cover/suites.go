@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// suiteConfig is the configuration of a named test suite of a
+// -suites-config file. Thresholds are percentages or threshold schedules,
+// as taken by the flags; nil ones are not checked.
+type suiteConfig struct {
+	MinCoverage      *thresholdFlag `json:"min_coverage"`
+	MinPatchCoverage *thresholdFlag `json:"min_patch_coverage"`
+	MinDelta         *thresholdFlag `json:"min_delta"`
+	Excludes         []string       `json:"excludes"`
+	Includes         []string       `json:"includes"`
+}
+
+// readSuites reads a JSON object holding suite configurations by name
+// under "suites".
+func readSuites(path string) (map[string]suiteConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading suites config: %w", err)
+	}
+
+	var file struct {
+		Suites map[string]suiteConfig `json:"suites"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("parsing suites config %s: %w", path, err)
+	}
+	return file.Suites, nil
+}
+
+// applySuite applies the suite selected by -suite, or the TEST_TYPE
+// environment variable, from the -suites-config file. Its excludes and
+// includes are added to the flags, and its thresholds set the gates whose
+// flags are not set.
+func (c *CoverCommand) applySuite() error {
+	if c.SuitesConfigFlag == "" {
+		if c.SuiteFlag != "" {
+			return fmt.Errorf("-suite requires -suites-config")
+		}
+		return nil
+	}
+
+	name := c.SuiteFlag
+	if name == "" {
+		name = os.Getenv("TEST_TYPE")
+	}
+	if name == "" {
+		return fmt.Errorf("-suites-config requires -suite or TEST_TYPE")
+	}
+
+	suites, err := readSuites(c.SuitesConfigFlag)
+	if err != nil {
+		return err
+	}
+	suite, ok := suites[name]
+	if !ok {
+		names := make([]string, 0, len(suites))
+		for n := range suites {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown suite %q in %s, expected one of: %s", name, c.SuitesConfigFlag, strings.Join(names, ", "))
+	}
+
+	c.applySuiteConfig(suite)
+	return nil
+}
+
+// applySuiteConfig adds the excludes and includes of cfg to the flags, and
+// sets the gates of its thresholds whose flags are not given yet.
+func (c *CoverCommand) applySuiteConfig(cfg suiteConfig) {
+	c.ExcludeFlag = append(c.ExcludeFlag, cfg.Excludes...)
+	c.IncludeFlag = append(c.IncludeFlag, cfg.Includes...)
+	for _, t := range []struct {
+		flag  *thresholdFlag
+		value *thresholdFlag
+	}{
+		{&c.MinCoverageFlag, cfg.MinCoverage},
+		{&c.MinPatchFlag, cfg.MinPatchCoverage},
+		{&c.MinDeltaFlag, cfg.MinDelta},
+	} {
+		if t.value != nil && !t.flag.explicit() {
+			*t.flag = *t.value
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+func Test_readSuites(t *testing.T) {
+	suites, err := readSuites("../../testdata/suites/suites.json")
+	assert.NilError(t, err)
+
+	var (
+		ten    = thresholdFlag{value: 10, set: true}
+		fifty  = thresholdFlag{value: 50, set: true}
+		ninety = thresholdFlag{value: 90, set: true}
+		zero   = thresholdFlag{set: true}
+	)
+	assert.DeepEqual(t, suites, map[string]suiteConfig{
+		"smoke": {MinCoverage: &ten},
+		"e2e":   {MinPatchCoverage: &ninety, Excludes: []string{"*/func2.go"}},
+		"contract": {
+			MinCoverage:      &fifty,
+			MinPatchCoverage: &fifty,
+			MinDelta:         &zero,
+			Includes:         []string{"testdata/*"},
+		},
+	}, cmp.AllowUnexported(thresholdFlag{}))
+
+	_, err = readSuites("../../testdata/suites/missing.json")
+	assert.ErrorContains(t, err, "reading suites config")
+}
+
+func TestCoverCommand_Run_suite(t *testing.T) {
+	args := []string{"../../testdata/scenarios/new_file/coverage.out", "../../testdata/scenarios/new_file/diff.diff"}
+	run := func(flags ...string) (*CoverCommand, error) {
+		c := newTestCommand(t)
+		_, _, err := runCommandOn(c, append(append([]string{"-suites-config", "../../testdata/suites/suites.json"}, flags...), args...)...)
+		return c, err
+	}
+
+	c, err := run("-suite", "smoke")
+	assert.NilError(t, err)
+	assert.Equal(t, c.MinCoverageFlag.String(), "10")
+	assert.Assert(t, !c.MinPatchFlag.set)
+
+	// The patch coverage is 75%.
+	c, err = run("-suite", "e2e")
+	assert.ErrorContains(t, err, "min-patch-coverage")
+	assert.DeepEqual(t, []string(c.ExcludeFlag), []string{"*/func2.go"})
+
+	// Flags take precedence over the thresholds of the suite.
+	_, err = run("-suite", "e2e", "-min-patch-coverage", "70")
+	assert.NilError(t, err)
+
+	t.Setenv("TEST_TYPE", "contract")
+	c, err = run()
+	assert.ErrorContains(t, err, "min-delta")
+	assert.Equal(t, c.MinCoverageFlag.String(), "50")
+	assert.DeepEqual(t, []string(c.IncludeFlag), []string{"testdata/*"})
+
+	_, err = run("-suite", "unit")
+	assert.Error(t, err, `unknown suite "unit" in ../../testdata/suites/suites.json, expected one of: contract, e2e, smoke`)
+}
+
+func TestCoverCommand_Run_suiteSelection(t *testing.T) {
+	err := newTestCommand(t).Run([]string{"-suites-config", "suites.json", "coverage.out", "patch.diff"})
+	assert.Error(t, err, "-suites-config requires -suite or TEST_TYPE")
+
+	err = newTestCommand(t).Run([]string{"-suite", "e2e", "coverage.out", "patch.diff"})
+	assert.Error(t, err, "-suite requires -suites-config")
+}
@@ -0,0 +1,166 @@
+package patchcover
+
+import (
+	"encoding/xml"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type coberturaCoverage struct {
+	XMLName         xml.Name          `xml:"coverage"`
+	LineRate        string            `xml:"line-rate,attr"`
+	BranchRate      string            `xml:"branch-rate,attr"`
+	LinesCovered    int               `xml:"lines-covered,attr"`
+	LinesValid      int               `xml:"lines-valid,attr"`
+	BranchesCovered int               `xml:"branches-covered,attr"`
+	BranchesValid   int               `xml:"branches-valid,attr"`
+	Complexity      string            `xml:"complexity,attr"`
+	Version         string            `xml:"version,attr"`
+	Timestamp       int64             `xml:"timestamp,attr"`
+	Sources         coberturaSources  `xml:"sources"`
+	Packages        coberturaPackages `xml:"packages"`
+}
+
+type coberturaSources struct {
+	Sources []string `xml:"source"`
+}
+
+type coberturaPackages struct {
+	Packages []coberturaPackage `xml:"package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity string           `xml:"complexity,attr"`
+	Classes    coberturaClasses `xml:"classes"`
+}
+
+type coberturaClasses struct {
+	Classes []coberturaClass `xml:"class"`
+}
+
+type coberturaClass struct {
+	Name       string         `xml:"name,attr"`
+	Filename   string         `xml:"filename,attr"`
+	LineRate   string         `xml:"line-rate,attr"`
+	BranchRate string         `xml:"branch-rate,attr"`
+	Complexity string         `xml:"complexity,attr"`
+	Methods    struct{}       `xml:"methods"`
+	Lines      coberturaLines `xml:"lines"`
+	covered    int
+	lines      map[int]int // line number -> hits
+}
+
+type coberturaLines struct {
+	Lines []coberturaLine `xml:"line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// RenderCoberturaOutput writes a Cobertura XML report of data.Profiles: one
+// <package> per directory holding one <class> per file, with one <line> per
+// line spanned by a block. A line spanned by several blocks gets the
+// highest of their counts as hits. With patchOnly, the report is scoped to
+// the patch: it only holds the added lines counted in the patch coverage,
+// of data.PatchLines. Rates are those of lines, Go profiles holding no
+// branch data.
+func RenderCoberturaOutput(data CoverageData, patchOnly bool, generated time.Time, out io.Writer) error {
+	classes := make(map[string]*coberturaClass)
+	hit := func(fileName string, lineNum, count int) {
+		class, ok := classes[fileName]
+		if !ok {
+			class = &coberturaClass{Name: path.Base(toSlash(fileName)), Filename: fileName, lines: make(map[int]int)}
+			classes[fileName] = class
+		}
+		if hits, ok := class.lines[lineNum]; !ok || count > hits {
+			class.lines[lineNum] = count
+		}
+	}
+	if patchOnly {
+		for fileName, lines := range data.PatchLines {
+			for _, line := range lines {
+				hit(fileName, line.LineNum, line.CoverCount)
+			}
+		}
+	} else {
+		for _, p := range data.Profiles {
+			for _, b := range p.Blocks {
+				for lineNum := b.StartLine; lineNum <= b.EndLine; lineNum++ {
+					hit(p.FileName, lineNum, b.Count)
+				}
+			}
+		}
+	}
+
+	byPkg := make(map[string][]*coberturaClass)
+	for fileName, class := range classes {
+		for lineNum, hits := range class.lines {
+			class.Lines.Lines = append(class.Lines.Lines, coberturaLine{Number: lineNum, Hits: hits})
+			if hits > 0 {
+				class.covered++
+			}
+		}
+		sort.Slice(class.Lines.Lines, func(i, j int) bool { return class.Lines.Lines[i].Number < class.Lines.Lines[j].Number })
+		class.LineRate = coberturaRate(class.covered, len(class.lines))
+		class.BranchRate, class.Complexity = "0", "0"
+		pkg := path.Dir(toSlash(fileName))
+		byPkg[pkg] = append(byPkg[pkg], class)
+	}
+	pkgNames := make([]string, 0, len(byPkg))
+	for name := range byPkg {
+		pkgNames = append(pkgNames, name)
+	}
+	sort.Strings(pkgNames)
+
+	doc := coberturaCoverage{
+		BranchRate: "0",
+		Complexity: "0",
+		Version:    "go-patch-cover",
+		Timestamp:  generated.UnixNano() / int64(time.Millisecond),
+		Sources:    coberturaSources{Sources: []string{"."}},
+	}
+	for _, name := range pkgNames {
+		pkgClasses := byPkg[name]
+		sort.Slice(pkgClasses, func(i, j int) bool { return pkgClasses[i].Filename < pkgClasses[j].Filename })
+		pkg := coberturaPackage{Name: name, BranchRate: "0", Complexity: "0"}
+		covered, valid := 0, 0
+		for _, class := range pkgClasses {
+			pkg.Classes.Classes = append(pkg.Classes.Classes, *class)
+			covered += class.covered
+			valid += len(class.lines)
+		}
+		pkg.LineRate = coberturaRate(covered, valid)
+		doc.Packages.Packages = append(doc.Packages.Packages, pkg)
+		doc.LinesCovered += covered
+		doc.LinesValid += valid
+	}
+	doc.LineRate = coberturaRate(doc.LinesCovered, doc.LinesValid)
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// coberturaRate returns the covered/valid ratio, 1 when there is nothing to
+// cover, as the patch coverage of a patch without statements is 100%.
+func coberturaRate(covered, valid int) string {
+	if valid == 0 {
+		return "1"
+	}
+	return strconv.FormatFloat(float64(covered)/float64(valid), 'f', -1, 64)
+}
@@ -0,0 +1,107 @@
+package patchcover
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/cover"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+type coberturaDoc struct {
+	XMLName      xml.Name `xml:"coverage"`
+	LineRate     string   `xml:"line-rate,attr"`
+	LinesCovered int      `xml:"lines-covered,attr"`
+	LinesValid   int      `xml:"lines-valid,attr"`
+	Timestamp    int64    `xml:"timestamp,attr"`
+	Packages     []struct {
+		Name    string `xml:"name,attr"`
+		Classes []struct {
+			Name     string `xml:"name,attr"`
+			Filename string `xml:"filename,attr"`
+			LineRate string `xml:"line-rate,attr"`
+			Lines    []struct {
+				Number int `xml:"number,attr"`
+				Hits   int `xml:"hits,attr"`
+			} `xml:"lines>line"`
+		} `xml:"classes>class"`
+	} `xml:"packages>package"`
+}
+
+func TestRenderCoberturaOutput(t *testing.T) {
+	profile := `mode: count
+example.com/m/a.go:3.14,5.2 1 2
+example.com/m/a.go:5.2,7.2 1 0
+example.com/m/pkg/b.go:3.14,4.2 1 0
+`
+	diff := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4 +4 @@ func A() int {
+-	return 0
++	return 1
+`
+	cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	assert.NilError(t, RenderCoberturaOutput(cov, false, time.Unix(1700000000, 0), &buf))
+	golden.Assert(t, buf.String(), "cobertura.golden.xml")
+
+	var doc coberturaDoc
+	assert.NilError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, doc.Timestamp, int64(1700000000000))
+	// Line 5 is spanned by a covered and an uncovered block.
+	assert.Equal(t, doc.LinesValid, 7)
+	assert.Equal(t, doc.LinesCovered, 3)
+	assert.Equal(t, len(doc.Packages), 2)
+	assert.Equal(t, doc.Packages[0].Name, "example.com/m")
+	a := doc.Packages[0].Classes[0]
+	assert.Equal(t, a.Name, "a.go")
+	assert.Equal(t, a.Filename, "example.com/m/a.go")
+	assert.Equal(t, a.LineRate, "0.6")
+	assert.Equal(t, a.Lines[2].Number, 5)
+	assert.Equal(t, a.Lines[2].Hits, 2)
+
+	buf.Reset()
+	assert.NilError(t, RenderCoberturaOutput(cov, true, time.Unix(1700000000, 0), &buf))
+	doc = coberturaDoc{}
+	assert.NilError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, doc.LinesValid, 1)
+	assert.Equal(t, doc.LinesCovered, 1)
+	assert.Equal(t, doc.LineRate, "1")
+	assert.Equal(t, len(doc.Packages), 1)
+	assert.Equal(t, doc.Packages[0].Classes[0].Lines[0].Number, 4)
+	assert.Equal(t, doc.Packages[0].Classes[0].Lines[0].Hits, 2)
+}
+
+func TestRenderCoberturaOutput_escaping(t *testing.T) {
+	cov := CoverageData{Profiles: []*cover.Profile{{
+		FileName: `example.com/m/a&b/<"x">.go`,
+		Mode:     "set",
+		Blocks:   []cover.ProfileBlock{{StartLine: 1, EndLine: 1, NumStmt: 1, Count: 1}},
+	}}}
+	var buf bytes.Buffer
+	assert.NilError(t, RenderCoberturaOutput(cov, false, time.Unix(0, 0), &buf))
+	assert.Assert(t, strings.Contains(buf.String(), `filename="example.com/m/a&amp;b/&lt;&#34;x&#34;&gt;.go"`), buf.String())
+
+	var doc coberturaDoc
+	assert.NilError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, doc.Packages[0].Name, "example.com/m/a&b")
+	assert.Equal(t, doc.Packages[0].Classes[0].Filename, `example.com/m/a&b/<"x">.go`)
+}
+
+func TestRenderCoberturaOutput_empty(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NilError(t, RenderCoberturaOutput(CoverageData{}, false, time.Unix(0, 0), &buf))
+	golden.Assert(t, buf.String(), "cobertura-empty.golden.xml")
+
+	var doc coberturaDoc
+	assert.NilError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, doc.LineRate, "1")
+	assert.Equal(t, len(doc.Packages), 0)
+}
@@ -0,0 +1,20 @@
+package patchcover
+
+import "io"
+
+// commentHeading heads the default body of pull request comments.
+const commentHeading = "### Patch coverage\n\n"
+
+// RenderCommentOutput writes the body of a pull request comment: the
+// markdown output under a heading, unless tmplOverride is set. It is kept
+// apart from RenderTemplateOutput so comments and console output can be
+// formatted differently.
+func RenderCommentOutput(data CoverageData, tmplOverride string, out io.Writer) error {
+	if tmplOverride != "" {
+		return renderTemplate("", tmplOverride, data, out)
+	}
+	if _, err := io.WriteString(out, commentHeading); err != nil {
+		return err
+	}
+	return RenderMarkdownOutput(data, out)
+}
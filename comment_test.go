@@ -0,0 +1,26 @@
+package patchcover
+
+import (
+	"bytes"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestRenderCommentOutput(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("testdata/scenarios/new_file/coverage.out", "testdata/scenarios/new_file/diff.diff", "testdata/scenarios/new_file/coverage.out")
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	assert.NilError(t, RenderCommentOutput(cov, "", &buf))
+	golden.Assert(t, buf.String(), "comment.golden.md")
+
+	buf.Reset()
+	assert.NilError(t, RenderCommentOutput(CoverageData{PatchCoverage: 100}, "", &buf))
+	golden.Assert(t, buf.String(), "comment-covered.golden.md")
+
+	buf.Reset()
+	assert.NilError(t, RenderCommentOutput(cov, "@owner patch coverage is {{.PatchCoverage}}%", &buf))
+	assert.Equal(t, buf.String(), "@owner patch coverage is 75%")
+}
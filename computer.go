@@ -0,0 +1,662 @@
+package patchcover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"golang.org/x/tools/cover"
+)
+
+// Config controls the behavior of a Computer. The zero value computes
+// coverage the same way ProcessFiles does, without writing any file.
+type Config struct {
+	// ModulePrefix is stripped from profile file names, which are then
+	// matched exactly against diff paths. When empty, the module path of
+	// the nearest go.mod, from the working directory up, is stripped from
+	// the profile file names of that module, which then match a diff file
+	// when its path is or ends with their module relative name. Other
+	// profiles match a diff file when their name ends with the diff path.
+	ModulePrefix string
+
+	// ModuleDir is the directory of the ModulePrefix module within the
+	// repository, for modules outside of its root: module relative profile
+	// file names are joined to it before being matched exactly against the
+	// repository relative diff paths. It is ignored without ModulePrefix.
+	ModuleDir string
+
+	// GoModFile is the path of a go.mod file whose replace directives by a
+	// local directory are applied to profile file names: files of a
+	// replaced module are matched exactly against their path in the
+	// replacement directory.
+	GoModFile string
+
+	// DetectModules resolves the module of each changed file by walking up
+	// from its directory to the nearest go.mod, relative to the working
+	// directory, and matches profiles exactly against the module path
+	// joined with the file's path within the module. This supports
+	// repositories holding several modules. Files outside a module are
+	// matched as if DetectModules was not set.
+	DetectModules bool
+
+	// Excludes lists glob patterns of files left out of all coverage
+	// numbers. Patterns are matched against the file path and against
+	// each of its trailing path segments, so "mocks/*" matches
+	// "github.com/org/repo/mocks/store.go", and a pattern matching a
+	// directory matches the files in it. "*" matches within a path
+	// segment, and a "**" segment any number of segments.
+	Excludes []string
+
+	// Includes, when not empty, restricts coverage to files matching at
+	// least one of these glob patterns. Excludes take precedence.
+	Includes []string
+
+	// CoverageIgnore lists patterns in the syntax of .gitignore files, e.g.
+	// the lines of a .coverageignore file, of files left out of all
+	// coverage numbers along with Excludes. Patterns are matched against
+	// file paths relative to the module root, once ModulePrefix, or the
+	// module path of the go.mod of the working directory, is stripped.
+	// The last matching pattern wins, so "!" patterns re-include files of
+	// excluded directories.
+	CoverageIgnore []string
+
+	// Extensions lists the extensions of the changed files considered,
+	// e.g. ".go". When empty, only .go files are considered.
+	Extensions []string
+
+	// ExcludeTests leaves _test.go files out of both the total and the
+	// patch coverage, for profiles that happen to hold test files. It
+	// applies on top of Excludes.
+	ExcludeTests bool
+
+	// Pathspecs, git-style pathspecs, restrict the changed files considered
+	// to those of the diff matching at least one of them, if any, and none
+	// of those prefixed with ":!", ":^" or ":(exclude)". They are matched
+	// against the diff path from the repository root, as a file or one of
+	// its parent directories; "*" matches within a path segment and "**"
+	// any number of them, as with git's glob magic, e.g. "pkg/**" or
+	// ":!**/testdata/**".
+	Pathspecs []string
+
+	// Strict makes the computation fail when the patch changes Go files but
+	// none of them matched a coverage profile, which usually means the
+	// profile and diff paths do not line up, or when the coverage is
+	// Stale.
+	Strict bool
+
+	// StaleThreshold is the fraction of the added code lines of the files
+	// matching a profile that may fall in none of its blocks before the
+	// coverage is reported Stale. When zero, 0.5 is used.
+	StaleThreshold float64
+
+	// EmptyPatchCoverage is the PatchCoverage of a patch adding no
+	// statement, e.g. of comments or docs only: "100", the default, "0",
+	// or "none", leaving it at 0 and setting NoTestableChanges.
+	EmptyPatchCoverage string
+
+	// UncoveredOut is the path the uncovered lines report is written to.
+	// When empty, no file is written.
+	UncoveredOut string
+
+	// CoveredOut is the path the covered lines report, listing the added
+	// lines counted in the patch coverage as covered in the format of the
+	// uncovered lines report, is written to. Setting it also fills
+	// CoverageData.CoveredLines. When empty, no file is written.
+	CoveredOut string
+
+	// Precision, when positive, rounds percentages to that many decimal
+	// places.
+	Precision int
+
+	// WeightByComplexity multiplies the statements of each changed block
+	// by the cyclomatic complexity of the function containing it, so
+	// complex code weighs more in the patch coverage. The changed files are
+	// read from disk; statements outside functions keep a weight of 1.
+	WeightByComplexity bool
+
+	// ChangedFunctions reports the patch coverage of every function holding
+	// changed statements in CoverageData.Functions. Changed files are read
+	// from disk; functions of files missing from disk are not reported.
+	ChangedFunctions bool
+
+	// TrimGeneratedFromTotal leaves generated files, marked by a
+	// "// Code generated ... DO NOT EDIT." comment, out of the total and
+	// previous coverage. Profile file names are read from disk relative to
+	// the working directory once ModulePrefix, or the module path of the
+	// go.mod of the working directory when empty, is stripped.
+	TrimGeneratedFromTotal bool
+
+	// StrictPercentages fails the computation when covered statement
+	// counts are negative or exceed statement counts, instead of clamping
+	// percentages to the 0-100 range.
+	StrictPercentages bool
+
+	// PatchOnly computes the patch coverage only, skipping the total and
+	// previous coverage, which are costly on large profiles: the previous
+	// coverage profile is not read, their fields are left zero and
+	// CoverageData.PatchOnly is set. Packages and TrimGeneratedFromTotal
+	// are ignored.
+	PatchOnly bool
+
+	// Regressions reports the lines covered in the previous coverage
+	// profile and not anymore in CoverageData.Regressions, apart from the
+	// uncovered added lines. Lines of changed files are correlated with
+	// their previous version through the diff.
+	Regressions bool
+
+	// Packages breaks the total and previous coverage down by package, the
+	// directory of profile file names, into CoverageData.Packages.
+	Packages bool
+
+	// Files breaks the total and patch coverage down by changed file into
+	// CoverageData.Files.
+	Files bool
+
+	// CodeOwners holds the lines of a CODEOWNERS file. When not empty, the
+	// patch coverage and uncovered lines of changed files are grouped by
+	// code owner into CoverageData.ByOwner, matching diff paths against
+	// the CODEOWNERS patterns.
+	CodeOwners []string
+
+	// TotalMinHits and PatchMinHits are the counts a block needs to be
+	// covered in the total and previous coverage, and in the patch
+	// coverage. When less than 1, any hit covers a block.
+	TotalMinHits int
+	PatchMinHits int
+
+	// ProfileMode, when set to "set", "count" or "atomic", overrides the
+	// mode of the profiles, for profiles with a wrong or missing mode
+	// header. In set mode, block counts are clamped to 1.
+	ProfileMode string
+
+	// Variants lists coverage profiles of other variants of the build the
+	// coverage profile comes from, e.g. with -race. They are merged into it
+	// with MergeProfiles.
+	Variants []string
+
+	// Suites lists coverage profiles of other test suites of the same code
+	// as the coverage profile, e.g. integration tests. They are summed with
+	// it with SumProfiles, after merging the variants.
+	Suites []string
+
+	// CoverageFormat is the format of the coverage files: "go" for go
+	// cover profiles, or "lcov" for lcov tracefiles, parsed with
+	// ParseLcovProfiles. When empty, files named *.info are lcov and others
+	// go cover profiles.
+	CoverageFormat string
+
+	// Concurrency bounds the number of coverage profiles parsed, and of
+	// profiles whose patch coverage is computed, in parallel. The diff is
+	// parsed alongside the coverage profiles. When not positive, GOMAXPROCS
+	// is used.
+	Concurrency int
+
+	// CacheDir, when set, is a directory where parsed coverage profiles
+	// and diffs are stored across runs, keyed by the hash of their
+	// content, and reused instead of parsing the same file again.
+	CacheDir string
+
+	// SkipEmbeddedData excludes added lines holding data rather than code:
+	// continuation lines of multi-line string literals and declarations
+	// following a //go:embed directive. The changed files are read from disk.
+	SkipEmbeddedData bool
+
+	// SkipDeprecated excludes added lines of functions whose doc comment
+	// has a paragraph starting with "Deprecated:". The changed files are
+	// read from disk.
+	SkipDeprecated bool
+
+	// SkipGenerated leaves changed generated files, marked by a
+	// "// Code generated ... DO NOT EDIT." comment, out of the patch, total
+	// and previous coverage. The changed files are read from disk; the
+	// leading lines of the new file held by the diff are checked for the
+	// comment when a file is not on disk.
+	SkipGenerated bool
+
+	// FunctionBodiesOnly restricts the patch coverage to added lines inside
+	// the bodies of function declarations, leaving out imports and
+	// package-level declarations such as variables initialized with
+	// function literals. The changed files are read from disk.
+	FunctionBodiesOnly bool
+
+	// IgnoreFile is the path of a file listing added lines excluded from
+	// the patch coverage, kept apart from the source: one file:line or
+	// file:start-end entry per line, where file is the path of the file in
+	// the diff. Blank lines and lines starting with # are skipped.
+	IgnoreFile string
+
+	// IgnoreMarkers lists marker strings, e.g. "// TODO" or "//nocover",
+	// excluding the added lines holding one of them from the patch
+	// coverage.
+	IgnoreMarkers []string
+
+	// SkipFormatOnly excludes from the patch coverage the added lines
+	// only reformatted: those matching a line deleted from the same file
+	// once whitespace is removed, as gofmt or an import reordering leave
+	// them.
+	SkipFormatOnly bool
+
+	// Deadline, when positive, bounds the time spent matching coverage
+	// profiles against the diff. Once exceeded, the remaining profiles are
+	// left out of the patch coverage and CoverageData.Incomplete is set,
+	// rather than running indefinitely on huge inputs. The total and
+	// previous coverage are always complete.
+	Deadline time.Duration
+
+	// UncoveredContext, when positive, is the number of source lines
+	// around each uncovered line added to the uncovered lines report and to
+	// UncoveredLine.Context. The changed files are read from disk; files
+	// that cannot be read get no context. It is ignored with RedactSource.
+	UncoveredContext int
+
+	// UncoveredHunks sets UncoveredLine.Hunk, the header of the diff hunk
+	// holding each uncovered line, e.g. "@@ -12,4 +12,6 @@ func A() {".
+	// With RedactSource, the header leaves out the code following it.
+	UncoveredHunks bool
+
+	// GroupUncoveredRanges reports contiguous uncovered lines of a file as
+	// one range, e.g. "LineNum: 42-48", in the uncovered lines report, and
+	// in CoverageData.UncoveredRanges.
+	GroupUncoveredRanges bool
+
+	// RedactSource leaves the content of source lines out of the coverage
+	// data, for environments where code must not leave the build: the
+	// uncovered lines report and the LineString of UncoveredLines and
+	// PatchLines only hold file names and line numbers.
+	RedactSource bool
+}
+
+// Computer computes coverage data according to its Config.
+type Computer struct {
+	cfg Config
+}
+
+// New returns a Computer using cfg.
+func New(cfg Config) *Computer {
+	return &Computer{cfg: cfg}
+}
+
+// ComputeFromFiles computes coverage from a coverage profile and a diff
+// file. prevCovFile is optional; when empty, no previous coverage is
+// reported. diffFile is optional too; when empty, only the total coverage
+// is computed, as with ComputeTotal.
+func (c *Computer) ComputeFromFiles(coverageFile, diffFile, prevCovFile string) (CoverageData, error) {
+	if diffFile == "" {
+		return c.ComputeTotal(coverageFile, prevCovFile)
+	}
+	patch, err := os.Open(diffFile)
+	if err != nil {
+		return CoverageData{}, &FileError{Arg: "diff", Path: diffFile, Err: err}
+	}
+	defer patch.Close()
+
+	return c.ComputeFromDiffReader(patch, coverageFile, prevCovFile)
+}
+
+// ComputeTotal computes the total coverage of a coverage profile file,
+// without a patch: CoverageData.TotalOnly is set and the patch fields are
+// left zero. prevCovFile is optional.
+func (c *Computer) ComputeTotal(coverageFile, prevCovFile string) (CoverageData, error) {
+	if c.cfg.PatchOnly {
+		return CoverageData{}, fmt.Errorf("computing patch coverage only requires a diff")
+	}
+	d, err := c.computeFromProfileFiles(parsedDiff(nil), coverageFile, prevCovFile)
+	if err != nil {
+		return CoverageData{}, err
+	}
+	d.TotalOnly = true
+	// Without a patch, there are no changed statements to be covered.
+	d.PatchCoverage = 0
+	return d, nil
+}
+
+// ComputeFromDiffReader computes coverage from a coverage profile file and
+// a diff read from diff. prevCovFile is optional.
+func (c *Computer) ComputeFromDiffReader(diff io.Reader, coverageFile, prevCovFile string) (CoverageData, error) {
+	return c.computeFromProfileFiles(parseDiffAsync(diff, c.cfg.CacheDir), coverageFile, prevCovFile)
+}
+
+// ComputeFromDiffs computes coverage from a coverage profile file and
+// several diff files, combined with op: "union" counts the lines added by
+// any of the diffs, and "intersect" only those added by all of them, e.g.
+// to find what two pull requests both change. The diffs must be relative
+// to the same version of the files. prevCovFile is optional.
+func (c *Computer) ComputeFromDiffs(diffFiles []string, op, coverageFile, prevCovFile string) (CoverageData, error) {
+	diffs := make([][]*gitdiff.File, 0, len(diffFiles))
+	for _, diffFile := range diffFiles {
+		patch, err := os.Open(diffFile)
+		if err != nil {
+			return CoverageData{}, &FileError{Arg: "diff", Path: diffFile, Err: err}
+		}
+		files, err := parseCachedDiff(patch, c.cfg.CacheDir)
+		patch.Close()
+		if err != nil {
+			return CoverageData{}, err
+		}
+		diffs = append(diffs, files)
+	}
+	files, err := combineDiffs(op, diffs)
+	if err != nil {
+		return CoverageData{}, err
+	}
+
+	return c.computeFromProfileFiles(parsedDiff(files), coverageFile, prevCovFile)
+}
+
+// ComputeWholeFiles computes coverage treating every line of the named
+// files as changed, without a diff. The files are read from disk; files
+// that do not exist are skipped. prevCovFile is optional.
+func (c *Computer) ComputeWholeFiles(coverageFile string, fileNames []string, prevCovFile string) (CoverageData, error) {
+	files, err := wholeFiles(fileNames)
+	if err != nil {
+		return CoverageData{}, err
+	}
+
+	return c.computeFromProfileFiles(parsedDiff(files), coverageFile, prevCovFile)
+}
+
+// ComputeFromReaders computes coverage from a coverage profile and a diff
+// read from the given readers. prevCoverage is optional; when nil, no
+// previous coverage is reported.
+func (c *Computer) ComputeFromReaders(coverage, diff, prevCoverage io.Reader) (CoverageData, error) {
+	return c.compute(parseDiffAsync(diff, c.cfg.CacheDir), coverage, prevCoverage)
+}
+
+// diffFunc returns the files of a diff, once parsed.
+type diffFunc func() ([]*gitdiff.File, error)
+
+// parseDiffAsync parses the diff read from r in the background, while the
+// coverage profiles are parsed, reusing the files cached in cacheDir.
+func parseDiffAsync(r io.Reader, cacheDir string) diffFunc {
+	type result struct {
+		files []*gitdiff.File
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		files, err := parseCachedDiff(r, cacheDir)
+		done <- result{files, err}
+	}()
+
+	var res *result
+	return func() ([]*gitdiff.File, error) {
+		if res == nil {
+			r := <-done
+			res = &r
+		}
+		return res.files, res.err
+	}
+}
+
+// parsedDiff returns the diffFunc of files parsed already.
+func parsedDiff(files []*gitdiff.File) diffFunc {
+	return func() ([]*gitdiff.File, error) { return files, nil }
+}
+
+// computeFromProfileFiles computes coverage from the coverage files and the
+// diff. Errors of the diff take precedence over those of the coverage
+// files, and the diff is always waited for, so that its reader is not read
+// anymore once the computation returns.
+func (c *Computer) computeFromProfileFiles(diff diffFunc, coverageFile, prevCovFile string) (CoverageData, error) {
+	cov, err := os.Open(coverageFile)
+	if err != nil {
+		return failAfterDiff(diff, &FileError{Arg: "coverage", Path: coverageFile, Err: err})
+	}
+	defer cov.Close()
+
+	var prev io.Reader
+	if prevCovFile != "" {
+		f, err := os.Open(prevCovFile)
+		if err != nil {
+			return failAfterDiff(diff, &FileError{Arg: "previous coverage", Path: prevCovFile, Err: err})
+		}
+		defer f.Close()
+		prev = f
+	}
+
+	return c.compute(diff, cov, prev)
+}
+
+// failAfterDiff returns err once the diff is parsed, or the error parsing
+// it.
+func failAfterDiff(diff diffFunc, err error) (CoverageData, error) {
+	if _, diffErr := diff(); diffErr != nil {
+		return CoverageData{}, diffErr
+	}
+	return CoverageData{}, err
+}
+
+// namedReader reads a file through a buffer, keeping its name.
+type namedReader struct {
+	io.Reader
+	name string
+}
+
+func (r namedReader) Name() string {
+	return r.name
+}
+
+// nonEmptyProfile returns a reader of the coverage profile read by r, or a
+// *ParseError of ErrEmptyProfile when r has no content. An empty previous
+// profile is not an error, but the coverage profile must at least hold
+// the mode line go test writes.
+func nonEmptyProfile(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); err == io.EOF {
+		return nil, &ParseError{Path: readerName(r), Err: ErrEmptyProfile}
+	} else if err != nil {
+		return nil, &ParseError{Path: readerName(r), Err: err}
+	}
+	if name := readerName(r); name != "" {
+		return namedReader{br, name}, nil
+	}
+	return br, nil
+}
+
+func (c *Computer) compute(diff diffFunc, coverage, prevCoverage io.Reader) (CoverageData, error) {
+	profiles, prevProfiles, err := c.parseCoverage(coverage, prevCoverage)
+	if err != nil {
+		return failAfterDiff(diff, err)
+	}
+	files, err := diff()
+	if err != nil {
+		return CoverageData{}, err
+	}
+	return c.ComputeFromProfiles(files, profiles, prevProfiles)
+}
+
+// parseCoverage parses the coverage and previous coverage profiles, with
+// the Variants and Suites of the Config, in parallel. The variants are
+// merged into the coverage profiles, and the suites summed up with them.
+func (c *Computer) parseCoverage(coverage, prevCoverage io.Reader) (profiles, prevProfiles []*cover.Profile, err error) {
+	if c.cfg.PatchOnly {
+		// Not parsed: the previous coverage is not computed.
+		prevCoverage = nil
+	}
+	coverage, err = nonEmptyProfile(coverage)
+	if err != nil {
+		return nil, nil, err
+	}
+	readers := []io.Reader{coverage}
+	if prevCoverage != nil {
+		readers = append(readers, prevCoverage)
+	}
+	for _, variant := range c.cfg.Variants {
+		f, err := os.Open(variant)
+		if err != nil {
+			return nil, nil, &FileError{Arg: "variant coverage", Path: variant, Err: err}
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	for _, suite := range c.cfg.Suites {
+		f, err := os.Open(suite)
+		if err != nil {
+			return nil, nil, &FileError{Arg: "suite coverage", Path: suite, Err: err}
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	for i, r := range readers {
+		format, err := c.coverageFormat(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if format == "lcov" {
+			readers[i] = lcovReader{r}
+		}
+	}
+	parsed, err := parseProfiles(readers, c.cfg.Concurrency, c.cfg.CacheDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.cfg.ProfileMode != "" {
+		for _, profiles := range parsed {
+			if err := overrideMode(profiles, c.cfg.ProfileMode); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	profiles = parsed[0]
+	if prevCoverage != nil {
+		prevProfiles = parsed[1]
+	}
+	suites := parsed[len(parsed)-len(c.cfg.Suites):]
+	if len(c.cfg.Variants) > 0 {
+		variants := parsed[len(parsed)-len(c.cfg.Suites)-len(c.cfg.Variants) : len(parsed)-len(c.cfg.Suites)]
+		profiles = MergeProfiles(append([][]*cover.Profile{profiles}, variants...)...)
+	}
+	if len(suites) > 0 {
+		profiles, err = SumProfiles(append([][]*cover.Profile{profiles}, suites...)...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return profiles, prevProfiles, nil
+}
+
+// ComputeFromProfiles computes coverage from parsed diff files and coverage
+// profiles, for callers reading them their own way. prevProfiles is empty
+// when there is no previous coverage. Profiles of the same file are
+// merged, and overlapping blocks of the profiles are resolved, on copies:
+// the profiles of the caller are left unchanged. The Variants, Suites and
+// coverage format settings of the Config, which concern coverage files,
+// are not applied.
+func (c *Computer) ComputeFromProfiles(files []*gitdiff.File, profiles, prevProfiles []*cover.Profile) (CoverageData, error) {
+	profiles = resolveOverlaps(mergeSameFile(profiles))
+	prevProfiles = resolveOverlaps(mergeSameFile(prevProfiles))
+
+	d, err := computeCoverage(files, profiles, prevProfiles, c.cfg)
+	if err != nil {
+		return CoverageData{}, err
+	}
+	// An empty previous profile, e.g. of a run that failed before writing
+	// any block, is no previous coverage.
+	d.HasPrevCoverage = d.PrevNumStmt > 0
+
+	if c.cfg.Precision > 0 {
+		d.Coverage = round(d.Coverage, c.cfg.Precision)
+		d.PatchCoverage = round(d.PatchCoverage, c.cfg.Precision)
+		d.PrevCoverage = round(d.PrevCoverage, c.cfg.Precision)
+		for i := range d.Packages {
+			d.Packages[i].Coverage = round(d.Packages[i].Coverage, c.cfg.Precision)
+			d.Packages[i].PrevCoverage = round(d.Packages[i].PrevCoverage, c.cfg.Precision)
+		}
+		for i := range d.Files {
+			d.Files[i].Coverage = round(d.Files[i].Coverage, c.cfg.Precision)
+			d.Files[i].PatchCoverage = round(d.Files[i].PatchCoverage, c.cfg.Precision)
+			d.Files[i].PrevCoverage = round(d.Files[i].PrevCoverage, c.cfg.Precision)
+		}
+		for i := range d.ByOwner {
+			d.ByOwner[i].PatchCoverage = round(d.ByOwner[i].PatchCoverage, c.cfg.Precision)
+		}
+	}
+
+	if c.cfg.UncoveredOut != "" {
+		if err := os.WriteFile(c.cfg.UncoveredOut, []byte(d.Uncovered_lines), 0o644); err != nil {
+			return CoverageData{}, fmt.Errorf("writing uncovered lines: %w", err)
+		}
+	}
+	if c.cfg.CoveredOut != "" {
+		if err := os.WriteFile(c.cfg.CoveredOut, []byte(coveredReport(d.CoveredLines, c.cfg.RedactSource)), 0o644); err != nil {
+			return CoverageData{}, fmt.Errorf("writing covered lines: %w", err)
+		}
+	}
+
+	return d, nil
+}
+
+func round(v float64, precision int) float64 {
+	p := math.Pow(10, float64(precision))
+	return math.Round(v*p) / p
+}
+
+// DumpPaths writes, for every profile and every diff file, its raw file
+// name and the normalized form used for matching, and flags the diff files
+// that match no profile.
+func (c *Computer) DumpPaths(out io.Writer, coverageFile, diffFile string) error {
+	patch, err := os.Open(diffFile)
+	if err != nil {
+		return &FileError{Arg: "diff", Path: diffFile, Err: err}
+	}
+	defer patch.Close()
+
+	files, err := parseDiff(patch)
+	if err != nil {
+		return err
+	}
+
+	cov, err := os.Open(coverageFile)
+	if err != nil {
+		return &FileError{Arg: "coverage", Path: coverageFile, Err: err}
+	}
+	defer cov.Close()
+	r, err := nonEmptyProfile(cov)
+	if err != nil {
+		return err
+	}
+	format, err := c.coverageFormat(r)
+	if err != nil {
+		return err
+	}
+	parse := cover.ParseProfilesFromReader
+	if format == "lcov" {
+		parse = ParseLcovProfiles
+	}
+	profiles, err := parse(r)
+	if err != nil {
+		return &ParseError{Path: coverageFile, Err: err}
+	}
+
+	matches, err := newDiffMatcher(files, profiles, c.cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "profiles:")
+	for _, p := range profiles {
+		fmt.Fprintf(out, "\t%s -> %s\n", p.FileName, normalizeProfileName(p.FileName, c.cfg.ModulePrefix))
+	}
+
+	fmt.Fprintln(out, "diff files:")
+	for _, f := range files {
+		matched := false
+		for _, p := range profiles {
+			if matches(p.FileName, f.NewName) {
+				matched = true
+				break
+			}
+		}
+		note := ""
+		if !matched {
+			note = " (no matching profile)"
+		}
+		fmt.Fprintf(out, "\t%s -> %s%s\n", f.NewName, normalizeDiffName(f.NewName), note)
+	}
+	return nil
+}
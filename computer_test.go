@@ -0,0 +1,1114 @@
+package patchcover
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestComputer_ComputeFromFiles(t *testing.T) {
+	newFile := "./testdata/scenarios/new_file"
+	embedded := "./testdata/embedded-data"
+	multiModule := "./testdata/multi-module"
+	deprecated := "./testdata/deprecated"
+	testFiles := "./testdata/test-files"
+	replaced := "./testdata/replace"
+	functionBodies := "./testdata/function-bodies"
+	generated := "./testdata/generated"
+	mockgen := "./testdata/mockgen"
+
+	tests := map[string]struct {
+		dir             string
+		cfg             Config
+		wantNumStmt     int
+		wantPatchStmt   int
+		wantPatchCover  int
+		wantCoverage    float64
+		wantErrContains string
+	}{
+		"zero config": {
+			dir:            newFile,
+			wantNumStmt:    8,
+			wantPatchStmt:  8,
+			wantPatchCover: 6,
+			wantCoverage:   75,
+		},
+		"module prefix": {
+			dir:            newFile,
+			cfg:            Config{ModulePrefix: "github.com/seriousben/go-patch-cover"},
+			wantNumStmt:    8,
+			wantPatchStmt:  8,
+			wantPatchCover: 6,
+			wantCoverage:   75,
+		},
+		"wrong module prefix": {
+			dir:          newFile,
+			cfg:          Config{ModulePrefix: "github.com/other/repo"},
+			wantNumStmt:  8,
+			wantCoverage: 75,
+		},
+		"wrong module prefix strict": {
+			dir:             newFile,
+			cfg:             Config{ModulePrefix: "github.com/other/repo", Strict: true},
+			wantErrContains: "none of the changed go files matched",
+		},
+		"excludes": {
+			dir: newFile,
+			cfg: Config{Excludes: []string{"test-project/*.go"}},
+		},
+		"coverageignore directory": {
+			dir: newFile,
+			cfg: Config{
+				ModulePrefix:   "github.com/seriousben/go-patch-cover",
+				CoverageIgnore: []string{"/testdata/"},
+			},
+		},
+		"coverageignore negated file": {
+			dir: newFile,
+			cfg: Config{
+				ModulePrefix:   "github.com/seriousben/go-patch-cover",
+				CoverageIgnore: []string{"# generated", "testdata/", "!testdata/test-project/func1.go"},
+			},
+			wantNumStmt:    8,
+			wantPatchStmt:  8,
+			wantPatchCover: 6,
+			wantCoverage:   75,
+		},
+		"includes not matching": {
+			dir: newFile,
+			cfg: Config{Includes: []string{"pkg/*"}},
+		},
+		"includes matching": {
+			dir:            newFile,
+			cfg:            Config{Includes: []string{"testdata/test-project/*"}},
+			wantNumStmt:    8,
+			wantPatchStmt:  8,
+			wantPatchCover: 6,
+			wantCoverage:   75,
+		},
+		"weight by complexity": {
+			// Func1 has a complexity of 3.
+			dir:            newFile,
+			cfg:            Config{WeightByComplexity: true},
+			wantNumStmt:    8,
+			wantPatchStmt:  24,
+			wantPatchCover: 18,
+			wantCoverage:   75,
+		},
+		"skip embedded data": {
+			dir:          embedded,
+			cfg:          Config{SkipEmbeddedData: true},
+			wantNumStmt:  2,
+			wantCoverage: 50,
+		},
+		"embedded data counted": {
+			dir:           embedded,
+			wantNumStmt:   2,
+			wantPatchStmt: 1,
+			wantCoverage:  50,
+		},
+		"skip deprecated": {
+			dir:            deprecated,
+			cfg:            Config{SkipDeprecated: true},
+			wantNumStmt:    5,
+			wantPatchStmt:  1,
+			wantPatchCover: 1,
+			wantCoverage:   80,
+		},
+		"deprecated counted": {
+			dir:            deprecated,
+			wantNumStmt:    5,
+			wantPatchStmt:  2,
+			wantPatchCover: 1,
+			wantCoverage:   80,
+		},
+		"test files counted": {
+			dir:            testFiles,
+			wantNumStmt:    2,
+			wantPatchStmt:  2,
+			wantPatchCover: 1,
+			wantCoverage:   50,
+		},
+		"exclude tests": {
+			dir:            testFiles,
+			cfg:            Config{ExcludeTests: true},
+			wantNumStmt:    1,
+			wantPatchStmt:  1,
+			wantPatchCover: 1,
+			wantCoverage:   100,
+		},
+		"exclude tests and patterns": {
+			dir:            testFiles,
+			cfg:            Config{ExcludeTests: true, Excludes: []string{"**/sum.go"}},
+			wantNumStmt:    0,
+			wantPatchStmt:  0,
+			wantPatchCover: 0,
+			wantCoverage:   0,
+		},
+		"multiple modules undetected": {
+			dir:          multiModule,
+			wantNumStmt:  2,
+			wantCoverage: 50,
+		},
+		"multiple modules": {
+			dir:            multiModule,
+			cfg:            Config{DetectModules: true},
+			wantNumStmt:    2,
+			wantPatchStmt:  2,
+			wantPatchCover: 1,
+			wantCoverage:   50,
+		},
+		"package-level declarations counted": {
+			dir:            functionBodies,
+			wantNumStmt:    3,
+			wantPatchStmt:  3,
+			wantPatchCover: 2,
+			wantCoverage:   66.66666666666666,
+		},
+		"function bodies only": {
+			dir:            functionBodies,
+			cfg:            Config{FunctionBodiesOnly: true},
+			wantNumStmt:    3,
+			wantPatchStmt:  2,
+			wantPatchCover: 2,
+			wantCoverage:   66.66666666666666,
+		},
+		"generated files in total": {
+			dir:            generated,
+			wantNumStmt:    3,
+			wantPatchStmt:  1,
+			wantPatchCover: 1,
+			wantCoverage:   33.33333333333333,
+		},
+		"trim generated from total": {
+			dir:            generated,
+			cfg:            Config{TrimGeneratedFromTotal: true},
+			wantNumStmt:    1,
+			wantPatchStmt:  1,
+			wantPatchCover: 1,
+			wantCoverage:   100,
+		},
+		"trim generated from total outside module": {
+			dir:            newFile,
+			cfg:            Config{TrimGeneratedFromTotal: true},
+			wantNumStmt:    8,
+			wantPatchStmt:  8,
+			wantPatchCover: 6,
+			wantCoverage:   75,
+		},
+		"generated files counted": {
+			dir:            mockgen,
+			wantNumStmt:    4,
+			wantPatchStmt:  3,
+			wantPatchCover: 1,
+			wantCoverage:   25,
+		},
+		"skip generated": {
+			dir:            mockgen,
+			cfg:            Config{SkipGenerated: true},
+			wantNumStmt:    1,
+			wantPatchStmt:  1,
+			wantPatchCover: 1,
+			wantCoverage:   100,
+		},
+		"ignore file": {
+			dir:            newFile,
+			cfg:            Config{IgnoreFile: "testdata/ignore/ignore.txt"},
+			wantNumStmt:    8,
+			wantPatchStmt:  5,
+			wantPatchCover: 5,
+			wantCoverage:   75,
+		},
+		"missing ignore file": {
+			dir:             newFile,
+			cfg:             Config{IgnoreFile: "testdata/ignore/missing.txt"},
+			wantErrContains: "ignore file not found: testdata/ignore/missing.txt",
+		},
+		"replace directive unapplied": {
+			dir:          replaced,
+			cfg:          Config{ModulePrefix: "example.com/app"},
+			wantNumStmt:  2,
+			wantCoverage: 50,
+		},
+		"replace directive": {
+			dir:            replaced,
+			cfg:            Config{ModulePrefix: "example.com/app", GoModFile: "testdata/replace/go.mod"},
+			wantNumStmt:    2,
+			wantPatchStmt:  2,
+			wantPatchCover: 1,
+			wantCoverage:   50,
+		},
+		"missing go.mod": {
+			dir:             replaced,
+			cfg:             Config{GoModFile: "testdata/replace/missing.mod"},
+			wantErrContains: "missing.mod",
+		},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			cov, err := New(tt.cfg).ComputeFromFiles(path.Join(tt.dir, "coverage.out"), path.Join(tt.dir, "diff.diff"), "")
+			if tt.wantErrContains != "" {
+				assert.ErrorContains(t, err, tt.wantErrContains)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, cov.NumStmt, tt.wantNumStmt)
+			assert.Equal(t, cov.PatchNumStmt, tt.wantPatchStmt)
+			assert.Equal(t, cov.PatchCoverCount, tt.wantPatchCover)
+			assert.Equal(t, cov.Coverage, tt.wantCoverage)
+		})
+	}
+}
+
+func TestComputer_ComputeFromFiles_changedFunctions(t *testing.T) {
+	dir := "./testdata/changed-funcs"
+	cov, err := New(Config{ChangedFunctions: true}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+	store := "github.com/srinidhis05/go-patch-cover/testdata/changed-funcs/store.go"
+	// Len is unchanged and not reported.
+	assert.DeepEqual(t, cov.Functions, []FunctionCoverage{
+		{FileName: store, Name: "Store.Get", Line: 7, PatchNumStmt: 1, PatchCoverCount: 1},
+		{FileName: store, Name: "Store.Delete", Line: 11, PatchNumStmt: 1, PatchCoverCount: 0},
+	})
+
+	cov, err = New(Config{}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+	assert.Assert(t, cov.Functions == nil)
+}
+
+func TestComputer_ComputeTotal(t *testing.T) {
+	dir := "./testdata/scenarios/new_file"
+	cov, err := New(Config{}).ComputeFromFiles(path.Join(dir, "coverage.out"), "", "")
+	assert.NilError(t, err)
+	assert.Assert(t, cov.TotalOnly)
+	assert.Equal(t, cov.NumStmt, 8)
+	assert.Equal(t, cov.PatchNumStmt, 0)
+	// Without a diff, there is no patch coverage rather than a full one.
+	assert.Equal(t, cov.PatchCoverage, 0.0)
+
+	var buf strings.Builder
+	assert.NilError(t, RenderTemplateOutput(cov, "", &buf))
+	assert.Assert(t, !strings.Contains(buf.String(), "patch coverage"), buf.String())
+}
+
+func TestComputer_ComputeFromReaders_goModModulePath(t *testing.T) {
+	// Both profile file names end with the changed foo.go.
+	profile := "mode: set\n" +
+		"example.com/m/foo.go:3.16,5.2 1 1\n" +
+		"example.com/m/sub/foo.go:3.16,5.2 1 0\n"
+	diff := `diff --git a/foo.go b/foo.go
+--- a/foo.go
++++ b/foo.go
+@@ -4 +4 @@ func Foo() int {
+-	return 0
++	return 1
+`
+	compute := func(dir string, diff string) CoverageData {
+		t.Helper()
+		wd, err := os.Getwd()
+		assert.NilError(t, err)
+		assert.NilError(t, os.Chdir(dir))
+		defer os.Chdir(wd)
+		cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+		assert.NilError(t, err)
+		return cov
+	}
+
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0o644))
+	cov := compute(dir, diff)
+	assert.Equal(t, cov.PatchNumStmt, 1)
+	assert.Equal(t, cov.PatchCoverCount, 1)
+
+	// The module may be in a subdirectory of the repository, and found
+	// from a directory of the module.
+	cov = compute(dir, strings.ReplaceAll(diff, "/foo.go", "/mod/foo.go"))
+	assert.Equal(t, cov.PatchNumStmt, 1)
+	assert.Equal(t, cov.PatchCoverCount, 1)
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	cov = compute(filepath.Join(dir, "sub"), diff)
+	assert.Equal(t, cov.PatchNumStmt, 1)
+
+	// Without go.mod, suffix matching counts both files.
+	cov = compute(t.TempDir(), diff)
+	assert.Equal(t, cov.PatchNumStmt, 2)
+	assert.Equal(t, cov.PatchCoverCount, 1)
+}
+
+func TestComputer_ComputeFromReaders_goModSameFileNames(t *testing.T) {
+	// util.go is a suffix of the changed internal/util.go.
+	profile := "mode: set\n" +
+		"example.com/m/util.go:3.16,5.2 1 0\n" +
+		"example.com/m/internal/util.go:3.16,5.2 1 1\n"
+	diff := `diff --git a/internal/util.go b/internal/util.go
+--- a/internal/util.go
++++ b/internal/util.go
+@@ -4 +4 @@ func Util() int {
+-	return 0
++	return 1
+`
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0o644))
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	for _, diff := range []string{diff, strings.ReplaceAll(diff, "/internal/", "/mod/internal/")} {
+		cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+		assert.NilError(t, err)
+		assert.Equal(t, cov.PatchNumStmt, 1)
+		assert.Equal(t, cov.PatchCoverCount, 1)
+		assert.Equal(t, cov.PatchCoverage, 100.0)
+	}
+}
+
+func TestComputer_ComputeFromFiles_patchOnly(t *testing.T) {
+	dir := "./testdata/scenarios/single_edit"
+	full, err := New(Config{}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), path.Join(dir, "coverage.out"))
+	assert.NilError(t, err)
+
+	cov, err := New(Config{PatchOnly: true, Packages: true}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), path.Join(dir, "coverage.out"))
+	assert.NilError(t, err)
+	assert.Assert(t, cov.PatchOnly)
+	assert.Equal(t, cov.PatchNumStmt, full.PatchNumStmt)
+	assert.Equal(t, cov.PatchCoverCount, full.PatchCoverCount)
+	assert.Equal(t, cov.PatchCoverage, full.PatchCoverage)
+	assert.Equal(t, cov.NumStmt, 0)
+	assert.Equal(t, cov.Coverage, 0.0)
+	assert.Assert(t, !cov.HasPrevCoverage)
+	assert.Assert(t, cov.Packages == nil)
+
+	var buf strings.Builder
+	assert.NilError(t, RenderTemplateOutput(cov, "", &buf))
+	assert.Assert(t, strings.HasPrefix(buf.String(), "patch coverage:"), buf.String())
+
+	_, err = New(Config{PatchOnly: true}).ComputeFromFiles(path.Join(dir, "coverage.out"), "", "")
+	assert.Error(t, err, "computing patch coverage only requires a diff")
+}
+
+func BenchmarkComputer_ComputeFromReaders_patchOnly(b *testing.B) {
+	profile := syntheticProfile(200, 500)
+	diff := `diff --git a/pkg0/file.go b/pkg0/file.go
+--- a/pkg0/file.go
++++ b/pkg0/file.go
+@@ -2 +2 @@
+-	a()
++	b()
+`
+	for _, patchOnly := range []bool{false, true} {
+		b.Run(fmt.Sprintf("patch only %t", patchOnly), func(b *testing.B) {
+			c := New(Config{PatchOnly: patchOnly})
+			for i := 0; i < b.N; i++ {
+				if _, err := c.ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), strings.NewReader(profile)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestComputer_ComputeFromReaders(t *testing.T) {
+	dir := "./testdata/scenarios/single_edit"
+	diff, err := os.ReadFile(path.Join(dir, "diff.diff"))
+	assert.NilError(t, err)
+	profile, err := os.ReadFile(path.Join(dir, "coverage.out"))
+	assert.NilError(t, err)
+
+	uncoveredOut := filepath.Join(t.TempDir(), "uncovered.txt")
+	c := New(Config{Precision: 1, UncoveredOut: uncoveredOut})
+
+	cov, err := c.ComputeFromReaders(strings.NewReader(string(profile)), strings.NewReader(string(diff)), strings.NewReader(string(profile)))
+	assert.NilError(t, err)
+	assert.Equal(t, cov.Coverage, 88.2)
+	assert.Equal(t, cov.PatchCoverage, 87.0)
+	assert.Equal(t, cov.PrevCoverage, 88.2)
+	assert.Assert(t, cov.HasPrevCoverage)
+
+	report, err := os.ReadFile(uncoveredOut)
+	assert.NilError(t, err)
+	assert.Equal(t, string(report), cov.Uncovered_lines)
+}
+
+func TestComputer_ComputeFromFiles_coveredOut(t *testing.T) {
+	dirs, err := os.ReadDir("./testdata/scenarios")
+	assert.NilError(t, err)
+	for _, d := range dirs {
+		t.Run(d.Name(), func(t *testing.T) {
+			dir := path.Join("./testdata/scenarios", d.Name())
+			coveredOut := filepath.Join(t.TempDir(), "covered.txt")
+			cov, err := New(Config{CoveredOut: coveredOut}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+			assert.NilError(t, err)
+
+			// The covered lines add up to the covered patch statements.
+			covered := 0
+			for _, l := range cov.CoveredLines {
+				covered += l.NumStmt
+			}
+			assert.Equal(t, covered, cov.PatchCoverCount)
+
+			report, err := os.ReadFile(coveredOut)
+			assert.NilError(t, err)
+			assert.Equal(t, string(report), coveredReport(cov.CoveredLines, false))
+		})
+	}
+}
+
+func TestComputer_ComputeFromReaders_coveredLines(t *testing.T) {
+	// Line 4 holds a covered and an uncovered block: it is reported both
+	// as covered and uncovered, with the statements of each.
+	const (
+		profile = "mode: set\nexample.com/m/pkg/x.go:3.14,4.12 2 1\nexample.com/m/pkg/x.go:4.12,6.2 1 0\n" +
+			"example.com/m/pkg/x.go:8.14,10.2 1 1\n"
+		diff = "diff --git a/pkg/x.go b/pkg/x.go\n--- a/pkg/x.go\n+++ b/pkg/x.go\n" +
+			"@@ -3,0 +4 @@\n+\tif x := f(); x > 0 { return x }\n@@ -8,0 +9 @@\n+\treturn 1\n"
+	)
+	coveredOut := filepath.Join(t.TempDir(), "covered.txt")
+	for _, redact := range []bool{false, true} {
+		cov, err := New(Config{CoveredOut: coveredOut, RedactSource: redact}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+		assert.NilError(t, err)
+		assert.Equal(t, cov.PatchCoverCount, 3)
+		assert.Equal(t, len(cov.UncoveredLines), 1)
+		assert.Equal(t, cov.UncoveredLines[0].LineNum, 4)
+
+		code := func(s string) string {
+			if redact {
+				return ""
+			}
+			return s
+		}
+		assert.DeepEqual(t, cov.CoveredLines, []CoveredLine{
+			{FileName: "example.com/m/pkg/x.go", LineNum: 4, LineString: code("\tif x := f(); x > 0 { return x }"), NumStmt: 2},
+			{FileName: "example.com/m/pkg/x.go", LineNum: 9, LineString: code("\treturn 1"), NumStmt: 1},
+		})
+
+		report, err := os.ReadFile(coveredOut)
+		assert.NilError(t, err)
+		want := "<pre>\nCovered lines in example.com/m/pkg/x.go:\n" +
+			"LineNum: 4\nLines:\n <code>\tif x := f(); x > 0 { return x }</code>\n" +
+			"LineNum: 9\nLines:\n <code>\treturn 1</code>\n" +
+			"\n-----------------------\n</pre>\n"
+		if redact {
+			want = "<pre>\nCovered lines in example.com/m/pkg/x.go:\nLineNum: 4\nLineNum: 9\n\n-----------------------\n</pre>\n"
+		}
+		assert.Equal(t, string(report), want)
+	}
+
+	cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+	assert.NilError(t, err)
+	assert.Assert(t, cov.CoveredLines == nil)
+}
+
+func TestComputer_ComputeWholeFiles(t *testing.T) {
+	cov, err := New(Config{}).ComputeWholeFiles("./testdata/test-project/coverage.out", []string{"testdata/test-project/func1.go"}, "")
+	assert.NilError(t, err)
+	// Every statement of the listed file counts as changed.
+	assert.Equal(t, cov.PatchNumStmt, cov.NumStmt)
+	assert.Equal(t, cov.PatchCoverCount, cov.CoverCount)
+	assert.Equal(t, cov.PatchNumStmt, 8)
+	assert.Equal(t, cov.PatchCoverCount, 6)
+}
+
+func TestComputer_DumpPaths(t *testing.T) {
+	dir := "./testdata/scenarios/new_file"
+
+	var buf strings.Builder
+	// The profile was generated for another module path than the one given.
+	err := New(Config{ModulePrefix: "github.com/srinidhis05/go-patch-cover"}).DumpPaths(&buf, path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"))
+	assert.NilError(t, err)
+	golden.Assert(t, buf.String(), "debug-paths.golden")
+
+	// Coverage files are rejected as when computing the coverage.
+	empty := filepath.Join(t.TempDir(), "empty.out")
+	assert.NilError(t, os.WriteFile(empty, nil, 0o644))
+	err = New(Config{}).DumpPaths(&buf, empty, path.Join(dir, "diff.diff"))
+	var parseErr *ParseError
+	assert.Assert(t, errors.As(err, &parseErr), "%v", err)
+	assert.Assert(t, errors.Is(err, ErrEmptyProfile))
+
+	malformed := filepath.Join(t.TempDir(), "malformed.out")
+	assert.NilError(t, os.WriteFile(malformed, []byte("mode: set\nnot a profile line\n"), 0o644))
+	err = New(Config{}).DumpPaths(&buf, malformed, path.Join(dir, "diff.diff"))
+	assert.Assert(t, errors.As(err, &parseErr), "%v", err)
+	assert.Equal(t, parseErr.Path, malformed)
+}
+
+func TestComputer_ComputeFromFiles_patchProfiles(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("./testdata/deprecated/coverage.out", "./testdata/deprecated/diff.diff", "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(cov.PatchProfiles), 1)
+
+	p := cov.PatchProfiles[0]
+	assert.Equal(t, p.FileName, "github.com/srinidhis05/go-patch-cover/testdata/deprecated/legacy.go")
+	assert.Equal(t, p.Mode, "set")
+	// The function header and loop blocks hold no added line.
+	assert.Equal(t, len(p.Blocks), 2)
+	assert.Equal(t, p.Blocks[0].StartLine, 6)
+	assert.Equal(t, p.Blocks[1].StartLine, 15)
+}
+
+func TestComputer_ComputeFromFiles_patchLines(t *testing.T) {
+	dir := "./testdata/scenarios/new_file"
+	cov, err := New(Config{}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+
+	uncovered := 0
+	for fileName, lines := range cov.PatchLines {
+		for _, l := range lines {
+			assert.Equal(t, l.Covered, l.CoverCount > 0, "%s:%d", fileName, l.LineNum)
+			assert.Assert(t, l.BlockStart <= l.LineNum && l.LineNum <= l.BlockEnd, "%s:%d", fileName, l.LineNum)
+			if !l.Covered {
+				uncovered++
+			}
+		}
+	}
+	assert.Equal(t, uncovered, len(cov.UncoveredLines))
+}
+
+func TestComputer_ComputeFromFiles_redactSource(t *testing.T) {
+	dir := "./testdata/scenarios/new_file"
+	cov, err := New(Config{RedactSource: true}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(cov.UncoveredLines), 1)
+	assert.Equal(t, cov.UncoveredLines[0].LineNum, 15)
+	assert.Equal(t, cov.UncoveredLines[0].LineString, "")
+	assert.Assert(t, strings.Contains(cov.Uncovered_lines, "LineNum: 15"))
+	assert.Assert(t, !strings.Contains(cov.Uncovered_lines, "<code>"))
+	for _, lines := range cov.PatchLines {
+		for _, l := range lines {
+			assert.Equal(t, l.LineString, "")
+		}
+	}
+	// Redaction does not change the numbers.
+	assert.Equal(t, cov.PatchCoverCount, 6)
+}
+
+func TestComputer_ComputeFromFiles_uncoveredContext(t *testing.T) {
+	dir := "./testdata/scenarios/new_file"
+	cov, err := New(Config{UncoveredContext: 1}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(cov.UncoveredLines), 1)
+	assert.DeepEqual(t, cov.UncoveredLines[0].Context, []SourceLine{
+		{LineNum: 14, LineString: "\tif bool2 {"},
+		{LineNum: 15, LineString: "\t\tfmt.Println(\"bool2\", bool2)"},
+		{LineNum: 16, LineString: ""},
+	})
+	assert.Assert(t, strings.Contains(cov.Uncovered_lines, "Context:\n 14: <code>\tif bool2 {</code>\n>15: <code>\t\tfmt.Println(\"bool2\", bool2)</code>\n 16: <code></code>\n"), cov.Uncovered_lines)
+
+	// Context is source, left out with RedactSource.
+	cov, err = New(Config{UncoveredContext: 1, RedactSource: true}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+	assert.Assert(t, cov.UncoveredLines[0].Context == nil)
+	assert.Assert(t, !strings.Contains(cov.Uncovered_lines, "Context:"))
+}
+
+func TestComputer_ComputeFromReaders_uncoveredHunks(t *testing.T) {
+	const (
+		profile = `mode: set
+example.com/m/a.go:3.14,5.2 1 1
+example.com/m/a.go:12.14,14.2 1 0
+`
+		diff = `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4 +4 @@ func A() int {
+-	return 0
++	return 1
+@@ -12,2 +12,3 @@ func B() int {
+ 	x := 0
++	x++
+ 	return x
+`
+	)
+	compute := func(cfg Config) CoverageData {
+		t.Helper()
+		cov, err := New(cfg).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+		assert.NilError(t, err)
+		assert.Equal(t, len(cov.UncoveredLines), 1)
+		assert.Equal(t, cov.UncoveredLines[0].LineNum, 13)
+		return cov
+	}
+
+	cov := compute(Config{UncoveredHunks: true})
+	assert.Equal(t, cov.UncoveredLines[0].Hunk, "@@ -12,2 +12,3 @@ func B() int {")
+	out, err := json.Marshal(cov.UncoveredLines)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(out), `"hunk":"@@ -12,2 +12,3 @@ func B() int {"`), string(out))
+
+	// The code following the header is source, left out with RedactSource.
+	cov = compute(Config{UncoveredHunks: true, RedactSource: true})
+	assert.Equal(t, cov.UncoveredLines[0].Hunk, "@@ -12,2 +12,3 @@")
+
+	cov = compute(Config{})
+	assert.Equal(t, cov.UncoveredLines[0].Hunk, "")
+}
+
+func TestComputer_ComputeFromReaders_uncoveredContextNotOnDisk(t *testing.T) {
+	profile := "mode: set\nexample.com/m/gone/gone.go:3.14,5.2 1 0\n"
+	diff := "diff --git a/gone/gone.go b/gone/gone.go\n--- /dev/null\n+++ b/gone/gone.go\n" +
+		"@@ -0,0 +1,5 @@\n+package gone\n+\n+func F() int {\n+\treturn 1\n+}\n"
+
+	cov, err := New(Config{UncoveredContext: 2}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(cov.UncoveredLines), 1)
+	assert.Assert(t, cov.UncoveredLines[0].Context == nil)
+	assert.Assert(t, !strings.Contains(cov.Uncovered_lines, "Context:"))
+}
+
+func TestComputer_ComputeFromReaders_emptyPrevCoverage(t *testing.T) {
+	dir := "./testdata/scenarios/new_file"
+	profile, err := os.ReadFile(path.Join(dir, "coverage.out"))
+	assert.NilError(t, err)
+	diff, err := os.ReadFile(path.Join(dir, "diff.diff"))
+	assert.NilError(t, err)
+
+	for _, prev := range []string{"", "mode: set\n"} {
+		cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(string(profile)), strings.NewReader(string(diff)), strings.NewReader(prev))
+		assert.NilError(t, err)
+		// The previous file was provided but holds no statement.
+		assert.Assert(t, !cov.HasPrevCoverage, "%q", prev)
+
+		var out bytes.Buffer
+		assert.NilError(t, RenderTemplateOutput(cov, "", &out))
+		assert.Assert(t, strings.HasPrefix(out.String(), "previous coverage: unknown\nnew coverage: 75.0%"), out.String())
+	}
+}
+
+func TestRenderTemplateOutput_noPrevCoverageText(t *testing.T) {
+	na, omitted := "previous coverage: N/A", ""
+	tests := map[string]struct {
+		text *string
+		want string
+	}{
+		"default": {want: "previous coverage: unknown\nnew coverage: 0.0%"},
+		"text":    {text: &na, want: "previous coverage: N/A\nnew coverage: 0.0%"},
+		"omitted": {text: &omitted, want: "new coverage: 0.0%"},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.NilError(t, RenderTemplateOutput(CoverageData{NoPrevCoverageText: tt.text}, "", &out))
+			assert.Assert(t, strings.HasPrefix(out.String(), tt.want), out.String())
+		})
+	}
+}
+
+func TestComputer_ComputeFromFiles_variants(t *testing.T) {
+	dir := "./testdata/scenarios/new_file"
+	c := New(Config{Variants: []string{"./testdata/variants/race.out"}})
+
+	cov, err := c.ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+	// The race variant covers the bool2 branch and adds a block of its own.
+	assert.Equal(t, cov.NumStmt, 9)
+	assert.Equal(t, cov.CoverCount, 9)
+	assert.Equal(t, cov.PatchNumStmt, 8)
+	assert.Equal(t, cov.PatchCoverCount, 8)
+
+	c = New(Config{Variants: []string{"./testdata/variants/missing.out"}})
+	_, err = c.ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.ErrorContains(t, err, "variant coverage file not found")
+}
+
+func TestComputer_ComputeFromFiles_suites(t *testing.T) {
+	dir := "./testdata/scenarios/new_file"
+	suite := path.Join(t.TempDir(), "coverage-int.out")
+	assert.NilError(t, os.WriteFile(suite, []byte(`mode: count
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:5.36,8.11 2 1
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:8.11,12.3 2 0
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:14.2,14.11 1 1
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:14.11,18.3 2 3
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:20.2,20.26 1 1
+`), 0o644))
+	c := New(Config{Suites: []string{suite}})
+
+	cov, err := c.ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+	// The integration suite covers the bool2 branch.
+	assert.Equal(t, cov.Mode, "count")
+	assert.Equal(t, cov.NumStmt, 8)
+	assert.Equal(t, cov.CoverCount, 8)
+	assert.Equal(t, cov.PatchCoverCount, 8)
+
+	c = New(Config{Suites: []string{"./testdata/variants/race.out"}})
+	_, err = c.ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.ErrorContains(t, err, "block boundaries of github.com/seriousben/go-patch-cover/testdata/test-project/func1.go disagree")
+}
+
+func TestComputer_ComputeFromFiles_inputsUntouched(t *testing.T) {
+	dir := t.TempDir()
+	inputs := make(map[string][]byte)
+	for _, name := range []string{"coverage.out", "diff.diff"} {
+		content, err := os.ReadFile(path.Join("./testdata/scenarios/new_file", name))
+		assert.NilError(t, err)
+		assert.NilError(t, os.WriteFile(path.Join(dir, name), content, 0o644))
+		inputs[name] = content
+	}
+
+	// Excludes and includes filter the parsed profiles, never the files.
+	c := New(Config{Excludes: []string{"*/func1.go"}, Includes: []string{"testdata/*"}})
+	cov, err := c.ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), path.Join(dir, "coverage.out"))
+	assert.NilError(t, err)
+	assert.Equal(t, cov.NumStmt, 0)
+
+	for name, want := range inputs {
+		content, err := os.ReadFile(path.Join(dir, name))
+		assert.NilError(t, err)
+		assert.Equal(t, string(content), string(want), name)
+	}
+}
+
+func TestComputer_ComputeFromFiles_extensions(t *testing.T) {
+	// The diff touches README.md and func1.go.
+	cov, err := New(Config{Extensions: []string{".md"}}).ComputeFromFiles("testdata/test-project/coverage.out", "testdata/vcs/hg.diff", "")
+	assert.NilError(t, err)
+	assert.Equal(t, cov.PatchNumStmt, 0)
+	assert.Equal(t, cov.NumStmt, 8)
+}
+
+func TestComputer_ComputeFromReaders_profileMode(t *testing.T) {
+	const profile = `mode: count
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:5.36,8.11 2 7
+`
+	diff, err := os.ReadFile("./testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, err)
+
+	compute := func(mode string) (CoverageData, error) {
+		return New(Config{ProfileMode: mode}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(string(diff)), nil)
+	}
+
+	cov, err := compute("")
+	assert.NilError(t, err)
+	assert.Equal(t, cov.PatchProfiles[0].Mode, "count")
+	assert.Equal(t, cov.PatchProfiles[0].Blocks[0].Count, 7)
+
+	// The header says count, but the profile is known to be in set mode.
+	cov, err = compute("set")
+	assert.NilError(t, err)
+	assert.Equal(t, cov.PatchProfiles[0].Mode, "set")
+	assert.Equal(t, cov.PatchProfiles[0].Blocks[0].Count, 1)
+	assert.Equal(t, cov.PatchLines["github.com/seriousben/go-patch-cover/testdata/test-project/func1.go"][0].CoverCount, 1)
+
+	_, err = compute("bogus")
+	assert.ErrorContains(t, err, `invalid profile mode "bogus"`)
+}
+
+func TestComputer_ComputeFromReaders_overlappingBlocks(t *testing.T) {
+	const (
+		outer = "github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:5.36,12.3 3 0\n"
+		inner = "github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:8.11,12.3 2 1\n"
+	)
+	diff, err := os.ReadFile("./testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, err)
+
+	for _, profile := range []string{"mode: count\n" + outer + inner, "mode: count\n" + inner + outer} {
+		cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(string(diff)), nil)
+		assert.NilError(t, err)
+		// Only the innermost block over the added lines 8 to 12 counts.
+		assert.Equal(t, cov.NumStmt, 2)
+		assert.Equal(t, cov.PatchNumStmt, 2)
+		assert.Equal(t, cov.PatchCoverCount, 2)
+		assert.Equal(t, len(cov.UncoveredLines), 0)
+	}
+}
+
+func TestComputer_ComputeFromReaders_blockOverlap(t *testing.T) {
+	profile, err := os.ReadFile("./testdata/scenarios/new_file/coverage.out")
+	assert.NilError(t, err)
+	diffAdding := func(line int, content string) string {
+		return "diff --git a/testdata/test-project/func1.go b/testdata/test-project/func1.go\n" +
+			"--- a/testdata/test-project/func1.go\n" +
+			"+++ b/testdata/test-project/func1.go\n" +
+			fmt.Sprintf("@@ -%d,0 +%d @@\n", line-1, line) +
+			"+" + content + "\n"
+	}
+
+	tests := map[string]struct {
+		diff          string
+		wantPatchStmt int
+	}{
+		// The bool1 block, 8.11,12.3, starts before the added line, which
+		// only closes it.
+		"closing brace only": {diff: diffAdding(12, "\t}"), wantPatchStmt: 0},
+		// Adding the line of the if statement counts the block ending on
+		// it, 5.36,8.11, not the one it opens.
+		"opening line": {diff: diffAdding(8, "\tif bool1 {"), wantPatchStmt: 2},
+		"blank line":   {diff: diffAdding(10, ""), wantPatchStmt: 0},
+		// Blocks entirely within unchanged lines never count.
+		"statement within block": {diff: diffAdding(11, "\t\tfmt.Println(\"end bool1\", bool2)"), wantPatchStmt: 2},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(string(profile)), strings.NewReader(tt.diff), nil)
+			assert.NilError(t, err)
+			assert.Equal(t, cov.PatchNumStmt, tt.wantPatchStmt)
+		})
+	}
+}
+
+func TestComputer_ComputeFromReaders_invalidLinesOfBlock(t *testing.T) {
+	// The uncovered block of F, 3.14,10.2, spans comment and blank lines,
+	// and several code lines the report treats as invalid.
+	profile := "mode: set\n" +
+		"example.com/m/pkg/a.go:3.14,10.2 2 0\n" +
+		"example.com/m/pkg/a.go:11.14,13.2 1 1\n"
+	diff := "diff --git a/pkg/a.go b/pkg/a.go\n--- /dev/null\n+++ b/pkg/a.go\n@@ -0,0 +1,13 @@\n" +
+		"+package pkg\n" +
+		"+\n" +
+		"+func F() int {\n" +
+		"+\t// doc\n" +
+		"+\n" +
+		"+\tx := 1 /* one */\n" +
+		"+\t/* block\n" +
+		"+\tcomment */\n" +
+		"+\treturn x // `json:\"x\"`\n" +
+		"+}\n" +
+		"+func G() int {\n" +
+		"+\treturn 1\n" +
+		"+}\n"
+
+	cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+	assert.NilError(t, err)
+	// The statements of F are subtracted once, for the block, not once per
+	// invalid line.
+	assert.Equal(t, cov.PatchNumStmt, 1)
+	assert.Equal(t, cov.PatchCoverCount, 1)
+	assert.Equal(t, cov.PatchCoverage, 100.0)
+	assert.Equal(t, len(cov.UncoveredLines), 0)
+}
+
+func TestComputer_ComputeFromReaders_deadline(t *testing.T) {
+	// A synthetic patch adding a covered function to each of many files.
+	const numFiles = 1000
+	var profile, diff strings.Builder
+	profile.WriteString("mode: set\n")
+	for i := 0; i < numFiles; i++ {
+		name := fmt.Sprintf("pkg/file%d.go", i)
+		fmt.Fprintf(&profile, "example.com/m/%s:3.14,5.2 1 1\n", name)
+		fmt.Fprintf(&diff, "diff --git a/%s b/%s\n--- /dev/null\n+++ b/%s\n", name, name, name)
+		diff.WriteString("@@ -0,0 +1,5 @@\n+package pkg\n+\n+func F() int {\n+\treturn 1\n+}\n")
+	}
+
+	// Every reading of the clock advances it by a millisecond.
+	clock := time.Unix(0, 0)
+	now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	t.Cleanup(func() { now = time.Now })
+
+	tests := map[string]struct {
+		deadline       time.Duration
+		wantIncomplete bool
+		wantPatchStmt  int
+	}{
+		"no deadline":  {wantPatchStmt: numFiles},
+		"deadline met": {deadline: time.Hour, wantPatchStmt: numFiles},
+		// The clock is read for the deadline, then before each profile:
+		// 100 profiles fit in 100 milliseconds.
+		"deadline exceeded": {deadline: 100 * time.Millisecond, wantIncomplete: true, wantPatchStmt: 100},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			cov, err := New(Config{Deadline: tt.deadline}).ComputeFromReaders(strings.NewReader(profile.String()), strings.NewReader(diff.String()), nil)
+			assert.NilError(t, err)
+			assert.Equal(t, cov.Incomplete, tt.wantIncomplete)
+			assert.Equal(t, cov.PatchNumStmt, tt.wantPatchStmt)
+			// The total coverage does not depend on the deadline.
+			assert.Equal(t, cov.NumStmt, numFiles)
+
+			var out bytes.Buffer
+			assert.NilError(t, RenderTemplateOutput(cov, "", &out))
+			assert.Equal(t, strings.Contains(out.String(), "incomplete: deadline exceeded"), tt.wantIncomplete)
+		})
+	}
+}
+
+func TestComputer_ComputeFromReaders_minHits(t *testing.T) {
+	const profile = `mode: count
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:5.36,8.11 2 3
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:14.2,14.11 1 1
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:20.2,20.26 1 2
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:8.11,12.3 2 1
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:14.11,18.3 2 0
+`
+	diff, err := os.ReadFile("./testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, err)
+
+	tests := map[string]struct {
+		cfg            Config
+		wantCoverCount int
+		wantPatchCover int
+	}{
+		"any hit":          {cfg: Config{}, wantCoverCount: 6, wantPatchCover: 6},
+		"two hits patch":   {cfg: Config{PatchMinHits: 2}, wantCoverCount: 6, wantPatchCover: 3},
+		"three hits total": {cfg: Config{TotalMinHits: 3}, wantCoverCount: 2, wantPatchCover: 6},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			cov, err := New(tt.cfg).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(string(diff)), strings.NewReader(profile))
+			assert.NilError(t, err)
+			assert.Equal(t, cov.NumStmt, 8)
+			assert.Equal(t, cov.CoverCount, tt.wantCoverCount)
+			assert.Equal(t, cov.PrevCoverCount, tt.wantCoverCount)
+			assert.Equal(t, cov.PatchNumStmt, 8)
+			assert.Equal(t, cov.PatchCoverCount, tt.wantPatchCover)
+			for _, l := range cov.PatchLines["github.com/seriousben/go-patch-cover/testdata/test-project/func1.go"] {
+				assert.Equal(t, l.Covered, l.CoverCount >= minHits(tt.cfg.PatchMinHits), "line %d", l.LineNum)
+			}
+		})
+	}
+}
+
+func TestComputer_ComputeFromReaders_partial(t *testing.T) {
+	const profile = `mode: count
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:5.36,8.11 2 3
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:14.2,14.11 1 1
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:20.2,20.26 1 2
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:8.11,12.3 2 1
+github.com/seriousben/go-patch-cover/testdata/test-project/func1.go:14.11,18.3 2 0
+`
+	diff, err := os.ReadFile("./testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, err)
+
+	compute := func(mode string) CoverageData {
+		cov, err := New(Config{PatchMinHits: 2, ProfileMode: mode}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(string(diff)), nil)
+		assert.NilError(t, err)
+		return cov
+	}
+
+	cov := compute("")
+	assert.Equal(t, cov.Mode, "count")
+	var partial []int
+	for _, l := range cov.UncoveredLines {
+		if l.Partial {
+			partial = append(partial, l.LineNum)
+		}
+	}
+	assert.DeepEqual(t, partial, []int{9, 14})
+
+	b, err := json.Marshal(cov)
+	assert.NilError(t, err)
+	var got CoverageData
+	assert.NilError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, got.Mode, "count")
+	assert.Equal(t, got.UncoveredLines[0].Partial, true)
+
+	// Set mode records no hit count: no uncovered line is partial.
+	cov = compute("set")
+	assert.Equal(t, cov.Mode, "set")
+	assert.Assert(t, len(cov.UncoveredLines) > 0)
+	for _, l := range cov.UncoveredLines {
+		assert.Assert(t, !l.Partial, "line %d", l.LineNum)
+	}
+}
+
+func TestComputer_ComputeFromReaders_stale(t *testing.T) {
+	diff := "diff --git a/pkg/x.go b/pkg/x.go\n--- a/pkg/x.go\n+++ b/pkg/x.go\n" +
+		"@@ -8,0 +9,9 @@\n+\n+func G() int {\n+\tg := 1\n+\treturn g\n+}\n+\n+func H() int {\n+\treturn 2\n+}\n"
+	tests := map[string]struct {
+		profile       string
+		cfg           Config
+		wantUnmatched int
+		wantStale     bool
+		wantErr       string
+	}{
+		"same revision": {
+			profile:       "mode: set\nexample.com/m/pkg/x.go:10.14,13.2 2 1\nexample.com/m/pkg/x.go:15.14,17.2 1 0\n",
+			wantUnmatched: 0,
+		},
+		"other revision": {
+			// Profiled before G and H were added: no block spans them and
+			// the patch coverage would be a vacuous 100%.
+			profile:       "mode: set\nexample.com/m/pkg/x.go:3.14,5.2 1 1\n",
+			wantUnmatched: 5,
+			wantStale:     true,
+		},
+		"below threshold": {
+			profile:       "mode: set\nexample.com/m/pkg/x.go:10.14,13.2 2 1\n",
+			wantUnmatched: 2,
+		},
+		"lower threshold": {
+			profile:       "mode: set\nexample.com/m/pkg/x.go:10.14,13.2 2 1\n",
+			cfg:           Config{StaleThreshold: 0.2},
+			wantUnmatched: 2,
+			wantStale:     true,
+		},
+		"strict": {
+			profile: "mode: set\nexample.com/m/pkg/x.go:3.14,5.2 1 1\n",
+			cfg:     Config{Strict: true},
+			wantErr: "5 of the 5 added code lines of the files matching a coverage profile are in none of its blocks",
+		},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			cov, err := New(tt.cfg).ComputeFromReaders(strings.NewReader(tt.profile), strings.NewReader(diff), nil)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, cov.PatchUnmatchedLines, tt.wantUnmatched)
+			assert.Equal(t, cov.Stale, tt.wantStale)
+		})
+	}
+}
+
+func TestComputer_ComputeFromReaders_emptyPatchCoverage(t *testing.T) {
+	profile := "mode: set\n" +
+		"example.com/m/foo.go:3.16,6.2 2 1\n"
+	// The patch only adds a comment.
+	diff := `diff --git a/foo.go b/foo.go
+--- a/foo.go
++++ b/foo.go
+@@ -1,0 +2 @@
++// Foo returns a number.
+`
+	compute := func(mode string) (CoverageData, string) {
+		t.Helper()
+		cov, err := New(Config{EmptyPatchCoverage: mode}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+		assert.NilError(t, err)
+		assert.Equal(t, cov.PatchNumStmt, 0)
+		assert.Assert(t, !cov.PatchHasStatements)
+
+		var buf bytes.Buffer
+		assert.NilError(t, RenderTemplateOutput(cov, "", &buf))
+		return cov, buf.String()
+	}
+
+	for _, mode := range []string{"", "100"} {
+		cov, out := compute(mode)
+		assert.Equal(t, cov.PatchCoverage, 100.0)
+		assert.Assert(t, !cov.NoTestableChanges)
+		assert.Assert(t, strings.Contains(out, "patch coverage: 100.0% of changed statements (0/0)"), out)
+	}
+
+	cov, out := compute("0")
+	assert.Equal(t, cov.PatchCoverage, 0.0)
+	assert.Assert(t, !cov.NoTestableChanges)
+	assert.Assert(t, strings.Contains(out, "patch coverage: 0.0% of changed statements (0/0)"), out)
+
+	cov, out = compute("none")
+	assert.Equal(t, cov.PatchCoverage, 0.0)
+	assert.Assert(t, cov.NoTestableChanges)
+	assert.Assert(t, strings.Contains(out, "patch coverage: no testable changes\n"), out)
+
+	js, err := json.Marshal(cov)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(js), `"patch_has_statements":false`), string(js))
+
+	_, err = New(Config{EmptyPatchCoverage: "50"}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+	assert.Error(t, err, `invalid empty patch coverage "50": must be 100, 0 or none`)
+}
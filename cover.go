@@ -5,7 +5,11 @@ import (
 	"html/template"
 	"io"
 	"os"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bluekeyes/go-gitdiff/gitdiff"
 	"golang.org/x/tools/cover"
@@ -16,43 +20,61 @@ type Line struct {
 	LineNum    int
 	NumStmt    int
 	CoverCount int
+	// Covered reports whether the line counts as covered in the patch
+	// coverage: CoverCount reaches Config.PatchMinHits and the line is not
+	// reported as uncovered by another block.
+	Covered bool
+	// BlockStart and BlockEnd are the first and last lines of the profile
+	// block the line is counted in.
+	BlockStart int
+	BlockEnd   int
 	LineString string
 }
 
-func ProcessFiles(coverageFile, diffFile, prevCovFile string) (CoverageData, error) {
-	patch, err := os.Open(diffFile)
-	if err != nil {
-		return CoverageData{}, err
-	}
+// now returns the current time; tests replace it to control deadlines.
+var now = time.Now
 
-	files, _, err := gitdiff.Parse(patch)
-	if err != nil {
-		return CoverageData{}, err
-	}
-
-	profiles, err := cover.ParseProfiles(coverageFile)
-	if err != nil {
-		return CoverageData{}, err
-	}
+// defaultStaleThreshold is the Config.StaleThreshold used when unset.
+const defaultStaleThreshold = 0.5
 
-	var prevProfiles []*cover.Profile
-	if prevCovFile != "" {
-		prevProfiles, err = cover.ParseProfiles(prevCovFile)
-		if err != nil {
-			return CoverageData{}, err
-		}
-	}
+// ProcessFiles computes the coverage of the coverage, diff and previous
+// coverage files with the default Config, writing the uncovered lines
+// report to uncovered_lines.txt. prevCovFile is empty when there is no
+// previous coverage. go-patch-cover computes its coverage with this
+// package too.
+func ProcessFiles(coverageFile, diffFile, prevCovFile string) (CoverageData, error) {
+	return New(Config{UncoveredOut: "uncovered_lines.txt"}).ComputeFromFiles(coverageFile, diffFile, prevCovFile)
+}
 
-	d, err := computeCoverage(files, profiles, prevProfiles)
+// ComputeCoverage computes the coverage of parsed diff files and coverage
+// profiles with the default Config, without writing any file, and returns
+// the uncovered added lines along with it, for callers rendering their
+// own report, e.g. inline pull request annotations. prevProfiles is empty
+// when there is no previous coverage. It is the computation ProcessFiles
+// runs once the files are parsed.
+func ComputeCoverage(diffFiles []*gitdiff.File, profiles, prevProfiles []*cover.Profile) (CoverageData, []UncoveredLine, error) {
+	d, err := New(Config{}).ComputeFromProfiles(diffFiles, profiles, prevProfiles)
 	if err != nil {
-		return CoverageData{}, err
+		return CoverageData{}, nil, err
 	}
-
-	d.HasPrevCoverage = prevCovFile != ""
-	return d, nil
+	return d, d.UncoveredLines, nil
 }
 
+// ReportSchemaVersion is the version of the JSON form of CoverageData. It
+// is bumped whenever its fields change, so consumers can detect changes.
+const ReportSchemaVersion = 21
+
 type CoverageData struct {
+	ReportSchemaVersion int `json:"report_schema_version"`
+	// ToolVersion is the version of the tool producing the report, set by
+	// the caller.
+	ToolVersion string `json:"tool_version,omitempty"`
+
+	// NoPrevCoverageText, set by the caller, replaces the "previous
+	// coverage: unknown" line of the default template when HasPrevCoverage
+	// is false. An empty text omits the line.
+	NoPrevCoverageText *string `json:"-"`
+
 	NumStmt         int     `json:"num_stmt"`
 	CoverCount      int     `json:"cover_count"`
 	Coverage        float64 `json:"coverage"`
@@ -64,19 +86,210 @@ type CoverageData struct {
 	PrevCoverCount  int     `json:"prev_cover_count"`
 	PrevCoverage    float64 `json:"prev_coverage"`
 	Uncovered_lines string  `json:"uncovered_lines"`
+
+	// PatchAddedLines and PatchDeletedLines are the number of lines added
+	// and deleted by the changed files considered, deleted files included,
+	// whether or not they hold statements: a patch only removing code adds
+	// no statement, and has a PatchCoverage of 100.
+	PatchAddedLines   int `json:"patch_added_lines"`
+	PatchDeletedLines int `json:"patch_deleted_lines"`
+
+	// PatchUnmatchedLines is the number of added lines holding code, of
+	// the files matching a profile, that fall in none of its blocks. A
+	// profile generated from the same revision as the diff leaves only
+	// package-level declarations out of its blocks; Stale reports that
+	// more than Config.StaleThreshold of the added code lines are
+	// unmatched, as when the profile and diff are of different commits.
+	PatchUnmatchedLines int  `json:"patch_unmatched_lines"`
+	Stale               bool `json:"stale,omitempty"`
+
+	// PatchHasStatements reports whether the patch adds statements. When it
+	// does not, PatchCoverage is that of Config.EmptyPatchCoverage, and
+	// NoTestableChanges is set when it is none, for the default template
+	// to print "no testable changes" instead of a patch coverage.
+	PatchHasStatements bool `json:"patch_has_statements"`
+	NoTestableChanges  bool `json:"-"`
+
+	UncoveredLines []UncoveredLine `json:"uncovered,omitempty"`
+
+	// CoveredLines holds the added lines counted in PatchCoverCount, when
+	// Config.CoveredOut is set, the statements of the covered blocks they
+	// were counted in summing up to it. A line counted both in covered and
+	// uncovered blocks is also among UncoveredLines.
+	CoveredLines []CoveredLine `json:"covered,omitempty"`
+
+	// UncoveredRanges holds the runs of contiguous uncovered lines of each
+	// file, when Config.GroupUncoveredRanges is set.
+	UncoveredRanges []UncoveredRange `json:"uncovered_ranges,omitempty"`
+
+	// Incomplete reports that Config.Deadline was exceeded: the patch
+	// coverage only accounts for the profiles matched until then.
+	Incomplete bool `json:"incomplete,omitempty"`
+
+	// TotalOnly reports coverage computed without a patch, e.g. by
+	// Computer.ComputeTotal; the patch fields are then zero.
+	TotalOnly bool `json:"total_only,omitempty"`
+
+	// PatchOnly reports coverage computed with Config.PatchOnly; the total
+	// and previous coverage fields are then zero.
+	PatchOnly bool `json:"patch_only,omitempty"`
+
+	// Mode is the cover mode of the coverage profile, "set", "count" or
+	// "atomic", as read from its header or set by Config.ProfileMode; ""
+	// for a profile without blocks.
+	Mode string `json:"mode,omitempty"`
+
+	// Regressions holds the lines covered in the previous coverage and not
+	// anymore, when Config.Regressions is set.
+	Regressions []Regression `json:"regressions,omitempty"`
+
+	// Packages holds the coverage of every package, when Config.Packages is
+	// set.
+	Packages []PackageCoverage `json:"packages,omitempty"`
+
+	// Files holds the coverage of every changed file matching a profile,
+	// when Config.Files is set.
+	Files []FileCoverage `json:"files,omitempty"`
+
+	// ByOwner holds the patch coverage of the changed files of every code
+	// owner, when Config.CodeOwners is set.
+	ByOwner []OwnerCoverage `json:"by_owner,omitempty"`
+
+	// Sources holds the coverage of every CoverageSource, when computed
+	// by Computer.ComputeSources.
+	Sources []SourceCoverage `json:"sources,omitempty"`
+
+	// Functions holds the patch coverage of every function holding changed
+	// statements, by file and line, when Config.ChangedFunctions is set.
+	Functions []FunctionCoverage `json:"functions,omitempty"`
+
+	// PatchLines holds, per profile file name, the added lines counted in
+	// the patch coverage, sorted by line number.
+	PatchLines map[string][]Line `json:"-"`
+
+	// Profiles holds the coverage profiles, as filtered by Config, in
+	// profile order.
+	Profiles []*cover.Profile `json:"-"`
+
+	// PatchProfiles holds the profiles restricted to the blocks overlapping
+	// added lines, in profile order.
+	PatchProfiles []*cover.Profile `json:"-"`
+
+	// DiffFiles holds the diff files considered for the patch coverage, and
+	// DiffProfiles the name of the profile each of them matched.
+	DiffFiles    []*gitdiff.File   `json:"-"`
+	DiffProfiles map[string]string `json:"-"`
+}
+
+// FunctionCoverage is the patch coverage of a function declared in a
+// changed file.
+type FunctionCoverage struct {
+	FileName        string `json:"file"`
+	Name            string `json:"name"`
+	Line            int    `json:"line"`
+	PatchNumStmt    int    `json:"patch_num_stmt"`
+	PatchCoverCount int    `json:"patch_cover_count"`
+}
+
+// UncoveredLine is an added line whose statements are not covered.
+type UncoveredLine struct {
+	FileName   string `json:"file"`
+	LineNum    int    `json:"line"`
+	LineString string `json:"code"`
+	NumStmt    int    `json:"num_stmt"`
+	// Partial reports a line whose block was hit, but fewer times than
+	// Config.PatchMinHits requires. Only count and atomic modes record hit
+	// counts: in set mode, an uncovered line is never partial.
+	Partial bool `json:"partial,omitempty"`
+	// Context holds the source lines around the line, itself included,
+	// when Config.UncoveredContext is set and the file is on disk.
+	Context []SourceLine `json:"context,omitempty"`
+	// Hunk is the header of the diff hunk holding the line, when
+	// Config.UncoveredHunks is set.
+	Hunk string `json:"hunk,omitempty"`
+	// Blame identifies the commit that introduced the line, set by the
+	// caller, e.g. from git blame.
+	Blame *Blame `json:"blame,omitempty"`
+}
+
+// CoveredLine is an added line counted in the patch coverage as covered.
+// NumStmt is the number of statements of its covered blocks.
+type CoveredLine struct {
+	FileName   string `json:"file"`
+	LineNum    int    `json:"line"`
+	LineString string `json:"code"`
+	NumStmt    int    `json:"num_stmt"`
+}
+
+// Blame is the commit and author that introduced a line.
+type Blame struct {
+	Commit     string `json:"commit,omitempty"`
+	Author     string `json:"author,omitempty"`
+	AuthorMail string `json:"author_mail,omitempty"`
+	// Uncommitted reports a line not committed yet, in which case the
+	// other fields are empty.
+	Uncommitted bool `json:"uncommitted,omitempty"`
+}
+
+// SourceLine is a line of a source file read from disk.
+type SourceLine struct {
+	LineNum    int    `json:"line"`
+	LineString string `json:"code"`
+}
+
+// UncoveredRange is a run of uncovered added lines with contiguous line
+// numbers. A line on its own is a range starting and ending on it.
+type UncoveredRange struct {
+	FileName  string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
 }
 
 func RenderTemplateOutput(data CoverageData, tmplOverride string, out io.Writer) error {
 	const defaultTmpl = `
-{{- if .HasPrevCoverage -}}
+{{- if not .PatchOnly -}}
+{{ if .HasPrevCoverage -}}
 	previous coverage: {{printf "%.1f" .PrevCoverage}}% of statements
 {{ else -}}
-	previous coverage: unknown
+	{{ with .NoPrevCoverageLine }}{{ . }}
+{{ end -}}
 {{ end -}}
 new coverage: {{printf "%.1f" .Coverage}}% of statements
+{{ end -}}
+{{ if .NoTestableChanges -}}
+patch coverage: no testable changes
+{{ else if not .TotalOnly -}}
 patch coverage: {{printf "%.1f" .PatchCoverage}}% of changed statements ({{ .PatchCoverCount }}/{{ .PatchNumStmt }})
+{{ end -}}
+{{ range .ByOwner -}}
+owner {{ or .Owner "(none)" }}: {{printf "%.1f" .PatchCoverage}}% of changed statements ({{ .PatchCoverCount }}/{{ .PatchNumStmt }})
+{{ end -}}
+{{ range .Packages -}}
+package {{ .Package }}: {{ if $.HasPrevCoverage }}{{ if .New }}new{{ else }}{{ printf "%.1f" .PrevCoverage }}%{{ end }} -> {{ end }}{{ if .Removed }}removed{{ else }}{{ printf "%.1f" .Coverage }}%{{ end }}
+{{ end -}}
+{{ if .Incomplete -}}
+incomplete: deadline exceeded, patch coverage only covers part of the changed files
+{{ end -}}
+{{ if not .TotalOnly -}}
 uncovered lines : {{printf .Uncovered_lines }}
+{{ end -}}
 `
+	return renderTemplate(defaultTmpl, tmplOverride, data, out)
+}
+
+// NoPrevCoverageLine returns the line the default template prints when
+// HasPrevCoverage is false: NoPrevCoverageText when set, or "previous
+// coverage: unknown".
+func (d CoverageData) NoPrevCoverageLine() string {
+	if d.NoPrevCoverageText != nil {
+		return *d.NoPrevCoverageText
+	}
+	return "previous coverage: unknown"
+}
+
+// renderTemplate executes tmplOverride, or defaultTmpl when it is empty,
+// with data.
+func renderTemplate(defaultTmpl, tmplOverride string, data CoverageData, out io.Writer) error {
 	tmpl := defaultTmpl
 	if tmplOverride != "" {
 		tmpl = tmplOverride
@@ -85,123 +298,357 @@ uncovered lines : {{printf .Uncovered_lines }}
 	if err != nil {
 		return err
 	}
-	return t.ExecuteTemplate(out, "cover_template", data)
+	// Overrides may declare their entry point with {{define "main"}}, in which
+	// case it is executed instead of the top-level template.
+	if main := t.Lookup("main"); main != nil {
+		return main.Execute(out, data)
+	}
+	return t.Execute(out, data)
 }
 
-func computeCoverage(diffFiles []*gitdiff.File, coverProfiles []*cover.Profile, prevCoverProfiles []*cover.Profile) (CoverageData, error) {
-	var data CoverageData
+func computeCoverage(diffFiles []*gitdiff.File, coverProfiles []*cover.Profile, prevCoverProfiles []*cover.Profile, cfg Config) (CoverageData, error) {
+	switch cfg.EmptyPatchCoverage {
+	case "", "100", "0", "none":
+	default:
+		return CoverageData{}, fmt.Errorf("invalid empty patch coverage %q: must be 100, 0 or none", cfg.EmptyPatchCoverage)
+	}
+
+	data := CoverageData{ReportSchemaVersion: ReportSchemaVersion}
+	if len(coverProfiles) > 0 {
+		data.Mode = coverProfiles[0].Mode
+	}
+	var deadline time.Time
+	if cfg.Deadline > 0 {
+		deadline = now().Add(cfg.Deadline)
+	}
 	coveredLines := make(map[string][]Line)
-	partiallyCoveredLines := make(map[string][]Line)
+	uncoveredBlockLines := make(map[string][]Line)
 
-	// patch coverage
-	for _, p := range coverProfiles {
+	removed := filterDiffFiles(deletedFiles(diffFiles), cfg)
+	diffFiles = filterDiffFiles(diffFiles, cfg)
+	var generated []*gitdiff.File
+	if cfg.SkipGenerated {
+		diffFiles, generated = generatedFiles(diffFiles)
+		removed, _ = generatedFiles(removed)
+	}
+	for _, f := range append(removed, diffFiles...) {
+		added, deleted := lineChurn(f)
+		data.PatchAddedLines += added
+		data.PatchDeletedLines += deleted
+	}
+	totalMinHits, patchMinHits := minHits(cfg.TotalMinHits), minHits(cfg.PatchMinHits)
+
+	skippedLines := make(map[string]map[int]bool)
+	funcs := make(map[string][]funcComplexity)
+	if cfg.SkipEmbeddedData || cfg.SkipDeprecated || cfg.FunctionBodiesOnly || cfg.WeightByComplexity || cfg.ChangedFunctions {
 		for _, f := range diffFiles {
-			// Using suffix since profiles are prepended with the go module.
-			if !strings.HasSuffix(p.FileName, f.NewName) {
-				//fmt.Printf("%s != %s\n", p.FileName, f.NewName)
+			src, err := os.ReadFile(f.NewName)
+			if err != nil {
+				// Deleted or not checked out; nothing to scan.
 				continue
 			}
+			skipped := make(map[int]bool)
+			if cfg.SkipEmbeddedData {
+				for line := range embeddedDataLines(src) {
+					skipped[line] = true
+				}
+			}
+			if cfg.SkipDeprecated {
+				for line := range deprecatedLines(src) {
+					skipped[line] = true
+				}
+			}
+			if cfg.FunctionBodiesOnly {
+				for line := range outsideFunctionLines(src) {
+					skipped[line] = true
+				}
+			}
+			skippedLines[f.NewName] = skipped
+			if cfg.WeightByComplexity || cfg.ChangedFunctions {
+				funcs[f.NewName] = functionComplexities(src)
+			}
+		}
+	}
 
-		blockloop:
-			for _, b := range p.Blocks {
-				//fmt.Printf("BLOCK %s:%d %d %d %d\n", p.FileName, b.StartLine, b.EndLine, b.NumStmt, b.Count)
-				for _, t := range f.TextFragments {
-					for i, line := range t.Lines {
-						if line.Op != gitdiff.OpAdd {
-							continue
-						}
-						lineNum := int(t.NewPosition) + i
-						lineString := strings.ReplaceAll(line.Line, "\n", "")
-						//fmt.Printf("DIFF %s:%d %s\n", f.NewName, lineNum, lineString)
-
-						if b.StartLine <= lineNum && lineNum <= b.EndLine {
-							data.PatchNumStmt += b.NumStmt
-							//	fmt.Printf("COVER %s:%d %d %d - %s\n", p.FileName, lineNum, b.NumStmt, b.Count, lineString)
-							if b.Count > 0 {
-								data.PatchCoverCount += b.NumStmt
-								// Line covered
-								coveredLines[p.FileName] = append(coveredLines[p.FileName], Line{
-									LineNum:    lineNum,
-									NumStmt:    b.NumStmt,
-									CoverCount: b.Count,
-									LineString: lineString,
-								})
-							} else {
-								// Line not covered (or) partially covered
-								partiallyCoveredLines[p.FileName] = append(partiallyCoveredLines[p.FileName], Line{
-									LineNum:    lineNum,
-									NumStmt:    b.NumStmt,
-									CoverCount: b.Count,
-									LineString: lineString,
-								})
-							}
-							continue blockloop
-						}
+	if len(cfg.IgnoreMarkers) > 0 {
+		for _, f := range diffFiles {
+			for _, t := range f.TextFragments {
+				for _, added := range addedLines(t) {
+					if !hasMarker(added.line.Line, cfg.IgnoreMarkers) {
+						continue
+					}
+					if skippedLines[f.NewName] == nil {
+						skippedLines[f.NewName] = make(map[int]bool)
 					}
+					skippedLines[f.NewName][added.num] = true
 				}
 			}
 		}
 	}
 
-	// total coverage
-	for _, p := range coverProfiles {
-		for _, b := range p.Blocks {
-			data.NumStmt += b.NumStmt
-			if b.Count > 0 {
-				data.CoverCount += b.NumStmt
+	if cfg.SkipFormatOnly {
+		for _, f := range diffFiles {
+			for line := range formatOnlyLines(f) {
+				if skippedLines[f.NewName] == nil {
+					skippedLines[f.NewName] = make(map[int]bool)
+				}
+				skippedLines[f.NewName][line] = true
 			}
 		}
 	}
 
-	// prev total coverage
-	for _, p := range prevCoverProfiles {
-		for _, b := range p.Blocks {
-			data.PrevNumStmt += b.NumStmt
-			if b.Count > 0 {
-				data.PrevCoverCount += b.NumStmt
+	if cfg.IgnoreFile != "" {
+		ignored, err := readIgnoreFile(cfg.IgnoreFile)
+		if err != nil {
+			return CoverageData{}, err
+		}
+		for _, f := range diffFiles {
+			lines := ignored[normalizeDiffName(f.NewName)]
+			if len(lines) == 0 {
+				continue
+			}
+			if skippedLines[f.NewName] == nil {
+				skippedLines[f.NewName] = make(map[int]bool)
+			}
+			for line := range lines {
+				skippedLines[f.NewName][line] = true
 			}
 		}
 	}
 
-	// Get uncovered lines and write to the file
-	data = printUncoveredLines(partiallyCoveredLines, coveredLines, data)
+	coverProfiles = filterProfiles(coverProfiles, cfg)
+	prevCoverProfiles = filterProfiles(prevCoverProfiles, cfg)
+	if len(generated) > 0 {
+		matchesGenerated, err := newDiffMatcher(generated, append(append([]*cover.Profile{}, coverProfiles...), prevCoverProfiles...), cfg)
+		if err != nil {
+			return CoverageData{}, err
+		}
+		coverProfiles = dropDiffProfiles(coverProfiles, generated, matchesGenerated)
+		prevCoverProfiles = dropDiffProfiles(prevCoverProfiles, generated, matchesGenerated)
+	}
+	data.Profiles = coverProfiles
+
+	matches, err := newDiffMatcher(diffFiles, coverProfiles, cfg)
+	if err != nil {
+		return CoverageData{}, err
+	}
+	data.DiffFiles = diffFiles
+	data.DiffProfiles = make(map[string]string)
+
+	// patch coverage, computed for several profiles in parallel and
+	// merged in profile order
+	in := patchInputs{diffFiles: diffFiles, matches: matches, skippedLines: skippedLines, funcs: funcs, cfg: cfg, patchMinHits: patchMinHits}
+	patches := make([]profilePatch, len(coverProfiles))
+	dispatched := len(coverProfiles)
+	workers := cfg.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(coverProfiles) {
+		workers = len(coverProfiles)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				patches[i] = computeProfilePatch(coverProfiles[i], in)
+			}
+		}()
+	}
+	for i := range coverProfiles {
+		// Checked as profiles are handed out, so that the profiles counted
+		// are the first ones, whatever the scheduling.
+		if !deadline.IsZero() && now().After(deadline) {
+			data.Incomplete = true
+			dispatched = i
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	matchedFiles, matchedCodeLines := 0, 0
+	changedFuncs := make(map[string]map[int]*FunctionCoverage)
+	for i, pp := range patches[:dispatched] {
+		p := coverProfiles[i]
+		for _, name := range pp.diffNames {
+			matchedFiles++
+			data.DiffProfiles[name] = p.FileName
+		}
+		matchedCodeLines += pp.codeLines
+		data.PatchUnmatchedLines += pp.unmatchedLines
+		data.PatchNumStmt += pp.numStmt
+		data.PatchCoverCount += pp.coverCount
+		if len(pp.covered) > 0 {
+			coveredLines[p.FileName] = append(coveredLines[p.FileName], pp.covered...)
+		}
+		if len(pp.uncovered) > 0 {
+			uncoveredBlockLines[p.FileName] = append(uncoveredBlockLines[p.FileName], pp.uncovered...)
+		}
+		for line, fn := range pp.funcs {
+			if changedFuncs[p.FileName] == nil {
+				changedFuncs[p.FileName] = make(map[int]*FunctionCoverage)
+			}
+			if prev := changedFuncs[p.FileName][line]; prev != nil {
+				prev.PatchNumStmt += fn.PatchNumStmt
+				prev.PatchCoverCount += fn.PatchCoverCount
+				continue
+			}
+			changedFuncs[p.FileName][line] = fn
+		}
+		data.PatchProfiles = append(data.PatchProfiles, pp.patchProfiles...)
+	}
+
+	for _, byLine := range changedFuncs {
+		for _, fn := range byLine {
+			data.Functions = append(data.Functions, *fn)
+		}
+	}
+	sort.Slice(data.Functions, func(i, j int) bool {
+		a, b := data.Functions[i], data.Functions[j]
+		if a.FileName != b.FileName {
+			return a.FileName < b.FileName
+		}
+		return a.Line < b.Line
+	})
+
+	if cfg.Strict && !data.Incomplete && matchedFiles == 0 && changesGoFiles(diffFiles) {
+		return CoverageData{}, fmt.Errorf("none of the changed go files matched a coverage profile")
+	}
+	staleThreshold := cfg.StaleThreshold
+	if staleThreshold == 0 {
+		staleThreshold = defaultStaleThreshold
+	}
+	data.Stale = matchedCodeLines > 0 && float64(data.PatchUnmatchedLines) > staleThreshold*float64(matchedCodeLines)
+	if cfg.Strict && data.Stale {
+		return CoverageData{}, fmt.Errorf("%d of the %d added code lines of the files matching a coverage profile are in none of its blocks: the profile and diff are likely of different revisions", data.PatchUnmatchedLines, matchedCodeLines)
+	}
+
+	if cfg.PatchOnly {
+		data.PatchOnly = true
+	} else {
+		if cfg.TrimGeneratedFromTotal {
+			if err := trimGenerated(cfg.ModulePrefix, &coverProfiles, &prevCoverProfiles); err != nil {
+				return CoverageData{}, err
+			}
+		}
+
+		// total coverage
+		for _, p := range coverProfiles {
+			for _, b := range p.Blocks {
+				data.NumStmt += b.NumStmt
+				if b.Count >= totalMinHits {
+					data.CoverCount += b.NumStmt
+				}
+			}
+		}
+
+		// prev total coverage
+		for _, p := range prevCoverProfiles {
+			for _, b := range p.Blocks {
+				data.PrevNumStmt += b.NumStmt
+				if b.Count >= totalMinHits {
+					data.PrevCoverCount += b.NumStmt
+				}
+			}
+		}
+
+		if cfg.Packages {
+			data.Packages = packageCoverage(coverProfiles, prevCoverProfiles, totalMinHits)
+		}
+		if cfg.Regressions {
+			data.Regressions = regressions(coverProfiles, prevCoverProfiles, diffFiles, data.DiffProfiles, totalMinHits)
+		}
+	}
 
-	if data.NumStmt != 0 {
-		data.Coverage = float64(data.CoverCount) / float64(data.NumStmt) * 100
+	// Get uncovered lines and write to the file
+	opts := reportOptions{redact: cfg.RedactSource, group: cfg.GroupUncoveredRanges}
+	if cfg.UncoveredContext > 0 && !cfg.RedactSource {
+		opts.context = cfg.UncoveredContext
+		opts.sources = readSources(data.DiffProfiles)
+	}
+	if cfg.UncoveredHunks {
+		opts.fragments = make(map[string][]*gitdiff.TextFragment)
+		for _, f := range diffFiles {
+			if profileName, ok := data.DiffProfiles[f.NewName]; ok {
+				opts.fragments[profileName] = f.TextFragments
+			}
+		}
+	}
+	data = printUncoveredLines(uncoveredBlockLines, coveredLines, data, opts)
+	if cfg.CoveredOut != "" {
+		data.CoveredLines = coveredLineList(coveredLines)
+	}
+	data.PatchLines = patchLines(coveredLines, uncoveredBlockLines, data.UncoveredLines)
+	if cfg.Files {
+		data.Files = fileCoverage(coverProfiles, prevCoverProfiles, diffFiles, data.DiffProfiles, data.PatchLines, totalMinHits)
 	}
-	if data.PatchNumStmt != 0 {
-		data.PatchCoverage = float64(data.PatchCoverCount) / float64(data.PatchNumStmt) * 100
+	if cfg.RedactSource {
+		redactSource(&data)
 	}
-	if data.PrevNumStmt != 0 {
-		data.PrevCoverage = float64(data.PrevCoverCount) / float64(data.PrevNumStmt) * 100
+	if len(cfg.CodeOwners) > 0 {
+		// Once redacted, as uncovered lines are copied.
+		data.ByOwner = ownerCoverage(parseCodeOwners(cfg.CodeOwners), data.DiffProfiles, data.PatchLines, data.UncoveredLines)
+	}
+
+	if err := checkCounts(data); err != nil && cfg.StrictPercentages {
+		return CoverageData{}, err
 	}
+	data.Coverage = percentage(data.CoverCount, data.NumStmt)
+	data.PatchCoverage = percentage(data.PatchCoverCount, data.PatchNumStmt)
+	data.PrevCoverage = percentage(data.PrevCoverCount, data.PrevNumStmt)
 
-	//Condition to set coverage to 100% if no lines added in PR
-	if data.PatchNumStmt == 0 {
-		data.PatchCoverage = 100.0
+	// A patch adding no statement has the coverage of EmptyPatchCoverage.
+	data.PatchHasStatements = data.PatchNumStmt > 0
+	if !data.PatchHasStatements {
+		switch cfg.EmptyPatchCoverage {
+		case "0":
+			data.PatchCoverage = 0
+		case "none":
+			data.PatchCoverage = 0
+			data.NoTestableChanges = true
+		default:
+			data.PatchCoverage = 100.0
+		}
 	}
 
 	return data, nil
 }
 
 /*
-The lines which are partially covered but not inside coveredLines are the uncovered lines. after we filter those lines,
-we print these lines to uncovered_lines.txt. For these invalid lines, we modify patch coverage in following way:
+The lines of blocks not covered, and not inside coveredLines, are the uncovered lines. after we filter those lines,
+we print these lines to the Uncovered_lines report. For these invalid lines, we modify patch coverage in following way:
 For valid covered line - Don't change patch coverage
 For valid uncovered line - Don't change patch coverage
-For Invalid covered line - subtract PatchNumStmt
-For Invalid uncovered line - subtract PatchNumStmt, PatchCoverCount
+For Invalid uncovered line - subtract its statements from PatchNumStmt
+For Invalid covered line - subtract its statements from PatchNumStmt and PatchCoverCount
+Each Line stands for a whole block, recorded once, so a block holding several invalid lines is subtracted once.
 */
-func printUncoveredLines(partiallyCoveredLines, coveredLines map[string][]Line, data CoverageData) CoverageData {
-	// Open a new file for writing
-	file, err := os.Create("uncovered_lines.txt")
-	if err != nil {
-		fmt.Println("Error creating file:", err)
+func printUncoveredLines(uncoveredBlockLines, coveredLines map[string][]Line, data CoverageData, opts reportOptions) CoverageData {
+	var report strings.Builder
+
+	for _, lines := range coveredLines {
+		for _, line := range lines {
+			if isInvalidLine(line.LineString) {
+				data.PatchNumStmt -= line.NumStmt
+				data.PatchCoverCount -= line.NumStmt
+			}
+		}
 	}
-	defer file.Close()
 
-	// Get uncovered lines and write to the file
-	for fileName, lines := range partiallyCoveredLines {
+	fileNames := make([]string, 0, len(uncoveredBlockLines))
+	for fileName := range uncoveredBlockLines {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	// Get uncovered lines and write to the report
+	for _, fileName := range fileNames {
+		lines := uncoveredBlockLines[fileName]
 		// Check if the file is covered
 		_, ok := coveredLines[fileName]
 
@@ -215,42 +662,551 @@ func printUncoveredLines(partiallyCoveredLines, coveredLines map[string][]Line,
 			if !isInvalidLine(line.LineString) {
 				if uncovered {
 					uncoveredLines = append(uncoveredLines, line)
+					data.UncoveredLines = append(data.UncoveredLines, UncoveredLine{
+						FileName:   fileName,
+						LineNum:    line.LineNum,
+						LineString: line.LineString,
+						NumStmt:    line.NumStmt,
+						Partial:    data.Mode != "set" && line.CoverCount > 0,
+						Context:    contextLines(opts.sources[fileName], line.LineNum, line.LineNum, opts.context),
+						Hunk:       hunkHeader(opts.fragments[fileName], line.LineNum, opts.redact),
+					})
 				}
 			} else {
 				data.PatchNumStmt -= line.NumStmt
-				if !uncovered {
-					data.PatchCoverCount -= line.NumStmt
-				}
 			}
 		}
 
 		// Write to the file if there are any remaining-uncovered lines
 		if len(uncoveredLines) > 0 {
 			// Write the filename to the file
-			file.WriteString("<pre>\n")
-			file.WriteString(fmt.Sprintf("Uncovered lines in %s:\n", fileName))
-
-			for _, line := range uncoveredLines {
-				// Write the line number to the file
-				file.WriteString(fmt.Sprintf("LineNum: %d\n", line.LineNum))
-				// Write the line string to the file
-				file.WriteString(fmt.Sprintf("Lines:\n <code>%s</code>\n", line.LineString))
+			report.WriteString("<pre>\n")
+			report.WriteString(fmt.Sprintf("Uncovered lines in %s:\n", fileName))
+
+			if opts.group {
+				for _, run := range lineRuns(uncoveredLines) {
+					first, last := run[0].LineNum, run[len(run)-1].LineNum
+					data.UncoveredRanges = append(data.UncoveredRanges, UncoveredRange{FileName: fileName, StartLine: first, EndLine: last})
+					if first == last {
+						report.WriteString(fmt.Sprintf("LineNum: %d\n", first))
+					} else {
+						report.WriteString(fmt.Sprintf("LineNum: %d-%d\n", first, last))
+					}
+					if !opts.redact {
+						report.WriteString("Lines:\n")
+						for _, line := range run {
+							report.WriteString(fmt.Sprintf(" <code>%s</code>\n", line.LineString))
+						}
+					}
+					writeContext(&report, contextLines(opts.sources[fileName], first, last, opts.context), first, last)
+				}
+			} else {
+				for _, line := range uncoveredLines {
+					// Write the line number to the file
+					report.WriteString(fmt.Sprintf("LineNum: %d\n", line.LineNum))
+					// Write the line string to the file
+					if !opts.redact {
+						report.WriteString(fmt.Sprintf("Lines:\n <code>%s</code>\n", line.LineString))
+					}
+					writeContext(&report, contextLines(opts.sources[fileName], line.LineNum, line.LineNum, opts.context), line.LineNum, line.LineNum)
+				}
 			}
 
 			// Write a separator to separate the sections for different files
-			file.WriteString("\n-----------------------\n")
-			file.WriteString("</pre>\n")
+			report.WriteString("\n-----------------------\n")
+			report.WriteString("</pre>\n")
 		}
 	}
 
-	content, err := os.ReadFile("uncovered_lines.txt")
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-	}
-	data.Uncovered_lines = string(content)
+	data.Uncovered_lines = report.String()
 	return data
 }
 
+// coveredLineList returns the covered lines of every file, sorted by file
+// and line. A line of several covered blocks is reported once, with the
+// statements of all of them, as PatchCoverCount counts them all.
+func coveredLineList(coveredLines map[string][]Line) []CoveredLine {
+	fileNames := make([]string, 0, len(coveredLines))
+	for fileName := range coveredLines {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	var list []CoveredLine
+	for _, fileName := range fileNames {
+		lines := append([]Line(nil), coveredLines[fileName]...)
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].LineNum < lines[j].LineNum })
+		for _, line := range lines {
+			if n := len(list); n > 0 && list[n-1].FileName == fileName && list[n-1].LineNum == line.LineNum {
+				list[n-1].NumStmt += line.NumStmt
+				continue
+			}
+			list = append(list, CoveredLine{FileName: fileName, LineNum: line.LineNum, LineString: line.LineString, NumStmt: line.NumStmt})
+		}
+	}
+	return list
+}
+
+// coveredReport returns the covered lines report of lines, in the format
+// of the uncovered lines report. The code of the lines is left out when
+// redact is set.
+func coveredReport(lines []CoveredLine, redact bool) string {
+	var report strings.Builder
+	for i, line := range lines {
+		if i == 0 || lines[i-1].FileName != line.FileName {
+			report.WriteString("<pre>\n")
+			report.WriteString(fmt.Sprintf("Covered lines in %s:\n", line.FileName))
+		}
+		report.WriteString(fmt.Sprintf("LineNum: %d\n", line.LineNum))
+		if !redact {
+			report.WriteString(fmt.Sprintf("Lines:\n <code>%s</code>\n", line.LineString))
+		}
+		if i == len(lines)-1 || lines[i+1].FileName != line.FileName {
+			report.WriteString("\n-----------------------\n")
+			report.WriteString("</pre>\n")
+		}
+	}
+	return report.String()
+}
+
+// reportOptions controls the uncovered lines report of printUncoveredLines.
+type reportOptions struct {
+	// redact leaves the code of the lines out of the report.
+	redact bool
+	// group reports contiguous uncovered lines as one range.
+	group bool
+	// context is the number of source lines reported before and after
+	// uncovered lines, taken from sources by profile file name.
+	context int
+	sources map[string][]string
+	// fragments holds the diff fragments of the changed files, by profile
+	// file name, to report the hunk of uncovered lines.
+	fragments map[string][]*gitdiff.TextFragment
+}
+
+// hunkHeader returns the header of the fragment holding the new line
+// number, without the code following it when redact is set, or "" when
+// no fragment holds it.
+func hunkHeader(fragments []*gitdiff.TextFragment, lineNum int, redact bool) string {
+	for _, frag := range fragments {
+		if int64(lineNum) < frag.NewPosition || int64(lineNum) >= frag.NewPosition+frag.NewLines {
+			continue
+		}
+		if redact {
+			return fmt.Sprintf("@@ -%d,%d +%d,%d @@", frag.OldPosition, frag.OldLines, frag.NewPosition, frag.NewLines)
+		}
+		return strings.TrimSpace(frag.Header())
+	}
+	return ""
+}
+
+// readSources reads the lines of the changed files from disk, by the name
+// of the profile they matched. Files that cannot be read are left out.
+func readSources(diffProfiles map[string]string) map[string][]string {
+	sources := make(map[string][]string)
+	for diffName, profileName := range diffProfiles {
+		src, err := os.ReadFile(diffName)
+		if err != nil {
+			continue
+		}
+		sources[profileName] = strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n"), "\n")
+	}
+	return sources
+}
+
+// contextLines returns the lines of src from n lines before first to n
+// lines after last, within the bounds of src. It returns nil when src is
+// nil or n is not positive.
+func contextLines(src []string, first, last, n int) []SourceLine {
+	if len(src) == 0 || n <= 0 {
+		return nil
+	}
+	start, end := first-n, last+n
+	if start < 1 {
+		start = 1
+	}
+	if end > len(src) {
+		end = len(src)
+	}
+
+	var lines []SourceLine
+	for num := start; num <= end; num++ {
+		lines = append(lines, SourceLine{LineNum: num, LineString: src[num-1]})
+	}
+	return lines
+}
+
+// writeContext writes the context lines to the report, marking the lines
+// from first to last with ">".
+func writeContext(report *strings.Builder, lines []SourceLine, first, last int) {
+	if len(lines) == 0 {
+		return
+	}
+	report.WriteString("Context:\n")
+	for _, l := range lines {
+		marker := " "
+		if first <= l.LineNum && l.LineNum <= last {
+			marker = ">"
+		}
+		report.WriteString(fmt.Sprintf("%s%d: <code>%s</code>\n", marker, l.LineNum, l.LineString))
+	}
+}
+
+// lineRuns sorts lines by line number, drops repeated line numbers and
+// splits them into runs of contiguous line numbers.
+func lineRuns(lines []Line) [][]Line {
+	sorted := make([]Line, len(lines))
+	copy(sorted, lines)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].LineNum < sorted[j].LineNum })
+
+	var runs [][]Line
+	for _, line := range sorted {
+		if n := len(runs); n > 0 {
+			last := runs[n-1][len(runs[n-1])-1].LineNum
+			if line.LineNum == last {
+				continue
+			}
+			if line.LineNum == last+1 {
+				runs[n-1] = append(runs[n-1], line)
+				continue
+			}
+		}
+		runs = append(runs, []Line{line})
+	}
+	return runs
+}
+
+// redactSource clears the content of the source lines of data, keeping
+// their file names and line numbers.
+func redactSource(data *CoverageData) {
+	for i := range data.UncoveredLines {
+		data.UncoveredLines[i].LineString = ""
+		data.UncoveredLines[i].Context = nil
+	}
+	for i := range data.CoveredLines {
+		data.CoveredLines[i].LineString = ""
+	}
+	for _, lines := range data.PatchLines {
+		for i := range lines {
+			lines[i].LineString = ""
+		}
+	}
+}
+
+// patchLines merges the covered and uncovered lines of each file. A line
+// reported by several blocks keeps its highest cover count, unless it is
+// reported as uncovered, which takes precedence so the lines agree with
+// UncoveredLines. uncoveredBlockLines holds the lines of the blocks not
+// covered, uncoveredLines is looked up in.
+func patchLines(coveredLines, uncoveredBlockLines map[string][]Line, uncoveredLines []UncoveredLine) map[string][]Line {
+	byFile := make(map[string]map[int]Line)
+	linesOf := func(fileName string) map[int]Line {
+		lines, ok := byFile[fileName]
+		if !ok {
+			lines = make(map[int]Line)
+			byFile[fileName] = lines
+		}
+		return lines
+	}
+
+	for fileName, lines := range coveredLines {
+		byNum := linesOf(fileName)
+		for _, line := range lines {
+			if prev, ok := byNum[line.LineNum]; ok && prev.CoverCount >= line.CoverCount {
+				continue
+			}
+			byNum[line.LineNum] = line
+		}
+	}
+	uncovered := make(map[string]map[int]bool)
+	for _, l := range uncoveredLines {
+		if uncovered[l.FileName] == nil {
+			uncovered[l.FileName] = make(map[int]bool)
+		}
+		uncovered[l.FileName][l.LineNum] = true
+	}
+	for fileName, lines := range uncoveredBlockLines {
+		byNum := linesOf(fileName)
+		for _, line := range lines {
+			if !uncovered[fileName][line.LineNum] {
+				continue
+			}
+			if prev, ok := byNum[line.LineNum]; ok && !prev.Covered && prev.CoverCount >= line.CoverCount {
+				continue
+			}
+			byNum[line.LineNum] = line
+		}
+	}
+
+	result := make(map[string][]Line, len(byFile))
+	for fileName, lines := range byFile {
+		sorted := make([]Line, 0, len(lines))
+		for _, line := range lines {
+			sorted = append(sorted, line)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].LineNum < sorted[j].LineNum })
+		result[fileName] = sorted
+	}
+	return result
+}
+
+// lineString returns the content of a diff line without its line ending,
+// "\n" or the "\r\n" of diffs produced on Windows, which is absent on a
+// last line marked "\ No newline at end of file".
+func lineString(line gitdiff.Line) string {
+	return strings.TrimSuffix(strings.TrimSuffix(line.Line, "\n"), "\r")
+}
+
+// checkCounts fails when covered statement counts are negative or exceed
+// their statement counts, which would yield percentages out of the 0-100
+// range.
+func checkCounts(data CoverageData) error {
+	for _, c := range []struct {
+		name           string
+		covered, total int
+	}{
+		{"total", data.CoverCount, data.NumStmt},
+		{"patch", data.PatchCoverCount, data.PatchNumStmt},
+		{"previous", data.PrevCoverCount, data.PrevNumStmt},
+	} {
+		if c.covered < 0 || c.covered > c.total {
+			return fmt.Errorf("invalid %s coverage: %d covered of %d statements", c.name, c.covered, c.total)
+		}
+	}
+	return nil
+}
+
+// percentage returns covered out of total statements as a percentage,
+// clamped to the 0-100 range, or 0 without statements.
+func percentage(covered, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	p := float64(covered) / float64(total) * 100
+	if p < 0 {
+		return 0
+	}
+	if p > 100 {
+		return 100
+	}
+	return p
+}
+
+// minHits returns the count a block needs to be covered, at least 1.
+func minHits(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// patchInputs are the inputs of computeProfilePatch, shared read-only by
+// the profiles computed in parallel.
+type patchInputs struct {
+	diffFiles    []*gitdiff.File
+	matches      diffMatcher
+	skippedLines map[string]map[int]bool
+	funcs        map[string][]funcComplexity
+	cfg          Config
+	patchMinHits int
+}
+
+// profilePatch is the patch coverage of the added lines of the diff files
+// matching one profile.
+type profilePatch struct {
+	// diffNames are the names of the diff files matching the profile.
+	diffNames []string
+	// codeLines is the number of added lines holding code, unmatchedLines
+	// of those in no block.
+	codeLines, unmatchedLines int
+	numStmt, coverCount       int
+	covered, uncovered        []Line
+	// funcs holds the coverage of the changed functions by start line,
+	// with Config.ChangedFunctions.
+	funcs         map[int]*FunctionCoverage
+	patchProfiles []*cover.Profile
+}
+
+// computeProfilePatch computes the patch coverage of profile p, apart from
+// the other profiles.
+func computeProfilePatch(p *cover.Profile, in patchInputs) profilePatch {
+	var pp profilePatch
+	for _, f := range in.diffFiles {
+		if !in.matches(p.FileName, f.NewName) {
+			continue
+		}
+		pp.diffNames = append(pp.diffNames, f.NewName)
+
+		// The first added line holding code of each block, in diff
+		// order. A block is counted, and recorded as a Line, once:
+		// printUncoveredLines subtracts the statements of invalid
+		// lines per Line, so per block.
+		blockLines := make([]*addedLine, len(p.Blocks))
+		index := newBlockIndex(p.Blocks)
+		for _, t := range f.TextFragments {
+			for _, added := range addedLines(t) {
+				if in.skippedLines[f.NewName][added.num] {
+					continue
+				}
+				added := added
+				lineString := lineString(added.line)
+				inBlock := false
+				index.containing(added.num, func(i int) {
+					inBlock = true
+					if blockLines[i] == nil && blockHoldsCode(p.Blocks[i], added.num, lineString) {
+						blockLines[i] = &added
+					}
+				})
+				if holdsCode(lineString) {
+					pp.codeLines++
+					if !inBlock {
+						pp.unmatchedLines++
+					}
+				}
+			}
+		}
+
+		var patchBlocks []cover.ProfileBlock
+		for i, b := range p.Blocks {
+			added := blockLines[i]
+			if added == nil {
+				continue
+			}
+			lineNum := added.num
+			lineString := lineString(added.line)
+			numStmt := b.NumStmt
+			if in.cfg.WeightByComplexity {
+				numStmt *= complexityAt(in.funcs[f.NewName], b.StartLine)
+			}
+
+			pp.numStmt += numStmt
+			var fnCoverage *FunctionCoverage
+			if fn, ok := funcAt(in.funcs[f.NewName], b.StartLine); ok && in.cfg.ChangedFunctions {
+				if pp.funcs == nil {
+					pp.funcs = make(map[int]*FunctionCoverage)
+				}
+				if fnCoverage = pp.funcs[fn.startLine]; fnCoverage == nil {
+					fnCoverage = &FunctionCoverage{FileName: p.FileName, Name: fn.name, Line: fn.startLine}
+					pp.funcs[fn.startLine] = fnCoverage
+				}
+				fnCoverage.PatchNumStmt += numStmt
+			}
+			if b.Count >= in.patchMinHits {
+				pp.coverCount += numStmt
+				if fnCoverage != nil {
+					fnCoverage.PatchCoverCount += numStmt
+				}
+				// Line covered
+				pp.covered = append(pp.covered, Line{
+					LineNum:    lineNum,
+					NumStmt:    numStmt,
+					CoverCount: b.Count,
+					Covered:    true,
+					BlockStart: b.StartLine,
+					BlockEnd:   b.EndLine,
+					LineString: lineString,
+				})
+			} else {
+				// Line of a block not covered: not hit, or hit
+				// fewer than patchMinHits times
+				pp.uncovered = append(pp.uncovered, Line{
+					LineNum:    lineNum,
+					NumStmt:    numStmt,
+					CoverCount: b.Count,
+					Covered:    false,
+					BlockStart: b.StartLine,
+					BlockEnd:   b.EndLine,
+					LineString: lineString,
+				})
+			}
+			patchBlocks = append(patchBlocks, b)
+		}
+		if len(patchBlocks) > 0 {
+			pp.patchProfiles = append(pp.patchProfiles, &cover.Profile{FileName: p.FileName, Mode: p.Mode, Blocks: patchBlocks})
+		}
+	}
+	return pp
+}
+
+func changesGoFiles(diffFiles []*gitdiff.File) bool {
+	for _, f := range diffFiles {
+		if strings.HasSuffix(f.NewName, ".go") {
+			return true
+		}
+	}
+	return false
+}
+
+// blockHoldsCode reports whether the added line lineNum, whose content is
+// text, holds code of block b, which then counts in the patch coverage.
+// This is the overlap rule between blocks and added lines: only the part of
+// the line within the block counts, from StartCol on the first line of the
+// block and up to EndCol on its last line, and that part must hold more
+// than blanks, braces and comments. So adding only the closing brace of a
+// block, the line opening it, or a blank line or comment inside it does not
+// make its statements part of the patch.
+func blockHoldsCode(b cover.ProfileBlock, lineNum int, text string) bool {
+	if lineNum == b.EndLine && b.EndCol >= 1 && b.EndCol-1 <= len(text) {
+		text = text[:b.EndCol-1]
+	}
+	if lineNum == b.StartLine && b.StartCol >= 1 && b.StartCol-1 <= len(text) {
+		text = text[b.StartCol-1:]
+	}
+	return holdsCode(text)
+}
+
+// holdsCode reports whether text holds more than blanks, braces and
+// comments.
+func holdsCode(text string) bool {
+	if i := strings.Index(text, "//"); i >= 0 {
+		text = text[:i]
+	}
+	text = strings.Trim(text, " \t{}")
+	return text != "" && !strings.HasPrefix(text, "/*")
+}
+
+// blockIndex finds the blocks of a profile spanning a line, by binary
+// search, rather than scanning every block for every added line.
+type blockIndex struct {
+	// order holds the positions of the blocks sorted by start line.
+	order  []int
+	blocks []cover.ProfileBlock
+	// maxEnd[i] is the greatest end line of the blocks of order[:i+1], as
+	// blocks of merged profiles may overlap.
+	maxEnd []int
+}
+
+func newBlockIndex(blocks []cover.ProfileBlock) blockIndex {
+	order := make([]int, len(blocks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return blocks[order[i]].StartLine < blocks[order[j]].StartLine
+	})
+	maxEnd := make([]int, len(order))
+	for i, b := range order {
+		maxEnd[i] = blocks[b].EndLine
+		if i > 0 && maxEnd[i-1] > maxEnd[i] {
+			maxEnd[i] = maxEnd[i-1]
+		}
+	}
+	return blockIndex{order: order, blocks: blocks, maxEnd: maxEnd}
+}
+
+// containing calls fn with the position of every block spanning lineNum.
+func (x blockIndex) containing(lineNum int, fn func(i int)) {
+	// The blocks of order[:n] start at lineNum or before.
+	n := sort.Search(len(x.order), func(i int) bool {
+		return x.blocks[x.order[i]].StartLine > lineNum
+	})
+	for i := n - 1; i >= 0 && x.maxEnd[i] >= lineNum; i-- {
+		if b := x.order[i]; x.blocks[b].EndLine >= lineNum {
+			fn(b)
+		}
+	}
+}
+
 // comments, and structs are excluded from uncovered lines
 func isInvalidLine(line string) bool {
 	line = strings.TrimSpace(line)
@@ -1,20 +1,33 @@
 package patchcover
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"golang.org/x/tools/cover"
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/golden"
 )
 
 func TestProcessFiles(t *testing.T) {
-	scenarioDir := "./testdata/scenarios"
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	scenarioDir := filepath.Join(wd, "testdata", "scenarios")
 	fis, err := os.ReadDir(scenarioDir)
 	assert.NilError(t, err)
 
+	// ProcessFiles writes uncovered_lines.txt in the working directory.
+	assert.NilError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
 	assert.Assert(t, len(fis) > 0) // Some scenarios exist.
 
 	for _, fi := range fis {
@@ -23,13 +36,336 @@ func TestProcessFiles(t *testing.T) {
 		}
 
 		t.Run(fi.Name(), func(t *testing.T) {
-			cov, err := ProcessFiles(path.Join(scenarioDir, fi.Name(), "coverage.out"), path.Join(scenarioDir, fi.Name(), "diff.diff"), "")
+			cov, err := ProcessFiles(filepath.Join(scenarioDir, fi.Name(), "coverage.out"), filepath.Join(scenarioDir, fi.Name(), "diff.diff"), "")
 			assert.NilError(t, err)
 
 			covJSON, err := json.MarshalIndent(cov, "", "  ")
 			assert.NilError(t, err)
 
-			golden.Assert(t, string(covJSON), path.Join("scenarios", fi.Name(), "golden.json"))
+			golden.Assert(t, string(covJSON), filepath.Join(scenarioDir, fi.Name(), "golden.json"))
 		})
 	}
 }
+
+func TestComputeCoverage_sameFileTwice(t *testing.T) {
+	diffFiles, _, err := gitdiff.Parse(strings.NewReader(`diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4 +4 @@ func A() int {
+-	return 0
++	return 1
+@@ -8 +8 @@ func B() int {
+-	return 0
++	return 1
+`))
+	assert.NilError(t, err)
+	profile := func(counts ...int) *cover.Profile {
+		return &cover.Profile{FileName: "example.com/m/a.go", Mode: "count", Blocks: []cover.ProfileBlock{
+			{StartLine: 3, StartCol: 14, EndLine: 5, EndCol: 2, NumStmt: 1, Count: counts[0]},
+			{StartLine: 7, StartCol: 14, EndLine: 9, EndCol: 2, NumStmt: 1, Count: counts[1]},
+		}}
+	}
+
+	// The outputs of two tools, concatenated: each covers one block.
+	cov, _, err := ComputeCoverage(diffFiles, []*cover.Profile{profile(1, 0), profile(0, 1)}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, cov.NumStmt, 2)
+	assert.Equal(t, cov.CoverCount, 2)
+	assert.Equal(t, cov.PatchNumStmt, 2)
+	assert.Equal(t, cov.PatchCoverCount, 2)
+	assert.Equal(t, cov.PatchCoverage, 100.0)
+}
+
+func TestComputeCoverage_profilesUnchanged(t *testing.T) {
+	diffFiles, _, err := gitdiff.Parse(strings.NewReader(`diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -6 +6 @@ func A() int {
+-	return 0
++	return 1
+`))
+	assert.NilError(t, err)
+	// Profiles of the same file, the first holding overlapping blocks.
+	profiles := []*cover.Profile{
+		{FileName: "example.com/m/a.go", Mode: "count", Blocks: []cover.ProfileBlock{
+			{StartLine: 3, StartCol: 14, EndLine: 9, EndCol: 2, NumStmt: 3, Count: 1},
+			{StartLine: 5, StartCol: 10, EndLine: 7, EndCol: 3, NumStmt: 1, Count: 0},
+		}},
+		{FileName: "example.com/m/a.go", Mode: "count", Blocks: []cover.ProfileBlock{
+			{StartLine: 5, StartCol: 10, EndLine: 7, EndCol: 3, NumStmt: 1, Count: 2},
+		}},
+	}
+	prevProfiles := []*cover.Profile{
+		{FileName: "example.com/m/a.go", Mode: "count", Blocks: []cover.ProfileBlock{
+			{StartLine: 3, StartCol: 14, EndLine: 9, EndCol: 2, NumStmt: 3, Count: 0},
+			{StartLine: 5, StartCol: 10, EndLine: 7, EndCol: 3, NumStmt: 1, Count: 1},
+		}},
+	}
+	copyProfiles := func(profiles []*cover.Profile) []*cover.Profile {
+		var copied []*cover.Profile
+		for _, p := range profiles {
+			copied = append(copied, &cover.Profile{FileName: p.FileName, Mode: p.Mode, Blocks: append([]cover.ProfileBlock(nil), p.Blocks...)})
+		}
+		return copied
+	}
+	wantProfiles, wantPrev := copyProfiles(profiles), copyProfiles(prevProfiles)
+
+	cov, _, err := ComputeCoverage(diffFiles, profiles, prevProfiles)
+	assert.NilError(t, err)
+	assert.Equal(t, cov.PatchNumStmt, 1)
+	assert.Equal(t, cov.PatchCoverCount, 1)
+	assert.DeepEqual(t, profiles, wantProfiles)
+	assert.DeepEqual(t, prevProfiles, wantPrev)
+}
+
+func TestComputeCoverage(t *testing.T) {
+	dir := "testdata/scenarios/single_edit"
+	patch, err := os.Open(path.Join(dir, "diff.diff"))
+	assert.NilError(t, err)
+	defer patch.Close()
+	diffFiles, _, err := gitdiff.Parse(patch)
+	assert.NilError(t, err)
+	profiles, err := cover.ParseProfiles(path.Join(dir, "coverage.out"))
+	assert.NilError(t, err)
+
+	cov, uncovered, err := ComputeCoverage(diffFiles, profiles, nil)
+	assert.NilError(t, err)
+	want, err := New(Config{}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, "diff.diff"), "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cov, want)
+	assert.DeepEqual(t, uncovered, want.UncoveredLines)
+	assert.Assert(t, len(uncovered) > 0)
+	for _, l := range uncovered {
+		assert.Assert(t, l.FileName != "" && l.LineNum > 0 && l.LineString != "" && l.NumStmt > 0, "%+v", l)
+	}
+}
+
+func TestRenderTemplateOutput(t *testing.T) {
+	data := CoverageData{Coverage: 50, PatchCoverage: 75}
+
+	tests := map[string]struct {
+		tmpl string
+		want string
+	}{
+		"top-level": {
+			tmpl: `{{ .PatchCoverage }}`,
+			want: "75",
+		},
+		"define main": {
+			tmpl: `{{define "pct"}}{{printf "%.1f" .}}%{{end}}{{define "main"}}{{template "pct" .Coverage}} {{template "pct" .PatchCoverage}}{{end}}`,
+			want: "50.0% 75.0%",
+		},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := RenderTemplateOutput(data, tt.tmpl, &buf)
+			assert.NilError(t, err)
+			assert.Equal(t, buf.String(), tt.want)
+		})
+	}
+}
+
+func Test_lineString(t *testing.T) {
+	assert.Equal(t, lineString(gitdiff.Line{Op: gitdiff.OpAdd, Line: "\treturn nil\n"}), "\treturn nil")
+	// Last line of a file without a trailing newline.
+	assert.Equal(t, lineString(gitdiff.Line{Op: gitdiff.OpAdd, Line: "\treturn nil"}), "\treturn nil")
+	// Line of a diff produced on Windows.
+	assert.Equal(t, lineString(gitdiff.Line{Op: gitdiff.OpAdd, Line: "\treturn nil\r\n"}), "\treturn nil")
+}
+
+func Test_blockHoldsCode(t *testing.T) {
+	// if bool1 {  // 8
+	//     ...
+	// }           // 12
+	b := cover.ProfileBlock{StartLine: 8, StartCol: 11, EndLine: 12, EndCol: 3, NumStmt: 2}
+	tests := []struct {
+		lineNum int
+		text    string
+		want    bool
+	}{
+		{8, "\tif bool1 {", false},
+		{8, "\tif bool1 { x++", true},
+		{9, "\t\tfmt.Println()", true},
+		{10, "", false},
+		{10, "\t\t// comment", false},
+		{10, "\t\t/* comment */", false},
+		{10, "\t\t}", false},
+		{11, "\t\tx++ // comment", true},
+		{12, "\t}", false},
+		{12, "\t} else {", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, blockHoldsCode(b, tt.lineNum, tt.text), tt.want, "%d: %q", tt.lineNum, tt.text)
+	}
+
+	// Single line blocks are cut at both ends.
+	single := cover.ProfileBlock{StartLine: 3, StartCol: 12, EndLine: 3, EndCol: 24}
+	assert.Assert(t, blockHoldsCode(single, 3, "\tif err { return err }"))
+	empty := cover.ProfileBlock{StartLine: 3, StartCol: 10, EndLine: 3, EndCol: 12}
+	assert.Assert(t, !blockHoldsCode(empty, 3, "\tif err {}"))
+}
+
+func Test_printUncoveredLines_group(t *testing.T) {
+	var lines []Line
+	// Line 4 is reported by two blocks.
+	for _, n := range []int{12, 3, 4, 5, 4, 9, 13} {
+		lines = append(lines, Line{LineNum: n, NumStmt: 1, LineString: fmt.Sprintf("f%d()", n)})
+	}
+	partial := map[string][]Line{"a.go": lines}
+
+	data := printUncoveredLines(partial, nil, CoverageData{}, reportOptions{group: true})
+	assert.DeepEqual(t, data.UncoveredRanges, []UncoveredRange{
+		{FileName: "a.go", StartLine: 3, EndLine: 5},
+		{FileName: "a.go", StartLine: 9, EndLine: 9},
+		{FileName: "a.go", StartLine: 12, EndLine: 13},
+	})
+	assert.Equal(t, data.Uncovered_lines, `<pre>
+Uncovered lines in a.go:
+LineNum: 3-5
+Lines:
+ <code>f3()</code>
+ <code>f4()</code>
+ <code>f5()</code>
+LineNum: 9
+Lines:
+ <code>f9()</code>
+LineNum: 12-13
+Lines:
+ <code>f12()</code>
+ <code>f13()</code>
+
+-----------------------
+</pre>
+`)
+
+	redacted := printUncoveredLines(partial, nil, CoverageData{}, reportOptions{redact: true, group: true})
+	assert.Equal(t, redacted.Uncovered_lines, "<pre>\nUncovered lines in a.go:\nLineNum: 3-5\nLineNum: 9\nLineNum: 12-13\n\n-----------------------\n</pre>\n")
+
+	// Without grouping, every line is reported on its own.
+	ungrouped := printUncoveredLines(partial, nil, CoverageData{}, reportOptions{})
+	assert.Assert(t, ungrouped.UncoveredRanges == nil)
+	assert.Equal(t, strings.Count(ungrouped.Uncovered_lines, "LineNum:"), 7)
+}
+
+func Test_printUncoveredLines_invalidLines(t *testing.T) {
+	// Lines 5 and 6 end with a comment: the statements of their blocks
+	// leave the patch coverage, covered or not.
+	covered := map[string][]Line{"a.go": {
+		{LineNum: 5, NumStmt: 1, CoverCount: 2, Covered: true, LineString: "x := f() /* why */"},
+		{LineNum: 7, NumStmt: 2, CoverCount: 2, Covered: true, LineString: "y := g()"},
+	}}
+	uncovered := map[string][]Line{"a.go": {
+		{LineNum: 6, NumStmt: 3, LineString: "z := h() /* why */"},
+		{LineNum: 8, NumStmt: 4, LineString: "w := i()"},
+	}}
+
+	data := printUncoveredLines(uncovered, covered, CoverageData{PatchNumStmt: 10, PatchCoverCount: 3}, reportOptions{})
+	assert.Equal(t, data.PatchNumStmt, 6)
+	assert.Equal(t, data.PatchCoverCount, 2)
+	assert.NilError(t, checkCounts(data))
+	assert.Equal(t, len(data.UncoveredLines), 1)
+	assert.Equal(t, data.UncoveredLines[0].LineNum, 8)
+}
+
+func Test_percentage(t *testing.T) {
+	assert.Equal(t, percentage(3, 4), 75.0)
+	assert.Equal(t, percentage(0, 0), 0.0)
+	assert.Equal(t, percentage(5, 4), 100.0)
+	assert.Equal(t, percentage(-1, 4), 0.0)
+	assert.Equal(t, percentage(1, -1), 0.0)
+}
+
+func Test_checkCounts(t *testing.T) {
+	assert.NilError(t, checkCounts(CoverageData{NumStmt: 4, CoverCount: 4, PatchNumStmt: 2, PrevNumStmt: 1, PrevCoverCount: 1}))
+	assert.Error(t, checkCounts(CoverageData{NumStmt: 4, CoverCount: 5}), "invalid total coverage: 5 covered of 4 statements")
+	assert.Error(t, checkCounts(CoverageData{PatchNumStmt: 2, PatchCoverCount: -1}), "invalid patch coverage: -1 covered of 2 statements")
+	assert.Error(t, checkCounts(CoverageData{PrevNumStmt: 1, PrevCoverCount: 2}), "invalid previous coverage: 2 covered of 1 statements")
+}
+
+func Test_contextLines(t *testing.T) {
+	src := []string{"a", "b", "c", "d", "e"}
+	assert.DeepEqual(t, contextLines(src, 3, 3, 1), []SourceLine{{2, "b"}, {3, "c"}, {4, "d"}})
+	// Context is cut at the bounds of the file.
+	assert.DeepEqual(t, contextLines(src, 1, 2, 2), []SourceLine{{1, "a"}, {2, "b"}, {3, "c"}, {4, "d"}})
+	assert.DeepEqual(t, contextLines(src, 5, 5, 1), []SourceLine{{4, "d"}, {5, "e"}})
+	assert.Assert(t, contextLines(nil, 3, 3, 1) == nil)
+	assert.Assert(t, contextLines(src, 3, 3, 0) == nil)
+}
+
+func Test_blockIndex_containing(t *testing.T) {
+	blocks := []cover.ProfileBlock{
+		{StartLine: 10, EndLine: 12},
+		{StartLine: 1, EndLine: 20},
+		{StartLine: 5, EndLine: 6},
+		{StartLine: 12, EndLine: 14},
+	}
+	index := newBlockIndex(blocks)
+	containing := func(lineNum int) []int {
+		var found []int
+		index.containing(lineNum, func(i int) { found = append(found, i) })
+		sort.Ints(found)
+		return found
+	}
+	assert.DeepEqual(t, containing(12), []int{0, 1, 3})
+	assert.DeepEqual(t, containing(5), []int{1, 2})
+	assert.DeepEqual(t, containing(15), []int{1})
+	assert.Assert(t, containing(21) == nil)
+	assert.Assert(t, containing(0) == nil)
+}
+
+// syntheticDiff returns a diff adding lines lines to each of the files of
+// syntheticProfile, in fragments of fragment lines.
+func syntheticDiff(files, lines, fragment int) string {
+	var b strings.Builder
+	for f := 0; f < files; f++ {
+		fmt.Fprintf(&b, "diff --git a/pkg%d/file.go b/pkg%d/file.go\n--- a/pkg%d/file.go\n+++ b/pkg%d/file.go\n", f, f, f, f)
+		for start := 1; start <= lines; start += fragment {
+			fmt.Fprintf(&b, "@@ -%d,0 +%d,%d @@\n", start-1, start, fragment)
+			for i := 0; i < fragment; i++ {
+				b.WriteString("+\tcall()\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func Benchmark_computeCoverage(b *testing.B) {
+	profiles, err := cover.ParseProfilesFromReader(strings.NewReader(syntheticProfile(20, 2000)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	diffFiles, err := parseDiff(strings.NewReader(syntheticDiff(20, 2000, 10)))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := computeCoverage(diffFiles, profiles, nil, Config{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Test_computeCoverage_concurrency(t *testing.T) {
+	cov := syntheticProfile(20, 200)
+	prev := syntheticProfile(20, 150)
+	diff := syntheticDiff(20, 200, 7)
+
+	compute := func(concurrency int) []byte {
+		cfg := Config{Concurrency: concurrency, PatchMinHits: 2}
+		d, err := New(cfg).ComputeFromReaders(strings.NewReader(cov), strings.NewReader(diff), strings.NewReader(prev))
+		assert.NilError(t, err)
+		assert.Assert(t, d.PatchNumStmt > 0)
+		out, err := json.Marshal(d)
+		assert.NilError(t, err)
+		return out
+	}
+
+	serial := compute(1)
+	for i := 0; i < 20; i++ {
+		assert.Assert(t, bytes.Equal(compute(8), serial), "run %d", i)
+		assert.Assert(t, bytes.Equal(compute(0), serial), "run %d", i)
+	}
+}
@@ -0,0 +1,117 @@
+package patchcover
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreRule is a pattern of a .gitignore style file.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// parseIgnoreRules parses lines in the syntax of .gitignore files. Blank
+// lines and lines starting with # are skipped. Patterns holding no slash
+// but a trailing one match at any depth; others are anchored to the module
+// root.
+func parseIgnoreRules(lines []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			// Escapes a leading ! or #.
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		r.segments = strings.Split(line, "/")
+		if !anchored {
+			r.segments = append([]string{"**"}, r.segments...)
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// matches reports whether the rule matches the module relative file name
+// or one of its directories.
+func (r ignoreRule) matches(name string) bool {
+	segments := strings.Split(name, "/")
+	n := len(segments)
+	if r.dirOnly {
+		n--
+	}
+	for i := 1; i <= n; i++ {
+		if matchSegments(r.segments, segments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments reports whether the path segments match the pattern
+// segments, where "**" matches any number of segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// isIgnored reports whether the last of the rules matching name excludes
+// it. Unlike git, which does not descend into excluded directories, a
+// negated pattern re-includes a file of an excluded directory.
+func isIgnored(rules []ignoreRule, name string) bool {
+	ignored := false
+	for _, r := range rules {
+		if r.matches(name) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// ignoreModulePrefix returns the module path stripped from profile file
+// names before matching them against CoverageIgnore patterns: modulePrefix
+// or, when empty, the module path of the go.mod of the working directory.
+func ignoreModulePrefix(modulePrefix string) string {
+	if modulePrefix != "" {
+		return modulePrefix
+	}
+	gomod, err := os.ReadFile("go.mod")
+	if err != nil {
+		return ""
+	}
+	return parseModulePath(gomod)
+}
@@ -0,0 +1,41 @@
+package patchcover
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_isIgnored(t *testing.T) {
+	rules := parseIgnoreRules([]string{
+		"# comment",
+		"",
+		"vendor/",
+		"/gen/",
+		"!gen/keep.go",
+		"*_mock.go",
+		"internal/**/fixtures.go",
+		`\!bang.go`,
+	})
+	tests := map[string]bool{
+		"main.go":                            false,
+		"vendor/x/y.go":                      true,
+		"pkg/vendor/y.go":                    true,
+		"vendor.go":                          false,
+		"gen/a.go":                           true,
+		"pkg/gen/a.go":                       false,
+		"gen/keep.go":                        false,
+		"pkg/store_mock.go":                  true,
+		"internal/fixtures.go":               true,
+		"internal/a/b/fixtures.go":           true,
+		"pkg/internal/fixtures.go":           false,
+		"!bang.go":                           true,
+		"gen/sub/keep.go":                    true,
+		"internal/a/b/fixtures_unrelated.go": false,
+	}
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, isIgnored(rules, name), want)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package patchcover
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// Diagnostic is the result of a check of a coverage file and diff run by
+// Computer.Diagnose. Advice tells how to fix a failed check.
+type Diagnostic struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Advice string `json:"advice,omitempty"`
+}
+
+// Diagnose checks a coverage file and a diff for common setup issues,
+// returning the result of every check in a fixed order:
+//   - profile-not-empty: the coverage file holds blocks;
+//   - mode-header: the coverage file starts with its mode line;
+//   - diff-matches-profile: a changed go file matches a profile;
+//   - consistent-paths: profile file names are import paths and diff
+//     file names repository relative paths;
+//   - profile-up-to-date: the coverage file is not older than the diff.
+//
+// It only fails when the files cannot be read or the diff not parsed.
+func (c *Computer) Diagnose(coverageFile, diffFile string) ([]Diagnostic, error) {
+	content, err := os.ReadFile(coverageFile)
+	if err != nil {
+		return nil, &FileError{Arg: "coverage", Path: coverageFile, Err: err}
+	}
+	patch, err := os.ReadFile(diffFile)
+	if err != nil {
+		return nil, &FileError{Arg: "diff", Path: diffFile, Err: err}
+	}
+	files, err := parseDiff(bytes.NewReader(patch))
+	if err != nil {
+		return nil, err
+	}
+
+	var diagnostics []Diagnostic
+	check := func(name string, passed bool, advice string, args ...interface{}) {
+		d := Diagnostic{Name: name, Passed: passed}
+		if !passed {
+			d.Advice = fmt.Sprintf(advice, args...)
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	// Without its mode line, the profile is parsed as if it was in set mode
+	// for the other checks.
+	hasMode := bytes.HasPrefix(bytes.TrimLeft(content, " \t\r\n"), []byte("mode: "))
+	if !hasMode {
+		content = append([]byte("mode: set\n"), content...)
+	}
+	profiles, perr := cover.ParseProfilesFromReader(bytes.NewReader(content))
+	blocks := 0
+	for _, p := range profiles {
+		blocks += len(p.Blocks)
+	}
+
+	check("profile-not-empty", blocks > 0,
+		"the coverage file holds no block: run the tests of the changed packages with coverage, e.g. go test -coverprofile=%s ./...", coverageFile)
+	if perr != nil {
+		check("mode-header", false, "the coverage file is not a coverage profile: %v", perr)
+	} else {
+		check("mode-header", hasMode,
+			`the coverage file lacks its first "mode: set", "mode: count" or "mode: atomic" line: regenerate it with go test -coverprofile, or set -profile-format`)
+	}
+
+	diffFiles := filterDiffFiles(files, c.cfg)
+	matches, err := newDiffMatcher(diffFiles, profiles, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	matched := !changesGoFiles(diffFiles)
+	for _, f := range diffFiles {
+		for _, p := range profiles {
+			if matches(p.FileName, f.NewName) {
+				matched = true
+				break
+			}
+		}
+	}
+	check("diff-matches-profile", matched,
+		"none of the changed go files matches a profile: compare their paths with -debug-paths, use -modules or -gomod in repositories holding several modules, and check the tests of the changed packages ran")
+
+	var badPaths []string
+	for _, p := range profiles {
+		if name := toSlash(p.FileName); strings.HasPrefix(name, "_/") || filepath.IsAbs(p.FileName) || strings.HasPrefix(name, "/") {
+			badPaths = append(badPaths, p.FileName)
+			break
+		}
+	}
+	for _, f := range diffFiles {
+		if strings.HasPrefix(toSlash(f.NewName), "/") {
+			badPaths = append(badPaths, f.NewName)
+			break
+		}
+	}
+	check("consistent-paths", len(badPaths) == 0,
+		"%s is a filesystem path: profiles name files by import path when the tests run inside a module, and diffs by repository relative path, e.g. with git diff",
+		strings.Join(badPaths, " and "))
+
+	covInfo, err := os.Stat(coverageFile)
+	if err != nil {
+		return nil, &FileError{Arg: "coverage", Path: coverageFile, Err: err}
+	}
+	diffInfo, err := os.Stat(diffFile)
+	if err != nil {
+		return nil, &FileError{Arg: "diff", Path: diffFile, Err: err}
+	}
+	check("profile-up-to-date", !covInfo.ModTime().Before(diffInfo.ModTime()),
+		"the coverage file is older than the diff, so it may not cover the latest changes: run the tests again after generating the diff")
+
+	return diagnostics, nil
+}
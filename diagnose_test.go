@@ -0,0 +1,79 @@
+package patchcover
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestComputer_Diagnose(t *testing.T) {
+	const (
+		profile = "mode: set\nexample.com/m/a.go:3.14,5.2 1 1\n"
+		diff    = `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4 +4 @@ func A() int {
+-	return 0
++	return 1
+`
+	)
+	diagnose := func(t *testing.T, profile, diff string, profileAge time.Duration) map[string]Diagnostic {
+		t.Helper()
+		dir := t.TempDir()
+		covFile, diffFile := filepath.Join(dir, "coverage.out"), filepath.Join(dir, "diff.diff")
+		assert.NilError(t, os.WriteFile(covFile, []byte(profile), 0o644))
+		assert.NilError(t, os.WriteFile(diffFile, []byte(diff), 0o644))
+		now := time.Now()
+		assert.NilError(t, os.Chtimes(diffFile, now, now))
+		assert.NilError(t, os.Chtimes(covFile, now.Add(-profileAge), now.Add(-profileAge)))
+
+		diagnostics, err := New(Config{}).Diagnose(covFile, diffFile)
+		assert.NilError(t, err)
+		byName := make(map[string]Diagnostic)
+		for _, d := range diagnostics {
+			byName[d.Name] = d
+		}
+		assert.Equal(t, len(byName), 5)
+		return byName
+	}
+	failed := func(diagnostics map[string]Diagnostic) []string {
+		var names []string
+		for _, name := range []string{"profile-not-empty", "mode-header", "diff-matches-profile", "consistent-paths", "profile-up-to-date"} {
+			if d := diagnostics[name]; !d.Passed {
+				assert.Assert(t, d.Advice != "", name)
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		assert.DeepEqual(t, failed(diagnose(t, profile, diff, 0)), []string(nil))
+	})
+	t.Run("empty profile", func(t *testing.T) {
+		assert.DeepEqual(t, failed(diagnose(t, "mode: set\n", diff, 0)), []string{"profile-not-empty", "diff-matches-profile"})
+	})
+	t.Run("missing mode line", func(t *testing.T) {
+		assert.DeepEqual(t, failed(diagnose(t, "example.com/m/a.go:3.14,5.2 1 1\n", diff, 0)), []string{"mode-header"})
+	})
+	t.Run("no matching profile", func(t *testing.T) {
+		d := diagnose(t, "mode: set\nexample.com/m/b.go:3.14,5.2 1 1\n", diff, 0)
+		assert.DeepEqual(t, failed(d), []string{"diff-matches-profile"})
+		assert.Assert(t, strings.Contains(d["diff-matches-profile"].Advice, "-debug-paths"))
+	})
+	t.Run("filesystem paths", func(t *testing.T) {
+		d := diagnose(t, "mode: set\n_/home/me/m/a.go:3.14,5.2 1 1\n", diff, 0)
+		assert.DeepEqual(t, failed(d), []string{"consistent-paths"})
+		assert.Assert(t, strings.HasPrefix(d["consistent-paths"].Advice, "_/home/me/m/a.go is a filesystem path"))
+	})
+	t.Run("stale profile", func(t *testing.T) {
+		assert.DeepEqual(t, failed(diagnose(t, profile, diff, time.Hour)), []string{"profile-up-to-date"})
+	})
+
+	_, err := New(Config{}).Diagnose(filepath.Join(t.TempDir(), "missing.out"), "diff.diff")
+	assert.ErrorContains(t, err, "coverage file not found")
+}
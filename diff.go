@@ -0,0 +1,325 @@
+package patchcover
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// parseDiff parses a unified diff. The CRLF line endings of diffs produced
+// on Windows are replaced, which would otherwise end up in file names.
+// Diffs produced by Mercurial or Subversion are first normalized with
+// normalizeDiff. Combined diffs are rejected.
+func parseDiff(r io.Reader) ([]*gitdiff.File, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	if name, ok := combinedDiffFile(content); ok {
+		return nil, fmt.Errorf("combined diff of %s is not supported: lines of a merge are added relative to some of its parents only; "+
+			"diff against a single parent instead, e.g. git diff -U0 <base>..<merge>", name)
+	}
+	files, _, err := gitdiff.Parse(bytes.NewReader(normalizeDiff(content)))
+	return files, err
+}
+
+// combinedDiffFile reports whether content holds a combined diff, as git
+// produces for merge commits and conflicted merges, and returns the name
+// of its first file. Hunk lines start with a space, + or -, so headers are
+// never confused with code.
+func combinedDiffFile(content []byte) (string, bool) {
+	name := "patch"
+	for _, line := range strings.Split(string(content), "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --cc "):
+			return strings.TrimSpace(strings.TrimPrefix(line, "diff --cc ")), true
+		case strings.HasPrefix(line, "diff --combined "):
+			return strings.TrimSpace(strings.TrimPrefix(line, "diff --combined ")), true
+		case strings.HasPrefix(line, "diff "):
+			name = "patch"
+		case strings.HasPrefix(line, "+++ "):
+			// Strip the b/ prefix of git headers.
+			name = headerName(line[4:], true)
+		case strings.HasPrefix(line, "@@@ "):
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// addedLine is an added line of a diff fragment.
+type addedLine struct {
+	// num is the line number in the new file.
+	num  int
+	line gitdiff.Line
+}
+
+// addedLines returns the added lines of a fragment with their line number
+// in the new file. Deleted lines do not advance the new line number, so
+// the index of a line in the fragment is not its offset from NewPosition;
+// context lines, of diffs generated without -U0, do, but are not added.
+// Line numbers only depend on the fragment, not on the diff algorithm that
+// produced it, though algorithms may disagree on which lines were added.
+func addedLines(frag *gitdiff.TextFragment) []addedLine {
+	num := int(frag.NewPosition)
+	if num < 1 {
+		// Only fragments adding no line start at 0.
+		num = 1
+	}
+
+	var added []addedLine
+	for _, line := range frag.Lines {
+		switch line.Op {
+		case gitdiff.OpAdd:
+			added = append(added, addedLine{num: num, line: line})
+			num++
+		case gitdiff.OpContext:
+			num++
+		}
+	}
+	return added
+}
+
+// lineChurn returns the number of lines the fragments of f add and
+// delete.
+func lineChurn(f *gitdiff.File) (added, deleted int) {
+	for _, t := range f.TextFragments {
+		added += int(t.LinesAdded)
+		deleted += int(t.LinesDeleted)
+	}
+	return added, deleted
+}
+
+// deletedFiles returns copies of the deleted files of diffFiles named by
+// their old name, so that filterDiffFiles, which drops files without a new
+// name, selects them as it would the files still present.
+func deletedFiles(diffFiles []*gitdiff.File) []*gitdiff.File {
+	var deleted []*gitdiff.File
+	for _, f := range diffFiles {
+		if f.IsDelete && f.NewName == "" {
+			d := *f
+			d.NewName = f.OldName
+			deleted = append(deleted, &d)
+		}
+	}
+	return deleted
+}
+
+// formatOnlyLines returns the numbers of the added lines of f matching a
+// deleted line of f once whitespace is removed. Each deleted line matches
+// one added line at most, so duplicated lines still count. Lines holding
+// only whitespace are left out.
+func formatOnlyLines(f *gitdiff.File) map[int]bool {
+	deleted := make(map[string]int)
+	for _, frag := range f.TextFragments {
+		for _, line := range frag.Lines {
+			if line.Op == gitdiff.OpDelete {
+				if s := stripWhitespace(line.Line); s != "" {
+					deleted[s]++
+				}
+			}
+		}
+	}
+
+	lines := make(map[int]bool)
+	for _, frag := range f.TextFragments {
+		for _, added := range addedLines(frag) {
+			if s := stripWhitespace(added.line.Line); deleted[s] > 0 {
+				deleted[s]--
+				lines[added.num] = true
+			}
+		}
+	}
+	return lines
+}
+
+// stripWhitespace returns s without its whitespace.
+func stripWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// normalizeDiff rewrites the file headers of non-git unified diffs into a
+// form gitdiff names files correctly from:
+//   - the tab separated timestamp or revision following header names is
+//     dropped, and Subversion's "(nonexistent)" becomes /dev/null;
+//   - Mercurial's a/ and b/ name prefixes are stripped;
+//   - Subversion property change sections are dropped.
+//
+// Git diffs are returned unchanged.
+func normalizeDiff(content []byte) []byte {
+	lines := strings.SplitAfter(string(content), "\n")
+
+	hg := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "diff --git ") {
+			return content
+		}
+		if strings.HasPrefix(line, "diff -r ") {
+			hg = true
+		}
+	}
+
+	var out strings.Builder
+	// Lines left in the current hunk, on the old and new sides.
+	oldLeft, newLeft := 0, 0
+	inProperties := false
+	for _, line := range lines {
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, " "), line == "\n":
+				oldLeft--
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+			}
+			out.WriteString(line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Property changes on: "):
+			inProperties = true
+			continue
+		case strings.HasPrefix(line, "Index: "):
+			inProperties = false
+		case inProperties:
+			continue
+		case strings.HasPrefix(line, "@@ "):
+			oldLeft, newLeft = hunkLengths(line)
+		case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+			line = line[:4] + headerName(line[4:], hg) + "\n"
+		}
+		out.WriteString(line)
+	}
+	return []byte(out.String())
+}
+
+// headerName returns the file name of a ---/+++ header, without its
+// trailing annotation.
+func headerName(header string, hg bool) string {
+	header = strings.TrimRight(header, "\r\n")
+	name, annotation := header, ""
+	if i := strings.Index(header, "\t"); i >= 0 {
+		name, annotation = header[:i], header[i+1:]
+	}
+	if annotation == "(nonexistent)" {
+		return "/dev/null"
+	}
+	if hg && (strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/")) {
+		name = name[2:]
+	}
+	return name
+}
+
+// hunkLengths returns the old and new line counts of a hunk header such as
+// "@@ -1,2 +1,3 @@". An omitted count is 1.
+func hunkLengths(header string) (int, int) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+	return rangeLength(strings.TrimPrefix(fields[1], "-")), rangeLength(strings.TrimPrefix(fields[2], "+"))
+}
+
+func rangeLength(r string) int {
+	i := strings.Index(r, ",")
+	if i < 0 {
+		return 1
+	}
+	n, err := strconv.Atoi(r[i+1:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// combineDiffs combines the files of several diffs by file name, with op:
+// "union" keeps the lines added by any of the diffs, and "intersect" only
+// those added by all of them. Line numbers of every diff must refer to the
+// same version of the files, e.g. the one the coverage profile was
+// generated from. A file changed by a single diff is kept as is by union;
+// other files only hold their combined added lines, without the deleted
+// and context lines, one fragment per run of consecutive lines.
+func combineDiffs(op string, diffs [][]*gitdiff.File) ([]*gitdiff.File, error) {
+	if op != "union" && op != "intersect" {
+		return nil, fmt.Errorf("invalid diff operation %q, expected union or intersect", op)
+	}
+
+	var names []string
+	byName := make(map[string][]*gitdiff.File)
+	inDiffs := make(map[string]map[int]bool) // file name -> diffs changing it
+	for i, files := range diffs {
+		for _, f := range files {
+			if f.IsDelete {
+				continue
+			}
+			if _, ok := byName[f.NewName]; !ok {
+				names = append(names, f.NewName)
+				inDiffs[f.NewName] = make(map[int]bool)
+			}
+			byName[f.NewName] = append(byName[f.NewName], f)
+			inDiffs[f.NewName][i] = true
+		}
+	}
+
+	var combined []*gitdiff.File
+	for _, name := range names {
+		files := byName[name]
+		if op == "intersect" && len(inDiffs[name]) < len(diffs) {
+			continue
+		}
+		if op == "union" && len(files) == 1 {
+			combined = append(combined, files[0])
+			continue
+		}
+
+		// Lines added by each diff, counted once per diff.
+		lines := make(map[int]gitdiff.Line)
+		addedBy := make(map[int]map[int]bool)
+		for d, diff := range diffs {
+			for _, f := range diff {
+				if f.NewName != name || f.IsDelete {
+					continue
+				}
+				for _, frag := range f.TextFragments {
+					for _, added := range addedLines(frag) {
+						if _, ok := lines[added.num]; !ok {
+							lines[added.num] = added.line
+							addedBy[added.num] = make(map[int]bool)
+						}
+						addedBy[added.num][d] = true
+					}
+				}
+			}
+		}
+		var nums []int
+		for num := range lines {
+			if op == "union" || len(addedBy[num]) == len(diffs) {
+				nums = append(nums, num)
+			}
+		}
+		sort.Ints(nums)
+
+		f := &gitdiff.File{OldName: files[0].OldName, NewName: name, IsNew: files[0].IsNew}
+		var frag *gitdiff.TextFragment
+		for _, num := range nums {
+			if frag == nil || int(frag.NewPosition+frag.NewLines) != num {
+				frag = &gitdiff.TextFragment{NewPosition: int64(num)}
+				f.TextFragments = append(f.TextFragments, frag)
+			}
+			frag.Lines = append(frag.Lines, lines[num])
+			frag.NewLines++
+			frag.LinesAdded++
+		}
+		combined = append(combined, f)
+	}
+	return combined, nil
+}
@@ -0,0 +1,332 @@
+package patchcover
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_parseDiff(t *testing.T) {
+	for _, name := range []string{"hg", "svn"} {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open("testdata/vcs/" + name + ".diff")
+			assert.NilError(t, err)
+			defer f.Close()
+
+			files, err := parseDiff(f)
+			assert.NilError(t, err)
+			assert.Equal(t, len(files), 2)
+
+			// The removed "-- old note" line is not mistaken for a header.
+			assert.Equal(t, files[0].NewName, "testdata/test-project/README.md")
+			assert.Equal(t, files[0].OldName, "testdata/test-project/README.md")
+			assert.Equal(t, len(files[0].TextFragments), 1)
+			assert.Equal(t, files[0].TextFragments[0].LinesDeleted, int64(1))
+
+			assert.Equal(t, files[1].NewName, "testdata/test-project/func1.go")
+			assert.Assert(t, files[1].IsNew)
+			assert.Equal(t, len(files[1].TextFragments), 1)
+			assert.Equal(t, files[1].TextFragments[0].LinesAdded, int64(21))
+		})
+	}
+}
+
+func Test_parseDiff_combined(t *testing.T) {
+	f, err := os.Open("testdata/vcs/combined.diff")
+	assert.NilError(t, err)
+	defer f.Close()
+
+	_, err = parseDiff(f)
+	assert.ErrorContains(t, err, "combined diff of testdata/test-project/func1.go is not supported")
+	assert.ErrorContains(t, err, "git diff -U0 <base>..<merge>")
+
+	// Headers of combined hunks are detected without a diff --cc line.
+	_, err = parseDiff(strings.NewReader("--- a/f.go\n+++ b/f.go\n@@@ -1,1 -1,1 +1,2 @@@\n  a\n++b\n"))
+	assert.ErrorContains(t, err, "combined diff of f.go is not supported")
+
+	// Code looking like a hunk header is not mistaken for one.
+	_, err = parseDiff(strings.NewReader("diff --git a/f.go b/f.go\n--- a/f.go\n+++ b/f.go\n@@ -1 +1,2 @@\n a\n+@@@ b\n"))
+	assert.NilError(t, err)
+}
+
+func Test_normalizeDiff_git(t *testing.T) {
+	content, err := os.ReadFile("testdata/scenarios/new_file/diff.diff")
+	assert.NilError(t, err)
+	assert.Equal(t, string(normalizeDiff(content)), string(content))
+}
+
+func Test_hunkLengths(t *testing.T) {
+	tests := map[string][2]int{
+		"@@ -1,2 +1,3 @@":          {2, 3},
+		"@@ -0,0 +1 @@":            {0, 1},
+		"@@ -5 +5,0 @@ func f() {": {1, 0},
+		"@@ malformed":             {0, 0},
+	}
+	for header, want := range tests {
+		t.Run(strings.Trim(header, "@ "), func(t *testing.T) {
+			oldLen, newLen := hunkLengths(header)
+			assert.DeepEqual(t, [2]int{oldLen, newLen}, want)
+		})
+	}
+}
+
+func Test_addedLines_diffAlgorithms(t *testing.T) {
+	dir := "./testdata/diff-algorithms"
+	src, err := os.ReadFile(path.Join(dir, "calc.go"))
+	assert.NilError(t, err)
+	lines := strings.SplitAfter(string(src), "\n")
+
+	patchLines := make(map[string][]Line)
+	for _, name := range []string{"myers", "histogram", "myers-context", "histogram-context"} {
+		diff, err := os.ReadFile(path.Join(dir, name+".diff"))
+		assert.NilError(t, err)
+		files, err := parseDiff(bytes.NewReader(diff))
+		assert.NilError(t, err)
+		// Added lines are numbered as in the new file, whatever the hunk
+		// boundaries.
+		for _, frag := range files[0].TextFragments {
+			for _, added := range addedLines(frag) {
+				assert.Equal(t, added.line.Line, lines[added.num-1], "%s: line %d", name, added.num)
+			}
+		}
+
+		cov, err := New(Config{}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, name+".diff"), "")
+		assert.NilError(t, err)
+		for _, l := range cov.PatchLines {
+			patchLines[name] = append(patchLines[name], l...)
+		}
+	}
+
+	// Context lines do not change the patch coverage.
+	assert.DeepEqual(t, patchLines["myers"], patchLines["myers-context"])
+	assert.DeepEqual(t, patchLines["histogram"], patchLines["histogram-context"])
+	// Myers reports the moved Sub function as rewritten, histogram as
+	// unchanged; the other changed lines are identical.
+	myers := patchLines["myers"]
+	assert.Equal(t, myers[len(myers)-1].LineString, "\treturn a - b")
+	assert.DeepEqual(t, myers[:len(myers)-1], patchLines["histogram"])
+}
+
+func Test_addedLines_context(t *testing.T) {
+	dir := "./testdata/context-lines"
+	src, err := os.ReadFile(path.Join(dir, "shapes.go"))
+	assert.NilError(t, err)
+	lines := strings.SplitAfter(string(src), "\n")
+
+	covs := make(map[string]CoverageData)
+	for _, name := range []string{"u0", "u3"} {
+		diff, err := os.ReadFile(path.Join(dir, name+".diff"))
+		assert.NilError(t, err)
+		files, err := parseDiff(bytes.NewReader(diff))
+		assert.NilError(t, err)
+
+		var nums []int
+		for _, frag := range files[0].TextFragments {
+			for _, added := range addedLines(frag) {
+				assert.Equal(t, added.line.Line, lines[added.num-1], "%s: line %d", name, added.num)
+				nums = append(nums, added.num)
+			}
+		}
+		// Context and deleted lines are not counted as added.
+		assert.DeepEqual(t, nums, []int{7, 8, 9, 15, 16, 17, 31, 33, 34, 35})
+
+		covs[name], err = New(Config{}).ComputeFromFiles(path.Join(dir, "coverage.out"), path.Join(dir, name+".diff"), "")
+		assert.NilError(t, err)
+	}
+
+	// With -U3, the guards of Area and Perimeter are in one fragment,
+	// separated by context lines, and the Scale change in another.
+	diff, err := os.ReadFile(path.Join(dir, "u3.diff"))
+	assert.NilError(t, err)
+	files, err := parseDiff(bytes.NewReader(diff))
+	assert.NilError(t, err)
+	assert.Equal(t, len(files[0].TextFragments), 2)
+	assert.Equal(t, files[0].TextFragments[0].NewPosition, int64(4))
+
+	u0, u3 := covs["u0"], covs["u3"]
+	assert.DeepEqual(t, u3.PatchLines, u0.PatchLines)
+	assert.DeepEqual(t, u3.UncoveredLines, u0.UncoveredLines)
+	assert.Equal(t, u3.PatchNumStmt, 6)
+	assert.Equal(t, u3.PatchCoverCount, 4)
+	assert.Equal(t, u3.PatchAddedLines, u0.PatchAddedLines)
+	assert.Equal(t, u3.PatchDeletedLines, 1)
+}
+
+func TestComputer_ComputeFromFiles_vcs(t *testing.T) {
+	for _, name := range []string{"hg", "svn"} {
+		t.Run(name, func(t *testing.T) {
+			cov, err := New(Config{}).ComputeFromFiles("testdata/test-project/coverage.out", "testdata/vcs/"+name+".diff", "")
+			assert.NilError(t, err)
+			assert.Equal(t, cov.PatchNumStmt, 8)
+			assert.Equal(t, cov.PatchCoverCount, 6)
+		})
+	}
+}
+
+func Test_addedLines(t *testing.T) {
+	const diff = `diff --git a/pkg/new.go b/pkg/new.go
+new file mode 100644
+index 0000000..1111111
+--- /dev/null
++++ b/pkg/new.go
+@@ -0,0 +1,3 @@
++package pkg
++
++var x = 1
+diff --git a/pkg/edit.go b/pkg/edit.go
+index 2222222..3333333 100644
+--- a/pkg/edit.go
++++ b/pkg/edit.go
+@@ -3,4 +3,4 @@ package pkg
+ var a = 1
+-var b = 2
+-var c = 3
++var bc = 5
+ var d = 4
++var e = 5
+`
+	files, err := parseDiff(strings.NewReader(diff))
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 2)
+
+	nums := func(file, frag int) []int {
+		var nums []int
+		for _, l := range addedLines(files[file].TextFragments[frag]) {
+			nums = append(nums, l.num)
+		}
+		return nums
+	}
+
+	// A brand-new file starts at line 1.
+	assert.DeepEqual(t, nums(0, 0), []int{1, 2, 3})
+	// Deleted lines do not advance the new line number.
+	assert.DeepEqual(t, nums(1, 0), []int{4, 6})
+	assert.Equal(t, addedLines(files[1].TextFragments[0])[0].line.Line, "var bc = 5\n")
+}
+
+func TestComputer_ComputeFromReaders_skipFormatOnly(t *testing.T) {
+	// gofmt reformatted A and reordered the imports, and a line was added
+	// to B.
+	const diff = `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,12 +1,12 @@
+ package m
+ 
+ import (
+-	"strings"
+ 	"fmt"
++	"strings"
+ )
+ 
+-func A(a,b int) int {
+-	x:=a+b
+-	fmt.Println(strings.Repeat("x",x))
++func A(a, b int) int {
++	x := a + b
++	fmt.Println(strings.Repeat("x", x))
+ 	return x
+ }
+@@ -15,2 +15,3 @@ func B() int {
+ 	y := 1
++	y++
+ 	return y
+`
+	const profile = `mode: set
+example.com/m/a.go:8.22,12.2 3 0
+example.com/m/a.go:14.14,18.2 3 0
+`
+	files, err := parseDiff(strings.NewReader(diff))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, formatOnlyLines(files[0]), map[int]bool{5: true, 8: true, 9: true, 10: true})
+
+	compute := func(cfg Config) CoverageData {
+		t.Helper()
+		cov, err := New(cfg).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+		assert.NilError(t, err)
+		return cov
+	}
+	cov := compute(Config{})
+	assert.Equal(t, cov.PatchNumStmt, 6)
+
+	cov = compute(Config{SkipFormatOnly: true})
+	assert.Equal(t, cov.PatchNumStmt, 3)
+	assert.Equal(t, len(cov.UncoveredLines), 1)
+	assert.Equal(t, cov.UncoveredLines[0].LineNum, 16)
+}
+
+func TestComputer_ComputeFromDiffs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := path.Join(dir, name)
+		assert.NilError(t, os.WriteFile(p, []byte(content), 0o644))
+		return p
+	}
+	covFile := write("coverage.out", `mode: set
+example.com/m/a.go:3.14,3.20 1 1
+example.com/m/a.go:4.2,4.10 1 0
+example.com/m/a.go:5.2,5.10 1 1
+example.com/m/a.go:6.2,6.10 1 0
+example.com/m/b.go:3.14,3.20 1 0
+example.com/m/c.go:3.14,3.20 1 1
+`)
+	// Both diffs add lines 4 and 5 of a.go, and one of them line 3 and the
+	// other line 6, b.go and c.go.
+	first := write("first.diff", `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -2,0 +3,3 @@
++	x := 1
++	y := 2
++	z := 3
+diff --git a/b.go b/b.go
+--- a/b.go
++++ b/b.go
+@@ -3 +3 @@
+-	return 0
++	return 1
+`)
+	second := write("second.diff", `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -3,0 +4,3 @@
++	y := 2
++	z := 3
++	w := 4
+diff --git a/c.go b/c.go
+--- a/c.go
++++ b/c.go
+@@ -3 +3 @@
+-	return 0
++	return 1
+`)
+
+	lines := func(d CoverageData) map[string][]int {
+		byFile := make(map[string][]int)
+		for fileName, fileLines := range d.PatchLines {
+			for _, l := range fileLines {
+				byFile[path.Base(fileName)] = append(byFile[path.Base(fileName)], l.LineNum)
+			}
+		}
+		return byFile
+	}
+
+	cov, err := New(Config{}).ComputeFromDiffs([]string{first, second}, "intersect", covFile, "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lines(cov), map[string][]int{"a.go": {4, 5}})
+	assert.Equal(t, cov.PatchNumStmt, 2)
+	assert.Equal(t, cov.PatchCoverCount, 1)
+
+	cov, err = New(Config{}).ComputeFromDiffs([]string{first, second}, "union", covFile, "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lines(cov), map[string][]int{"a.go": {3, 4, 5, 6}, "b.go": {3}, "c.go": {3}})
+	assert.Equal(t, cov.PatchNumStmt, 6)
+	assert.Equal(t, cov.PatchCoverCount, 3)
+
+	_, err = New(Config{}).ComputeFromDiffs([]string{first, second}, "xor", covFile, "")
+	assert.Error(t, err, `invalid diff operation "xor", expected union or intersect`)
+}
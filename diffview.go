@@ -0,0 +1,60 @@
+package patchcover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// Markers of added lines in RenderDiffOutput.
+const (
+	coveredMarker   = "✓"
+	uncoveredMarker = "✗"
+	noStmtMarker    = " "
+)
+
+// RenderDiffOutput reprints the patch as a unified diff whose added lines
+// are marked "+✓" when covered, "+✗" when uncovered, and "+ " when they
+// count in no patch statement.
+func RenderDiffOutput(data CoverageData, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	for _, f := range data.DiffFiles {
+		covered := make(map[int]bool)
+		for _, l := range data.PatchLines[data.DiffProfiles[f.NewName]] {
+			covered[l.LineNum] = l.Covered
+		}
+
+		oldName, newName := "/dev/null", "/dev/null"
+		if !f.IsNew {
+			oldName = "a/" + f.OldName
+		}
+		if !f.IsDelete {
+			newName = "b/" + f.NewName
+		}
+		fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName)
+
+		for _, frag := range f.TextFragments {
+			fmt.Fprintln(w, strings.TrimRight(frag.Header(), " "))
+			added := addedLines(frag)
+			for _, line := range frag.Lines {
+				if line.Op != gitdiff.OpAdd {
+					fmt.Fprintf(w, "%s%s\n", line.Op, lineString(line))
+					continue
+				}
+				marker := noStmtMarker
+				if isCovered, ok := covered[added[0].num]; ok {
+					marker = uncoveredMarker
+					if isCovered {
+						marker = coveredMarker
+					}
+				}
+				added = added[1:]
+				fmt.Fprintf(w, "+%s %s\n", marker, lineString(line))
+			}
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,52 @@
+package patchcover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestRenderDiffOutput(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("testdata/scenarios/new_file/coverage.out", "testdata/scenarios/new_file/diff.diff", "")
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	assert.NilError(t, RenderDiffOutput(cov, &buf))
+	golden.Assert(t, buf.String(), "diff-view.golden")
+}
+
+func TestRenderDiffOutput_markersMatchCoverage(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("testdata/scenarios/single_edit/coverage.out", "testdata/scenarios/single_edit/diff.diff", "")
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	assert.NilError(t, RenderDiffOutput(cov, &buf))
+
+	var covered, uncovered []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"+coveredMarker+" "):
+			covered = append(covered, strings.TrimPrefix(line, "+"+coveredMarker+" "))
+		case strings.HasPrefix(line, "+"+uncoveredMarker+" "):
+			uncovered = append(uncovered, strings.TrimPrefix(line, "+"+uncoveredMarker+" "))
+		}
+	}
+
+	var wantCovered, wantUncovered []string
+	for _, lines := range cov.PatchLines {
+		for _, l := range lines {
+			if l.CoverCount > 0 {
+				wantCovered = append(wantCovered, l.LineString)
+			}
+		}
+	}
+	for _, l := range cov.UncoveredLines {
+		wantUncovered = append(wantUncovered, l.LineString)
+	}
+
+	assert.Equal(t, len(covered), len(wantCovered))
+	assert.DeepEqual(t, uncovered, wantUncovered)
+}
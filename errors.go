@@ -0,0 +1,54 @@
+package patchcover
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// FileError reports an input file that could not be read, naming which
+// argument it was given as.
+type FileError struct {
+	// Arg is the argument the file was given as: "coverage", "diff" or
+	// "previous coverage".
+	Arg  string
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	if errors.Is(e.Err, fs.ErrNotExist) {
+		return fmt.Sprintf("%s file not found: %s", e.Arg, e.Path)
+	}
+	return fmt.Sprintf("%s file %s: %v", e.Arg, e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// ErrEmptyProfile is the cause of the ParseError of a coverage file with
+// no content at all, not even a mode line, as truncated or never written
+// profiles are.
+var ErrEmptyProfile = errors.New("empty file")
+
+// ParseError reports a coverage file that could be read but not parsed,
+// so that a malformed or empty profile is not taken for the profile of
+// untested code.
+type ParseError struct {
+	// Path is the name of the coverage file, empty when it was read from
+	// an unnamed reader.
+	Path string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("parsing coverage profile: %v", e.Err)
+	}
+	return fmt.Sprintf("parsing coverage profile %s: %v", e.Path, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
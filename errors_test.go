@@ -0,0 +1,83 @@
+package patchcover
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFileError(t *testing.T) {
+	const (
+		cov  = "./testdata/scenarios/single_edit/coverage.out"
+		diff = "./testdata/scenarios/single_edit/diff.diff"
+	)
+
+	tests := map[string]struct {
+		coverageFile, diffFile, prevCovFile string
+		wantArg, wantPath                   string
+	}{
+		"coverage":          {"missing.out", diff, "", "coverage", "missing.out"},
+		"diff":              {cov, "missing.diff", "", "diff", "missing.diff"},
+		"previous coverage": {cov, diff, "missing-prev.out", "previous coverage", "missing-prev.out"},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			_, err := New(Config{}).ComputeFromFiles(tt.coverageFile, tt.diffFile, tt.prevCovFile)
+
+			var fileErr *FileError
+			assert.Assert(t, errors.As(err, &fileErr))
+			assert.Equal(t, fileErr.Arg, tt.wantArg)
+			assert.Equal(t, fileErr.Path, tt.wantPath)
+			assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+			assert.Error(t, err, tt.wantArg+" file not found: "+tt.wantPath)
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	const diff = "./testdata/scenarios/single_edit/diff.diff"
+	dir := t.TempDir()
+
+	tests := map[string]struct {
+		content string
+		wantErr string
+	}{
+		"empty":             {"", "empty file"},
+		"no profile lines":  {"hello\nworld\n", "bad mode line: hello"},
+		"bad profile lines": {"mode: set\nnot a profile line\n", `line "not a profile line" doesn't match expected format`},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			coverageFile := filepath.Join(dir, tn+".out")
+			assert.NilError(t, os.WriteFile(coverageFile, []byte(tt.content), 0o644))
+
+			_, err := New(Config{}).ComputeFromFiles(coverageFile, diff, "")
+
+			var parseErr *ParseError
+			assert.Assert(t, errors.As(err, &parseErr))
+			assert.Equal(t, parseErr.Path, coverageFile)
+			assert.ErrorContains(t, err, "parsing coverage profile "+coverageFile+": "+tt.wantErr)
+			assert.Equal(t, errors.Is(err, ErrEmptyProfile), tt.content == "")
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := New(Config{}).ComputeFromFiles(filepath.Join(dir, "missing.out"), diff, "")
+		var parseErr *ParseError
+		assert.Assert(t, !errors.As(err, &parseErr))
+		assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("header only", func(t *testing.T) {
+		coverageFile := filepath.Join(dir, "header.out")
+		assert.NilError(t, os.WriteFile(coverageFile, []byte("mode: set\n"), 0o644))
+		// A profile of no tested package is valid.
+		cov, err := New(Config{}).ComputeFromFiles(coverageFile, diff, "")
+		assert.NilError(t, err)
+		assert.Equal(t, cov.NumStmt, 0)
+	})
+}
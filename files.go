@@ -0,0 +1,113 @@
+package patchcover
+
+import (
+	"sort"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"golang.org/x/tools/cover"
+)
+
+// FileCoverage is the total and patch coverage of a changed file.
+type FileCoverage struct {
+	FileName        string  `json:"file"`
+	NumStmt         int     `json:"num_stmt"`
+	CoverCount      int     `json:"cover_count"`
+	Coverage        float64 `json:"coverage"`
+	PatchNumStmt    int     `json:"patch_num_stmt"`
+	PatchCoverCount int     `json:"patch_cover_count"`
+	PatchCoverage   float64 `json:"patch_coverage"`
+	// PrevNumStmt, PrevCoverCount and PrevCoverage are the coverage of the
+	// file in the previous coverage; zero when it is absent from it.
+	PrevNumStmt    int     `json:"prev_num_stmt,omitempty"`
+	PrevCoverCount int     `json:"prev_cover_count,omitempty"`
+	PrevCoverage   float64 `json:"prev_coverage,omitempty"`
+	// AddedLines and DeletedLines are the number of lines the diff adds to
+	// and deletes from the file.
+	AddedLines   int `json:"added_lines"`
+	DeletedLines int `json:"deleted_lines"`
+}
+
+// fileCoverage returns the coverage of every profile of a changed file,
+// listed in diffProfiles, sorted by file name, along with its coverage in
+// prevProfiles and the lines its diffFiles add and delete. Patch
+// statements are counted from patchLines. A block is covered when its
+// count reaches minHits.
+func fileCoverage(profiles, prevProfiles []*cover.Profile, diffFiles []*gitdiff.File, diffProfiles map[string]string, patchLines map[string][]Line, minHits int) []FileCoverage {
+	changed := make(map[string]bool, len(diffProfiles))
+	for _, profileName := range diffProfiles {
+		changed[profileName] = true
+	}
+	churn := make(map[string][2]int)
+	for _, f := range diffFiles {
+		if profileName, ok := diffProfiles[f.NewName]; ok {
+			added, deleted := lineChurn(f)
+			c := churn[profileName]
+			churn[profileName] = [2]int{c[0] + added, c[1] + deleted}
+		}
+	}
+
+	byFile := make(map[string]*FileCoverage)
+	for _, p := range profiles {
+		if !changed[p.FileName] {
+			continue
+		}
+		f, ok := byFile[p.FileName]
+		if !ok {
+			f = &FileCoverage{FileName: p.FileName, AddedLines: churn[p.FileName][0], DeletedLines: churn[p.FileName][1]}
+			byFile[p.FileName] = f
+			for _, line := range patchLines[p.FileName] {
+				f.PatchNumStmt += line.NumStmt
+				if line.Covered {
+					f.PatchCoverCount += line.NumStmt
+				}
+			}
+		}
+		for _, b := range p.Blocks {
+			f.NumStmt += b.NumStmt
+			if b.Count >= minHits {
+				f.CoverCount += b.NumStmt
+			}
+		}
+	}
+
+	for _, p := range prevProfiles {
+		f, ok := byFile[p.FileName]
+		if !ok {
+			continue
+		}
+		for _, b := range p.Blocks {
+			f.PrevNumStmt += b.NumStmt
+			if b.Count >= minHits {
+				f.PrevCoverCount += b.NumStmt
+			}
+		}
+	}
+
+	files := make([]FileCoverage, 0, len(byFile))
+	for _, f := range byFile {
+		f.Coverage = percentage(f.CoverCount, f.NumStmt)
+		f.PrevCoverage = percentage(f.PrevCoverCount, f.PrevNumStmt)
+		f.PatchCoverage = percentage(f.PatchCoverCount, f.PatchNumStmt)
+		if f.PatchNumStmt == 0 {
+			f.PatchCoverage = 100
+		}
+		files = append(files, *f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].FileName < files[j].FileName })
+	return files
+}
+
+// ChangedFilesCoverage returns the coverage of files taken together, and
+// their previous coverage, e.g. to compare the coverage of the changed
+// files of CoverageData.Files with their previous coverage. Files absent
+// from the previous coverage count for no previous statement.
+func ChangedFilesCoverage(files []FileCoverage) (coverage, prevCoverage float64) {
+	var numStmt, coverCount, prevNumStmt, prevCoverCount int
+	for _, f := range files {
+		numStmt += f.NumStmt
+		coverCount += f.CoverCount
+		prevNumStmt += f.PrevNumStmt
+		prevCoverCount += f.PrevCoverCount
+	}
+	return percentage(coverCount, numStmt), percentage(prevCoverCount, prevNumStmt)
+}
@@ -0,0 +1,47 @@
+package patchcover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestComputer_ComputeFromFiles_files(t *testing.T) {
+	dir := "./testdata/coverage-floor/"
+	cov, err := New(Config{Files: true, Precision: 1}).ComputeFromFiles(dir+"coverage.out", dir+"diff.diff", "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cov.Files, []FileCoverage{
+		{FileName: "example.com/m/pkg/big.go", NumStmt: 4, CoverCount: 4, Coverage: 100, PatchNumStmt: 4, PatchCoverCount: 4, PatchCoverage: 100, AddedLines: 9},
+		{FileName: "example.com/m/pkg/tiny.go", NumStmt: 2, PatchNumStmt: 2, AddedLines: 6},
+	})
+
+	// The previous coverage of changed files comes along.
+	prev := filepath.Join(t.TempDir(), "prev.out")
+	assert.NilError(t, os.WriteFile(prev, []byte("mode: set\nexample.com/m/pkg/tiny.go:3.18,6.2 2 1\nexample.com/m/pkg/other.go:3.18,6.2 2 1\n"), 0o644))
+	cov, err = New(Config{Files: true, Precision: 1}).ComputeFromFiles(dir+"coverage.out", dir+"diff.diff", prev)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cov.Files, []FileCoverage{
+		{FileName: "example.com/m/pkg/big.go", NumStmt: 4, CoverCount: 4, Coverage: 100, PatchNumStmt: 4, PatchCoverCount: 4, PatchCoverage: 100, AddedLines: 9},
+		{FileName: "example.com/m/pkg/tiny.go", NumStmt: 2, PatchNumStmt: 2, PrevNumStmt: 2, PrevCoverCount: 2, PrevCoverage: 100, AddedLines: 6},
+	})
+
+	cov, err = New(Config{}).ComputeFromFiles(dir+"coverage.out", dir+"diff.diff", "")
+	assert.NilError(t, err)
+	assert.Assert(t, cov.Files == nil)
+}
+
+func TestChangedFilesCoverage(t *testing.T) {
+	coverage, prevCoverage := ChangedFilesCoverage([]FileCoverage{
+		{NumStmt: 4, CoverCount: 3, PrevNumStmt: 2, PrevCoverCount: 1},
+		{NumStmt: 4, CoverCount: 3},
+	})
+	assert.Equal(t, coverage, 75.0)
+	assert.Equal(t, prevCoverage, 50.0)
+
+	// Invalid counts are clamped as the other percentages of the report.
+	coverage, prevCoverage = ChangedFilesCoverage([]FileCoverage{{NumStmt: 2, CoverCount: 3}})
+	assert.Equal(t, coverage, 100.0)
+	assert.Equal(t, prevCoverage, 0.0)
+}
@@ -0,0 +1,159 @@
+package patchcover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Formatter writes coverage data in an output format.
+type Formatter interface {
+	Format(data CoverageData, opts FormatOptions, out io.Writer) error
+}
+
+// FormatterFunc is a function used as a Formatter.
+type FormatterFunc func(data CoverageData, opts FormatOptions, out io.Writer) error
+
+// Format implements Formatter.
+func (f FormatterFunc) Format(data CoverageData, opts FormatOptions, out io.Writer) error {
+	return f(data, opts, out)
+}
+
+// FormatOptions holds the options of the output formats, e.g. set from
+// flags of go-patch-cover. Formats ignore the options of other formats.
+type FormatOptions struct {
+	// Template overrides the template of the template format.
+	Template string
+
+	// CommentTemplate overrides the markdown of the comment format.
+	CommentTemplate string
+
+	// Indent indents the JSON of the json and uncovered formats.
+	Indent bool
+
+	// CoberturaPatchOnly scopes the cobertura report to the patch.
+	CoberturaPatchOnly bool
+
+	// OmitProfileMode leaves the "mode:" header line out of the
+	// profile-subset format.
+	OmitProfileMode bool
+
+	// TAPResults are test points the tap format reports after those of the
+	// changed files, e.g. the coverage gates.
+	TAPResults []TAPResult
+
+	// Now is the generation time of the clover and cobertura reports.
+	// When zero, the current time is used.
+	Now time.Time
+}
+
+// now returns opts.Now, or the current time when it is zero.
+func (opts FormatOptions) now() time.Time {
+	if opts.Now.IsZero() {
+		return time.Now()
+	}
+	return opts.Now
+}
+
+// jsonEncoder returns an encoder of JSON to out, indented with
+// opts.Indent.
+func (opts FormatOptions) jsonEncoder(out io.Writer) *json.Encoder {
+	enc := json.NewEncoder(out)
+	if opts.Indent {
+		enc.SetIndent("", "  ")
+	}
+	return enc
+}
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = make(map[string]Formatter)
+)
+
+func init() {
+	for name, f := range map[string]FormatterFunc{
+		"json": func(data CoverageData, opts FormatOptions, out io.Writer) error {
+			return opts.jsonEncoder(out).Encode(data)
+		},
+		"ndjson": withoutOptions(RenderNDJSONOutput),
+		"uncovered": func(data CoverageData, opts FormatOptions, out io.Writer) error {
+			lines := data.UncoveredLines
+			if lines == nil {
+				lines = []UncoveredLine{}
+			}
+			return opts.jsonEncoder(out).Encode(lines)
+		},
+		"template": func(data CoverageData, opts FormatOptions, out io.Writer) error {
+			return RenderTemplateOutput(data, opts.Template, out)
+		},
+		"comment": func(data CoverageData, opts FormatOptions, out io.Writer) error {
+			return RenderCommentOutput(data, opts.CommentTemplate, out)
+		},
+		"clover": func(data CoverageData, opts FormatOptions, out io.Writer) error {
+			return RenderCloverOutput(data, opts.now(), out)
+		},
+		"cobertura": func(data CoverageData, opts FormatOptions, out io.Writer) error {
+			return RenderCoberturaOutput(data, opts.CoberturaPatchOnly, opts.now(), out)
+		},
+		"badge":    withoutOptions(RenderBadgeOutput),
+		"diff":     withoutOptions(RenderDiffOutput),
+		"html":     withoutOptions(RenderHTMLOutput),
+		"markdown": withoutOptions(RenderMarkdownOutput),
+		"sarif":    withoutOptions(RenderSARIFOutput),
+		"tap": func(data CoverageData, opts FormatOptions, out io.Writer) error {
+			return RenderTAPOutput(data, opts.TAPResults, out)
+		},
+		"profile-subset": func(data CoverageData, opts FormatOptions, out io.Writer) error {
+			return WriteProfiles(out, data.PatchProfiles, !opts.OmitProfileMode)
+		},
+	} {
+		RegisterFormatter(name, f)
+	}
+}
+
+// withoutOptions returns the FormatterFunc of a format taking no option.
+func withoutOptions(render func(data CoverageData, out io.Writer) error) FormatterFunc {
+	return func(data CoverageData, _ FormatOptions, out io.Writer) error {
+		return render(data, out)
+	}
+}
+
+// RegisterFormatter makes f available as the output format name, e.g. for
+// the -o flag of go-patch-cover. It panics when name is empty or already
+// registered. The built-in formats are json, ndjson, uncovered, template,
+// comment, clover, cobertura, badge, diff, html, markdown, sarif, tap
+// and profile-subset.
+func RegisterFormatter(name string, f Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	if name == "" || f == nil {
+		panic("patchcover: RegisterFormatter requires a name and a formatter")
+	}
+	if _, dup := formatters[name]; dup {
+		panic(fmt.Sprintf("patchcover: RegisterFormatter called twice for %q", name))
+	}
+	formatters[name] = f
+}
+
+// LookupFormatter returns the Formatter registered as name.
+func LookupFormatter(name string) (Formatter, bool) {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	f, ok := formatters[name]
+	return f, ok
+}
+
+// Formatters returns the names of the registered formats, sorted.
+func Formatters() []string {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,85 @@
+package patchcover
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRegisterFormatter(t *testing.T) {
+	// Registrations are global; skip it when the test runs again.
+	if _, ok := LookupFormatter("test-summary"); !ok {
+		RegisterFormatter("test-summary", FormatterFunc(func(data CoverageData, _ FormatOptions, out io.Writer) error {
+			_, err := fmt.Fprintf(out, "%d/%d\n", data.PatchCoverCount, data.PatchNumStmt)
+			return err
+		}))
+	}
+
+	f, ok := LookupFormatter("test-summary")
+	assert.Assert(t, ok)
+	var out bytes.Buffer
+	assert.NilError(t, f.Format(CoverageData{PatchNumStmt: 4, PatchCoverCount: 3}, FormatOptions{}, &out))
+	assert.Equal(t, out.String(), "3/4\n")
+	assert.Assert(t, contains(Formatters(), "test-summary"))
+
+	_, ok = LookupFormatter("missing")
+	assert.Assert(t, !ok)
+
+	assert.Assert(t, panics(func() { RegisterFormatter("json", withoutOptions(RenderBadgeOutput)) }))
+	assert.Assert(t, panics(func() { RegisterFormatter("", withoutOptions(RenderBadgeOutput)) }))
+}
+
+func TestFormatters_builtin(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("./testdata/scenarios/single_edit/coverage.out", "./testdata/scenarios/single_edit/diff.diff", "")
+	assert.NilError(t, err)
+	for _, name := range []string{"json", "ndjson", "uncovered", "template", "comment", "clover", "cobertura", "badge", "diff", "html", "markdown", "sarif", "tap", "profile-subset"} {
+		f, ok := LookupFormatter(name)
+		assert.Assert(t, ok, name)
+		var out bytes.Buffer
+		assert.NilError(t, f.Format(cov, FormatOptions{}, &out), name)
+		assert.Assert(t, out.Len() > 0, name)
+	}
+}
+
+func TestFormatters_options(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("./testdata/scenarios/single_edit/coverage.out", "./testdata/scenarios/single_edit/diff.diff", "")
+	assert.NilError(t, err)
+	format := func(name string, opts FormatOptions) string {
+		t.Helper()
+		f, ok := LookupFormatter(name)
+		assert.Assert(t, ok, name)
+		var out bytes.Buffer
+		assert.NilError(t, f.Format(cov, opts, &out), name)
+		return out.String()
+	}
+
+	assert.Assert(t, strings.HasPrefix(format("json", FormatOptions{Indent: true}), "{\n  \"report_schema_version\""))
+	assert.Equal(t, format("template", FormatOptions{Template: "{{ .PatchNumStmt }}"}), "23")
+	assert.Equal(t, format("comment", FormatOptions{CommentTemplate: "{{ .PatchCoverCount }}"}), "20")
+	assert.Assert(t, !strings.HasPrefix(format("profile-subset", FormatOptions{OmitProfileMode: true}), "mode:"))
+	assert.Assert(t, strings.Contains(format("tap", FormatOptions{TAPResults: []TAPResult{{OK: true, Description: "gate"}}}), "ok 2 - gate"))
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Assert(t, strings.Contains(format("cobertura", FormatOptions{Now: now}), `timestamp="1704164645000"`))
+	assert.Assert(t, format("cobertura", FormatOptions{Now: now, CoberturaPatchOnly: true}) != format("cobertura", FormatOptions{Now: now}))
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	f()
+	return false
+}
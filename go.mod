@@ -8,4 +8,4 @@ require (
 	gotest.tools/v3 v3.5.0
 )
 
-require github.com/google/go-cmp v0.5.9 // indirect
+require github.com/google/go-cmp v0.5.9
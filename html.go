@@ -0,0 +1,96 @@
+package patchcover
+
+import (
+	"html/template"
+	"io"
+)
+
+// htmlReportTmpl is the standalone page of RenderHTMLOutput. Its CSS is
+// inline so the page can be published as is, e.g. as a CI artifact.
+const htmlReportTmpl = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Patch coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #24292f; }
+table.summary { border-collapse: collapse; margin-bottom: 2em; }
+table.summary th, table.summary td { border: 1px solid #d0d7de; padding: 0.3em 0.8em; text-align: left; }
+h2 { font-size: 1em; font-family: monospace; margin: 1.5em 0 0.3em; }
+pre { margin: 0; border: 1px solid #d0d7de; overflow-x: auto; }
+pre span { display: block; padding: 0 0.5em; }
+.num { display: inline-block; width: 4em; color: #57606a; user-select: none; }
+.covered { background: #dafbe1; }
+.uncovered { background: #ffebe9; }
+</style>
+</head>
+<body>
+<h1>Patch coverage</h1>
+<table class="summary">
+<tr><th>Previous</th><td>{{ if .HasPrevCoverage }}{{ printf "%.1f" .PrevCoverage }}%{{ else }}unknown{{ end }}</td></tr>
+<tr><th>New</th><td>{{ printf "%.1f" .Coverage }}% ({{ .CoverCount }}/{{ .NumStmt }})</td></tr>
+<tr><th>Patch</th><td>{{ printf "%.1f" .PatchCoverage }}% ({{ .PatchCoverCount }}/{{ .PatchNumStmt }})</td></tr>
+</table>
+{{- range .Files }}
+<h2>{{ .Name }}</h2>
+<pre>
+{{- range .Lines }}<span class="{{ .Class }}"><span class="num">{{ .Num }}</span>{{ .Text }}</span>{{ end -}}
+</pre>
+{{- end }}
+</body>
+</html>
+`
+
+var htmlReport = template.Must(template.New("html_report").Parse(htmlReportTmpl))
+
+// htmlFile is a changed file of the HTML report.
+type htmlFile struct {
+	Name  string
+	Lines []htmlLine
+}
+
+// htmlLine is an added line of the HTML report, of class covered,
+// uncovered, or none when it counts in no patch statement.
+type htmlLine struct {
+	Num   int
+	Text  string
+	Class string
+}
+
+// RenderHTMLOutput writes a standalone HTML page of the coverage: the
+// previous, total and patch coverage, then the added lines of every
+// changed file, green when covered and red when not. Line contents are
+// escaped.
+func RenderHTMLOutput(data CoverageData, out io.Writer) error {
+	page := struct {
+		CoverageData
+		Files []htmlFile
+	}{CoverageData: data}
+
+	for _, f := range data.DiffFiles {
+		profileName, ok := data.DiffProfiles[f.NewName]
+		if !ok {
+			continue
+		}
+		covered := make(map[int]bool)
+		for _, l := range data.PatchLines[profileName] {
+			covered[l.LineNum] = l.Covered
+		}
+
+		hf := htmlFile{Name: f.NewName}
+		for _, frag := range f.TextFragments {
+			for _, a := range addedLines(frag) {
+				hl := htmlLine{Num: a.num, Text: lineString(a.line), Class: "none"}
+				if isCovered, ok := covered[a.num]; ok {
+					hl.Class = "uncovered"
+					if isCovered {
+						hl.Class = "covered"
+					}
+				}
+				hf.Lines = append(hf.Lines, hl)
+			}
+		}
+		page.Files = append(page.Files, hf)
+	}
+	return htmlReport.Execute(out, page)
+}
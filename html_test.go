@@ -0,0 +1,39 @@
+package patchcover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestRenderHTMLOutput(t *testing.T) {
+	profile := `mode: set
+example.com/m/a.go:3.14,5.2 1 1
+example.com/m/a.go:7.14,9.2 1 0
+`
+	diff := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4 +4 @@ func A() int {
+-	return 0
++	return "<b>" + 1
+@@ -7,0 +8,2 @@ func B() int {
++	return x & y
++	// done
+`
+	cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	assert.NilError(t, RenderHTMLOutput(cov, &buf))
+	golden.Assert(t, buf.String(), "report.golden.html")
+	out := buf.String()
+	// Source is escaped.
+	assert.Assert(t, strings.Contains(out, `<span class="covered"><span class="num">4</span>	return &#34;&lt;b&gt;&#34; &#43; 1</span>`), out)
+	assert.Assert(t, strings.Contains(out, `<span class="uncovered"><span class="num">8</span>	return x &amp; y</span>`), out)
+	assert.Assert(t, strings.Contains(out, `<span class="none"><span class="num">9</span>`), out)
+	assert.Assert(t, strings.Contains(out, "<tr><th>Previous</th><td>unknown</td></tr>"), out)
+}
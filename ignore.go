@@ -0,0 +1,85 @@
+package patchcover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readIgnoreFile reads the ignore file at path with parseIgnoreFile.
+func readIgnoreFile(path string) (map[string]map[int]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &FileError{Arg: "ignore", Path: path, Err: err}
+	}
+	defer f.Close()
+
+	ignored, err := parseIgnoreFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("ignore file %s: %w", path, err)
+	}
+	return ignored, nil
+}
+
+// parseIgnoreFile parses the lines to ignore, by normalized diff file name,
+// of an ignore file. Each entry is a file:line pair, where file is the path
+// of the file in the diff and line a line number or a start-end range of
+// line numbers. Blank lines and lines starting with # are skipped.
+func parseIgnoreFile(r io.Reader) (map[string]map[int]bool, error) {
+	ignored := make(map[string]map[int]bool)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		entry := strings.TrimSpace(s.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: invalid entry %q: expected file:line", n, entry)
+		}
+		start, end, err := parseLineRange(entry[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid entry %q: %w", n, entry, err)
+		}
+
+		name := strings.TrimPrefix(normalizeDiffName(entry[:i]), "./")
+		if ignored[name] == nil {
+			ignored[name] = make(map[int]bool)
+		}
+		for line := start; line <= end; line++ {
+			ignored[name][line] = true
+		}
+	}
+	return ignored, s.Err()
+}
+
+// hasMarker reports whether line holds one of the markers.
+func hasMarker(line string, markers []string) bool {
+	for _, marker := range markers {
+		if marker != "" && strings.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLineRange parses a line number or a start-end range of them.
+func parseLineRange(s string) (int, int, error) {
+	from, to := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		from, to = s[:i], s[i+1:]
+	}
+	start, err := strconv.Atoi(from)
+	if err != nil || start < 1 {
+		return 0, 0, fmt.Errorf("invalid line %q", from)
+	}
+	end, err := strconv.Atoi(to)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid line %q", to)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,76 @@
+package patchcover
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_parseIgnoreFile(t *testing.T) {
+	ignored, err := parseIgnoreFile(strings.NewReader(`# comment
+
+pkg/a.go:3
+./pkg/b.go:5-7
+pkg\c.go:1
+`))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ignored, map[string]map[int]bool{
+		"pkg/a.go": {3: true},
+		"pkg/b.go": {5: true, 6: true, 7: true},
+		"pkg/c.go": {1: true},
+	})
+
+	for entry, want := range map[string]string{
+		"pkg/a.go":     `line 1: invalid entry "pkg/a.go": expected file:line`,
+		"pkg/a.go:x":   `line 1: invalid entry "pkg/a.go:x": invalid line "x"`,
+		"pkg/a.go:0":   `line 1: invalid entry "pkg/a.go:0": invalid line "0"`,
+		"pkg/a.go:7-5": `line 1: invalid entry "pkg/a.go:7-5": invalid line "5"`,
+	} {
+		_, err := parseIgnoreFile(strings.NewReader(entry))
+		assert.Error(t, err, want)
+	}
+}
+
+func TestComputer_ComputeFromReaders_ignoreMarkers(t *testing.T) {
+	profile := `mode: set
+example.com/m/a.go:3.16,5.2 1 0
+example.com/m/a.go:7.16,9.2 1 0
+example.com/m/a.go:11.16,13.2 1 1
+`
+	diff := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4 +4 @@ func A() int {
+-	return 0
++	return 1 // TODO: cover the error case
+@@ -8 +8 @@ func B() int {
+-	return 0
++	return 2 //nocover
+@@ -12 +12 @@ func C() int {
+-	return 0
++	return 3
+`
+	compute := func(markers ...string) CoverageData {
+		t.Helper()
+		cov, err := New(Config{ModulePrefix: "example.com/m", IgnoreMarkers: markers}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+		assert.NilError(t, err)
+		return cov
+	}
+
+	cov := compute()
+	assert.Equal(t, cov.PatchNumStmt, 3)
+	assert.Equal(t, cov.PatchCoverCount, 1)
+
+	for marker, uncovered := range map[string]int{"// TODO": 8, "//nocover": 4} {
+		cov := compute(marker)
+		assert.Equal(t, cov.PatchNumStmt, 2, marker)
+		assert.Equal(t, cov.PatchCoverCount, 1, marker)
+		assert.Equal(t, len(cov.UncoveredLines), 1, marker)
+		assert.Equal(t, cov.UncoveredLines[0].LineNum, uncovered, marker)
+	}
+
+	cov = compute("// TODO", "//nocover")
+	assert.Equal(t, cov.PatchNumStmt, 1)
+	assert.Equal(t, cov.PatchCoverage, 100.0)
+}
@@ -0,0 +1,153 @@
+package patchcover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// lcovReader marks a coverage file in the lcov format, parsed by
+// parseProfiles with ParseLcovProfiles instead of as a go cover profile.
+type lcovReader struct {
+	io.Reader
+}
+
+// coverageFormat returns the format of the coverage file read from r: the
+// CoverageFormat of the Config when set, otherwise lcov for files named
+// *.info and go for others.
+func (c *Computer) coverageFormat(r io.Reader) (string, error) {
+	switch c.cfg.CoverageFormat {
+	case "go", "lcov":
+		return c.cfg.CoverageFormat, nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid coverage format %q: must be go or lcov", c.cfg.CoverageFormat)
+	}
+	if f, ok := r.(interface{ Name() string }); ok && filepath.Ext(f.Name()) == ".info" {
+		return "lcov", nil
+	}
+	return "go", nil
+}
+
+// ParseLcovProfiles parses an lcov tracefile, such as the .info files of
+// genhtml, Bazel or the coverage tools of other languages, into profiles
+// in count mode. Every line of a DA record becomes a block of its own,
+// spanning the whole line with one statement, whose count is the hits of
+// the line. Files are named by their SF record. LF and LH records, when
+// present, must match the DA records of their file; other records, such
+// as those of functions and branches, are ignored.
+func ParseLcovProfiles(r io.Reader) ([]*cover.Profile, error) {
+	byFile := make(map[string]map[int]int)
+	var (
+		fileName    string
+		hits        map[int]int
+		found, seen = -1, -1
+	)
+	endRecord := func(lineNum int) error {
+		if fileName == "" {
+			return nil
+		}
+		if found >= 0 && found != len(hits) {
+			return fmt.Errorf("lcov line %d: %s has LF:%d but %d DA lines", lineNum, fileName, found, len(hits))
+		}
+		if seen >= 0 {
+			covered := 0
+			for _, n := range hits {
+				if n > 0 {
+					covered++
+				}
+			}
+			if seen != covered {
+				return fmt.Errorf("lcov line %d: %s has LH:%d but %d DA lines hit", lineNum, fileName, seen, covered)
+			}
+		}
+		fileHits, ok := byFile[fileName]
+		if !ok {
+			fileHits = make(map[int]int)
+			byFile[fileName] = fileHits
+		}
+		for line, n := range hits {
+			fileHits[line] += n
+		}
+		fileName, hits, found, seen = "", nil, -1, -1
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "end_of_record" {
+			if err := endRecord(lineNum); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		kind, value := line[:colon], line[colon+1:]
+		if fileName == "" && (kind == "DA" || kind == "LF" || kind == "LH") {
+			return nil, fmt.Errorf("lcov line %d: %s record outside of a file record", lineNum, kind)
+		}
+		switch kind {
+		case "SF":
+			if err := endRecord(lineNum); err != nil {
+				return nil, err
+			}
+			fileName, hits = value, make(map[int]int)
+		case "DA":
+			fields := strings.Split(value, ",")
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("lcov line %d: invalid DA record %q", lineNum, value)
+			}
+			daLine, err := strconv.Atoi(fields[0])
+			if err != nil || daLine < 1 {
+				return nil, fmt.Errorf("lcov line %d: invalid DA line number %q", lineNum, fields[0])
+			}
+			n, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("lcov line %d: invalid DA hit count %q", lineNum, fields[1])
+			}
+			hits[daLine] += int(n)
+		case "LF", "LH":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("lcov line %d: invalid %s record %q", lineNum, kind, value)
+			}
+			if kind == "LF" {
+				found = n
+			} else {
+				seen = n
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// A last record without end_of_record is kept.
+	if err := endRecord(lineNum); err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*cover.Profile, 0, len(byFile))
+	for name, fileHits := range byFile {
+		p := &cover.Profile{FileName: name, Mode: "count", Blocks: make([]cover.ProfileBlock, 0, len(fileHits))}
+		for line, n := range fileHits {
+			p.Blocks = append(p.Blocks, cover.ProfileBlock{StartLine: line, StartCol: 1, EndLine: line, EndCol: math.MaxInt32, NumStmt: 1, Count: n})
+		}
+		sortBlocks(p.Blocks)
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].FileName < profiles[j].FileName })
+	return profiles, nil
+}
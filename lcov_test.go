@@ -0,0 +1,85 @@
+package patchcover
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseLcovProfiles(t *testing.T) {
+	profiles, err := ParseLcovProfiles(strings.NewReader(`TN:unit
+SF:pkg/b.go
+DA:4,0
+DA:3,2,checksum
+BRDA:3,0,0,1
+LF:2
+LH:1
+end_of_record
+SF:pkg/a.go
+DA:1,1
+end_of_record
+SF:pkg/b.go
+DA:3,1
+SF:pkg/c.go
+DA:7,0
+`))
+	assert.NilError(t, err)
+	line := func(n, count int) cover.ProfileBlock {
+		return cover.ProfileBlock{StartLine: n, StartCol: 1, EndLine: n, EndCol: math.MaxInt32, NumStmt: 1, Count: count}
+	}
+	assert.DeepEqual(t, profiles, []*cover.Profile{
+		{FileName: "pkg/a.go", Mode: "count", Blocks: []cover.ProfileBlock{line(1, 1)}},
+		// The records of a file add up.
+		{FileName: "pkg/b.go", Mode: "count", Blocks: []cover.ProfileBlock{line(3, 3), line(4, 0)}},
+		// The last record may lack its end_of_record.
+		{FileName: "pkg/c.go", Mode: "count", Blocks: []cover.ProfileBlock{line(7, 0)}},
+	})
+}
+
+func TestParseLcovProfiles_errors(t *testing.T) {
+	tests := map[string]struct {
+		lcov    string
+		wantErr string
+	}{
+		"DA outside of file": {lcov: "DA:1,1\n", wantErr: "lcov line 1: DA record outside of a file record"},
+		"invalid DA":         {lcov: "SF:a.go\nDA:1\n", wantErr: `lcov line 2: invalid DA record "1"`},
+		"invalid line":       {lcov: "SF:a.go\nDA:x,1\n", wantErr: `lcov line 2: invalid DA line number "x"`},
+		"invalid hits":       {lcov: "SF:a.go\nDA:1,-1\n", wantErr: `lcov line 2: invalid DA hit count "-1"`},
+		"invalid LF":         {lcov: "SF:a.go\nLF:x\n", wantErr: `lcov line 2: invalid LF record "x"`},
+		"LF mismatch":        {lcov: "SF:a.go\nDA:1,1\nLF:2\nend_of_record\n", wantErr: "lcov line 4: a.go has LF:2 but 1 DA lines"},
+		"LH mismatch":        {lcov: "SF:a.go\nDA:1,0\nLH:1\nend_of_record\n", wantErr: "lcov line 4: a.go has LH:1 but 0 DA lines hit"},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			_, err := ParseLcovProfiles(strings.NewReader(tt.lcov))
+			assert.Error(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestComputer_ComputeFromFiles_lcov(t *testing.T) {
+	c := New(Config{Extensions: []string{".py"}})
+	cov, err := c.ComputeFromFiles("testdata/lcov/coverage.info", "testdata/lcov/diff.diff", "")
+	assert.NilError(t, err)
+	assert.Equal(t, cov.Mode, "count")
+	assert.Equal(t, cov.NumStmt, 5)
+	assert.Equal(t, cov.CoverCount, 3)
+	assert.Equal(t, cov.PatchNumStmt, 3)
+	assert.Equal(t, cov.PatchCoverCount, 2)
+	// Zero-hit lines are uncovered.
+	assert.Equal(t, len(cov.UncoveredLines), 1)
+	assert.Equal(t, cov.UncoveredLines[0].FileName, "/home/ci/repo/pkg/calc.py")
+	assert.Equal(t, cov.UncoveredLines[0].LineNum, 6)
+
+	// Otherwise the file would be parsed as a go cover profile.
+	c = New(Config{Extensions: []string{".py"}, CoverageFormat: "go"})
+	_, err = c.ComputeFromFiles("testdata/lcov/coverage.info", "testdata/lcov/diff.diff", "")
+	assert.ErrorContains(t, err, "bad mode line")
+
+	c = New(Config{CoverageFormat: "cobertura"})
+	_, err = c.ComputeFromFiles("testdata/lcov/coverage.info", "testdata/lcov/diff.diff", "")
+	assert.Error(t, err, `invalid coverage format "cobertura": must be go or lcov`)
+}
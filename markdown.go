@@ -0,0 +1,64 @@
+package patchcover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// RenderMarkdownOutput writes a GitHub-flavored markdown table of the
+// previous, new and patch coverage, its columns padded to line up, then a
+// collapsible <details> block of the uncovered lines grouped by file.
+// Unlike the html output, it is meant to be pasted into comments, pull
+// request descriptions or chat messages.
+func RenderMarkdownOutput(data CoverageData, out io.Writer) error {
+	prev := "unknown"
+	if data.HasPrevCoverage {
+		prev = fmt.Sprintf("%.1f%%", data.PrevCoverage)
+	}
+	rows := [][2]string{
+		{"Coverage", "Value"},
+		{"Previous", prev},
+		{"New", fmt.Sprintf("%.1f%%", data.Coverage)},
+		{"Patch", fmt.Sprintf("%.1f%% (%d/%d)", data.PatchCoverage, data.PatchCoverCount, data.PatchNumStmt)},
+	}
+	var widths [2]int
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	writeRow := func(row [2]string) {
+		fmt.Fprintf(w, "| %-*s | %-*s |\n", widths[0], row[0], widths[1], row[1])
+	}
+	writeRow(rows[0])
+	fmt.Fprintf(w, "|%s|%s|\n", strings.Repeat("-", widths[0]+2), strings.Repeat("-", widths[1]+2))
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+
+	if len(data.UncoveredLines) > 0 {
+		var files []string
+		lines := make(map[string][]string)
+		for _, l := range data.UncoveredLines {
+			if _, ok := lines[l.FileName]; !ok {
+				files = append(files, l.FileName)
+			}
+			lines[l.FileName] = append(lines[l.FileName], strconv.Itoa(l.LineNum))
+		}
+
+		fmt.Fprintf(w, "\n<details>\n<summary>Uncovered lines (%d)</summary>\n\n", len(data.UncoveredLines))
+		for _, f := range files {
+			fmt.Fprintf(w, "- `%s`: %s\n", f, strings.Join(lines[f], ", "))
+		}
+		fmt.Fprintln(w, "\n</details>")
+	}
+	return w.Flush()
+}
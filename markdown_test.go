@@ -0,0 +1,63 @@
+package patchcover
+
+import (
+	"bytes"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestRenderMarkdownOutput(t *testing.T) {
+	const (
+		cov  = "testdata/scenarios/new_file/coverage.out"
+		diff = "testdata/scenarios/new_file/diff.diff"
+	)
+
+	tests := map[string]struct {
+		prevCovFile string
+		golden      string
+	}{
+		"previous coverage":    {cov, "markdown.golden.md"},
+		"no previous coverage": {"", "markdown-no-prev.golden.md"},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			data, err := New(Config{}).ComputeFromFiles(cov, diff, tt.prevCovFile)
+			assert.NilError(t, err)
+
+			var buf bytes.Buffer
+			assert.NilError(t, RenderMarkdownOutput(data, &buf))
+			golden.Assert(t, buf.String(), tt.golden)
+		})
+	}
+
+	var buf bytes.Buffer
+	assert.NilError(t, RenderMarkdownOutput(CoverageData{
+		HasPrevCoverage: true,
+		PrevCoverage:    50,
+		Coverage:        60,
+		PatchCoverage:   50,
+		PatchCoverCount: 2,
+		PatchNumStmt:    4,
+		UncoveredLines: []UncoveredLine{
+			{FileName: "pkg/a.go", LineNum: 3},
+			{FileName: "pkg/b.go", LineNum: 7},
+			{FileName: "pkg/a.go", LineNum: 9},
+		},
+	}, &buf))
+	assert.Equal(t, buf.String(), `| Coverage | Value       |
+|----------|-------------|
+| Previous | 50.0%       |
+| New      | 60.0%       |
+| Patch    | 50.0% (2/4) |
+
+<details>
+<summary>Uncovered lines (3)</summary>
+
+- `+"`pkg/a.go`"+`: 3, 9
+- `+"`pkg/b.go`"+`: 7
+
+</details>
+`)
+}
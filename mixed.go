@@ -0,0 +1,140 @@
+package patchcover
+
+import (
+	"os"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// CoverageSource is a coverage adapter for the files of one language of a
+// mixed repository, e.g. Go code along with gRPC stubs generated in another
+// language. Computer.ComputeSources combines the coverage of several of
+// them into one report. Computer.GoSource returns the adapter of Go
+// coverage profiles; adapters of other languages typically read the
+// coverage report of their test runner.
+type CoverageSource interface {
+	// Name labels the source in CoverageData.Sources, e.g. "go".
+	Name() string
+
+	// Matches reports whether the source covers the file at diffName, a
+	// repository relative path taken from the diff.
+	Matches(diffName string) bool
+
+	// Coverage returns the coverage of the source: its total coverage,
+	// and the patch coverage of diffFiles, the changed files it matches.
+	// Percentages are computed by ComputeSources and may be left zero.
+	Coverage(diffFiles []*gitdiff.File) (SourceCoverage, error)
+}
+
+// SourceCoverage is the coverage of the files of a CoverageSource.
+type SourceCoverage struct {
+	Source          string          `json:"source"`
+	NumStmt         int             `json:"num_stmt"`
+	CoverCount      int             `json:"cover_count"`
+	Coverage        float64         `json:"coverage"`
+	PatchNumStmt    int             `json:"patch_num_stmt"`
+	PatchCoverCount int             `json:"patch_cover_count"`
+	PatchCoverage   float64         `json:"patch_coverage"`
+	UncoveredLines  []UncoveredLine `json:"uncovered,omitempty"`
+}
+
+// ComputeSources computes the coverage of a mixed repository from a diff
+// file and one CoverageSource per language. Every changed file is given to
+// the first source matching it. The statements of all sources add up in
+// the total and patch coverage, and CoverageData.Sources holds the
+// coverage of each of them, in order.
+func (c *Computer) ComputeSources(diffFile string, sources []CoverageSource) (CoverageData, error) {
+	patch, err := os.Open(diffFile)
+	if err != nil {
+		return CoverageData{}, &FileError{Arg: "diff", Path: diffFile, Err: err}
+	}
+	defer patch.Close()
+
+	files, err := parseDiff(patch)
+	if err != nil {
+		return CoverageData{}, err
+	}
+
+	var data CoverageData
+	matched := make(map[*gitdiff.File]bool)
+	for _, src := range sources {
+		var srcFiles []*gitdiff.File
+		for _, f := range files {
+			if !matched[f] && src.Matches(f.NewName) {
+				matched[f] = true
+				srcFiles = append(srcFiles, f)
+			}
+		}
+		sc, err := src.Coverage(srcFiles)
+		if err != nil {
+			return CoverageData{}, err
+		}
+		sc.Source = src.Name()
+		sc.Coverage = c.sourcePercentage(sc.CoverCount, sc.NumStmt, false)
+		sc.PatchCoverage = c.sourcePercentage(sc.PatchCoverCount, sc.PatchNumStmt, true)
+		data.Sources = append(data.Sources, sc)
+
+		data.NumStmt += sc.NumStmt
+		data.CoverCount += sc.CoverCount
+		data.PatchNumStmt += sc.PatchNumStmt
+		data.PatchCoverCount += sc.PatchCoverCount
+		data.UncoveredLines = append(data.UncoveredLines, sc.UncoveredLines...)
+	}
+	data.Coverage = c.sourcePercentage(data.CoverCount, data.NumStmt, false)
+	data.PatchCoverage = c.sourcePercentage(data.PatchCoverCount, data.PatchNumStmt, true)
+	return data, nil
+}
+
+// sourcePercentage returns covered/total as a percentage rounded to the
+// configured Precision. A patch without statements is 100% covered, as in
+// computeCoverage.
+func (c *Computer) sourcePercentage(covered, total int, patch bool) float64 {
+	if patch && total == 0 {
+		return 100
+	}
+	p := percentage(covered, total)
+	if c.cfg.Precision > 0 {
+		p = round(p, c.cfg.Precision)
+	}
+	return p
+}
+
+// goSource is the CoverageSource of a Go coverage profile.
+type goSource struct {
+	c            *Computer
+	coverageFile string
+}
+
+// GoSource returns the CoverageSource of the Go coverage profile
+// coverageFile, matching the files of the Config Extensions, .go by
+// default, and computing their coverage with the Config of c. No uncovered
+// or covered lines report is written.
+func (c *Computer) GoSource(coverageFile string) CoverageSource {
+	cfg := c.cfg
+	cfg.UncoveredOut, cfg.CoveredOut = "", ""
+	return &goSource{c: New(cfg), coverageFile: coverageFile}
+}
+
+func (s *goSource) Name() string { return "go" }
+
+func (s *goSource) Matches(diffName string) bool {
+	extensions := s.c.cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = []string{".go"}
+	}
+	return hasExtension(diffName, extensions)
+}
+
+func (s *goSource) Coverage(diffFiles []*gitdiff.File) (SourceCoverage, error) {
+	d, err := s.c.computeFromProfileFiles(parsedDiff(diffFiles), s.coverageFile, "")
+	if err != nil {
+		return SourceCoverage{}, err
+	}
+	return SourceCoverage{
+		NumStmt:         d.NumStmt,
+		CoverCount:      d.CoverCount,
+		PatchNumStmt:    d.PatchNumStmt,
+		PatchCoverCount: d.PatchCoverCount,
+		UncoveredLines:  d.UncoveredLines,
+	}, nil
+}
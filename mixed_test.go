@@ -0,0 +1,107 @@
+package patchcover
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"gotest.tools/v3/assert"
+)
+
+// pySource is a CoverageSource of Python files, covering the lines of
+// hits, by file name.
+type pySource struct {
+	hits  map[string]map[int]bool
+	files []string
+}
+
+func (s *pySource) Name() string { return "python" }
+
+func (s *pySource) Matches(diffName string) bool { return strings.HasSuffix(diffName, ".py") }
+
+func (s *pySource) Coverage(diffFiles []*gitdiff.File) (SourceCoverage, error) {
+	var sc SourceCoverage
+	for _, lines := range s.hits {
+		for _, covered := range lines {
+			sc.NumStmt++
+			if covered {
+				sc.CoverCount++
+			}
+		}
+	}
+	for _, f := range diffFiles {
+		s.files = append(s.files, f.NewName)
+		for _, frag := range f.TextFragments {
+			for _, added := range addedLines(frag) {
+				covered, ok := s.hits[f.NewName][added.num]
+				if !ok {
+					continue
+				}
+				sc.PatchNumStmt++
+				if covered {
+					sc.PatchCoverCount++
+				} else {
+					sc.UncoveredLines = append(sc.UncoveredLines, UncoveredLine{FileName: f.NewName, LineNum: added.num})
+				}
+			}
+		}
+	}
+	return sc, nil
+}
+
+func TestComputer_ComputeSources(t *testing.T) {
+	dir := t.TempDir()
+	covFile, diffFile := filepath.Join(dir, "coverage.out"), filepath.Join(dir, "diff.diff")
+	assert.NilError(t, os.WriteFile(covFile, []byte(`mode: set
+example.com/m/a.go:3.14,5.2 1 1
+example.com/m/a.go:7.14,9.2 1 0
+`), 0o644))
+	assert.NilError(t, os.WriteFile(diffFile, []byte(`diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4 +4 @@ func A() int {
+-	return 0
++	return 1
+diff --git a/stubs/api_pb2.py b/stubs/api_pb2.py
+--- a/stubs/api_pb2.py
++++ b/stubs/api_pb2.py
+@@ -1,0 +2,2 @@
++x = 1
++y = 2
+`), 0o644))
+
+	c := New(Config{Precision: 1})
+	py := &pySource{hits: map[string]map[int]bool{
+		"stubs/api_pb2.py": {1: true, 2: true, 3: false},
+	}}
+	cov, err := c.ComputeSources(diffFile, []CoverageSource{c.GoSource(covFile), py})
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, py.files, []string{"stubs/api_pb2.py"})
+	assert.Equal(t, len(cov.Sources), 2)
+	goCov, pyCov := cov.Sources[0], cov.Sources[1]
+	assert.DeepEqual(t, goCov, SourceCoverage{Source: "go", NumStmt: 2, CoverCount: 1, Coverage: 50, PatchNumStmt: 1, PatchCoverCount: 1, PatchCoverage: 100})
+	assert.Equal(t, pyCov.Source, "python")
+	assert.Equal(t, pyCov.Coverage, 66.7)
+	assert.Equal(t, pyCov.PatchNumStmt, 2)
+	assert.Equal(t, pyCov.PatchCoverCount, 1)
+	assert.Equal(t, pyCov.PatchCoverage, 50.0)
+
+	// The aggregate combines the statements of both sources.
+	assert.Equal(t, cov.NumStmt, 5)
+	assert.Equal(t, cov.CoverCount, 3)
+	assert.Equal(t, cov.Coverage, 60.0)
+	assert.Equal(t, cov.PatchNumStmt, 3)
+	assert.Equal(t, cov.PatchCoverCount, 2)
+	assert.Equal(t, cov.PatchCoverage, 66.7)
+	assert.DeepEqual(t, cov.UncoveredLines, []UncoveredLine{{FileName: "stubs/api_pb2.py", LineNum: 3}})
+
+	// Without changed files, the patch is fully covered.
+	assert.NilError(t, os.WriteFile(diffFile, nil, 0o644))
+	cov, err = c.ComputeSources(diffFile, []CoverageSource{c.GoSource(covFile), &pySource{}})
+	assert.NilError(t, err)
+	assert.Equal(t, cov.PatchCoverage, 100.0)
+	assert.Equal(t, cov.Sources[1].PatchCoverage, 100.0)
+}
@@ -0,0 +1,182 @@
+package patchcover
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// moduleResolver finds the Go module of repository relative files by
+// walking up from their directory to the nearest go.mod. Lookups are
+// cached per directory.
+type moduleResolver struct {
+	root string
+	dirs map[string]string // directory -> module path, "" when none
+}
+
+func newModuleResolver(root string) *moduleResolver {
+	return &moduleResolver{root: root, dirs: make(map[string]string)}
+}
+
+// profileName returns the name coverage profiles use for the file at
+// diffName: its path within the module, prefixed by the module path. It
+// returns false when the file is not inside a module.
+func (r *moduleResolver) profileName(diffName string) (string, bool) {
+	diffName = normalizeDiffName(diffName)
+	for dir := path.Dir(diffName); ; dir = path.Dir(dir) {
+		if modulePath := r.modulePath(dir); modulePath != "" {
+			rel := diffName
+			if dir != "." {
+				rel = strings.TrimPrefix(diffName, dir+"/")
+			}
+			return modulePath + "/" + rel, true
+		}
+		if dir == "." || dir == "/" {
+			return "", false
+		}
+	}
+}
+
+// modulePath returns the path declared by the go.mod of dir, or "" when
+// dir has none.
+func (r *moduleResolver) modulePath(dir string) string {
+	if modulePath, ok := r.dirs[dir]; ok {
+		return modulePath
+	}
+	modulePath := ""
+	if gomod, err := os.ReadFile(filepath.Join(r.root, filepath.FromSlash(dir), "go.mod")); err == nil {
+		modulePath = parseModulePath(gomod)
+	}
+	r.dirs[dir] = modulePath
+	return modulePath
+}
+
+var (
+	workingModulesMu sync.Mutex
+	workingModules   = make(map[string]string) // working directory -> module path
+)
+
+// workingModulePath returns the module path of the nearest go.mod, walking
+// up from the working directory, or "" when there is none. Results are
+// cached per working directory.
+func workingModulePath() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	workingModulesMu.Lock()
+	defer workingModulesMu.Unlock()
+	if modulePath, ok := workingModules[wd]; ok {
+		return modulePath
+	}
+	modulePath := ""
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if gomod, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			modulePath = parseModulePath(gomod)
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	workingModules[wd] = modulePath
+	return modulePath
+}
+
+// parseModulePath returns the path of the module directive of a go.mod
+// file, or "" when it has none.
+func parseModulePath(gomod []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(gomod))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		return unquote(fields[1])
+	}
+	return ""
+}
+
+// moduleReplace is a replace directive of a module by a local directory.
+type moduleReplace struct {
+	modulePath string
+	// dir is slash separated and relative to the working directory.
+	dir string
+}
+
+// parseLocalReplaces returns the replace directives of a go.mod file whose
+// replacement is a local directory, longest module path first. dir is the
+// directory of the go.mod file, which relative replacements are resolved
+// against.
+func parseLocalReplaces(gomod []byte, dir string) []moduleReplace {
+	var replaces []moduleReplace
+	inBlock := false
+	s := bufio.NewScanner(bytes.NewReader(gomod))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+
+		switch {
+		case line == "replace (":
+			inBlock = true
+			continue
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case strings.HasPrefix(line, "replace "):
+			line = strings.TrimPrefix(line, "replace ")
+		case !inBlock:
+			continue
+		}
+
+		// old [version] => new [version]
+		sides := strings.SplitN(line, "=>", 2)
+		if len(sides) != 2 {
+			continue
+		}
+		old, target := strings.Fields(sides[0]), strings.Fields(sides[1])
+		if len(old) == 0 || len(target) != 1 {
+			// Replacements by another module have a version.
+			continue
+		}
+		local := unquote(target[0])
+		if !strings.HasPrefix(local, "./") && !strings.HasPrefix(local, "../") {
+			continue
+		}
+		replaces = append(replaces, moduleReplace{modulePath: unquote(old[0]), dir: path.Join(dir, local)})
+	}
+
+	sort.SliceStable(replaces, func(i, j int) bool { return len(replaces[i].modulePath) > len(replaces[j].modulePath) })
+	return replaces
+}
+
+// replacedPath returns the local path of a profile file name of a replaced
+// module.
+func replacedPath(replaces []moduleReplace, profileName string) (string, bool) {
+	for _, r := range replaces {
+		if rel := strings.TrimPrefix(profileName, r.modulePath+"/"); rel != profileName {
+			return path.Join(r.dir, rel), true
+		}
+	}
+	return "", false
+}
+
+func unquote(s string) string {
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s
+}
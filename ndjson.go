@@ -0,0 +1,99 @@
+package patchcover
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+type ndjsonHeader struct {
+	Type                string `json:"type"`
+	ReportSchemaVersion int    `json:"report_schema_version"`
+	ToolVersion         string `json:"tool_version,omitempty"`
+	Files               int    `json:"files"`
+}
+
+type ndjsonFile struct {
+	Type            string          `json:"type"`
+	FileName        string          `json:"file"`
+	PatchNumStmt    int             `json:"patch_num_stmt"`
+	PatchCoverCount int             `json:"patch_cover_count"`
+	PatchCoverage   float64         `json:"patch_coverage"`
+	Uncovered       []UncoveredLine `json:"uncovered,omitempty"`
+}
+
+type ndjsonSummary struct {
+	Type            string  `json:"type"`
+	NumStmt         int     `json:"num_stmt"`
+	CoverCount      int     `json:"cover_count"`
+	Coverage        float64 `json:"coverage"`
+	PatchNumStmt    int     `json:"patch_num_stmt"`
+	PatchCoverCount int     `json:"patch_cover_count"`
+	PatchCoverage   float64 `json:"patch_coverage"`
+	HasPrevCoverage bool    `json:"has_prev_coverage"`
+	PrevNumStmt     int     `json:"prev_num_stmt"`
+	PrevCoverCount  int     `json:"prev_cover_count"`
+	PrevCoverage    float64 `json:"prev_coverage"`
+	Incomplete      bool    `json:"incomplete,omitempty"`
+}
+
+// RenderNDJSONOutput writes the coverage as newline delimited JSON, for
+// consumers processing reports incrementally. The first record, of type
+// "header", holds the report schema version and the number of file
+// records following it. Each "file" record holds the patch coverage and
+// uncovered lines of one changed file, by file name. The last record, of
+// type "summary", holds the total, patch and previous coverage; its patch
+// statement counts are the sums of those of the file records.
+func RenderNDJSONOutput(data CoverageData, out io.Writer) error {
+	fileNames := make([]string, 0, len(data.PatchLines))
+	for fileName := range data.PatchLines {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	uncovered := make(map[string][]UncoveredLine)
+	for _, l := range data.UncoveredLines {
+		uncovered[l.FileName] = append(uncovered[l.FileName], l)
+	}
+
+	enc := json.NewEncoder(out)
+	if err := enc.Encode(ndjsonHeader{
+		Type:                "header",
+		ReportSchemaVersion: ReportSchemaVersion,
+		ToolVersion:         data.ToolVersion,
+		Files:               len(fileNames),
+	}); err != nil {
+		return err
+	}
+
+	for _, fileName := range fileNames {
+		f := ndjsonFile{Type: "file", FileName: fileName, Uncovered: uncovered[fileName]}
+		for _, line := range data.PatchLines[fileName] {
+			f.PatchNumStmt += line.NumStmt
+			if line.Covered {
+				f.PatchCoverCount += line.NumStmt
+			}
+		}
+		if f.PatchNumStmt > 0 {
+			f.PatchCoverage = float64(f.PatchCoverCount) / float64(f.PatchNumStmt) * 100
+		}
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+
+	return enc.Encode(ndjsonSummary{
+		Type:            "summary",
+		NumStmt:         data.NumStmt,
+		CoverCount:      data.CoverCount,
+		Coverage:        data.Coverage,
+		PatchNumStmt:    data.PatchNumStmt,
+		PatchCoverCount: data.PatchCoverCount,
+		PatchCoverage:   data.PatchCoverage,
+		HasPrevCoverage: data.HasPrevCoverage,
+		PrevNumStmt:     data.PrevNumStmt,
+		PrevCoverCount:  data.PrevCoverCount,
+		PrevCoverage:    data.PrevCoverage,
+		Incomplete:      data.Incomplete,
+	})
+}
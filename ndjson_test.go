@@ -0,0 +1,69 @@
+package patchcover
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRenderNDJSONOutput(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("./testdata/scenarios/single_edit/coverage.out", "./testdata/scenarios/single_edit/diff.diff", "./testdata/scenarios/single_edit/coverage.out")
+	assert.NilError(t, err)
+	cov.ToolVersion = "1.0.0"
+
+	var buf bytes.Buffer
+	assert.NilError(t, RenderNDJSONOutput(cov, &buf))
+
+	type record struct {
+		Type                string          `json:"type"`
+		ReportSchemaVersion int             `json:"report_schema_version"`
+		ToolVersion         string          `json:"tool_version"`
+		Files               int             `json:"files"`
+		FileName            string          `json:"file"`
+		PatchNumStmt        int             `json:"patch_num_stmt"`
+		PatchCoverCount     int             `json:"patch_cover_count"`
+		PatchCoverage       float64         `json:"patch_coverage"`
+		Coverage            float64         `json:"coverage"`
+		HasPrevCoverage     bool            `json:"has_prev_coverage"`
+		Uncovered           []UncoveredLine `json:"uncovered"`
+	}
+	var records []record
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		var r record
+		assert.NilError(t, json.Unmarshal(s.Bytes(), &r), s.Text())
+		records = append(records, r)
+	}
+	assert.NilError(t, s.Err())
+	assert.Assert(t, len(records) >= 3)
+
+	header, files, summary := records[0], records[1:len(records)-1], records[len(records)-1]
+	assert.Equal(t, header.Type, "header")
+	assert.Equal(t, header.ReportSchemaVersion, ReportSchemaVersion)
+	assert.Equal(t, header.ToolVersion, "1.0.0")
+	assert.Equal(t, header.Files, len(files))
+
+	// The summary is reconstructed from the file records.
+	var patchNumStmt, patchCoverCount, uncovered int
+	for _, f := range files {
+		assert.Equal(t, f.Type, "file")
+		assert.Assert(t, f.FileName != "")
+		patchNumStmt += f.PatchNumStmt
+		patchCoverCount += f.PatchCoverCount
+		for _, l := range f.Uncovered {
+			assert.Equal(t, l.FileName, f.FileName)
+		}
+		uncovered += len(f.Uncovered)
+	}
+	assert.Equal(t, summary.Type, "summary")
+	assert.Equal(t, summary.PatchNumStmt, patchNumStmt)
+	assert.Equal(t, summary.PatchCoverCount, patchCoverCount)
+	assert.Equal(t, summary.PatchCoverage, float64(patchCoverCount)/float64(patchNumStmt)*100)
+	assert.Equal(t, summary.PatchCoverage, cov.PatchCoverage)
+	assert.Equal(t, summary.Coverage, cov.Coverage)
+	assert.Assert(t, summary.HasPrevCoverage)
+	assert.Equal(t, uncovered, len(cov.UncoveredLines))
+}
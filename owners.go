@@ -0,0 +1,111 @@
+package patchcover
+
+import (
+	"sort"
+	"strings"
+)
+
+// OwnerCoverage is the patch coverage of the changed files of a code owner.
+type OwnerCoverage struct {
+	// Owner is the team or user owning the files, e.g. "@org/team", or ""
+	// for files without an owner.
+	Owner           string          `json:"owner"`
+	PatchNumStmt    int             `json:"patch_num_stmt"`
+	PatchCoverCount int             `json:"patch_cover_count"`
+	PatchCoverage   float64         `json:"patch_coverage"`
+	UncoveredLines  []UncoveredLine `json:"uncovered,omitempty"`
+}
+
+// codeOwnersRule is an entry of a CODEOWNERS file.
+type codeOwnersRule struct {
+	rule   ignoreRule
+	owners []string
+}
+
+// parseCodeOwners parses the lines of a CODEOWNERS file: a pattern, in the
+// syntax of .gitignore files, followed by its owners. Blank lines and
+// comments are skipped; a pattern without owners leaves files unowned.
+func parseCodeOwners(lines []string) []codeOwnersRule {
+	var rules []codeOwnersRule
+	for _, line := range lines {
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		parsed := parseIgnoreRules(fields[:1])
+		if len(parsed) == 0 {
+			continue
+		}
+		rules = append(rules, codeOwnersRule{rule: parsed[0], owners: fields[1:]})
+	}
+	return rules
+}
+
+// fileOwners returns the owners of the repository relative file name: those
+// of the last matching rule, as GitHub does.
+func fileOwners(rules []codeOwnersRule, name string) []string {
+	var owners []string
+	for _, r := range rules {
+		if r.rule.matches(name) {
+			owners = r.owners
+		}
+	}
+	return owners
+}
+
+// ownerCoverage returns the patch coverage of every owner of changed files,
+// sorted by owner, files without an owner coming first. Files are matched
+// against rules by their diff name, mapped to their profile file name by
+// diffProfiles. A file with several owners counts for each of them.
+func ownerCoverage(rules []codeOwnersRule, diffProfiles map[string]string, patchLines map[string][]Line, uncovered []UncoveredLine) []OwnerCoverage {
+	owners := make(map[string][]string) // profile file name -> owners
+	for diffName, profileName := range diffProfiles {
+		fileOwners := fileOwners(rules, strings.TrimPrefix(normalizeDiffName(diffName), "./"))
+		if len(fileOwners) == 0 {
+			fileOwners = []string{""}
+		}
+		owners[profileName] = fileOwners
+	}
+
+	byOwner := make(map[string]*OwnerCoverage)
+	forOwners := func(profileName string, f func(*OwnerCoverage)) {
+		for _, owner := range owners[profileName] {
+			o, ok := byOwner[owner]
+			if !ok {
+				o = &OwnerCoverage{Owner: owner}
+				byOwner[owner] = o
+			}
+			f(o)
+		}
+	}
+	for profileName, lines := range patchLines {
+		forOwners(profileName, func(o *OwnerCoverage) {
+			for _, line := range lines {
+				o.PatchNumStmt += line.NumStmt
+				if line.Covered {
+					o.PatchCoverCount += line.NumStmt
+				}
+			}
+		})
+	}
+	for _, l := range uncovered {
+		l := l
+		forOwners(l.FileName, func(o *OwnerCoverage) {
+			o.UncoveredLines = append(o.UncoveredLines, l)
+		})
+	}
+
+	result := make([]OwnerCoverage, 0, len(byOwner))
+	for _, o := range byOwner {
+		o.PatchCoverage = 100
+		if o.PatchNumStmt > 0 {
+			o.PatchCoverage = percentage(o.PatchCoverCount, o.PatchNumStmt)
+		}
+		result = append(result, *o)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Owner < result[j].Owner })
+	return result
+}
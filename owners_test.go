@@ -0,0 +1,65 @@
+package patchcover
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_fileOwners(t *testing.T) {
+	rules := parseCodeOwners(strings.Split(`# Default owners.
+*                @org/all
+*.md             @org/docs # trailing comment
+/internal/       @org/core @alice
+internal/gen/
+`, "\n"))
+
+	tests := map[string][]string{
+		"main.go":                 {"@org/all"},
+		"docs/README.md":          {"@org/docs"},
+		"internal/store/store.go": {"@org/core", "@alice"},
+		"pkg/internal/x.go":       {"@org/all"},
+		"internal/gen/gen.go":     {},
+	}
+	for name, want := range tests {
+		assert.DeepEqual(t, fileOwners(rules, name), want)
+	}
+}
+
+func TestComputer_ComputeFromFiles_codeOwners(t *testing.T) {
+	dir := "./testdata/coverage-floor/"
+	owners := []string{
+		"pkg/ @org/pkg",
+		"big.go @org/big @alice",
+		"/pkg/tiny.go",
+	}
+	cov, err := New(Config{CodeOwners: owners, Precision: 1}).ComputeFromFiles(dir+"coverage.out", dir+"diff.diff", "")
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(cov.ByOwner), 3)
+	unowned, alice, big := cov.ByOwner[0], cov.ByOwner[1], cov.ByOwner[2]
+	// tiny.go has no owner, and big.go two of them.
+	assert.Equal(t, unowned.Owner, "")
+	assert.Equal(t, unowned.PatchNumStmt, 2)
+	assert.Equal(t, unowned.PatchCoverCount, 0)
+	assert.Equal(t, unowned.PatchCoverage, 0.0)
+	assert.Assert(t, len(unowned.UncoveredLines) > 0)
+	for _, l := range unowned.UncoveredLines {
+		assert.Equal(t, l.FileName, "example.com/m/pkg/tiny.go")
+	}
+	for _, o := range []OwnerCoverage{alice, big} {
+		assert.DeepEqual(t, o, OwnerCoverage{Owner: o.Owner, PatchNumStmt: 4, PatchCoverCount: 4, PatchCoverage: 100})
+	}
+	assert.Equal(t, alice.Owner, "@alice")
+	assert.Equal(t, big.Owner, "@org/big")
+
+	var buf strings.Builder
+	assert.NilError(t, RenderTemplateOutput(cov, "", &buf))
+	assert.Assert(t, strings.Contains(buf.String(), "owner (none): 0.0% of changed statements (0/2)\n"), buf.String())
+	assert.Assert(t, strings.Contains(buf.String(), "owner @org/big: 100.0% of changed statements (4/4)\n"), buf.String())
+
+	cov, err = New(Config{}).ComputeFromFiles(dir+"coverage.out", dir+"diff.diff", "")
+	assert.NilError(t, err)
+	assert.Assert(t, cov.ByOwner == nil)
+}
@@ -0,0 +1,81 @@
+package patchcover
+
+import (
+	"path"
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// PackageCoverage is the total coverage of a package, along with its
+// previous coverage.
+type PackageCoverage struct {
+	Package        string  `json:"package"`
+	NumStmt        int     `json:"num_stmt"`
+	CoverCount     int     `json:"cover_count"`
+	Coverage       float64 `json:"coverage"`
+	PrevNumStmt    int     `json:"prev_num_stmt"`
+	PrevCoverCount int     `json:"prev_cover_count"`
+	PrevCoverage   float64 `json:"prev_coverage"`
+	// New reports a package absent from the previous coverage, and Removed
+	// a package only present in it. Both are false without previous
+	// coverage.
+	New     bool `json:"new"`
+	Removed bool `json:"removed"`
+}
+
+// packageCoverage returns the coverage of every package of profiles and
+// prevProfiles, sorted by package. prevProfiles is nil without previous
+// coverage. A block is covered when its count reaches minHits.
+func packageCoverage(profiles, prevProfiles []*cover.Profile, minHits int) []PackageCoverage {
+	byPkg := make(map[string]*PackageCoverage)
+	pkgOf := func(fileName string) *PackageCoverage {
+		name := path.Dir(toSlash(fileName))
+		pkg, ok := byPkg[name]
+		if !ok {
+			pkg = &PackageCoverage{Package: name}
+			byPkg[name] = pkg
+		}
+		return pkg
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range profiles {
+		pkg := pkgOf(p.FileName)
+		seen[pkg.Package] = true
+		for _, b := range p.Blocks {
+			pkg.NumStmt += b.NumStmt
+			if b.Count >= minHits {
+				pkg.CoverCount += b.NumStmt
+			}
+		}
+	}
+	prevSeen := make(map[string]bool)
+	for _, p := range prevProfiles {
+		pkg := pkgOf(p.FileName)
+		prevSeen[pkg.Package] = true
+		for _, b := range p.Blocks {
+			pkg.PrevNumStmt += b.NumStmt
+			if b.Count >= minHits {
+				pkg.PrevCoverCount += b.NumStmt
+			}
+		}
+	}
+
+	pkgs := make([]PackageCoverage, 0, len(byPkg))
+	for _, pkg := range byPkg {
+		if pkg.NumStmt != 0 {
+			pkg.Coverage = float64(pkg.CoverCount) / float64(pkg.NumStmt) * 100
+		}
+		if pkg.PrevNumStmt != 0 {
+			pkg.PrevCoverage = float64(pkg.PrevCoverCount) / float64(pkg.PrevNumStmt) * 100
+		}
+		if prevProfiles != nil {
+			pkg.New = !prevSeen[pkg.Package]
+			pkg.Removed = !seen[pkg.Package]
+		}
+		pkgs = append(pkgs, *pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Package < pkgs[j].Package })
+	return pkgs
+}
@@ -0,0 +1,61 @@
+package patchcover
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+	"gotest.tools/v3/assert"
+)
+
+func Test_packageCoverage(t *testing.T) {
+	profile := func(fileName string, counts ...int) *cover.Profile {
+		p := &cover.Profile{FileName: fileName, Mode: "set"}
+		for i, count := range counts {
+			p.Blocks = append(p.Blocks, cover.ProfileBlock{StartLine: i + 1, EndLine: i + 1, NumStmt: 1, Count: count})
+		}
+		return p
+	}
+	prev := []*cover.Profile{
+		profile("example.com/m/regressed/a.go", 1, 1, 1, 1, 0),
+		profile("example.com/m/improved/a.go", 1, 0),
+		profile("example.com/m/removed/a.go", 1),
+	}
+	profiles := []*cover.Profile{
+		profile("example.com/m/regressed/a.go", 1, 1, 0, 0),
+		profile("example.com/m/improved/a.go", 1, 1),
+		profile("example.com/m/improved/b.go", 0, 1),
+		profile("example.com/m/added/a.go", 1, 0),
+	}
+
+	assert.DeepEqual(t, packageCoverage(profiles, prev, 1), []PackageCoverage{
+		{Package: "example.com/m/added", NumStmt: 2, CoverCount: 1, Coverage: 50, New: true},
+		{Package: "example.com/m/improved", NumStmt: 4, CoverCount: 3, Coverage: 75, PrevNumStmt: 2, PrevCoverCount: 1, PrevCoverage: 50},
+		{Package: "example.com/m/regressed", NumStmt: 4, CoverCount: 2, Coverage: 50, PrevNumStmt: 5, PrevCoverCount: 4, PrevCoverage: 80},
+		{Package: "example.com/m/removed", PrevNumStmt: 1, PrevCoverCount: 1, PrevCoverage: 100, Removed: true},
+	})
+
+	// Without previous coverage, no package is new.
+	pkgs := packageCoverage(profiles[:1], nil, 1)
+	assert.DeepEqual(t, pkgs, []PackageCoverage{
+		{Package: "example.com/m/regressed", NumStmt: 4, CoverCount: 2, Coverage: 50},
+	})
+}
+
+func TestRenderTemplateOutput_packages(t *testing.T) {
+	data := CoverageData{
+		HasPrevCoverage: true,
+		Packages: []PackageCoverage{
+			{Package: "example.com/m/added", Coverage: 50, New: true},
+			{Package: "example.com/m/regressed", Coverage: 72, PrevCoverage: 80},
+			{Package: "example.com/m/removed", PrevCoverage: 100, Removed: true},
+		},
+	}
+	var out strings.Builder
+	assert.NilError(t, RenderTemplateOutput(data, "", &out))
+	assert.Assert(t, strings.Contains(out.String(), `patch coverage: 0.0% of changed statements (0/0)
+package example.com/m/added: new -> 50.0%
+package example.com/m/regressed: 80.0% -> 72.0%
+package example.com/m/removed: 100.0% -> removed
+uncovered lines : `), out.String())
+}
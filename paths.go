@@ -0,0 +1,360 @@
+package patchcover
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"golang.org/x/tools/cover"
+)
+
+// profileMatchesDiff reports whether the profile file name refers to the
+// file at diffName, a repository relative path taken from the diff.
+func profileMatchesDiff(profileName, diffName, modulePrefix string) bool {
+	profileName = normalizeProfileName(profileName, modulePrefix)
+	diffName = normalizeDiffName(diffName)
+	if modulePrefix != "" {
+		return profileName == path.Clean(diffName)
+	}
+	// Using suffix since profiles are prepended with the go module.
+	return hasPathSuffix(profileName, diffName)
+}
+
+// hasPathSuffix reports whether the slash separated name ends with the
+// whole path segments of suffix, so that user.go is not a suffix of
+// superuser.go.
+func hasPathSuffix(name, suffix string) bool {
+	suffix = strings.TrimPrefix(suffix, "./")
+	return name == suffix || strings.HasSuffix(name, "/"+suffix)
+}
+
+// longestSuffixIn returns the longest whole path segment suffix of the
+// slash separated name in names, and false when there is none.
+func longestSuffixIn(names map[string]bool, name string) (string, bool) {
+	name = strings.TrimPrefix(name, "./")
+	for {
+		if names[name] {
+			return name, true
+		}
+		i := strings.Index(name, "/")
+		if i < 0 {
+			return "", false
+		}
+		name = name[i+1:]
+	}
+}
+
+// diffMatcher reports whether a profile file name refers to a diff file.
+type diffMatcher func(profileName, diffName string) bool
+
+// newDiffMatcher returns the diffMatcher configured by cfg. Profiles of
+// modules replaced by a local directory in cfg.GoModFile are matched
+// exactly against their path in that directory. With DetectModules, files
+// inside a module are matched exactly against their module qualified name.
+// Without ModulePrefix, profiles of the module of the nearest go.mod of the
+// working directory are matched by their module relative name: a diff file
+// matches the profile of profiles whose name is the longest whole path
+// segment suffix of its path, so that util.go does not match a change of
+// internal/util.go when both have a profile. With
+// ModulePrefix and ModuleDir, module relative names are joined to ModuleDir
+// and matched exactly. Other files fall back to profileMatchesDiff.
+func newDiffMatcher(diffFiles []*gitdiff.File, profiles []*cover.Profile, cfg Config) (diffMatcher, error) {
+	var replaces []moduleReplace
+	if cfg.GoModFile != "" {
+		gomod, err := os.ReadFile(cfg.GoModFile)
+		if err != nil {
+			return nil, &FileError{Arg: "go.mod", Path: cfg.GoModFile, Err: err}
+		}
+		replaces = parseLocalReplaces(gomod, path.Dir(toSlash(cfg.GoModFile)))
+	}
+
+	qualified := make(map[string]string)
+	if cfg.DetectModules {
+		resolver := newModuleResolver(".")
+		for _, f := range diffFiles {
+			if q, ok := resolver.profileName(f.NewName); ok {
+				qualified[f.NewName] = q
+			}
+		}
+	}
+
+	workingModule := ""
+	if cfg.ModulePrefix == "" {
+		workingModule = workingModulePath()
+	}
+	// Module relative name of the profile each diff file matches, by
+	// diff file name.
+	var moduleMatches map[string]string
+	if workingModule != "" {
+		rels := make(map[string]bool)
+		for _, p := range profiles {
+			if rel, ok := moduleRelativeName(p.FileName, workingModule); ok {
+				rels[rel] = true
+			}
+		}
+		moduleMatches = make(map[string]string)
+		for _, f := range diffFiles {
+			if rel, ok := longestSuffixIn(rels, normalizeDiffName(f.NewName)); ok {
+				moduleMatches[f.NewName] = rel
+			}
+		}
+	}
+	moduleDir := ""
+	if cfg.ModulePrefix != "" && cfg.ModuleDir != "" {
+		moduleDir = path.Clean(toSlash(cfg.ModuleDir))
+	}
+
+	return func(profileName, diffName string) bool {
+		if local, ok := replacedPath(replaces, toSlash(profileName)); ok {
+			return local == normalizeDiffName(diffName)
+		}
+		if q, ok := qualified[diffName]; ok {
+			return toSlash(profileName) == q
+		}
+		if workingModule != "" {
+			if rel, ok := moduleRelativeName(profileName, workingModule); ok {
+				if match, ok := moduleMatches[diffName]; ok {
+					return rel == match
+				}
+				// The diff path is repository relative and the module may
+				// be in a subdirectory of the repository.
+				return hasPathSuffix(normalizeDiffName(diffName), rel)
+			}
+		}
+		if moduleDir != "" {
+			profileName = path.Join(moduleDir, normalizeProfileName(profileName, cfg.ModulePrefix))
+			return profileName == path.Clean(normalizeDiffName(diffName))
+		}
+		return profileMatchesDiff(profileName, diffName, cfg.ModulePrefix)
+	}, nil
+}
+
+// normalizeProfileName returns the form of a profile file name used for
+// matching: slash separated and, when modulePrefix is set, module relative.
+func normalizeProfileName(profileName, modulePrefix string) string {
+	profileName = toSlash(profileName)
+	if modulePrefix != "" {
+		profileName = trimModulePrefix(profileName, toSlash(modulePrefix))
+	}
+	return profileName
+}
+
+// normalizeDiffName returns the form of a diff file name used for matching.
+func normalizeDiffName(diffName string) string {
+	return toSlash(diffName)
+}
+
+// toSlash replaces backslash separators, regardless of the current OS.
+func toSlash(p string) string {
+	return strings.ReplaceAll(p, "\\", "/")
+}
+
+// moduleRelativeName returns the path of the profile file name within the
+// module at modulePath, and false when the file is not in that module.
+func moduleRelativeName(profileName, modulePath string) (string, bool) {
+	name := toSlash(profileName)
+	rel := trimModulePrefix(name, modulePath)
+	return rel, rel != name
+}
+
+// trimModulePrefix strips the module path from a profile file name.
+func trimModulePrefix(profileName, modulePrefix string) string {
+	return strings.TrimPrefix(profileName, strings.TrimSuffix(modulePrefix, "/")+"/")
+}
+
+// matchesAnyPattern reports whether name, or any trailing sequence of its
+// path segments, matches one of the glob patterns or is in a directory
+// matching one. "*" matches within a path segment, and a "**" segment any
+// number of segments, so "**/mock" matches the files of every mock
+// directory, and "*_test.go" does not match "pkg/sub/a_test.go" as a whole.
+func matchesAnyPattern(patterns []string, name string) bool {
+	segments := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		p := strings.Split(pattern, "/")
+		for start := range segments {
+			for end := start + 1; end <= len(segments); end++ {
+				if matchSegments(p, segments[start:end]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// filterDiffFiles drops the diff files left out of the patch coverage by
+// cfg: files without one of the Extensions, test files with ExcludeTests,
+// and files not selected by the Pathspecs.
+func filterDiffFiles(diffFiles []*gitdiff.File, cfg Config) []*gitdiff.File {
+	extensions := cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = []string{".go"}
+	}
+	includes, excludes := parsePathspecs(cfg.Pathspecs)
+
+	var filtered []*gitdiff.File
+	for _, f := range diffFiles {
+		if !hasExtension(f.NewName, extensions) {
+			continue
+		}
+		if cfg.ExcludeTests && strings.HasSuffix(f.NewName, "_test.go") {
+			continue
+		}
+		if name := strings.TrimPrefix(normalizeDiffName(f.NewName), "./"); !matchesPathspecs(includes, excludes, name) {
+			continue
+		}
+		filtered = append(filtered, f)
+	}
+	return filtered
+}
+
+// parsePathspecs parses git-style pathspecs into rules matching, anchored
+// to the repository root, a file or one of its parent directories, split
+// into include and exclude ones.
+func parsePathspecs(specs []string) (includes, excludes []ignoreRule) {
+	for _, spec := range specs {
+		exclude := false
+		for _, prefix := range []string{":(exclude)", ":!", ":^"} {
+			if strings.HasPrefix(spec, prefix) {
+				exclude, spec = true, spec[len(prefix):]
+				break
+			}
+		}
+		spec = strings.Trim(strings.TrimPrefix(toSlash(spec), "./"), "/")
+		if spec == "" {
+			// The whole repository, as "." is.
+			spec = "**"
+		}
+		r := ignoreRule{segments: strings.Split(spec, "/")}
+		if exclude {
+			excludes = append(excludes, r)
+		} else {
+			includes = append(includes, r)
+		}
+	}
+	return includes, excludes
+}
+
+// matchesPathspecs reports whether name matches at least one of the
+// includes, or there are none, and none of the excludes.
+func matchesPathspecs(includes, excludes []ignoreRule, name string) bool {
+	for _, r := range excludes {
+		if r.matches(name) {
+			return false
+		}
+	}
+	if len(includes) == 0 {
+		return true
+	}
+	for _, r := range includes {
+		if r.matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExtension reports whether name ends with one of the extensions, which
+// may be given with or without their leading dot.
+func hasExtension(name string, extensions []string) bool {
+	ext := path.Ext(toSlash(name))
+	for _, e := range extensions {
+		if ext == "."+strings.TrimPrefix(e, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// filterProfiles drops the profiles excluded by the Includes, Excludes
+// and CoverageIgnore patterns of cfg, and test files with ExcludeTests.
+func filterProfiles(profiles []*cover.Profile, cfg Config) []*cover.Profile {
+	if len(cfg.Includes) == 0 && len(cfg.Excludes) == 0 && len(cfg.CoverageIgnore) == 0 && !cfg.ExcludeTests {
+		return profiles
+	}
+
+	var ignoreRules []ignoreRule
+	ignorePrefix := ""
+	if len(cfg.CoverageIgnore) > 0 {
+		ignoreRules = parseIgnoreRules(cfg.CoverageIgnore)
+		ignorePrefix = ignoreModulePrefix(cfg.ModulePrefix)
+	}
+
+	var filtered []*cover.Profile
+	for _, p := range profiles {
+		name := normalizeProfileName(p.FileName, cfg.ModulePrefix)
+		if len(cfg.Includes) > 0 && !matchesAnyPattern(cfg.Includes, name) {
+			continue
+		}
+		if matchesAnyPattern(cfg.Excludes, name) {
+			continue
+		}
+		if cfg.ExcludeTests && strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ignoreRules != nil && isIgnored(ignoreRules, normalizeProfileName(p.FileName, ignorePrefix)) {
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+	return filtered
+}
+
+// dropDiffProfiles drops the profiles matching one of diffFiles.
+func dropDiffProfiles(profiles []*cover.Profile, diffFiles []*gitdiff.File, matches diffMatcher) []*cover.Profile {
+	var kept []*cover.Profile
+profiles:
+	for _, p := range profiles {
+		for _, f := range diffFiles {
+			if matches(p.FileName, f.NewName) {
+				continue profiles
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// trimGenerated drops the profiles of generated files from each of the
+// profile lists. Profile file names are mapped to the disk by stripping
+// modulePrefix or, when empty, the module path of the go.mod of the working
+// directory. Files outside the module or missing from disk are kept.
+func trimGenerated(modulePrefix string, profileLists ...*[]*cover.Profile) error {
+	if modulePrefix == "" {
+		gomod, err := os.ReadFile("go.mod")
+		if err != nil {
+			return fmt.Errorf("trimming generated files requires a module prefix or a go.mod in the working directory: %w", err)
+		}
+		modulePrefix = parseModulePath(gomod)
+	}
+
+	generated := make(map[string]bool)
+	isGeneratedProfile := func(profileName string) bool {
+		if g, ok := generated[profileName]; ok {
+			return g
+		}
+		name := toSlash(profileName)
+		rel := trimModulePrefix(name, toSlash(modulePrefix))
+		g := false
+		if rel != name {
+			if src, err := os.ReadFile(rel); err == nil {
+				g = isGenerated(src)
+			}
+		}
+		generated[profileName] = g
+		return g
+	}
+
+	for _, profiles := range profileLists {
+		var kept []*cover.Profile
+		for _, p := range *profiles {
+			if !isGeneratedProfile(p.FileName) {
+				kept = append(kept, p)
+			}
+		}
+		*profiles = kept
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package patchcover
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+func Test_profileMatchesDiff(t *testing.T) {
+	tests := map[string]struct {
+		profileName  string
+		diffName     string
+		modulePrefix string
+		want         bool
+	}{
+		"suffix":              {"github.com/org/repo/pkg/x.go", "pkg/x.go", "", true},
+		"suffix mismatch":     {"github.com/org/repo/pkg/x.go", "pkg/y.go", "", false},
+		"partial file name":   {"github.com/org/repo/superuser.go", "user.go", "", false},
+		"partial directory":   {"github.com/org/repo/xpkg/x.go", "pkg/x.go", "", false},
+		"other package":       {"github.com/org/repo/pkg/b/handler.go", "a/handler.go", "", false},
+		"whole name":          {"x.go", "x.go", "", true},
+		"dot slash":           {"github.com/org/repo/pkg/x.go", "./pkg/x.go", "", true},
+		"prefix exact":        {"github.com/org/repo/pkg/x.go", "pkg/x.go", "github.com/org/repo", true},
+		"prefix trailing /":   {"github.com/org/repo/pkg/x.go", "pkg/x.go", "github.com/org/repo/", true},
+		"prefix not a suffix": {"github.com/org/repo/sub/pkg/x.go", "pkg/x.go", "github.com/org/repo", false},
+		"prefix dot slash":    {"github.com/org/repo/pkg/x.go", "./pkg/x.go", "github.com/org/repo", true},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			assert.Equal(t, profileMatchesDiff(tt.profileName, tt.diffName, tt.modulePrefix), tt.want)
+		})
+	}
+}
+
+func TestComputer_ComputeFromReaders_pathSegments(t *testing.T) {
+	// Only user.go and pkg/a/handler.go changed, superuser.go and
+	// pkg/b/handler.go sharing a suffix of their names.
+	profile := `mode: set
+example.com/m/user.go:3.14,5.2 1 1
+example.com/m/superuser.go:3.14,5.2 1 0
+example.com/m/pkg/a/handler.go:3.14,5.2 1 1
+example.com/m/pkg/b/handler.go:3.14,5.2 1 0
+`
+	diff := `diff --git a/user.go b/user.go
+--- a/user.go
++++ b/user.go
+@@ -4 +4 @@ func User() int {
+-	return 0
++	return 1
+diff --git a/a/handler.go b/a/handler.go
+--- a/a/handler.go
++++ b/a/handler.go
+@@ -4 +4 @@ func Handle() int {
+-	return 0
++	return 1
+`
+	cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+	assert.NilError(t, err)
+	assert.Equal(t, cov.PatchNumStmt, 2)
+	assert.Equal(t, cov.PatchCoverCount, 2)
+}
+
+func TestComputer_ComputeFromReaders_windowsDiff(t *testing.T) {
+	profile := `mode: set
+example.com/m/pkg/user.go:3.14,6.2 2 1
+example.com/m/pkg/user.go:7.1,8.2 1 0
+`
+	// A diff produced on Windows, with CRLF line endings and backslash
+	// separated paths.
+	diff := strings.ReplaceAll(`diff --git a/pkg\user.go b/pkg\user.go
+--- a/pkg\user.go
++++ b/pkg\user.go
+@@ -4,0 +5,2 @@ func User() int {
++	n := 1
++	return n
+@@ -7 +7 @@ func User() int {
+-	return 0
++	return 1
+`, "\n", "\r\n")
+	cov, err := New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), nil)
+	assert.NilError(t, err)
+	assert.Equal(t, cov.PatchNumStmt, 3)
+	assert.Equal(t, cov.PatchCoverCount, 2)
+	assert.DeepEqual(t, cov.UncoveredLines, []UncoveredLine{
+		{FileName: "example.com/m/pkg/user.go", LineNum: 7, LineString: "\treturn 1", NumStmt: 1},
+	})
+}
+
+func TestComputer_ComputeFromReaders_modulePrefix(t *testing.T) {
+	// The pkg/x.go profile of the root module shares a suffix with the
+	// svc/pkg/x.go profile of the module in the svc directory.
+	profile := `mode: set
+github.com/org/repo/pkg/x.go:3.14,5.2 1 1
+github.com/org/svc/pkg/x.go:3.14,5.2 1 0
+`
+	diff := func(name string) string {
+		return "diff --git a/" + name + " b/" + name + "\n--- a/" + name + "\n+++ b/" + name + `
+@@ -4 +4 @@ func X() int {
+-	return 0
++	return 1
+`
+	}
+
+	tests := map[string]struct {
+		cfg       Config
+		diff      string
+		wantCover int
+	}{
+		"root module":                    {Config{ModulePrefix: "github.com/org/repo"}, diff("pkg/x.go"), 1},
+		"module directory":               {Config{ModulePrefix: "github.com/org/svc", ModuleDir: "./svc/"}, diff("svc/pkg/x.go"), 0},
+		"directory not in the diff path": {Config{ModulePrefix: "github.com/org/svc", ModuleDir: "svc"}, diff("pkg/x.go"), -1},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			cov, err := New(tt.cfg).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(tt.diff), nil)
+			assert.NilError(t, err)
+			if tt.wantCover < 0 {
+				assert.Equal(t, cov.PatchNumStmt, 0)
+				return
+			}
+			assert.Equal(t, cov.PatchNumStmt, 1)
+			assert.Equal(t, cov.PatchCoverCount, tt.wantCover)
+		})
+	}
+}
+
+func Test_matchesAnyPattern(t *testing.T) {
+	tests := map[string]struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		"no patterns":      {nil, "pkg/x.go", false},
+		"full path":        {[]string{"pkg/*.go"}, "pkg/x.go", true},
+		"trailing segment": {[]string{"mocks/*"}, "github.com/org/repo/mocks/store.go", true},
+		"base name":        {[]string{"*_mock.go"}, "github.com/org/repo/pkg/store_mock.go", true},
+		"no match":         {[]string{"mocks/*"}, "github.com/org/repo/pkg/store.go", false},
+		"mock directory":   {[]string{"**/mock"}, "github.com/org/repo/internal/mock/store.go", true},
+		"mock name prefix": {[]string{"**/mock"}, "github.com/org/repo/internal/mockery.go", false},
+		"any depth":        {[]string{"mocks/**/*.go"}, "github.com/org/repo/mocks/a/b/store.go", true},
+		"test files":       {[]string{"*_test.go"}, "github.com/org/repo/pkg/store_test.go", true},
+		"in one segment":   {[]string{"pkg/*_test.go"}, "github.com/org/repo/pkg/sub/store_test.go", false},
+		"generated":        {[]string{"*_easyjson.go"}, "github.com/org/repo/pkg/store_easyjson.go", true},
+	}
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			assert.Equal(t, matchesAnyPattern(tt.patterns, tt.name), tt.want)
+		})
+	}
+}
+
+func Test_normalizeProfileName(t *testing.T) {
+	assert.Equal(t, normalizeProfileName(`github.com\org\repo\pkg\x.go`, ""), "github.com/org/repo/pkg/x.go")
+	assert.Equal(t, normalizeProfileName("github.com/org/repo/pkg/x.go", "github.com/org/repo"), "pkg/x.go")
+	assert.Equal(t, normalizeDiffName(`pkg\x.go`), "pkg/x.go")
+}
+
+func Test_moduleResolver_profileName(t *testing.T) {
+	r := newModuleResolver(".")
+
+	name, ok := r.profileName("testdata/multi-module/a/lib.go")
+	assert.Assert(t, ok)
+	assert.Equal(t, name, "example.com/a/lib.go")
+
+	name, ok = r.profileName(`testdata\multi-module\b\lib.go`)
+	assert.Assert(t, ok)
+	assert.Equal(t, name, "example.com/b/lib.go")
+
+	// Outside the nested modules, the repository module applies.
+	name, ok = r.profileName("testdata/test-project/func1.go")
+	assert.Assert(t, ok)
+	assert.Equal(t, name, "github.com/srinidhis05/go-patch-cover/testdata/test-project/func1.go")
+
+	_, ok = newModuleResolver(t.TempDir()).profileName("pkg/x.go")
+	assert.Assert(t, !ok)
+}
+
+func Test_parseModulePath(t *testing.T) {
+	assert.Equal(t, parseModulePath([]byte("// comment\nmodule example.com/a // trailing\n")), "example.com/a")
+	assert.Equal(t, parseModulePath([]byte(`module "example.com/b"`)), "example.com/b")
+	assert.Equal(t, parseModulePath([]byte("go 1.17\n")), "")
+	assert.Equal(t, parseModulePath([]byte("modules x\n")), "")
+}
+
+func Test_parseLocalReplaces(t *testing.T) {
+	gomod := []byte(`module example.com/app
+
+replace example.com/lib => ./lib
+
+replace (
+	example.com/lib/sub v1.0.0 => ../sub // vendored
+	example.com/remote => example.com/fork v1.2.0
+	"example.com/quoted" => "./quoted"
+)
+`)
+	assert.DeepEqual(t, parseLocalReplaces(gomod, "mod"), []moduleReplace{
+		{modulePath: "example.com/lib/sub", dir: "sub"},
+		{modulePath: "example.com/quoted", dir: "mod/quoted"},
+		{modulePath: "example.com/lib", dir: "mod/lib"},
+	}, cmp.AllowUnexported(moduleReplace{}))
+}
+
+func Test_replacedPath(t *testing.T) {
+	replaces := []moduleReplace{
+		{modulePath: "example.com/lib/sub", dir: "sub"},
+		{modulePath: "example.com/lib", dir: "lib"},
+	}
+
+	local, ok := replacedPath(replaces, "example.com/lib/sub/x.go")
+	assert.Assert(t, ok)
+	assert.Equal(t, local, "sub/x.go")
+
+	local, ok = replacedPath(replaces, "example.com/lib/x.go")
+	assert.Assert(t, ok)
+	assert.Equal(t, local, "lib/x.go")
+
+	_, ok = replacedPath(replaces, "example.com/library/x.go")
+	assert.Assert(t, !ok)
+}
+
+func Test_filterDiffFiles(t *testing.T) {
+	var files []*gitdiff.File
+	for _, name := range []string{"README.md", "deploy/app.yaml", "pkg/x.go", "pkg/x_test.go", "web/page.gohtml"} {
+		files = append(files, &gitdiff.File{NewName: name})
+	}
+	names := func(files []*gitdiff.File) []string {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.NewName)
+		}
+		return names
+	}
+
+	assert.DeepEqual(t, names(filterDiffFiles(files, Config{})), []string{"pkg/x.go", "pkg/x_test.go"})
+	assert.DeepEqual(t, names(filterDiffFiles(files, Config{ExcludeTests: true})), []string{"pkg/x.go"})
+	assert.DeepEqual(t, names(filterDiffFiles(files, Config{Extensions: []string{".go", "gohtml"}})), []string{"pkg/x.go", "pkg/x_test.go", "web/page.gohtml"})
+	assert.DeepEqual(t, names(filterDiffFiles(files, Config{Extensions: []string{".md"}})), []string{"README.md"})
+}
+
+func Test_filterDiffFiles_pathspecs(t *testing.T) {
+	var files []*gitdiff.File
+	for _, name := range []string{"main.go", "pkg/x.go", "pkg/testdata/gen.go", "pkg/sub/y.go", "pkg/sub/testdata/z.go", "internal/pkg/w.go", "./tools/t.go"} {
+		files = append(files, &gitdiff.File{NewName: name})
+	}
+	filter := func(specs ...string) []string {
+		var names []string
+		for _, f := range filterDiffFiles(files, Config{Pathspecs: specs}) {
+			names = append(names, f.NewName)
+		}
+		return names
+	}
+
+	assert.DeepEqual(t, filter(), []string{"main.go", "pkg/x.go", "pkg/testdata/gen.go", "pkg/sub/y.go", "pkg/sub/testdata/z.go", "internal/pkg/w.go", "./tools/t.go"})
+	// Pathspecs are anchored to the repository root and match directories.
+	assert.DeepEqual(t, filter("pkg"), []string{"pkg/x.go", "pkg/testdata/gen.go", "pkg/sub/y.go", "pkg/sub/testdata/z.go"})
+	assert.DeepEqual(t, filter("pkg/*.go", "tools/"), []string{"pkg/x.go", "./tools/t.go"})
+	// Includes and excludes compose.
+	assert.DeepEqual(t, filter("pkg/**", ":!**/testdata/**"), []string{"pkg/x.go", "pkg/sub/y.go"})
+	assert.DeepEqual(t, filter("pkg/**", "internal", ":^pkg/sub", ":(exclude)pkg/*/gen.go"), []string{"pkg/x.go", "internal/pkg/w.go"})
+	assert.DeepEqual(t, filter(":!pkg", ":!**/t.go"), []string{"main.go", "internal/pkg/w.go"})
+	assert.DeepEqual(t, filter(":!**/testdata", "**/pkg/**"), []string{"pkg/x.go", "pkg/sub/y.go", "internal/pkg/w.go"})
+}
@@ -0,0 +1,353 @@
+package patchcover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/cover"
+)
+
+// parseProfiles parses each reader as a coverage profile using at most
+// concurrency workers, or GOMAXPROCS when concurrency is not positive.
+// Results are returned in the order of the readers. When several readers
+// fail to parse, the error of the first one is returned. Parsed profiles
+// are cached in cacheDir, unless it is empty. Errors are *ParseError,
+// naming the file of readers that have a name.
+func parseProfiles(readers []io.Reader, concurrency int, cacheDir string) ([][]*cover.Profile, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	if concurrency > len(readers) {
+		concurrency = len(readers)
+	}
+
+	results := make([][]*cover.Profile, len(readers))
+	errs := make([]error, len(readers))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var err error
+				results[i], err = parseCachedProfile(readers[i], cacheDir)
+				if err != nil {
+					errs[i] = &ParseError{Path: readerName(readers[i]), Err: err}
+				}
+			}
+		}()
+	}
+	for i := range readers {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// readerName returns the name of the file r reads, or "" when it is not a
+// file.
+func readerName(r io.Reader) string {
+	if lr, ok := r.(lcovReader); ok {
+		r = lr.Reader
+	}
+	if f, ok := r.(interface{ Name() string }); ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// overrideMode sets the mode of profiles to mode, clamping block counts to
+// 1 in set mode.
+func overrideMode(profiles []*cover.Profile, mode string) error {
+	switch mode {
+	case "set", "count", "atomic":
+	default:
+		return fmt.Errorf("invalid profile mode %q: must be set, count or atomic", mode)
+	}
+
+	for _, p := range profiles {
+		p.Mode = mode
+		if mode != "set" {
+			continue
+		}
+		for i := range p.Blocks {
+			if p.Blocks[i].Count > 1 {
+				p.Blocks[i].Count = 1
+			}
+		}
+	}
+	return nil
+}
+
+// WriteProfiles writes profiles in the go cover profile format. The
+// "mode:" header line, taken from the first profile, is only written when
+// header is true; consumers of the standard format expect it.
+func WriteProfiles(out io.Writer, profiles []*cover.Profile, header bool) error {
+	w := bufio.NewWriter(out)
+	if header {
+		mode := "set"
+		if len(profiles) > 0 && profiles[0].Mode != "" {
+			mode = profiles[0].Mode
+		}
+		fmt.Fprintf(w, "mode: %s\n", mode)
+	}
+	for _, p := range profiles {
+		for _, b := range p.Blocks {
+			fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", p.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+		}
+	}
+	return w.Flush()
+}
+
+// MergeProfiles merges the profiles of several variants of a build of the
+// same code, e.g. with and without -race, into one set of profiles. Blocks
+// are identified by their position: the result holds the union of the
+// blocks of every variant, and a block present in several variants keeps
+// its highest count. The mode is "set" when every variant uses it, and
+// otherwise the first other mode. Profiles and blocks are sorted.
+func MergeProfiles(variants ...[]*cover.Profile) []*cover.Profile {
+	type blockPos struct {
+		startLine, startCol, endLine, endCol int
+	}
+
+	mode := ""
+	byFile := make(map[string]map[blockPos]cover.ProfileBlock)
+	for _, profiles := range variants {
+		for _, p := range profiles {
+			if mode == "" || mode == "set" {
+				mode = p.Mode
+			}
+			blocks, ok := byFile[p.FileName]
+			if !ok {
+				blocks = make(map[blockPos]cover.ProfileBlock)
+				byFile[p.FileName] = blocks
+			}
+			for _, b := range p.Blocks {
+				pos := blockPos{b.StartLine, b.StartCol, b.EndLine, b.EndCol}
+				if prev, ok := blocks[pos]; ok && prev.Count >= b.Count {
+					continue
+				}
+				blocks[pos] = b
+			}
+		}
+	}
+
+	merged := make([]*cover.Profile, 0, len(byFile))
+	for fileName, blocks := range byFile {
+		p := &cover.Profile{FileName: fileName, Mode: mode, Blocks: make([]cover.ProfileBlock, 0, len(blocks))}
+		for _, b := range blocks {
+			p.Blocks = append(p.Blocks, b)
+		}
+		sortBlocks(p.Blocks)
+		merged = append(merged, p)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].FileName < merged[j].FileName })
+	return merged
+}
+
+// SumProfiles merges the profiles of several test suites of the same code,
+// e.g. unit and integration tests, into one set of profiles. The counts of
+// a block add up, so that a block is covered when any suite covers it. The
+// mode is kept when every suite uses it, and is "count" otherwise; in set
+// mode, summed counts are clamped to 1. A file profiled by several suites
+// must have the same blocks in each of them, otherwise the suites were not
+// run on the same code and an error is returned. Profiles and blocks are
+// sorted.
+func SumProfiles(suites ...[]*cover.Profile) ([]*cover.Profile, error) {
+	mode := ""
+	byFile := make(map[string]*cover.Profile)
+	for _, profiles := range suites {
+		for _, p := range profiles {
+			switch mode {
+			case "":
+				mode = p.Mode
+			case p.Mode:
+			default:
+				mode = "count"
+			}
+			sum, ok := byFile[p.FileName]
+			if !ok {
+				sum = &cover.Profile{FileName: p.FileName, Blocks: append([]cover.ProfileBlock(nil), p.Blocks...)}
+				sortBlocks(sum.Blocks)
+				byFile[p.FileName] = sum
+				continue
+			}
+			blocks := append([]cover.ProfileBlock(nil), p.Blocks...)
+			sortBlocks(blocks)
+			if len(blocks) != len(sum.Blocks) {
+				return nil, fmt.Errorf("block boundaries of %s disagree between coverage files: %d blocks instead of %d", p.FileName, len(blocks), len(sum.Blocks))
+			}
+			for i, b := range blocks {
+				s := &sum.Blocks[i]
+				if b.StartLine != s.StartLine || b.StartCol != s.StartCol || b.EndLine != s.EndLine || b.EndCol != s.EndCol {
+					return nil, fmt.Errorf("block boundaries of %s disagree between coverage files: %d.%d,%d.%d instead of %d.%d,%d.%d",
+						p.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol, s.StartLine, s.StartCol, s.EndLine, s.EndCol)
+				}
+				s.Count += b.Count
+			}
+		}
+	}
+
+	summed := make([]*cover.Profile, 0, len(byFile))
+	for _, p := range byFile {
+		p.Mode = mode
+		if mode == "set" {
+			for i := range p.Blocks {
+				if p.Blocks[i].Count > 1 {
+					p.Blocks[i].Count = 1
+				}
+			}
+		}
+		summed = append(summed, p)
+	}
+	sort.Slice(summed, func(i, j int) bool { return summed[i].FileName < summed[j].FileName })
+	return summed, nil
+}
+
+// mergeSameFile merges the profiles of the same file, as concatenated
+// outputs of several tools hold, so that the statements of the file are
+// counted once. Blocks of the same range are merged as go test merges the
+// profiles of several packages: their counts add up, or the highest is
+// kept in set mode. Profiles keep the order of the first profile of their
+// file; profiles of a single file are returned as they are.
+func mergeSameFile(profiles []*cover.Profile) []*cover.Profile {
+	type blockPos struct {
+		startLine, startCol, endLine, endCol int
+	}
+
+	seen := make(map[string]int, len(profiles))
+	var merged []*cover.Profile
+	for _, p := range profiles {
+		i, ok := seen[p.FileName]
+		if !ok {
+			seen[p.FileName] = len(merged)
+			merged = append(merged, p)
+			continue
+		}
+
+		first := merged[i]
+		index := make(map[blockPos]int, len(first.Blocks))
+		blocks := append([]cover.ProfileBlock(nil), first.Blocks...)
+		for j, b := range blocks {
+			index[blockPos{b.StartLine, b.StartCol, b.EndLine, b.EndCol}] = j
+		}
+		for _, b := range p.Blocks {
+			pos := blockPos{b.StartLine, b.StartCol, b.EndLine, b.EndCol}
+			j, ok := index[pos]
+			switch {
+			case !ok:
+				index[pos] = len(blocks)
+				blocks = append(blocks, b)
+			case first.Mode == "set":
+				if b.Count > blocks[j].Count {
+					blocks[j].Count = b.Count
+				}
+			default:
+				blocks[j].Count += b.Count
+			}
+		}
+		sortBlocks(blocks)
+		merged[i] = &cover.Profile{FileName: first.FileName, Mode: first.Mode, Blocks: blocks}
+	}
+	return merged
+}
+
+// sortBlocks sorts blocks by start position.
+func sortBlocks(blocks []cover.ProfileBlock) {
+	sort.Slice(blocks, func(i, j int) bool {
+		bi, bj := blocks[i], blocks[j]
+		if bi.StartLine != bj.StartLine {
+			return bi.StartLine < bj.StartLine
+		}
+		return bi.StartCol < bj.StartCol
+	})
+}
+
+// resolveOverlaps drops overlapping blocks so that every position of a
+// file is counted by at most one block, whatever the order of the blocks.
+// Blocks overlap when their ranges intersect; blocks merely sharing a line,
+// one ending at the column the other starts, do not. Of overlapping
+// blocks, the one spanning the fewest lines, then columns, is kept; among
+// equally sized blocks, the one with the highest count. Profiles produced
+// by go test have no overlapping blocks and keep all of them. The profiles
+// returned are copies: profiles is left unchanged.
+func resolveOverlaps(profiles []*cover.Profile) []*cover.Profile {
+	resolved := make([]*cover.Profile, 0, len(profiles))
+	for _, p := range profiles {
+		blocks := append([]cover.ProfileBlock(nil), p.Blocks...)
+		sort.SliceStable(blocks, func(i, j int) bool { return blockBefore(blocks[i], blocks[j]) })
+
+		kept := blocks[:0:0]
+		for _, b := range blocks {
+			var overlapping []int
+			preferred := true
+			for i, k := range kept {
+				if !blocksOverlap(k, b) {
+					continue
+				}
+				overlapping = append(overlapping, i)
+				if !preferBlock(b, k) {
+					preferred = false
+				}
+			}
+			if !preferred {
+				continue
+			}
+			for i := len(overlapping) - 1; i >= 0; i-- {
+				kept = append(kept[:overlapping[i]], kept[overlapping[i]+1:]...)
+			}
+			kept = append(kept, b)
+		}
+		resolved = append(resolved, &cover.Profile{FileName: p.FileName, Mode: p.Mode, Blocks: kept})
+	}
+	return resolved
+}
+
+// blockBefore orders blocks by start position, then end position.
+func blockBefore(a, b cover.ProfileBlock) bool {
+	if a.StartLine != b.StartLine {
+		return a.StartLine < b.StartLine
+	}
+	if a.StartCol != b.StartCol {
+		return a.StartCol < b.StartCol
+	}
+	if a.EndLine != b.EndLine {
+		return a.EndLine < b.EndLine
+	}
+	return a.EndCol < b.EndCol
+}
+
+// blocksOverlap reports whether the ranges of a and b intersect. Ends are
+// exclusive.
+func blocksOverlap(a, b cover.ProfileBlock) bool {
+	before := func(line1, col1, line2, col2 int) bool {
+		return line1 < line2 || line1 == line2 && col1 < col2
+	}
+	return before(a.StartLine, a.StartCol, b.EndLine, b.EndCol) && before(b.StartLine, b.StartCol, a.EndLine, a.EndCol)
+}
+
+// preferBlock reports whether b is kept over the overlapping block k.
+func preferBlock(b, k cover.ProfileBlock) bool {
+	bLines, kLines := b.EndLine-b.StartLine, k.EndLine-k.StartLine
+	if bLines != kLines {
+		return bLines < kLines
+	}
+	bCols, kCols := b.EndCol-b.StartCol, k.EndCol-k.StartCol
+	if bCols != kCols {
+		return bCols < kCols
+	}
+	return b.Count > k.Count
+}
@@ -0,0 +1,268 @@
+package patchcover
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+	"gotest.tools/v3/assert"
+)
+
+// syntheticProfile returns a profile covering files with blocks each.
+func syntheticProfile(files, blocks int) string {
+	var b strings.Builder
+	b.WriteString("mode: count\n")
+	for f := 0; f < files; f++ {
+		for i := 0; i < blocks; i++ {
+			fmt.Fprintf(&b, "github.com/org/repo/pkg%d/file.go:%d.2,%d.10 1 %d\n", f, i+1, i+1, i%3)
+		}
+	}
+	return b.String()
+}
+
+func readers(profiles []string) []io.Reader {
+	rs := make([]io.Reader, len(profiles))
+	for i, p := range profiles {
+		rs[i] = strings.NewReader(p)
+	}
+	return rs
+}
+
+func Test_parseProfiles(t *testing.T) {
+	var profiles []string
+	for i := 0; i < 8; i++ {
+		profiles = append(profiles, syntheticProfile(i+1, 50))
+	}
+
+	var serial [][]*cover.Profile
+	for _, p := range profiles {
+		ps, err := cover.ParseProfilesFromReader(strings.NewReader(p))
+		assert.NilError(t, err)
+		serial = append(serial, ps)
+	}
+
+	for _, concurrency := range []int{0, 1, 3, 16} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			parsed, err := parseProfiles(readers(profiles), concurrency, "")
+			assert.NilError(t, err)
+			assert.DeepEqual(t, parsed, serial)
+		})
+	}
+}
+
+func Test_parseProfiles_error(t *testing.T) {
+	profiles := []string{
+		syntheticProfile(1, 1),
+		"mode: set\nnot a profile line\n",
+		"mode: set\nalso not a profile line\n",
+	}
+	_, err := parseProfiles(readers(profiles), 2, "")
+	assert.ErrorContains(t, err, `"not a profile line"`)
+}
+
+func Benchmark_parseProfiles(b *testing.B) {
+	var profiles []string
+	for i := 0; i < 8; i++ {
+		profiles = append(profiles, syntheticProfile(100, 200))
+	}
+
+	for _, concurrency := range []int{1, 0} {
+		b.Run(fmt.Sprintf("concurrency %d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := parseProfiles(readers(profiles), concurrency, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteProfiles(t *testing.T) {
+	const profile = `mode: count
+github.com/org/repo/a.go:1.2,3.4 2 1
+github.com/org/repo/a.go:5.2,6.4 1 0
+github.com/org/repo/b.go:1.2,1.10 1 7
+`
+	profiles, err := cover.ParseProfilesFromReader(strings.NewReader(profile))
+	assert.NilError(t, err)
+
+	var withHeader strings.Builder
+	assert.NilError(t, WriteProfiles(&withHeader, profiles, true))
+	assert.Equal(t, withHeader.String(), profile)
+
+	// The output round-trips through the standard parser.
+	reparsed, err := cover.ParseProfilesFromReader(strings.NewReader(withHeader.String()))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reparsed, profiles)
+
+	var withoutHeader strings.Builder
+	assert.NilError(t, WriteProfiles(&withoutHeader, profiles, false))
+	assert.Equal(t, withoutHeader.String(), strings.TrimPrefix(profile, "mode: count\n"))
+}
+
+func TestMergeProfiles(t *testing.T) {
+	parse := func(profile string) []*cover.Profile {
+		profiles, err := cover.ParseProfilesFromReader(strings.NewReader(profile))
+		assert.NilError(t, err)
+		return profiles
+	}
+
+	noRace := parse(`mode: set
+github.com/org/repo/a.go:1.2,3.4 2 1
+github.com/org/repo/a.go:5.2,6.4 1 0
+github.com/org/repo/b.go:1.2,1.10 1 0
+`)
+	race := parse(`mode: atomic
+github.com/org/repo/a.go:5.2,6.4 1 3
+github.com/org/repo/a.go:4.2,4.9 1 0
+github.com/org/repo/c.go:2.1,2.8 1 1
+`)
+
+	var merged strings.Builder
+	assert.NilError(t, WriteProfiles(&merged, MergeProfiles(noRace, race), true))
+	assert.Equal(t, merged.String(), `mode: atomic
+github.com/org/repo/a.go:1.2,3.4 2 1
+github.com/org/repo/a.go:4.2,4.9 1 0
+github.com/org/repo/a.go:5.2,6.4 1 3
+github.com/org/repo/b.go:1.2,1.10 1 0
+github.com/org/repo/c.go:2.1,2.8 1 1
+`)
+
+	// The union does not depend on the order of the variants.
+	assert.DeepEqual(t, MergeProfiles(race, noRace), MergeProfiles(noRace, race))
+}
+
+func TestSumProfiles(t *testing.T) {
+	parse := func(profile string) []*cover.Profile {
+		profiles, err := cover.ParseProfilesFromReader(strings.NewReader(profile))
+		assert.NilError(t, err)
+		return profiles
+	}
+
+	unit := parse(`mode: set
+github.com/org/repo/a.go:1.2,3.4 2 1
+github.com/org/repo/a.go:5.2,6.4 1 0
+github.com/org/repo/b.go:1.2,1.10 1 0
+`)
+	integration := parse(`mode: count
+github.com/org/repo/a.go:5.2,6.4 1 3
+github.com/org/repo/a.go:1.2,3.4 2 2
+github.com/org/repo/c.go:2.1,2.8 1 1
+`)
+
+	summed, err := SumProfiles(unit, integration)
+	assert.NilError(t, err)
+	var out strings.Builder
+	assert.NilError(t, WriteProfiles(&out, summed, true))
+	assert.Equal(t, out.String(), `mode: count
+github.com/org/repo/a.go:1.2,3.4 2 3
+github.com/org/repo/a.go:5.2,6.4 1 3
+github.com/org/repo/b.go:1.2,1.10 1 0
+github.com/org/repo/c.go:2.1,2.8 1 1
+`)
+
+	// Set mode is kept when every suite uses it.
+	summed, err = SumProfiles(unit, parse(`mode: set
+github.com/org/repo/a.go:1.2,3.4 2 1
+github.com/org/repo/a.go:5.2,6.4 1 1
+`))
+	assert.NilError(t, err)
+	assert.Equal(t, summed[0].Mode, "set")
+	assert.Equal(t, summed[0].Blocks[0].Count, 1)
+	assert.Equal(t, summed[0].Blocks[1].Count, 1)
+
+	_, err = SumProfiles(unit, parse(`mode: set
+github.com/org/repo/a.go:1.2,3.4 2 1
+github.com/org/repo/a.go:5.2,6.9 1 1
+`))
+	assert.Error(t, err, "block boundaries of github.com/org/repo/a.go disagree between coverage files: 5.2,6.9 instead of 5.2,6.4")
+	_, err = SumProfiles(unit, parse(`mode: set
+github.com/org/repo/a.go:1.2,3.4 2 1
+`))
+	assert.Error(t, err, "block boundaries of github.com/org/repo/a.go disagree between coverage files: 1 blocks instead of 2")
+}
+
+func Test_mergeSameFile(t *testing.T) {
+	a := &cover.Profile{FileName: "example.com/m/a.go", Mode: "count", Blocks: []cover.ProfileBlock{
+		{StartLine: 3, StartCol: 14, EndLine: 5, EndCol: 2, NumStmt: 1, Count: 1},
+		{StartLine: 7, StartCol: 14, EndLine: 9, EndCol: 2, NumStmt: 1, Count: 0},
+	}}
+	b := &cover.Profile{FileName: "example.com/m/b.go", Mode: "count"}
+	aAgain := &cover.Profile{FileName: "example.com/m/a.go", Mode: "count", Blocks: []cover.ProfileBlock{
+		{StartLine: 7, StartCol: 14, EndLine: 9, EndCol: 2, NumStmt: 1, Count: 2},
+		{StartLine: 1, StartCol: 14, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 0},
+	}}
+
+	merged := mergeSameFile([]*cover.Profile{a, b, aAgain})
+	assert.DeepEqual(t, merged, []*cover.Profile{
+		{FileName: "example.com/m/a.go", Mode: "count", Blocks: []cover.ProfileBlock{
+			{StartLine: 1, StartCol: 14, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 0},
+			{StartLine: 3, StartCol: 14, EndLine: 5, EndCol: 2, NumStmt: 1, Count: 1},
+			{StartLine: 7, StartCol: 14, EndLine: 9, EndCol: 2, NumStmt: 1, Count: 2},
+		}},
+		b,
+	})
+	// The input profiles are left untouched.
+	assert.Equal(t, len(a.Blocks), 2)
+	assert.Equal(t, a.Blocks[1].Count, 0)
+
+	a.Mode, aAgain.Mode = "set", "set"
+	merged = mergeSameFile([]*cover.Profile{a, aAgain, aAgain})
+	assert.Equal(t, len(merged), 1)
+	assert.Equal(t, merged[0].Blocks[2].Count, 2)
+}
+
+func Test_overrideMode(t *testing.T) {
+	const profile = `mode: count
+github.com/org/repo/a.go:1.2,3.4 2 5
+github.com/org/repo/a.go:5.2,6.4 1 0
+`
+	parse := func() []*cover.Profile {
+		profiles, err := cover.ParseProfilesFromReader(strings.NewReader(profile))
+		assert.NilError(t, err)
+		return profiles
+	}
+
+	profiles := parse()
+	assert.NilError(t, overrideMode(profiles, "set"))
+	assert.Equal(t, profiles[0].Mode, "set")
+	assert.Equal(t, profiles[0].Blocks[0].Count, 1)
+	assert.Equal(t, profiles[0].Blocks[1].Count, 0)
+
+	profiles = parse()
+	assert.NilError(t, overrideMode(profiles, "atomic"))
+	assert.Equal(t, profiles[0].Mode, "atomic")
+	assert.Equal(t, profiles[0].Blocks[0].Count, 5)
+
+	assert.Error(t, overrideMode(parse(), "sets"), `invalid profile mode "sets": must be set, count or atomic`)
+}
+
+func Test_resolveOverlaps(t *testing.T) {
+	const profile = `mode: count
+github.com/org/repo/a.go:3.20,9.2 4 1
+github.com/org/repo/a.go:5.10,7.3 2 0
+github.com/org/repo/a.go:5.10,7.3 2 0
+github.com/org/repo/a.go:9.2,9.12 1 1
+github.com/org/repo/a.go:9.12,10.2 1 0
+github.com/org/repo/b.go:1.2,1.10 1 2
+github.com/org/repo/b.go:1.4,1.12 1 5
+`
+	profiles, err := cover.ParseProfilesFromReader(strings.NewReader(profile))
+	assert.NilError(t, err)
+	blocks := len(profiles[0].Blocks)
+	resolved := resolveOverlaps(profiles)
+	// The profiles given are left unchanged.
+	assert.Equal(t, len(profiles[0].Blocks), blocks)
+
+	var out strings.Builder
+	assert.NilError(t, WriteProfiles(&out, resolved, false))
+	// The innermost block is kept over the enclosing one; blocks sharing
+	// only a line are kept; equally sized blocks keep the highest count.
+	assert.Equal(t, out.String(), `github.com/org/repo/a.go:5.10,7.3 2 0
+github.com/org/repo/a.go:9.2,9.12 1 1
+github.com/org/repo/a.go:9.12,10.2 1 0
+github.com/org/repo/b.go:1.4,1.12 1 5
+`)
+}
@@ -0,0 +1,117 @@
+package patchcover
+
+import (
+	"sort"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"golang.org/x/tools/cover"
+)
+
+// Regression is a line covered in the previous coverage and not anymore.
+// Lines of changed files are correlated through the diff: PrevLineNum is
+// the number of the line in the previous version of the file.
+type Regression struct {
+	FileName    string `json:"file"`
+	LineNum     int    `json:"line"`
+	PrevLineNum int    `json:"prev_line"`
+}
+
+// regressions returns the lines of profiles left uncovered whose line in
+// prevProfiles was covered, sorted by file name and line number. Added
+// lines have no previous line; they are reported as uncovered lines of the
+// patch instead. diffProfiles maps the diff files of diffFiles to the
+// profile file name they matched. A line is covered when one of the blocks
+// spanning it reaches minHits.
+func regressions(profiles, prevProfiles []*cover.Profile, diffFiles []*gitdiff.File, diffProfiles map[string]string, minHits int) []Regression {
+	prevByName := make(map[string]*cover.Profile, len(prevProfiles))
+	for _, p := range prevProfiles {
+		prevByName[p.FileName] = p
+	}
+	fragments := make(map[string][]*gitdiff.TextFragment)
+	for _, f := range diffFiles {
+		if profileName, ok := diffProfiles[f.NewName]; ok {
+			fragments[profileName] = f.TextFragments
+		}
+	}
+
+	var regressed []Regression
+	for _, p := range profiles {
+		prev, ok := prevByName[p.FileName]
+		if !ok {
+			continue
+		}
+		prevCovered := coveredLines(prev, minHits)
+		toOld := oldLineNumbers(fragments[p.FileName])
+		for line, covered := range coveredLines(p, minHits) {
+			if covered {
+				continue
+			}
+			old, ok := toOld(line)
+			if ok && prevCovered[old] {
+				regressed = append(regressed, Regression{FileName: p.FileName, LineNum: line, PrevLineNum: old})
+			}
+		}
+	}
+	sort.Slice(regressed, func(i, j int) bool {
+		a, b := regressed[i], regressed[j]
+		if a.FileName != b.FileName {
+			return a.FileName < b.FileName
+		}
+		return a.LineNum < b.LineNum
+	})
+	return regressed
+}
+
+// coveredLines returns the coverage state of every line spanned by the
+// blocks of p: true when one of them reaches minHits.
+func coveredLines(p *cover.Profile, minHits int) map[int]bool {
+	lines := make(map[int]bool)
+	for _, b := range p.Blocks {
+		for line := b.StartLine; line <= b.EndLine; line++ {
+			lines[line] = lines[line] || b.Count >= minHits
+		}
+	}
+	return lines
+}
+
+// oldLineNumbers returns a function mapping the line numbers of the new
+// version of a file to those of its old version, given the fragments of its
+// diff, sorted by position. Added lines have no old line number.
+func oldLineNumbers(fragments []*gitdiff.TextFragment) func(int) (int, bool) {
+	return func(line int) (int, bool) {
+		offset := 0 // old line number - new line number, before line
+		for _, frag := range fragments {
+			oldNum, newNum := int(frag.OldPosition), int(frag.NewPosition)
+			// Empty sides of fragments are positioned on the line
+			// preceding them.
+			if frag.NewLines == 0 {
+				newNum++
+			}
+			if frag.OldLines == 0 {
+				oldNum++
+			}
+			if line < newNum {
+				break
+			}
+			for _, l := range frag.Lines {
+				switch l.Op {
+				case gitdiff.OpAdd:
+					if newNum == line {
+						return 0, false
+					}
+					newNum++
+				case gitdiff.OpDelete:
+					oldNum++
+				case gitdiff.OpContext:
+					if newNum == line {
+						return oldNum, true
+					}
+					oldNum++
+					newNum++
+				}
+			}
+			offset = oldNum - newNum
+		}
+		return line + offset, true
+	}
+}
@@ -0,0 +1,72 @@
+package patchcover
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_oldLineNumbers(t *testing.T) {
+	files, err := parseDiff(strings.NewReader(`diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -2,0 +3,2 @@
++	added()
++	added()
+@@ -6,2 +8 @@
+-	deleted()
+-	replaced()
++	replacement()
+@@ -10 +10,0 @@
+-	deleted()
+`))
+	assert.NilError(t, err)
+	toOld := oldLineNumbers(files[0].TextFragments)
+
+	for line, want := range map[int]int{1: 1, 2: 2, 5: 3, 7: 5, 9: 8, 10: 9, 11: 11, 20: 20} {
+		old, ok := toOld(line)
+		assert.Assert(t, ok, line)
+		assert.Equal(t, old, want, line)
+	}
+	for _, line := range []int{3, 4, 8} {
+		_, ok := toOld(line)
+		assert.Assert(t, !ok, line)
+	}
+}
+
+func TestComputer_ComputeFromReaders_regressions(t *testing.T) {
+	prev := `mode: set
+example.com/m/a.go:3.14,5.2 1 1
+example.com/m/a.go:7.14,9.2 1 1
+example.com/m/b.go:3.14,5.2 1 1
+`
+	// Two lines were added to A, moving B down, and the tests of B and of
+	// b.go were removed.
+	profile := `mode: set
+example.com/m/a.go:3.14,7.2 2 1
+example.com/m/a.go:9.14,11.2 1 0
+example.com/m/b.go:3.14,5.2 1 0
+`
+	diff := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -4,0 +5,2 @@ func A() int {
++	x := 1
++	return x
+`
+	cov, err := New(Config{Regressions: true}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), strings.NewReader(prev))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cov.Regressions, []Regression{
+		{FileName: "example.com/m/a.go", LineNum: 9, PrevLineNum: 7},
+		{FileName: "example.com/m/a.go", LineNum: 10, PrevLineNum: 8},
+		{FileName: "example.com/m/a.go", LineNum: 11, PrevLineNum: 9},
+		{FileName: "example.com/m/b.go", LineNum: 3, PrevLineNum: 3},
+		{FileName: "example.com/m/b.go", LineNum: 4, PrevLineNum: 4},
+		{FileName: "example.com/m/b.go", LineNum: 5, PrevLineNum: 5},
+	})
+
+	cov, err = New(Config{}).ComputeFromReaders(strings.NewReader(profile), strings.NewReader(diff), strings.NewReader(prev))
+	assert.NilError(t, err)
+	assert.Assert(t, cov.Regressions == nil)
+}
@@ -0,0 +1,143 @@
+package patchcover
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// SARIF identifiers of RenderSARIFOutput.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	// SARIFUncoveredRule is the rule id of the results of uncovered added
+	// lines.
+	SARIFUncoveredRule = "patch-coverage/uncovered-line"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool          `json:"tool"`
+	Results    []sarifResult      `json:"results"`
+	Properties sarifRunProperties `json:"properties"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifRunProperties is the property bag of the run, holding the coverage.
+type sarifRunProperties struct {
+	Coverage        float64  `json:"coverage"`
+	PrevCoverage    *float64 `json:"prevCoverage,omitempty"`
+	PatchCoverage   float64  `json:"patchCoverage"`
+	PatchNumStmt    int      `json:"patchNumStmt"`
+	PatchCoverCount int      `json:"patchCoverCount"`
+}
+
+// RenderSARIFOutput writes a SARIF 2.1.0 log, for code scanning: one
+// warning result of the SARIFUncoveredRule per uncovered added line, at
+// its line of the file, by its diff name relative to the repository root
+// rather than its import path, and the total and patch coverage in the
+// properties of the run.
+func RenderSARIFOutput(data CoverageData, out io.Writer) error {
+	diffNames := make(map[string]string, len(data.DiffProfiles))
+	for diffName, profileName := range data.DiffProfiles {
+		diffNames[profileName] = diffName
+	}
+
+	results := make([]sarifResult, 0, len(data.UncoveredLines))
+	for _, l := range data.UncoveredLines {
+		uri, ok := diffNames[l.FileName]
+		if !ok {
+			uri = l.FileName
+		}
+		msg := "Added line is not covered by tests."
+		if l.Partial {
+			msg = "Added line is not hit often enough by tests."
+		}
+		results = append(results, sarifResult{
+			RuleID:  SARIFUncoveredRule,
+			Level:   "warning",
+			Message: sarifMessage{Text: msg},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: uri},
+				Region:           sarifRegion{StartLine: l.LineNum},
+			}}},
+		})
+	}
+
+	props := sarifRunProperties{
+		Coverage:        data.Coverage,
+		PatchCoverage:   data.PatchCoverage,
+		PatchNumStmt:    data.PatchNumStmt,
+		PatchCoverCount: data.PatchCoverCount,
+	}
+	if data.HasPrevCoverage {
+		prev := data.PrevCoverage
+		props.PrevCoverage = &prev
+	}
+
+	return json.NewEncoder(out).Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "go-patch-cover",
+				Version:        data.ToolVersion,
+				InformationURI: "https://github.com/srinidhis05/go-patch-cover",
+				Rules: []sarifRule{{
+					ID:               SARIFUncoveredRule,
+					ShortDescription: sarifMessage{Text: "Added line not covered by tests"},
+				}},
+			}},
+			Results:    results,
+			Properties: props,
+		}},
+	})
+}
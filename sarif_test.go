@@ -0,0 +1,56 @@
+package patchcover
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestRenderSARIFOutput(t *testing.T) {
+	const (
+		cov  = "testdata/scenarios/new_file/coverage.out"
+		diff = "testdata/scenarios/new_file/diff.diff"
+	)
+	data, err := New(Config{}).ComputeFromFiles(cov, diff, cov)
+	assert.NilError(t, err)
+	assert.Assert(t, len(data.UncoveredLines) > 0)
+
+	var buf bytes.Buffer
+	assert.NilError(t, RenderSARIFOutput(data, &buf))
+	golden.Assert(t, buf.String(), "sarif.golden.json")
+
+	// The properties the SARIF 2.1.0 schema requires, and the constraints
+	// it puts on their values.
+	var log map[string]interface{}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, log["version"], "2.1.0")
+	runs := log["runs"].([]interface{})
+	assert.Equal(t, len(runs), 1)
+	run := runs[0].(map[string]interface{})
+	driver := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})
+	assert.Equal(t, driver["name"], "go-patch-cover")
+	for _, rule := range driver["rules"].([]interface{}) {
+		assert.Equal(t, rule.(map[string]interface{})["id"], SARIFUncoveredRule)
+	}
+	props := run["properties"].(map[string]interface{})
+	assert.Equal(t, props["coverage"], data.Coverage)
+	assert.Equal(t, props["patchCoverage"], data.PatchCoverage)
+
+	results := run["results"].([]interface{})
+	assert.Equal(t, len(results), len(data.UncoveredLines))
+	for i, r := range results {
+		result := r.(map[string]interface{})
+		assert.Equal(t, result["ruleId"], SARIFUncoveredRule)
+		assert.Equal(t, result["level"], "warning")
+		assert.Assert(t, result["message"].(map[string]interface{})["text"] != "")
+
+		loc := result["locations"].([]interface{})[0].(map[string]interface{})["physicalLocation"].(map[string]interface{})
+		assert.Equal(t, data.DiffProfiles[loc["artifactLocation"].(map[string]interface{})["uri"].(string)], data.UncoveredLines[i].FileName)
+		startLine := loc["region"].(map[string]interface{})["startLine"].(float64)
+		assert.Assert(t, startLine >= 1)
+		assert.Equal(t, int(startLine), data.UncoveredLines[i].LineNum)
+	}
+}
@@ -0,0 +1,320 @@
+package patchcover
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// wholeFiles reads the named files from disk and returns them as diff files
+// adding every one of their lines. Missing files are skipped.
+func wholeFiles(names []string) ([]*gitdiff.File, error) {
+	var files []*gitdiff.File
+	for _, name := range names {
+		src, err := os.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		frag := &gitdiff.TextFragment{NewPosition: 1}
+		for _, line := range strings.SplitAfter(string(src), "\n") {
+			if line == "" {
+				continue
+			}
+			frag.Lines = append(frag.Lines, gitdiff.Line{Op: gitdiff.OpAdd, Line: line})
+		}
+		frag.NewLines = int64(len(frag.Lines))
+		frag.LinesAdded = frag.NewLines
+
+		files = append(files, &gitdiff.File{
+			NewName:       name,
+			TextFragments: []*gitdiff.TextFragment{frag},
+		})
+	}
+	return files, nil
+}
+
+// embeddedDataLines returns the lines of a Go source file that hold data
+// rather than statements: every line of a multi-line string literal but the
+// first, and the line following a //go:embed directive.
+func embeddedDataLines(src []byte) map[int]bool {
+	lines := make(map[int]bool)
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	embedLine := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		line := file.Line(pos)
+
+		switch {
+		case tok == token.COMMENT && strings.HasPrefix(lit, "//go:embed"):
+			embedLine = line
+		case tok == token.STRING:
+			for i := 1; i <= strings.Count(lit, "\n"); i++ {
+				lines[line+i] = true
+			}
+		}
+		if embedLine != 0 && line == embedLine+1 {
+			lines[line] = true
+			embedLine = 0
+		}
+	}
+
+	return lines
+}
+
+// funcComplexity is the cyclomatic complexity of the function declared
+// between two lines.
+type funcComplexity struct {
+	name               string
+	startLine, endLine int
+	complexity         int
+}
+
+// functionComplexities returns the cyclomatic complexity of every function
+// declared in a Go source file: one plus the number of branches, where a
+// branch is an if, for or range statement, a non-default case or select
+// clause, or a && or || operator. Function literals count toward their
+// enclosing function. Sources that do not parse yield no functions.
+func functionComplexities(src []byte) []funcComplexity {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil
+	}
+
+	var funcs []funcComplexity
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+
+		complexity := 1
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+				complexity++
+			case *ast.CaseClause:
+				if n.List != nil {
+					complexity++
+				}
+			case *ast.CommClause:
+				if n.Comm != nil {
+					complexity++
+				}
+			case *ast.BinaryExpr:
+				if n.Op == token.LAND || n.Op == token.LOR {
+					complexity++
+				}
+			}
+			return true
+		})
+
+		funcs = append(funcs, funcComplexity{
+			name:       funcName(fn),
+			startLine:  fset.Position(fn.Pos()).Line,
+			endLine:    fset.Position(fn.End()).Line,
+			complexity: complexity,
+		})
+	}
+	return funcs
+}
+
+// funcName returns the name of a function declaration, qualified by the
+// type of its receiver, e.g. "Store.Get" for methods of Store or *Store.
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// funcAt returns the function containing line, if any.
+func funcAt(funcs []funcComplexity, line int) (funcComplexity, bool) {
+	for _, fn := range funcs {
+		if fn.startLine <= line && line <= fn.endLine {
+			return fn, true
+		}
+	}
+	return funcComplexity{}, false
+}
+
+// complexityAt returns the complexity of the function containing line, or
+// 1 outside of any function.
+func complexityAt(funcs []funcComplexity, line int) int {
+	for _, fn := range funcs {
+		if fn.startLine <= line && line <= fn.endLine {
+			return fn.complexity
+		}
+	}
+	return 1
+}
+
+// deprecatedLines returns the lines of the functions declared in a Go
+// source file whose doc comment has a paragraph starting with
+// "Deprecated:". Sources that do not parse yield no lines.
+func deprecatedLines(src []byte) map[int]bool {
+	lines := make(map[int]bool)
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return lines
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !isDeprecated(fn.Doc) {
+			continue
+		}
+		for l := fset.Position(fn.Pos()).Line; l <= fset.Position(fn.End()).Line; l++ {
+			lines[l] = true
+		}
+	}
+	return lines
+}
+
+// outsideFunctionLines returns the lines of a Go source file outside the
+// bodies of its function declarations, from the opening brace to the
+// closing one: imports, package-level declarations and function literals
+// they hold. Sources that do not parse yield no lines.
+func outsideFunctionLines(src []byte) map[int]bool {
+	lines := make(map[int]bool)
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return lines
+	}
+
+	inBody := make(map[int]bool)
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		for l := fset.Position(fn.Body.Lbrace).Line; l <= fset.Position(fn.Body.Rbrace).Line; l++ {
+			inBody[l] = true
+		}
+	}
+
+	numLines := bytes.Count(src, []byte("\n")) + 1
+	for l := 1; l <= numLines; l++ {
+		if !inBody[l] {
+			lines[l] = true
+		}
+	}
+	return lines
+}
+
+// isDeprecated reports whether a doc comment has a paragraph starting with
+// "Deprecated: ".
+func isDeprecated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, paragraph := range strings.Split(doc.Text(), "\n\n") {
+		if strings.HasPrefix(paragraph, "Deprecated: ") {
+			return true
+		}
+	}
+	return false
+}
+
+// generatedRe matches the comment marking generated Go files, as described
+// in https://golang.org/s/generatedcode.
+var generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether a Go source file has a generated code
+// comment before its package clause. Sources that do not parse are not
+// generated.
+func isGenerated(src []byte) bool {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return false
+	}
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if generatedRe.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isGeneratedDiff reports whether the diff of a file holds a generated code
+// comment before its package clause: the new file must start with the
+// first fragment, whose lines, added or context, are scanned up to the
+// package clause. It stands in for isGenerated when a changed file is not
+// on disk.
+func isGeneratedDiff(f *gitdiff.File) bool {
+	if len(f.TextFragments) == 0 || f.TextFragments[0].NewPosition > 1 {
+		return false
+	}
+	for _, line := range f.TextFragments[0].Lines {
+		if line.Op == gitdiff.OpDelete {
+			continue
+		}
+		text := strings.TrimRight(line.Line, "\r\n")
+		if strings.HasPrefix(text, "package ") {
+			break
+		}
+		if generatedRe.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// generatedFiles splits diffFiles into the files kept and the generated
+// ones, read from disk at their new name, or checked with isGeneratedDiff
+// when not on disk.
+func generatedFiles(diffFiles []*gitdiff.File) (kept, generated []*gitdiff.File) {
+	for _, f := range diffFiles {
+		var g bool
+		if src, err := os.ReadFile(f.NewName); err == nil {
+			g = isGenerated(src)
+		} else {
+			g = isGeneratedDiff(f)
+		}
+		if g {
+			generated = append(generated, f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	return kept, generated
+}
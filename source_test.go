@@ -0,0 +1,180 @@
+package patchcover
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+func Test_embeddedDataLines(t *testing.T) {
+	src := "package p\n" + // 1
+		"\n" + // 2
+		"//go:embed data.txt\n" + // 3
+		"var data string\n" + // 4
+		"\n" + // 5
+		"func f() string {\n" + // 6
+		"\treturn `a\n" + // 7
+		"b\n" + // 8
+		"c`\n" + // 9
+		"}\n" // 10
+
+	lines := embeddedDataLines([]byte(src))
+	assert.DeepEqual(t, lines, map[int]bool{4: true, 8: true, 9: true})
+}
+
+func Test_wholeFiles(t *testing.T) {
+	files, err := wholeFiles([]string{"testdata/test-project/func1.go", "testdata/test-project/missing.go"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, files[0].NewName, "testdata/test-project/func1.go")
+	assert.Equal(t, len(files[0].TextFragments), 1)
+
+	frag := files[0].TextFragments[0]
+	assert.Equal(t, frag.NewPosition, int64(1))
+	assert.Equal(t, len(frag.Lines), 21)
+	assert.Equal(t, frag.Lines[0].Line, "package testproject\n")
+	for _, line := range frag.Lines {
+		assert.Equal(t, line.Op, gitdiff.OpAdd)
+	}
+}
+
+func Test_functionComplexities(t *testing.T) {
+	src := `package p
+
+func simple() int {
+	return 1
+}
+
+func branchy(xs []int, ok bool) int {
+	n := 0
+	for _, x := range xs {
+		if x > 0 && ok {
+			n++
+		}
+	}
+	switch n {
+	case 0:
+		return -1
+	case 1, 2:
+		return 1
+	default:
+		return n
+	}
+}
+
+func (s *store) get() int {
+	return 0
+}
+`
+	funcs := functionComplexities([]byte(src))
+	assert.DeepEqual(t, funcs, []funcComplexity{
+		{name: "simple", startLine: 3, endLine: 5, complexity: 1},
+		// range, if, &&, two non-default cases.
+		{name: "branchy", startLine: 7, endLine: 22, complexity: 6},
+		{name: "store.get", startLine: 24, endLine: 26, complexity: 1},
+	}, cmp.AllowUnexported(funcComplexity{}))
+
+	assert.Equal(t, complexityAt(funcs, 4), 1)
+	assert.Equal(t, complexityAt(funcs, 11), 6)
+	assert.Equal(t, complexityAt(funcs, 1), 1)
+	assert.Assert(t, functionComplexities([]byte("not go")) == nil)
+}
+
+func Test_deprecatedLines(t *testing.T) {
+	src, err := os.ReadFile("testdata/deprecated/legacy.go")
+	assert.NilError(t, err)
+
+	lines := deprecatedLines(src)
+	// Only the body and signature of Add; its doc comment is not code.
+	assert.DeepEqual(t, lines, map[int]bool{15: true, 16: true, 17: true})
+
+	notParagraph := []byte("package p\n\n// Add is not Deprecated: really.\nfunc Add() {}\n")
+	assert.Equal(t, len(deprecatedLines(notParagraph)), 0)
+}
+
+func Test_outsideFunctionLines(t *testing.T) {
+	src := []byte(`package p // 1
+
+import "fmt" // 3
+
+var F = func() { // 5
+	fmt.Println() // 6
+} // 7
+
+func G() { // 9
+	fmt.Println() // 10
+} // 11
+`)
+	lines := outsideFunctionLines(src)
+	for _, l := range []int{1, 3, 5, 6, 7, 12} {
+		assert.Assert(t, lines[l], "line %d", l)
+	}
+	for _, l := range []int{9, 10, 11} {
+		assert.Assert(t, !lines[l], "line %d", l)
+	}
+
+	assert.Equal(t, len(outsideFunctionLines([]byte("not go"))), 0)
+}
+
+func Test_isGenerated(t *testing.T) {
+	src, err := os.ReadFile("testdata/generated/zz_generated.go")
+	assert.NilError(t, err)
+	assert.Assert(t, isGenerated(src))
+
+	src, err = os.ReadFile("testdata/generated/handwritten.go")
+	assert.NilError(t, err)
+	assert.Assert(t, !isGenerated(src))
+
+	// The comment must precede the package clause and match exactly.
+	assert.Assert(t, !isGenerated([]byte("package p\n\n// Code generated by hand; DO NOT EDIT.\n")))
+	assert.Assert(t, !isGenerated([]byte("// Code generated by hand. DO NOT EDIT\n\npackage p\n")))
+	assert.Assert(t, isGenerated([]byte("// Copyright 2024\n\n// Code generated by hand. DO NOT EDIT.\n\npackage p\n")))
+	assert.Assert(t, !isGenerated([]byte("not go")))
+}
+
+func Test_isGeneratedDiff(t *testing.T) {
+	parse := func(diff string) *gitdiff.File {
+		t.Helper()
+		files, _, err := gitdiff.Parse(strings.NewReader(diff))
+		assert.NilError(t, err)
+		return files[0]
+	}
+
+	mockgen := parse(`diff --git a/mock_store.go b/mock_store.go
+new file mode 100644
+--- /dev/null
++++ b/mock_store.go
+@@ -0,0 +1,4 @@
++// Code generated by MockGen. DO NOT EDIT.
++// Source: store.go
++
++package mocks
+`)
+	assert.Assert(t, isGeneratedDiff(mockgen))
+
+	// The header is not held by the diff of a later fragment.
+	later := parse(`diff --git a/mock_store.go b/mock_store.go
+--- a/mock_store.go
++++ b/mock_store.go
+@@ -9 +9 @@ func (m *MockStore) Get(key string) string {
+-	return "mock"
++	return ""
+`)
+	assert.Assert(t, !isGeneratedDiff(later))
+
+	// The comment must precede the package clause.
+	after := parse(`diff --git a/store.go b/store.go
+new file mode 100644
+--- /dev/null
++++ b/store.go
+@@ -0,0 +1,3 @@
++package mocks
++
++// Code generated by MockGen. DO NOT EDIT.
+`)
+	assert.Assert(t, !isGeneratedDiff(after))
+}
@@ -0,0 +1,31 @@
+package patchcover
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestComputer_CompareSources(t *testing.T) {
+	lines, err := New(Config{}).CompareSources("./testdata/scenarios/new_file/diff.diff", []Source{
+		{TestType: "unit", CoverageFile: "./testdata/sources/unit.out"},
+		{TestType: "integration", CoverageFile: "./testdata/sources/integration.out"},
+	})
+	assert.NilError(t, err)
+
+	const fileName = "github.com/seriousben/go-patch-cover/testdata/test-project/func1.go"
+	assert.DeepEqual(t, lines, []LineSources{
+		{FileName: fileName, LineNum: 6, LineString: "\tfmt.Println(\"func1\")", CoveredBy: []string{"unit", "integration"}},
+		{FileName: fileName, LineNum: 9, LineString: "\t\tfmt.Println(\"bool1\", bool1)", CoveredBy: []string{"unit"}},
+		{FileName: fileName, LineNum: 14, LineString: "\tif bool2 {", CoveredBy: []string{"unit", "integration"}},
+		{FileName: fileName, LineNum: 15, LineString: "\t\tfmt.Println(\"bool2\", bool2)", CoveredBy: []string{"integration"}},
+		{FileName: fileName, LineNum: 20, LineString: "\tfmt.Println(\"end func1\")", CoveredBy: []string{"unit", "integration"}},
+	})
+}
+
+func TestComputer_CompareSources_missingProfile(t *testing.T) {
+	_, err := New(Config{}).CompareSources("./testdata/scenarios/new_file/diff.diff", []Source{
+		{TestType: "unit", CoverageFile: "./testdata/sources/missing.out"},
+	})
+	assert.Error(t, err, "coverage file not found: ./testdata/sources/missing.out")
+}
@@ -0,0 +1,59 @@
+package patchcover
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// TAPResult is a test point of a TAP report.
+type TAPResult struct {
+	OK          bool
+	Description string
+}
+
+// RenderTAPOutput writes the coverage as a TAP version 13 report, for test
+// reporters: one test point per changed file, by file name, failing when
+// the file has uncovered added lines, followed by the extra test points,
+// e.g. the coverage gates. Descriptions hold the patch coverage of files.
+func RenderTAPOutput(data CoverageData, extra []TAPResult, out io.Writer) error {
+	fileNames := make([]string, 0, len(data.PatchLines))
+	for fileName := range data.PatchLines {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	results := make([]TAPResult, 0, len(fileNames)+len(extra))
+	for _, fileName := range fileNames {
+		numStmt, coverCount := 0, 0
+		for _, line := range data.PatchLines[fileName] {
+			numStmt += line.NumStmt
+			if line.Covered {
+				coverCount += line.NumStmt
+			}
+		}
+		coverage := 100.0
+		if numStmt > 0 {
+			coverage = percentage(coverCount, numStmt)
+		}
+		results = append(results, TAPResult{
+			OK:          coverCount == numStmt,
+			Description: fmt.Sprintf("%s: %.1f%% of changed statements (%d/%d)", fileName, coverage, coverCount, numStmt),
+		})
+	}
+	results = append(results, extra...)
+
+	if _, err := fmt.Fprintf(out, "TAP version 13\n1..%d\n", len(results)); err != nil {
+		return err
+	}
+	for i, r := range results {
+		status := "ok"
+		if !r.OK {
+			status = "not ok"
+		}
+		if _, err := fmt.Fprintf(out, "%s %d - %s\n", status, i+1, r.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package patchcover
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRenderTAPOutput(t *testing.T) {
+	cov, err := New(Config{}).ComputeFromFiles("./testdata/scenarios/new_file/coverage.out", "./testdata/scenarios/new_file/diff.diff", "")
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	extra := []TAPResult{{OK: true, Description: "gate passing"}, {OK: false, Description: "gate failing"}}
+	assert.NilError(t, RenderTAPOutput(cov, extra, &buf))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(t, lines[0], "TAP version 13")
+	plan := regexp.MustCompile(`^1\.\.(\d+)$`).FindStringSubmatch(lines[1])
+	assert.Assert(t, plan != nil, lines[1])
+	points := lines[2:]
+	assert.Equal(t, plan[1], strconv.Itoa(len(points)))
+	assert.Equal(t, len(points), len(cov.PatchLines)+len(extra))
+
+	point := regexp.MustCompile(`^(ok|not ok) (\d+) - (.+)$`)
+	for i, l := range points {
+		m := point.FindStringSubmatch(l)
+		assert.Assert(t, m != nil, l)
+		assert.Equal(t, m[2], strconv.Itoa(i+1))
+	}
+	for _, l := range points[:len(cov.PatchLines)] {
+		assert.Assert(t, strings.Contains(l, "% of changed statements ("), l)
+	}
+	assert.Equal(t, points[len(points)-2], "ok "+strconv.Itoa(len(points)-1)+" - gate passing")
+	assert.Equal(t, points[len(points)-1], "not ok "+strconv.Itoa(len(points))+" - gate failing")
+}
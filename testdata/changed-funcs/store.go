@@ -0,0 +1,17 @@
+package store
+
+type Store struct {
+	items map[string]int
+}
+
+func (s *Store) Get(key string) int {
+	return s.items[key]
+}
+
+func (s *Store) Delete(key string) {
+	delete(s.items, key)
+}
+
+func Len(s *Store) int {
+	return len(s.items)
+}
@@ -0,0 +1,37 @@
+package shapes
+
+import "math"
+
+// Area returns the area of a circle of radius r.
+func Area(r float64) float64 {
+	if r < 0 {
+		return 0
+	}
+	return math.Pi * r * r
+}
+
+// Perimeter returns the perimeter of a circle of radius r.
+func Perimeter(r float64) float64 {
+	if r < 0 {
+		return 0
+	}
+	return 2 * math.Pi * r
+}
+
+// Diameter returns the diameter of a circle of radius r.
+func Diameter(r float64) float64 {
+	return 2 * r
+}
+
+// Radius returns the radius of a circle of diameter d.
+func Radius(d float64) float64 {
+	return d / 2
+}
+
+// Scale returns r scaled by k, or r when k is not positive.
+func Scale(r, k float64) float64 {
+	if k <= 0 {
+		return r
+	}
+	return r * k
+}
@@ -0,0 +1,17 @@
+package deprecated
+
+// Sum returns the sum of xs.
+func Sum(xs ...int) int {
+	n := 0
+	for _, x := range xs {
+		n += x
+	}
+	return n
+}
+
+// Add returns a + b.
+//
+// Deprecated: use Sum.
+func Add(a, b int) int {
+	return a + b
+}
@@ -0,0 +1,20 @@
+package calc
+
+func Mul(a, b int) int {
+	return a * b
+}
+
+func Add(a, b int) int {
+	if a == 0 {
+		return b
+	}
+	return a + b
+}
+
+func Div(a, b int) int {
+	return a / b
+}
+
+func Sub(a, b int) int {
+	return a - b
+}
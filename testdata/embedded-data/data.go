@@ -0,0 +1,16 @@
+package embeddeddata
+
+import _ "embed"
+
+//go:embed data.txt
+var data string
+
+func Banner() string {
+	return `+---------+
+| patched |
++---------+`
+}
+
+func Data() string {
+	return data
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import "strings"
+
+var Default = func() string {
+	return "default"
+}
+
+func Upper(s string) string {
+	s = strings.TrimSpace(s)
+	return strings.ToUpper(s)
+}
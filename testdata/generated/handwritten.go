@@ -0,0 +1,5 @@
+package generated
+
+func Add(a, b int) int {
+	return a + b
+}
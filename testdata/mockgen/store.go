@@ -0,0 +1,5 @@
+package mockgen
+
+func Get(key string) string {
+	return "value of " + key
+}
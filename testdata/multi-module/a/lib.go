@@ -0,0 +1,5 @@
+package a
+
+func Double(n int) int {
+	return n * 2
+}
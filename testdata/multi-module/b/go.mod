@@ -0,0 +1,3 @@
+module "example.com/b" // quoted
+
+go 1.17
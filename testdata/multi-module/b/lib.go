@@ -0,0 +1,5 @@
+package b
+
+func Half(n int) int {
+	return n / 2
+}
@@ -0,0 +1,7 @@
+module example.com/app
+
+go 1.17
+
+require example.com/lib v0.1.0
+
+replace example.com/lib => ./lib